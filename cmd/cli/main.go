@@ -49,6 +49,57 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "amqp":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Subcommand is required")
+			fmt.Println("Usage: boilerblade amqp <subcommand> [options]")
+			fmt.Println("\nAvailable subcommands:")
+			fmt.Println("  topology apply  - Declare the topology in config/amqp/topology on the broker")
+			fmt.Println("  topology diff   - Compare the topology with the broker")
+			fmt.Println("  publish         - Publish a message from a file or stdin (-exchange, -key, -header k=v)")
+			fmt.Println("  tail            - Peek at messages of a queue without consuming them (-queue, -n)")
+			fmt.Println("  replay          - Move messages from a .retry or .error queue back to their exchange (-queue, filters, -dry-run)")
+			fmt.Println("  stats           - Show depth and consumers of the topology queues")
+			fmt.Println("  stream read     - Print messages of a stream from an offset or timestamp (-stream, -from, -n)")
+			fmt.Println("  stream replay   - Rewind a stream consumer to an offset or timestamp (-stream, -consumer, -since)")
+			os.Exit(1)
+		}
+		if err := cli.HandleAMQPCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "auth":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Subcommand is required")
+			fmt.Println("Usage: boilerblade auth <subcommand> [options]")
+			fmt.Println("\nAvailable subcommands:")
+			fmt.Println("  hash-passwords  - Hash passwords still stored in plaintext (-batch, -dry-run)")
+			fmt.Println("  assign-role     - Give a stored role to a user (-user, -role)")
+			fmt.Println("  revoke-role     - Remove a stored role from a user (-user, -role)")
+			os.Exit(1)
+		}
+		if err := cli.HandleAuthCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "apikey":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Subcommand is required")
+			fmt.Println("Usage: boilerblade apikey <subcommand> [options]")
+			fmt.Println("\nAvailable subcommands:")
+			fmt.Println("  create  - Issue a service API key (-name, -scopes, -expires-in-days)")
+			fmt.Println("  list    - List API keys (-all includes revoked ones)")
+			fmt.Println("  rotate  - Replace a key, the old one keeps working for -grace seconds (-id)")
+			fmt.Println("  revoke  - Disable a key immediately (-id)")
+			os.Exit(1)
+		}
+		if err := cli.HandleAPIKeyCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	case "version", "-v", "--version":
 		fmt.Printf("Boilerblade CLI v%s\n", version)
 		os.Exit(0)
@@ -1,11 +1,19 @@
 package amqp
 
-import "github.com/streadway/amqp"
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
 
 const (
 	RetrySuffix      = ".retry"
 	QueueRetrySuffix = ".retry"
+	ErrorQueueSuffix = ".error"
 	delay            = 3
+
+	// DefaultPrefetch is the QoS of new channels
+	DefaultPrefetch = 20
 )
 
 type IAMQPConnection interface {
@@ -16,12 +24,47 @@ type IAMQPConnection interface {
 type IAMQPChannel interface {
 	IsClosed() bool
 	Close() error
-	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	// Consume returns deliveries until ctx is done or the channel is closed; the channel is then closed
+	Consume(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
 	DeclareExchange(exchangeName string, exchangeType string) (err error)
 	DeclareQueue(queue, queueType, exchangeName, routeKey string, interval int) (amqp.Queue, error)
 	BindQueue(q amqp.Queue, routeKey, exchangeName string) error
 	NewQueue(exchangeName, queueName, queueType, routeKey string, interval int) (amqp.Queue, error)
-	ReadMessage(q amqp.Queue) (<-chan amqp.Delivery, error)
-	PublishMessage(q *amqp.Queue, routingKey, contentType, exchange string, body []byte) error
-	GetChannel() *amqp.Channel
+	ReadMessage(ctx context.Context, q amqp.Queue) (<-chan amqp.Delivery, error)
+	PublishMessage(ctx context.Context, q *amqp.Queue, routingKey, contentType, exchange string, body []byte) error
+	PublishCloudEvent(ctx context.Context, exchange, routingKey string, evt *CloudEvent, mode CloudEventMode) error
+	GetChannel() RawChannel
+	// SetPrefetch sets the number of unacked deliveries per consumer of the channel.
+	// Unlike GetChannel().Qos it is re-applied when the channel is recreated; it
+	// applies to consumers started afterwards.
+	SetPrefetch(count int) error
+
+	// Raw publish with full message properties (ReplyTo, CorrelationId, headers, ...)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+
+	// Raw declarations (promoted from *amqp.Channel), used to apply the declarative topology
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueInspect(name string) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error
+}
+
+// RawChannel is the subset of *amqp.Channel returned by GetChannel
+type RawChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+	QueuePurge(name string, noWait bool) (int, error)
+	Ack(tag uint64, multiple bool) error
+	Nack(tag uint64, multiple bool, requeue bool) error
+	Reject(tag uint64, requeue bool) error
+
+	// Publisher confirms and returns of mandatory messages
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
 }
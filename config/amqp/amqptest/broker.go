@@ -0,0 +1,568 @@
+// Package amqptest provides an in-memory AMQP broker for tests.
+//
+// Broker implements amqp.IAMQPConnection and its channels implement
+// amqp.IAMQPChannel, so consumers and publishers can be exercised without
+// RabbitMQ. It supports direct, topic and fanout exchanges, the default
+// exchange, dead-lettering (x-dead-letter-exchange/routing-key with x-death
+// headers), stream queues (x-stream-offset), queue and message TTL, x-max-length (drop-head or reject-publish),
+// ack/nack/reject with requeue, publisher confirms and returns, a per-consumer prefetch, exchange-to-exchange bindings and, when
+// DelayedMessagePlugin is set, x-delayed-message exchanges. Time only moves
+// through Advance, so TTL based retry and delay flows are deterministic.
+package amqptest
+
+import (
+	"boilerblade/config/amqp"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+const (
+	// DefaultPrefetch matches the QoS applied by amqp.Dial channels
+	DefaultPrefetch = amqp.DefaultPrefetch
+	// DefaultTimeout bounds WaitIdle
+	DefaultTimeout = 2 * time.Second
+)
+
+// Message is a message published to the broker
+type Message struct {
+	Exchange   string
+	RoutingKey string
+	amqplib.Publishing
+}
+
+// Delivery returns the message as a consumer would receive it
+func (m Message) Delivery() amqplib.Delivery {
+	return amqplib.Delivery{
+		Headers:         m.Headers,
+		ContentType:     m.ContentType,
+		ContentEncoding: m.ContentEncoding,
+		DeliveryMode:    m.DeliveryMode,
+		Priority:        m.Priority,
+		CorrelationId:   m.CorrelationId,
+		ReplyTo:         m.ReplyTo,
+		Expiration:      m.Expiration,
+		MessageId:       m.MessageId,
+		Timestamp:       m.Timestamp,
+		Type:            m.Type,
+		UserId:          m.UserId,
+		AppId:           m.AppId,
+		Exchange:        m.Exchange,
+		RoutingKey:      m.RoutingKey,
+		Body:            m.Body,
+	}
+}
+
+// QueueStats is a snapshot of a queue
+type QueueStats struct {
+	Ready        int // messages waiting for a consumer
+	Unacked      int // messages delivered but not yet acked
+	Consumers    int
+	Acked        int
+	Requeued     int // nacked or rejected with requeue
+	DeadLettered int // rejected or expired and routed to the dead letter exchange
+	Dropped      int // rejected or expired without a dead letter exchange
+	Stored       int // messages kept by a stream queue
+}
+
+// Broker is an in-memory AMQP broker
+type Broker struct {
+	// Prefetch is the maximum number of unacked deliveries per consumer, unless
+	// set for the channel with Qos or SetPrefetch
+	Prefetch int
+	// Timeout bounds WaitIdle
+	Timeout time.Duration
+	// DelayedMessagePlugin enables x-delayed-message exchanges; without it declaring one fails
+	DelayedMessagePlugin bool
+
+	mu               sync.Mutex
+	cond             *sync.Cond
+	exchanges        map[string]string // name -> kind (x-delayed-type for delayed exchanges)
+	delayedExchanges map[string]bool
+	held             []*heldMessage // published to a delayed exchange, waiting for x-delay
+	queues           map[string]*queue
+	bindings         []binding
+	published        []Message
+	channels         []*channel
+	clock            time.Time
+	queueSeq         int
+	closed           bool
+}
+
+type queue struct {
+	name      string
+	args      amqplib.Table
+	stream    bool       // x-queue-type stream: messages are appended to log and never removed
+	log       []*message // stream messages, indexed by offset
+	ready     []*message
+	consumers int
+	unacked   int
+	stats     QueueStats
+}
+
+// binding routes exchange to a queue, or to destination for an exchange-to-exchange binding
+type binding struct {
+	exchange    string
+	queue       string
+	destination string
+	routingKey  string
+}
+
+type heldMessage struct {
+	releaseAt  time.Time
+	exchange   string
+	routingKey string
+	publishing amqplib.Publishing
+}
+
+type message struct {
+	exchange    string
+	routingKey  string
+	publishing  amqplib.Publishing
+	expiresAt   time.Time // zero means never
+	redelivered bool
+	offset      int64     // position in a stream
+	storedAt    time.Time // when a stream stored the message
+}
+
+var _ amqp.IAMQPConnection = (*Broker)(nil)
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	b := &Broker{
+		Prefetch:         DefaultPrefetch,
+		Timeout:          DefaultTimeout,
+		exchanges:        make(map[string]string),
+		delayedExchanges: make(map[string]bool),
+		queues:           make(map[string]*queue),
+		clock:            time.Now().UTC(),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Channel opens a channel
+func (b *Broker) Channel() (amqp.IAMQPChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, amqplib.ErrClosed
+	}
+	ch := &channel{
+		broker:    b,
+		consumers: make(map[string]*consumer),
+		pending:   make(map[uint64]*pending),
+	}
+	b.channels = append(b.channels, ch)
+	return ch, nil
+}
+
+// Close closes every channel; unacked deliveries are requeued
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return amqplib.ErrClosed
+	}
+	b.closed = true
+	for _, ch := range b.channels {
+		ch.closeLocked()
+	}
+	return nil
+}
+
+// Reconnect simulates a connection loss the client recovers from: the raw
+// channel behind every open channel is closed and replaced with a new one, as
+// amqp.connection.Channel does. IsClosed stays false, GetChannel returns the
+// new channel, which is not in confirm mode and has no listeners. The other
+// methods of a reconnected channel keep failing with ErrClosed.
+func (b *Broker) Reconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range append([]*channel(nil), b.channels...) {
+		if ch.replacement || ch.userClosed || (ch.raw == nil && ch.closed) {
+			continue
+		}
+		old := ch.raw
+		if old == nil {
+			old = ch
+		}
+		ch.raw = &channel{
+			broker:      b,
+			consumers:   make(map[string]*consumer),
+			pending:     make(map[uint64]*pending),
+			prefetch:    old.prefetch,
+			replacement: true,
+		}
+		b.channels = append(b.channels, ch.raw)
+		old.closeLocked()
+	}
+}
+
+// Deliver publishes msg as an external producer would. It is not recorded in Published.
+func (b *Broker) Deliver(exchange, routingKey string, msg amqplib.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.publishLocked(exchange, routingKey, msg, false)
+	return err
+}
+
+// Published returns the messages published through the broker's channels
+func (b *Broker) Published() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// ExpectPublished fails the test unless a message was published to exchange with
+// routingKey, and returns the last such message
+func (b *Broker) ExpectPublished(t testing.TB, exchange, routingKey string) Message {
+	t.Helper()
+
+	published := b.Published()
+	for i := len(published) - 1; i >= 0; i-- {
+		if published[i].Exchange == exchange && published[i].RoutingKey == routingKey {
+			return published[i]
+		}
+	}
+
+	seen := make([]string, 0, len(published))
+	for _, m := range published {
+		seen = append(seen, m.Exchange+"/"+m.RoutingKey)
+	}
+	t.Fatalf("Expected a message published to %s/%s, got %v", exchange, routingKey, seen)
+	return Message{}
+}
+
+// Stats returns a snapshot of the queue
+func (b *Broker) Stats(name string) QueueStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return QueueStats{}
+	}
+	return q.snapshot()
+}
+
+// Now returns the broker clock, which stamps stream messages and delays
+func (b *Broker) Now() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.clock
+}
+
+// Advance moves the broker clock forward, releases delayed messages that are due
+// and expires messages whose TTL elapsed
+func (b *Broker) Advance(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clock = b.clock.Add(d)
+
+	sort.SliceStable(b.held, func(i, j int) bool { return b.held[i].releaseAt.Before(b.held[j].releaseAt) })
+	for len(b.held) > 0 && !b.held[0].releaseAt.After(b.clock) {
+		m := b.held[0]
+		b.held = b.held[1:]
+		for _, q := range b.routeLocked(m.exchange, m.routingKey) {
+			b.enqueueLocked(q, &message{exchange: m.exchange, routingKey: m.routingKey, publishing: m.publishing})
+		}
+	}
+
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		q := b.queues[name]
+		var expired []*message
+		ready := q.ready[:0]
+		for _, m := range q.ready {
+			if !m.expiresAt.IsZero() && !m.expiresAt.After(b.clock) {
+				expired = append(expired, m)
+				continue
+			}
+			ready = append(ready, m)
+		}
+		q.ready = ready
+		for _, m := range expired {
+			b.deadLetterLocked(q, m, "expired")
+		}
+	}
+	b.cond.Broadcast()
+}
+
+// WaitIdle blocks until the queue has no ready or unacked messages and returns
+// its stats. The test fails if that does not happen within Timeout.
+func (b *Broker) WaitIdle(t testing.TB, name string) QueueStats {
+	t.Helper()
+
+	timedOut := false
+	timer := time.AfterFunc(b.Timeout, func() {
+		b.mu.Lock()
+		timedOut = true
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	b.mu.Lock()
+	idle := func() bool {
+		q, ok := b.queues[name]
+		return !ok || (len(q.ready) == 0 && q.unacked == 0 && b.streamReadLocked(q))
+	}
+	for !idle() && !timedOut {
+		b.cond.Wait()
+	}
+	done := idle()
+	var stats QueueStats
+	if q, ok := b.queues[name]; ok {
+		stats = q.snapshot()
+	}
+	b.mu.Unlock()
+
+	if !done {
+		t.Fatalf("Queue %s not idle after %s: %+v", name, b.Timeout, stats)
+	}
+	return stats
+}
+
+// streamReadLocked reports whether every consumer of a stream reached its end
+func (b *Broker) streamReadLocked(q *queue) bool {
+	for _, ch := range b.channels {
+		for _, c := range ch.consumers {
+			if c.queue == q && !c.cancelled && c.cursor < len(q.log) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (q *queue) snapshot() QueueStats {
+	stats := q.stats
+	stats.Ready = len(q.ready)
+	stats.Unacked = q.unacked
+	stats.Consumers = q.consumers
+	stats.Stored = len(q.log)
+	return stats
+}
+
+// publishResult is what a confirm-mode publisher learns about a publish
+type publishResult struct {
+	routed   bool // a queue (or a delayed exchange) took the message
+	rejected bool // a full queue with x-overflow=reject-publish refused it
+}
+
+// publishLocked routes msg to the bound queues. record adds it to Published.
+func (b *Broker) publishLocked(exchange, routingKey string, msg amqplib.Publishing, record bool) (publishResult, error) {
+	var result publishResult
+	if exchange != "" {
+		if _, ok := b.exchanges[exchange]; !ok {
+			return result, notFound("exchange", exchange)
+		}
+	}
+	if record {
+		b.published = append(b.published, Message{Exchange: exchange, RoutingKey: routingKey, Publishing: msg})
+	}
+	if delay, ok := intArg(msg.Headers["x-delay"]); ok && delay > 0 && b.delayedExchanges[exchange] {
+		b.held = append(b.held, &heldMessage{
+			releaseAt:  b.clock.Add(time.Duration(delay) * time.Millisecond),
+			exchange:   exchange,
+			routingKey: routingKey,
+			publishing: msg,
+		})
+		result.routed = true
+		return result, nil
+	}
+	for _, q := range b.routeLocked(exchange, routingKey) {
+		result.routed = true
+		if max, ok := intArg(q.args["x-max-length"]); ok && len(q.ready) >= max {
+			if q.args["x-overflow"] == "reject-publish" {
+				result.rejected = true
+				continue
+			}
+			if len(q.ready) > 0 {
+				head := q.ready[0]
+				q.ready = q.ready[1:]
+				b.deadLetterLocked(q, head, "maxlen")
+			}
+		}
+		b.enqueueLocked(q, &message{exchange: exchange, routingKey: routingKey, publishing: msg})
+	}
+	b.cond.Broadcast()
+	return result, nil
+}
+
+// routeLocked returns the queues a message is routed to; unroutable messages are dropped
+func (b *Broker) routeLocked(exchange, routingKey string) []*queue {
+	if exchange == "" {
+		if q, ok := b.queues[routingKey]; ok {
+			return []*queue{q}
+		}
+		return nil
+	}
+
+	var routed []*queue
+	b.collectLocked(exchange, routingKey, make(map[string]bool), make(map[string]bool), &routed)
+	return routed
+}
+
+// collectLocked appends the queues bound to exchange, following exchange-to-exchange bindings
+func (b *Broker) collectLocked(exchange, routingKey string, seenQueues, seenExchanges map[string]bool, routed *[]*queue) {
+	seenExchanges[exchange] = true
+	kind := b.exchanges[exchange]
+	for _, bd := range b.bindings {
+		if bd.exchange != exchange {
+			continue
+		}
+		var match bool
+		switch kind {
+		case "fanout":
+			match = true
+		case "topic":
+			match = amqp.MatchTopic(bd.routingKey, routingKey)
+		default:
+			match = bd.routingKey == routingKey
+		}
+		if !match {
+			continue
+		}
+		if bd.destination != "" {
+			if !seenExchanges[bd.destination] {
+				b.collectLocked(bd.destination, routingKey, seenQueues, seenExchanges, routed)
+			}
+			continue
+		}
+		if !seenQueues[bd.queue] {
+			seenQueues[bd.queue] = true
+			*routed = append(*routed, b.queues[bd.queue])
+		}
+	}
+}
+
+// enqueueLocked appends m to q, applying the shorter of the queue and message TTL.
+// A stream appends m to its log instead.
+func (b *Broker) enqueueLocked(q *queue, m *message) {
+	if q.stream {
+		m.offset = int64(len(q.log))
+		m.storedAt = b.clock
+		q.log = append(q.log, m)
+		return
+	}
+
+	ttl, ok := intArg(q.args["x-message-ttl"])
+	if expiration, err := strconv.Atoi(m.publishing.Expiration); err == nil && (!ok || expiration < ttl) {
+		ttl, ok = expiration, true
+	}
+	if ok {
+		m.expiresAt = b.clock.Add(time.Duration(ttl) * time.Millisecond)
+	}
+	q.ready = append(q.ready, m)
+}
+
+// deadLetterLocked routes a rejected or expired message to the queue's dead letter exchange
+func (b *Broker) deadLetterLocked(q *queue, m *message, reason string) {
+	dlx, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		q.stats.Dropped++
+		return
+	}
+	q.stats.DeadLettered++
+
+	routingKey := m.routingKey
+	if key, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		routingKey = key
+	}
+
+	msg := m.publishing
+	msg.Headers = withDeath(msg.Headers, q.name, reason, m.exchange, m.routingKey, b.clock)
+	msg.Expiration = ""
+
+	if _, ok := b.exchanges[dlx]; !ok && dlx != "" {
+		return
+	}
+	for _, target := range b.routeLocked(dlx, routingKey) {
+		b.enqueueLocked(target, &message{exchange: dlx, routingKey: routingKey, publishing: msg})
+	}
+}
+
+// withDeath returns a copy of headers with the x-death entry for (queue, reason) added or incremented
+func withDeath(headers amqplib.Table, queueName, reason, exchange, routingKey string, at time.Time) amqplib.Table {
+	out := amqplib.Table{}
+	for k, v := range headers {
+		out[k] = v
+	}
+
+	deaths, _ := out["x-death"].([]interface{})
+	deaths = append([]interface{}(nil), deaths...)
+	for i, d := range deaths {
+		entry, ok := d.(amqplib.Table)
+		if ok && entry["queue"] == queueName && entry["reason"] == reason {
+			updated := amqplib.Table{}
+			for k, v := range entry {
+				updated[k] = v
+			}
+			count, _ := updated["count"].(int64)
+			updated["count"] = count + 1
+			updated["time"] = at
+			// the most recent death goes first
+			deaths = append(append([]interface{}{updated}, deaths[:i]...), deaths[i+1:]...)
+			out["x-death"] = deaths
+			return out
+		}
+	}
+
+	entry := amqplib.Table{
+		"count":        int64(1),
+		"reason":       reason,
+		"queue":        queueName,
+		"exchange":     exchange,
+		"routing-keys": []interface{}{routingKey},
+		"time":         at,
+	}
+	out["x-death"] = append([]interface{}{entry}, deaths...)
+	if _, ok := out["x-first-death-queue"]; !ok {
+		out["x-first-death-queue"] = queueName
+		out["x-first-death-reason"] = reason
+		out["x-first-death-exchange"] = exchange
+	}
+	return out
+}
+
+func intArg(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func notFound(kind, name string) *amqplib.Error {
+	return &amqplib.Error{
+		Code:   amqplib.NotFound,
+		Reason: fmt.Sprintf("NOT_FOUND - no %s '%s' in vhost '/'", kind, name),
+	}
+}
+
+func preconditionFailed(format string, args ...interface{}) *amqplib.Error {
+	return &amqplib.Error{
+		Code:   amqplib.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - " + fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,901 @@
+package amqptest
+
+import (
+	"boilerblade/config/amqp"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// channel is an in-memory amqp.IAMQPChannel. Like a real channel, a failed
+// declaration or an unknown delivery tag closes it.
+type channel struct {
+	broker      *Broker
+	closed      bool
+	consumers   map[string]*consumer
+	pending     map[uint64]*pending
+	nextTag     uint64
+	consumerSeq int
+	replyTo     string // queue behind amq.rabbitmq.reply-to for this channel
+	prefetch    int    // unacked deliveries per consumer; 0 uses Broker.Prefetch
+
+	// After Broker.Reconnect, raw is the channel GetChannel returns in place
+	// of this one, which is then closed; userClosed is what IsClosed reports
+	raw         *channel
+	userClosed  bool
+	replacement bool // opened by Broker.Reconnect behind another channel
+
+	// Publisher confirms and returns are sent in order by a goroutine, like the client library
+	confirm    bool
+	publishSeq uint64
+	confirms   []chan amqplib.Confirmation
+	returns    []chan amqplib.Return
+	notify     chan func()
+}
+
+type consumer struct {
+	tag        string
+	queue      *queue
+	autoAck    bool
+	unacked    int
+	cursor     int // next stream offset to deliver
+	cancelled  bool
+	done       chan struct{}
+	deliveries chan amqplib.Delivery
+}
+
+// pending is a delivery waiting for ack/nack
+type pending struct {
+	queue    *queue
+	consumer *consumer // nil for basic.get
+	message  *message
+}
+
+// rawChannel is the channel as returned by GetChannel, with the client library's Consume
+type rawChannel struct {
+	*channel
+}
+
+var (
+	_ amqp.IAMQPChannel    = (*channel)(nil)
+	_ amqp.RawChannel      = rawChannel{}
+	_ amqplib.Acknowledger = (*channel)(nil)
+)
+
+// IsClosed reports whether the channel was closed. Like the reconnecting
+// channel, it does not report the loss of the raw channel to Broker.Reconnect.
+func (ch *channel) IsClosed() bool {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.raw != nil {
+		return ch.userClosed
+	}
+	return ch.closed
+}
+
+// Close closes the channel, cancels its consumers and requeues its unacked deliveries
+func (ch *channel) Close() error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+
+	if ch.raw != nil {
+		if ch.userClosed {
+			return amqplib.ErrClosed
+		}
+		ch.userClosed = true
+		ch.raw.closeLocked()
+		return nil
+	}
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	ch.closeLocked()
+	return nil
+}
+
+func (ch *channel) closeLocked() {
+	if ch.closed {
+		return
+	}
+	ch.closed = true
+
+	for _, c := range ch.consumers {
+		ch.cancelLocked(c)
+	}
+
+	tags := ch.pendingTags(^uint64(0), true)
+	requeued := make(map[*queue][]*message)
+	var order []*queue
+	for _, tag := range tags {
+		p := ch.pending[tag]
+		delete(ch.pending, tag)
+		p.queue.unacked--
+		if p.queue.stream {
+			continue // stream messages stay in the log
+		}
+		p.message.redelivered = true
+		if _, ok := requeued[p.queue]; !ok {
+			order = append(order, p.queue)
+		}
+		requeued[p.queue] = append(requeued[p.queue], p.message)
+	}
+	for _, q := range order {
+		q.ready = append(requeued[q], q.ready...)
+	}
+
+	// Like the client library, closing the channel closes the notify listeners
+	confirms, returns := ch.confirms, ch.returns
+	ch.confirms, ch.returns = nil, nil
+	if len(confirms)+len(returns) > 0 {
+		ch.notifyLocked(func() {
+			for _, c := range confirms {
+				close(c)
+			}
+			for _, c := range returns {
+				close(c)
+			}
+		})
+	}
+	if ch.notify != nil {
+		close(ch.notify)
+	}
+	ch.broker.cond.Broadcast()
+}
+
+// notifyLocked queues fn for the notification goroutine
+func (ch *channel) notifyLocked(fn func()) {
+	if ch.notify == nil {
+		ch.notify = make(chan func(), 1024)
+		go func(notify chan func()) {
+			for fn := range notify {
+				fn()
+			}
+		}(ch.notify)
+	}
+	ch.notify <- fn
+}
+
+// Confirm puts the channel in confirm mode
+func (ch *channel) Confirm(noWait bool) error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	ch.confirm = true
+	return nil
+}
+
+// NotifyPublish registers a listener for publisher confirms
+func (ch *channel) NotifyPublish(confirm chan amqplib.Confirmation) chan amqplib.Confirmation {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+
+	if ch.closed {
+		close(confirm)
+		return confirm
+	}
+	ch.confirms = append(ch.confirms, confirm)
+	return confirm
+}
+
+// NotifyReturn registers a listener for mandatory messages that could not be routed
+func (ch *channel) NotifyReturn(c chan amqplib.Return) chan amqplib.Return {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+
+	if ch.closed {
+		close(c)
+		return c
+	}
+	ch.returns = append(ch.returns, c)
+	return c
+}
+
+// fail closes the channel the way the broker does on a channel exception
+func (ch *channel) fail(err *amqplib.Error) error {
+	ch.closeLocked()
+	return err
+}
+
+// ExchangeDeclare declares an exchange (direct, topic, fanout or, with
+// DelayedMessagePlugin, x-delayed-message)
+func (ch *channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqplib.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	delayed := kind == amqp.DelayedMessageExchangeType && b.DelayedMessagePlugin
+	if delayed {
+		kind, _ = args["x-delayed-type"].(string)
+	}
+	switch kind {
+	case "direct", "topic", "fanout":
+	default:
+		return ch.fail(&amqplib.Error{Code: amqplib.NotImplemented, Reason: fmt.Sprintf("NOT_IMPLEMENTED - exchange type '%s' is not supported by amqptest", kind)})
+	}
+	if existing, ok := b.exchanges[name]; ok && existing != kind {
+		return ch.fail(preconditionFailed("inequivalent arg 'type' for exchange '%s' in vhost '/': received '%s' but current is '%s'", name, kind, existing))
+	}
+	b.exchanges[name] = kind
+	if delayed {
+		b.delayedExchanges[name] = true
+	}
+	return nil
+}
+
+// ExchangeDeclarePassive checks that an exchange exists
+func (ch *channel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqplib.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	if _, ok := b.exchanges[name]; !ok {
+		return ch.fail(notFound("exchange", name))
+	}
+	return nil
+}
+
+// QueueDeclare declares a queue; re-declaring with different arguments fails
+func (ch *channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqplib.Table) (amqplib.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.Queue{}, amqplib.ErrClosed
+	}
+	if name == "" {
+		b.queueSeq++
+		name = fmt.Sprintf("amq.gen-%d", b.queueSeq)
+	}
+
+	q, ok := b.queues[name]
+	if ok {
+		for _, key := range argKeys(q.args, args) {
+			if fmt.Sprint(q.args[key]) != fmt.Sprint(args[key]) {
+				return amqplib.Queue{}, ch.fail(preconditionFailed("inequivalent arg '%s' for queue '%s' in vhost '/': received '%v' but current is '%v'", key, name, args[key], q.args[key]))
+			}
+		}
+	} else {
+		q = &queue{name: name, args: args, stream: args["x-queue-type"] == "stream"}
+		b.queues[name] = q
+	}
+	return amqplib.Queue{Name: name, Messages: len(q.ready) + len(q.log), Consumers: q.consumers}, nil
+}
+
+// QueueInspect returns the state of an existing queue
+func (ch *channel) QueueInspect(name string) (amqplib.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.Queue{}, amqplib.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return amqplib.Queue{}, ch.fail(notFound("queue", name))
+	}
+	return amqplib.Queue{Name: name, Messages: len(q.ready) + len(q.log), Consumers: q.consumers}, nil
+}
+
+// QueueBind binds a queue to an exchange
+func (ch *channel) QueueBind(name, key, exchange string, noWait bool, args amqplib.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	if _, ok := b.queues[name]; !ok {
+		return ch.fail(notFound("queue", name))
+	}
+	if _, ok := b.exchanges[exchange]; !ok {
+		return ch.fail(notFound("exchange", exchange))
+	}
+	bd := binding{exchange: exchange, queue: name, routingKey: key}
+	for _, existing := range b.bindings {
+		if existing == bd {
+			return nil
+		}
+	}
+	b.bindings = append(b.bindings, bd)
+	return nil
+}
+
+// ExchangeBind binds destination to source
+func (ch *channel) ExchangeBind(destination, key, source string, noWait bool, args amqplib.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	for _, name := range []string{destination, source} {
+		if _, ok := b.exchanges[name]; !ok {
+			return ch.fail(notFound("exchange", name))
+		}
+	}
+	bd := binding{exchange: source, destination: destination, routingKey: key}
+	for _, existing := range b.bindings {
+		if existing == bd {
+			return nil
+		}
+	}
+	b.bindings = append(b.bindings, bd)
+	return nil
+}
+
+// DeclareExchange declares the exchange and its retry exchange, like the real channel
+func (ch *channel) DeclareExchange(exchangeName string, exchangeType string) error {
+	if err := ch.ExchangeDeclare(exchangeName, exchangeType, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.ExchangeDeclare(exchangeName+amqp.RetrySuffix, exchangeType, true, false, false, false, nil)
+}
+
+// DeclareQueue declares the queue and its retry queue, like the real channel
+func (ch *channel) DeclareQueue(queue, queueType, exchangeName, routeKey string, interval int) (amqplib.Queue, error) {
+	args := amqplib.Table{"x-queue-type": queueType, "x-dead-letter-exchange": exchangeName + amqp.RetrySuffix}
+	retryArgs := amqplib.Table{"x-queue-type": queueType, "x-dead-letter-exchange": exchangeName, "x-message-ttl": interval}
+	if routeKey != "" {
+		args["x-dead-letter-routing-key"] = routeKey + amqp.RetrySuffix
+		retryArgs["x-dead-letter-routing-key"] = routeKey
+	}
+
+	q, err := ch.QueueDeclare(queue, true, false, false, false, args)
+	if err != nil {
+		return q, err
+	}
+	_, err = ch.QueueDeclare(queue+amqp.QueueRetrySuffix, true, false, false, false, retryArgs)
+	return q, err
+}
+
+// BindQueue binds the queue and its retry queue, like the real channel
+func (ch *channel) BindQueue(q amqplib.Queue, routeKey, exchangeName string) error {
+	retryKey := ""
+	if routeKey != "" {
+		retryKey = routeKey + amqp.RetrySuffix
+	}
+	if err := ch.QueueBind(q.Name, routeKey, exchangeName, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(q.Name+amqp.QueueRetrySuffix, retryKey, exchangeName+amqp.RetrySuffix, false, nil)
+}
+
+// NewQueue declares and binds a queue with its retry queue
+func (ch *channel) NewQueue(exchangeName, queueName, queueType, routeKey string, interval int) (amqplib.Queue, error) {
+	q, err := ch.DeclareQueue(queueName, queueType, exchangeName, routeKey, interval)
+	if err != nil {
+		return q, err
+	}
+	return q, ch.BindQueue(q, routeKey, exchangeName)
+}
+
+// Consume starts a consumer that is cancelled when ctx is done; the deliveries
+// channel is closed when the channel closes or the consumer is cancelled
+func (ch *channel) Consume(ctx context.Context, queueName, consumerTag string, autoAck, exclusive, noLocal, noWait bool, args amqplib.Table) (<-chan amqplib.Delivery, error) {
+	c, err := ch.consume(queueName, consumerTag, autoAck, args)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			ch.Cancel(c.tag, false)
+		case <-c.done:
+		}
+	}()
+	return c.deliveries, nil
+}
+
+// Consume starts a consumer like amqp.Channel.Consume
+func (r rawChannel) Consume(queueName, consumerTag string, autoAck, exclusive, noLocal, noWait bool, args amqplib.Table) (<-chan amqplib.Delivery, error) {
+	c, err := r.consume(queueName, consumerTag, autoAck, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.deliveries, nil
+}
+
+func (ch *channel) consume(queueName, consumerTag string, autoAck bool, args amqplib.Table) (*consumer, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return nil, amqplib.ErrClosed
+	}
+	if queueName == amqp.DirectReplyTo {
+		if !autoAck {
+			return nil, ch.fail(preconditionFailed("reply consumer cannot acknowledge"))
+		}
+		if ch.replyTo == "" {
+			b.queueSeq++
+			ch.replyTo = fmt.Sprintf("%s.g%d", amqp.DirectReplyTo, b.queueSeq)
+			b.queues[ch.replyTo] = &queue{name: ch.replyTo}
+		}
+		queueName = ch.replyTo
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil, ch.fail(notFound("queue", queueName))
+	}
+	if consumerTag == "" {
+		ch.consumerSeq++
+		consumerTag = fmt.Sprintf("ctag-%d", ch.consumerSeq)
+	}
+	if _, ok := ch.consumers[consumerTag]; ok {
+		return nil, ch.fail(&amqplib.Error{Code: amqplib.NotAllowed, Reason: fmt.Sprintf("NOT_ALLOWED - attempt to reuse consumer tag '%s'", consumerTag)})
+	}
+
+	c := &consumer{
+		tag:        consumerTag,
+		queue:      q,
+		autoAck:    autoAck,
+		done:       make(chan struct{}),
+		deliveries: make(chan amqplib.Delivery),
+	}
+	if q.stream {
+		if autoAck {
+			return nil, ch.fail(preconditionFailed("stream queue '%s' requires manual acknowledgement", queueName))
+		}
+		cursor, err := streamStart(q, args[amqp.StreamOffsetArg])
+		if err != nil {
+			return nil, ch.fail(preconditionFailed("%v", err))
+		}
+		c.cursor = cursor
+	}
+	ch.consumers[consumerTag] = c
+	q.consumers++
+
+	go ch.deliver(c)
+	return c, nil
+}
+
+// deliver hands ready messages to the consumer while it is under its prefetch limit
+func (ch *channel) deliver(c *consumer) {
+	b := ch.broker
+	defer close(c.deliveries)
+
+	for {
+		b.mu.Lock()
+		for !c.cancelled && (!c.available() || (!c.autoAck && c.unacked >= ch.prefetchLocked())) {
+			b.cond.Wait()
+		}
+		if c.cancelled {
+			b.mu.Unlock()
+			return
+		}
+		var d amqplib.Delivery
+		if c.queue.stream {
+			d = ch.takeStreamLocked(c)
+		} else {
+			d = ch.takeLocked(c.queue, c, c.autoAck)
+		}
+		b.mu.Unlock()
+
+		select {
+		case c.deliveries <- d:
+		case <-c.done:
+			// the delivery never reached the consumer
+			if !c.autoAck {
+				ch.Nack(d.DeliveryTag, false, true)
+			}
+			return
+		}
+	}
+}
+
+// available reports whether the consumer has a message to take
+func (c *consumer) available() bool {
+	if c.queue.stream {
+		return c.cursor < len(c.queue.log)
+	}
+	return len(c.queue.ready) > 0
+}
+
+// streamStart returns the log position a stream consumer starts at for an x-stream-offset value
+func streamStart(q *queue, spec interface{}) (int, error) {
+	switch v := spec.(type) {
+	case nil, string:
+		switch v {
+		case nil, "next":
+			return len(q.log), nil
+		case "first":
+			return 0, nil
+		case "last":
+			if len(q.log) == 0 {
+				return 0, nil
+			}
+			return len(q.log) - 1, nil
+		}
+	case time.Time:
+		for i, m := range q.log {
+			if !m.storedAt.Before(v) {
+				return i, nil
+			}
+		}
+		return len(q.log), nil
+	default:
+		if offset, ok := intArg(v); ok && offset >= 0 {
+			if offset > len(q.log) {
+				offset = len(q.log)
+			}
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid x-stream-offset %v", spec)
+}
+
+// takeStreamLocked delivers the message at the consumer's stream position
+func (ch *channel) takeStreamLocked(c *consumer) amqplib.Delivery {
+	m := c.queue.log[c.cursor]
+	c.cursor++
+
+	d := ch.deliveryLocked(c.queue, c, m, false)
+	headers := amqplib.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[amqp.StreamOffsetHeader] = m.offset
+	d.Headers = headers
+	return d
+}
+
+// takeLocked pops the head of q as a delivery
+func (ch *channel) takeLocked(q *queue, c *consumer, autoAck bool) amqplib.Delivery {
+	m := q.ready[0]
+	q.ready = q.ready[1:]
+	return ch.deliveryLocked(q, c, m, autoAck)
+}
+
+// deliveryLocked registers m as delivered to c (nil for basic.get) and builds the delivery
+func (ch *channel) deliveryLocked(q *queue, c *consumer, m *message, autoAck bool) amqplib.Delivery {
+	ch.nextTag++
+	tag := ch.nextTag
+	consumerTag := ""
+	if c != nil {
+		consumerTag = c.tag
+	}
+
+	if autoAck {
+		q.stats.Acked++
+	} else {
+		ch.pending[tag] = &pending{queue: q, consumer: c, message: m}
+		q.unacked++
+		if c != nil {
+			c.unacked++
+		}
+	}
+
+	p := m.publishing
+	return amqplib.Delivery{
+		Acknowledger:    ch,
+		Headers:         p.Headers,
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationId:   p.CorrelationId,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageId:       p.MessageId,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserId:          p.UserId,
+		AppId:           p.AppId,
+		ConsumerTag:     consumerTag,
+		DeliveryTag:     tag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.routingKey,
+		Body:            p.Body,
+	}
+}
+
+// Cancel stops a consumer; its unacked deliveries stay pending
+func (ch *channel) Cancel(consumerTag string, noWait bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	if c, ok := ch.consumers[consumerTag]; ok {
+		ch.cancelLocked(c)
+		delete(ch.consumers, consumerTag)
+	}
+	return nil
+}
+
+func (ch *channel) cancelLocked(c *consumer) {
+	if c.cancelled {
+		return
+	}
+	c.cancelled = true
+	c.queue.consumers--
+	close(c.done)
+	ch.broker.cond.Broadcast()
+}
+
+// Get fetches a single message (basic.get)
+func (ch *channel) Get(queueName string, autoAck bool) (amqplib.Delivery, bool, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.Delivery{}, false, amqplib.ErrClosed
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		return amqplib.Delivery{}, false, ch.fail(notFound("queue", queueName))
+	}
+	if len(q.ready) == 0 {
+		return amqplib.Delivery{}, false, nil
+	}
+	return ch.takeLocked(q, nil, autoAck), true, nil
+}
+
+// Qos sets the prefetch count of the channel's consumers
+func (ch *channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+
+	ch.prefetch = prefetchCount
+	ch.broker.cond.Broadcast()
+	return nil
+}
+
+// SetPrefetch sets the prefetch count of the channel's consumers
+func (ch *channel) SetPrefetch(count int) error {
+	return ch.Qos(count, 0, false)
+}
+
+// prefetchLocked returns the prefetch count of the channel
+func (ch *channel) prefetchLocked() int {
+	if ch.prefetch > 0 {
+		return ch.prefetch
+	}
+	return ch.broker.Prefetch
+}
+
+// QueuePurge removes the ready messages of a queue
+func (ch *channel) QueuePurge(name string, noWait bool) (int, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return 0, amqplib.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return 0, ch.fail(notFound("queue", name))
+	}
+	n := len(q.ready)
+	q.ready = nil
+	return n, nil
+}
+
+// Publish routes a message and records it for ExpectPublished
+func (ch *channel) Publish(exchange, key string, mandatory, immediate bool, msg amqplib.Publishing) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	if msg.ReplyTo == amqp.DirectReplyTo {
+		if ch.replyTo == "" {
+			return ch.fail(preconditionFailed("fast reply consumer does not exist"))
+		}
+		msg.ReplyTo = ch.replyTo
+	}
+	result, err := b.publishLocked(exchange, key, msg, true)
+	if err != nil {
+		return ch.fail(err.(*amqplib.Error))
+	}
+
+	if mandatory && !result.routed && len(ch.returns) > 0 {
+		returned := amqplib.Return{
+			ReplyCode:       amqplib.NoRoute,
+			ReplyText:       "NO_ROUTE",
+			Exchange:        exchange,
+			RoutingKey:      key,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			Headers:         msg.Headers,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		}
+		returns := ch.returns
+		ch.notifyLocked(func() {
+			for _, c := range returns {
+				c <- returned
+			}
+		})
+	}
+	if ch.confirm {
+		ch.publishSeq++
+		confirmation := amqplib.Confirmation{DeliveryTag: ch.publishSeq, Ack: !result.rejected}
+		confirms := ch.confirms
+		ch.notifyLocked(func() {
+			for _, c := range confirms {
+				c <- confirmation
+			}
+		})
+	}
+	return nil
+}
+
+// PublishMessage publishes a persistent message, like the real channel
+func (ch *channel) PublishMessage(ctx context.Context, q *amqplib.Queue, routingKey, contentType, exchange string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := routingKey
+	if q != nil {
+		key = q.Name
+	}
+	return ch.Publish(exchange, key, false, false, amqplib.Publishing{
+		ContentType:  contentType,
+		Body:         body,
+		DeliveryMode: amqplib.Persistent,
+	})
+}
+
+// PublishCloudEvent publishes a CloudEvent in binary or structured mode
+func (ch *channel) PublishCloudEvent(ctx context.Context, exchange, routingKey string, evt *amqp.CloudEvent, mode amqp.CloudEventMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	msg, err := evt.ToPublishing(mode)
+	if err != nil {
+		return err
+	}
+	return ch.Publish(exchange, routingKey, false, false, msg)
+}
+
+// ReadMessage consumes the queue with manual acks until ctx is done
+func (ch *channel) ReadMessage(ctx context.Context, q amqplib.Queue) (<-chan amqplib.Delivery, error) {
+	return ch.Consume(ctx, q.Name, "", false, false, false, false, nil)
+}
+
+// GetChannel returns the channel with the client library's Consume, or the
+// channel that replaced it on Broker.Reconnect
+func (ch *channel) GetChannel() amqp.RawChannel {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.raw != nil {
+		return rawChannel{ch.raw}
+	}
+	return rawChannel{ch}
+}
+
+// Ack acknowledges a delivery (or every delivery up to tag when multiple)
+func (ch *channel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, multiple, func(q *queue, m *message) {
+		q.stats.Acked++
+	}, nil)
+}
+
+// Nack rejects a delivery; it is requeued or dead-lettered
+func (ch *channel) Nack(tag uint64, multiple bool, requeue bool) error {
+	requeued := make(map[*queue][]*message)
+	var order []*queue
+	return ch.settle(tag, multiple, func(q *queue, m *message) {
+		if q.stream {
+			return // a stream keeps every message; a nack only releases prefetch credit
+		}
+		if !requeue {
+			ch.broker.deadLetterLocked(q, m, "rejected")
+			return
+		}
+		q.stats.Requeued++
+		m.redelivered = true
+		if _, ok := requeued[q]; !ok {
+			order = append(order, q)
+		}
+		requeued[q] = append(requeued[q], m)
+	}, func() {
+		// requeued messages go back to the head of their queue, in tag order
+		for _, q := range order {
+			q.ready = append(requeued[q], q.ready...)
+		}
+	})
+}
+
+// Reject rejects a single delivery
+func (ch *channel) Reject(tag uint64, requeue bool) error {
+	return ch.Nack(tag, false, requeue)
+}
+
+// settle removes the pending deliveries covered by tag and calls fn for each, in tag
+// order, then done (if any), all under the broker lock
+func (ch *channel) settle(tag uint64, multiple bool, fn func(*queue, *message), done func()) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch.closed {
+		return amqplib.ErrClosed
+	}
+	tags := ch.pendingTags(tag, multiple)
+	if len(tags) == 0 {
+		return ch.fail(preconditionFailed("unknown delivery tag %d", tag))
+	}
+	for _, t := range tags {
+		p := ch.pending[t]
+		delete(ch.pending, t)
+		p.queue.unacked--
+		if p.consumer != nil {
+			p.consumer.unacked--
+		}
+		fn(p.queue, p.message)
+	}
+	if done != nil {
+		done()
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+// pendingTags returns tag, or every pending tag up to tag when multiple, sorted
+func (ch *channel) pendingTags(tag uint64, multiple bool) []uint64 {
+	if !multiple {
+		if _, ok := ch.pending[tag]; ok {
+			return []uint64{tag}
+		}
+		return nil
+	}
+	var tags []uint64
+	for t := range ch.pending {
+		if t <= tag {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// argKeys returns the union of the keys of a and b
+func argKeys(a, b amqplib.Table) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, t := range []amqplib.Table{a, b} {
+		for k := range t {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,16 +2,60 @@ package amqp
 
 import (
 	"boilerblade/helper"
+	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
-	"time"
 
+	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
 
 type amqpChannel struct {
 	*amqp.Channel
 	closed int32
+
+	mu       sync.Mutex
+	reopened chan struct{} // closed when Channel is recreated or closed by developer
+	prefetch int           // QoS re-applied to a recreated Channel
+}
+
+func newAMQPChannel(ch *amqp.Channel, prefetch int) *amqpChannel {
+	return &amqpChannel{Channel: ch, reopened: make(chan struct{}), prefetch: prefetch}
+}
+
+// SetPrefetch applies the QoS and keeps it for the recreated channel
+func (ch *amqpChannel) SetPrefetch(count int) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if err := ch.Channel.Qos(count, 0, false); err != nil {
+		return err
+	}
+	ch.prefetch = count
+	return nil
+}
+
+// prefetchCount returns the QoS to apply to a recreated channel
+func (ch *amqpChannel) prefetchCount() int {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.prefetch
+}
+
+// current returns the underlying channel and a signal for its replacement
+func (ch *amqpChannel) current() (*amqp.Channel, <-chan struct{}) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.Channel, ch.reopened
+}
+
+// replace swaps in a recreated channel and wakes up the consumers of the old one
+func (ch *amqpChannel) replace(raw *amqp.Channel) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.Channel = raw
+	close(ch.reopened)
+	ch.reopened = make(chan struct{})
 }
 
 // IsClosed indicate closed by developer
@@ -27,16 +71,28 @@ func (ch *amqpChannel) Close() error {
 
 	atomic.StoreInt32(&ch.closed, 1)
 
-	return ch.Channel.Close()
+	raw, _ := ch.current()
+	err := raw.Close()
+	ch.replace(raw) // consumers waiting for a recreated channel see the closed flag
+	return err
 }
 
-// Consume warp amqp.Channel.Consume, the returned delivery will end only when channel closed by developer
-func (ch *amqpChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+// Consume wraps amqp.Channel.Consume. The deliveries survive the channel being
+// recreated after a connection loss, and are closed once ctx is done or the
+// channel is closed by developer. On cancellation the consumer is cancelled on
+// the broker and the messages it had prefetched are requeued.
+func (ch *amqpChannel) Consume(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	if consumer == "" {
+		// A known tag is needed to cancel the consumer
+		consumer = "ctag-" + uuid.NewString()
+	}
 	deliveries := make(chan amqp.Delivery)
 
 	go func() {
+		defer close(deliveries)
 		for {
-			d, err := ch.Channel.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+			raw, reopened := ch.current()
+			d, err := raw.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
 			if err != nil {
 				helper.LogError("AMQP consume failed", err, queue, map[string]interface{}{
 					"queue":     queue,
@@ -44,19 +100,24 @@ func (ch *amqpChannel) Consume(queue, consumer string, autoAck, exclusive, noLoc
 					"auto_ack":  autoAck,
 					"exclusive": exclusive,
 				})
-				time.Sleep(delay * time.Second)
-				continue
+			} else if !forwardDeliveries(ctx, d, deliveries, autoAck) {
+				raw.Cancel(consumer, false)
+				for msg := range d {
+					if !autoAck {
+						msg.Nack(false, true)
+					}
+				}
+				return
 			}
 
-			for msg := range d {
-				deliveries <- msg
+			// The channel is gone: wait until it is recreated or closed by developer
+			select {
+			case <-ctx.Done():
+				return
+			case <-reopened:
 			}
-
-			// sleep before IsClose call. closed flag may not set before sleep.
-			time.Sleep(delay * time.Second)
-
 			if ch.IsClosed() {
-				break
+				return
 			}
 		}
 	}()
@@ -64,6 +125,29 @@ func (ch *amqpChannel) Consume(queue, consumer string, autoAck, exclusive, noLoc
 	return deliveries, nil
 }
 
+// forwardDeliveries copies d to out until d is closed (true) or ctx is done (false).
+// A message read from d but not handed out stays unacked and is requeued with the rest.
+func forwardDeliveries(ctx context.Context, d <-chan amqp.Delivery, out chan<- amqp.Delivery, autoAck bool) bool {
+	for {
+		select {
+		case msg, ok := <-d:
+			if !ok {
+				return true
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				if !autoAck {
+					msg.Nack(false, true)
+				}
+				return false
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
 func (ch *amqpChannel) DeclareExchange(exchangeName string, exchangeType string) (err error) {
 	err = ch.ExchangeDeclare(
 		exchangeName,
@@ -247,9 +331,10 @@ func (ch *amqpChannel) NewQueue(exchangeName, queueName, queueType, routeKey str
 	return queue, err
 }
 
-// Read Message
-func (ch *amqpChannel) ReadMessage(q amqp.Queue) (<-chan amqp.Delivery, error) {
+// ReadMessage consumes q with manual acks until ctx is done
+func (ch *amqpChannel) ReadMessage(ctx context.Context, q amqp.Queue) (<-chan amqp.Delivery, error) {
 	msgs, err := ch.Consume(
+		ctx,
 		q.Name, // queue
 		"",     // consumer
 		false,  // auto-ack
@@ -262,7 +347,13 @@ func (ch *amqpChannel) ReadMessage(q amqp.Queue) (<-chan amqp.Delivery, error) {
 	return msgs, err
 }
 
-func (ch *amqpChannel) PublishMessage(q *amqp.Queue, routingKey, contentType, exchange string, body []byte) error {
+// PublishMessage publishes without confirms on this channel; use Publisher for
+// confirmed publishing from several goroutines
+func (ch *amqpChannel) PublishMessage(ctx context.Context, q *amqp.Queue, routingKey, contentType, exchange string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	var key = ""
 
 	if routingKey != "" {
@@ -302,12 +393,45 @@ func (ch *amqpChannel) PublishMessage(q *amqp.Queue, routingKey, contentType, ex
 	return err
 }
 
+// PublishCloudEvent publishes a CloudEvent in binary or structured mode
+func (ch *amqpChannel) PublishCloudEvent(ctx context.Context, exchange, routingKey string, evt *CloudEvent, mode CloudEventMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg, err := evt.ToPublishing(mode)
+	if err != nil {
+		return err
+	}
+
+	err = ch.Publish(exchange, routingKey, false, false, msg)
+	if err != nil {
+		helper.LogError("AMQP publish CloudEvent failed", err, exchange, map[string]interface{}{
+			"exchange":    exchange,
+			"routing_key": routingKey,
+			"event_id":    evt.ID,
+			"event_type":  evt.Type,
+			"mode":        mode,
+		})
+	} else {
+		helper.LogInfo("AMQP CloudEvent published", map[string]interface{}{
+			"exchange":    exchange,
+			"routing_key": routingKey,
+			"event_id":    evt.ID,
+			"event_type":  evt.Type,
+			"mode":        mode,
+		})
+	}
+	return err
+}
+
 func failOnError(err error) {
 	if err != nil {
 		helper.LogError("AMQP operation failed", err, "", nil)
 	}
 }
 
-func (ch *amqpChannel) GetChannel() *amqp.Channel {
+// GetChannel returns the underlying channel
+func (ch *amqpChannel) GetChannel() RawChannel {
 	return ch.Channel
 }
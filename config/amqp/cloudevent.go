@@ -0,0 +1,190 @@
+package amqp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// CloudEventMode selects how a CloudEvent is carried in an AMQP message
+type CloudEventMode string
+
+const (
+	// CloudEventModeBinary puts attributes in AMQP headers and data in the body
+	CloudEventModeBinary CloudEventMode = "binary"
+	// CloudEventModeStructured puts the whole event as JSON in the body
+	CloudEventModeStructured CloudEventMode = "structured"
+
+	CloudEventsSpecVersion = "1.0"
+	CloudEventsContentType = "application/cloudevents+json"
+
+	// cloudEventsHeaderPrefix is the AMQP binding prefix for binary-mode attributes
+	cloudEventsHeaderPrefix = "cloudEvents_"
+	// cloudEventsLegacyHeaderPrefix is the prefix used by older AMQP binding drafts
+	cloudEventsLegacyHeaderPrefix = "cloudEvents:"
+)
+
+var (
+	ErrInvalidCloudEvent = errors.New("invalid CloudEvent")
+)
+
+// CloudEvent is a CloudEvents 1.0 envelope
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+
+	// Legacy is true when the delivery had no envelope (bare payload)
+	Legacy bool `json:"-"`
+	// Delivery is the AMQP delivery the event was parsed from (consumer side only)
+	Delivery amqp.Delivery `json:"-"`
+}
+
+// NewCloudEvent creates a CloudEvent with a JSON-encoded data payload
+func NewCloudEvent(id, source, eventType, dataSchema string, data interface{}) (*CloudEvent, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              id,
+		Source:          source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		DataSchema:      dataSchema,
+		Data:            body,
+	}, nil
+}
+
+// SchemaVersion returns the version segment of the dataschema (its last ':' or '/' separated part)
+func (e *CloudEvent) SchemaVersion() string {
+	return SchemaVersion(e.DataSchema)
+}
+
+// SchemaVersion returns the last ':' or '/' separated segment of a dataschema URI
+func SchemaVersion(dataSchema string) string {
+	if i := strings.LastIndexAny(dataSchema, ":/"); i >= 0 {
+		return dataSchema[i+1:]
+	}
+	return dataSchema
+}
+
+// Decode unmarshals the event data into v
+func (e *CloudEvent) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// ToPublishing converts the event to an AMQP publishing in the given mode
+func (e *CloudEvent) ToPublishing(mode CloudEventMode) (amqp.Publishing, error) {
+	if mode == CloudEventModeStructured {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return amqp.Publishing{}, err
+		}
+		return amqp.Publishing{
+			ContentType:  CloudEventsContentType,
+			MessageId:    e.ID,
+			Timestamp:    e.Time,
+			Type:         e.Type,
+			Body:         body,
+			DeliveryMode: amqp.Persistent,
+		}, nil
+	}
+
+	headers := amqp.Table{
+		cloudEventsHeaderPrefix + "specversion": e.SpecVersion,
+		cloudEventsHeaderPrefix + "id":          e.ID,
+		cloudEventsHeaderPrefix + "source":      e.Source,
+		cloudEventsHeaderPrefix + "type":        e.Type,
+	}
+	if !e.Time.IsZero() {
+		headers[cloudEventsHeaderPrefix+"time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		headers[cloudEventsHeaderPrefix+"dataschema"] = e.DataSchema
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  e.DataContentType,
+		MessageId:    e.ID,
+		Timestamp:    e.Time,
+		Type:         e.Type,
+		Body:         e.Data,
+		DeliveryMode: amqp.Persistent,
+	}, nil
+}
+
+// ParseCloudEvent reads a CloudEvent from a delivery in structured or binary mode.
+// Deliveries without an envelope are returned as a Legacy event whose Data is the raw body.
+func ParseCloudEvent(d amqp.Delivery) (*CloudEvent, error) {
+	if strings.HasPrefix(d.ContentType, CloudEventsContentType) {
+		var evt CloudEvent
+		if err := json.Unmarshal(d.Body, &evt); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCloudEvent, err)
+		}
+		if evt.SpecVersion == "" || evt.Type == "" {
+			return nil, fmt.Errorf("%w: missing specversion or type", ErrInvalidCloudEvent)
+		}
+		evt.Delivery = d
+		return &evt, nil
+	}
+
+	if specVersion := ceHeader(d.Headers, "specversion"); specVersion != "" {
+		evt := &CloudEvent{
+			SpecVersion:     specVersion,
+			ID:              ceHeader(d.Headers, "id"),
+			Source:          ceHeader(d.Headers, "source"),
+			Type:            ceHeader(d.Headers, "type"),
+			DataContentType: d.ContentType,
+			DataSchema:      ceHeader(d.Headers, "dataschema"),
+			Data:            d.Body,
+			Delivery:        d,
+		}
+		if evt.Type == "" {
+			return nil, fmt.Errorf("%w: missing type header", ErrInvalidCloudEvent)
+		}
+		if t := ceHeader(d.Headers, "time"); t != "" {
+			if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				evt.Time = parsed
+			}
+		}
+		return evt, nil
+	}
+
+	return &CloudEvent{
+		ID:              d.MessageId,
+		Time:            d.Timestamp,
+		DataContentType: d.ContentType,
+		Data:            d.Body,
+		Legacy:          true,
+		Delivery:        d,
+	}, nil
+}
+
+// ceHeader returns a binary-mode CloudEvents attribute from the headers
+func ceHeader(headers amqp.Table, name string) string {
+	for _, prefix := range []string{cloudEventsHeaderPrefix, cloudEventsLegacyHeaderPrefix} {
+		if v, ok := headers[prefix+name]; ok {
+			switch val := v.(type) {
+			case string:
+				return val
+			case []byte:
+				return string(val)
+			case time.Time:
+				return val.Format(time.RFC3339Nano)
+			}
+		}
+	}
+	return ""
+}
@@ -2,7 +2,6 @@ package amqp
 
 import (
 	"boilerblade/helper"
-	"fmt"
 	"time"
 
 	"github.com/streadway/amqp"
@@ -33,7 +32,7 @@ func Dial(url string) (IAMQPConnection, error) {
 				})
 				break
 			}
-			helper.LogError("AMQP connection closed", fmt.Errorf(reason.Error()), url, map[string]interface{}{
+			helper.LogError("AMQP connection closed", reason, url, map[string]interface{}{
 				"reason": reason.Reason,
 				"code":   reason.Code,
 			})
@@ -67,10 +66,9 @@ func (c *connection) Channel() (IAMQPChannel, error) {
 		return nil, err
 	}
 
-	prefetchCount := 20
-	setChannelQoS(ch, prefetchCount)
+	setChannelQoS(ch, DefaultPrefetch)
 
-	channel := &amqpChannel{Channel: ch}
+	channel := newAMQPChannel(ch, DefaultPrefetch)
 
 	go func() {
 		for {
@@ -81,7 +79,7 @@ func (c *connection) Channel() (IAMQPChannel, error) {
 				channel.Close() // close again, ensure closed flag set when connection closed
 				break
 			}
-			helper.LogError("AMQP channel closed", fmt.Errorf(reason.Error()), "", map[string]interface{}{
+			helper.LogError("AMQP channel closed", reason, "", map[string]interface{}{
 				"reason": reason.Reason,
 				"code":   reason.Code,
 			})
@@ -94,11 +92,11 @@ func (c *connection) Channel() (IAMQPChannel, error) {
 				ch, err := c.Connection.Channel()
 				if err == nil {
 					// Apply QoS settings to the recreated channel
-					if err := setChannelQoS(ch, prefetchCount); err != nil {
+					if err := setChannelQoS(ch, channel.prefetchCount()); err != nil {
 						helper.LogError("AMQP channel QoS setting failed", err, "", nil)
 					}
 					helper.LogInfo("AMQP channel recreate success", map[string]interface{}{})
-					channel.Channel = ch
+					channel.replace(ch)
 					break
 				}
 
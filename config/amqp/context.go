@@ -0,0 +1,20 @@
+package amqp
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultMessageTimeout bounds the handling of a single delivery
+const DefaultMessageTimeout = 30 * time.Second
+
+// MessageContext returns the context a delivery is handled with. It keeps the
+// values of parent but not its cancellation, so a message being handled when
+// the consumer shuts down is finished, and it expires after timeout
+// (DefaultMessageTimeout when zero or less).
+func MessageContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultMessageTimeout
+	}
+	return context.WithTimeout(context.WithoutCancel(parent), timeout)
+}
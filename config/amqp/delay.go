@@ -0,0 +1,228 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DelaySuffix names the bucket exchanges and queues: <exchange>.delay.<bucket>
+	DelaySuffix = ".delay."
+	// DelayedSuffix names the delayed-message plugin exchange: <exchange>.delayed
+	DelayedSuffix = ".delayed"
+	// DelayedMessageExchangeType is the exchange type of the rabbitmq_delayed_message_exchange plugin
+	DelayedMessageExchangeType = "x-delayed-message"
+	// DelayHeader carries the delay in ms for the delayed-message plugin
+	DelayHeader = "x-delay"
+
+	// maxPluginDelay is the largest x-delay the plugin accepts (2^32-1 ms, about 49 days)
+	maxPluginDelay = (1<<32 - 1) * time.Millisecond
+)
+
+// DelayBuckets are the TTL queues used without the plugin. A message goes to the
+// smallest bucket that fits its delay and expires after exactly that delay, but a
+// bucket queue only expires its head: a message can be held up to the bucket width
+// by a longer delay published before it. Messages with the same delay are never late.
+var DelayBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	72 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+var (
+	ErrDelayTooLong = errors.New("delay exceeds the largest supported delay")
+)
+
+// DelayedPublisher schedules messages for delivery after a delay
+type DelayedPublisher struct {
+	conn      IAMQPConnection
+	usePlugin bool
+
+	mu       sync.Mutex
+	channel  IAMQPChannel // opened on first use
+	declared map[string]bool
+}
+
+// NewDelayedPublisher creates a delayed publisher on conn. With usePlugin the
+// rabbitmq_delayed_message_exchange plugin must be enabled on the broker; it is
+// not probed because declaring an unknown exchange type closes the connection.
+func NewDelayedPublisher(conn IAMQPConnection, usePlugin bool) *DelayedPublisher {
+	return &DelayedPublisher{
+		conn:      conn,
+		usePlugin: usePlugin,
+		declared:  make(map[string]bool),
+	}
+}
+
+// PublishDelayed publishes body (JSON) to exchange/routingKey once delay has elapsed.
+// A delay of zero or less publishes immediately.
+func (p *DelayedPublisher) PublishDelayed(ctx context.Context, exchange, routingKey string, body []byte, delay time.Duration) error {
+	return p.PublishDelayedMessage(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Body:         body,
+	}, delay)
+}
+
+// PublishDelayedMessage is PublishDelayed with full message properties. msg.Expiration is overwritten.
+func (p *DelayedPublisher) PublishDelayedMessage(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, delay time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel == nil || p.channel.IsClosed() {
+		channel, err := p.conn.Channel()
+		if err != nil {
+			helper.LogError("Failed to get AMQP channel for delayed publishing", err, "", map[string]interface{}{
+				"source": "DelayedPublisher.PublishDelayed",
+			})
+			return err
+		}
+		p.channel = channel
+	}
+
+	if delay <= 0 {
+		return p.channel.Publish(exchange, routingKey, false, false, msg)
+	}
+
+	// The default exchange cannot be bound to, so it always goes through the buckets
+	if p.usePlugin && exchange != "" {
+		return p.publishPlugin(exchange, routingKey, msg, delay)
+	}
+	return p.publishBucket(exchange, routingKey, msg, delay)
+}
+
+// publishPlugin publishes through <exchange>.delayed, which is bound to exchange
+func (p *DelayedPublisher) publishPlugin(exchange, routingKey string, msg amqp.Publishing, delay time.Duration) error {
+	if delay > maxPluginDelay {
+		return ErrDelayTooLong
+	}
+
+	delayed := exchange + DelayedSuffix
+	if !p.declared[delayed] {
+		err := p.channel.ExchangeDeclare(delayed, DelayedMessageExchangeType, true, false, false, false, amqp.Table{
+			"x-delayed-type": "fanout",
+		})
+		if err == nil {
+			err = p.channel.ExchangeBind(exchange, "", delayed, false, nil)
+		}
+		if err != nil {
+			helper.LogError("Failed to declare delayed-message exchange", err, delayed, map[string]interface{}{
+				"source":   "DelayedPublisher.publishPlugin",
+				"exchange": exchange,
+			})
+			return err
+		}
+		p.declared[delayed] = true
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[DelayHeader] = delay.Milliseconds()
+	msg.Headers = headers
+	msg.Expiration = ""
+
+	return p.channel.Publish(delayed, routingKey, false, false, msg)
+}
+
+// publishBucket publishes to the bucket queue, which dead-letters to exchange on expiry
+func (p *DelayedPublisher) publishBucket(exchange, routingKey string, msg amqp.Publishing, delay time.Duration) error {
+	bucket, ok := delayBucket(delay)
+	if !ok {
+		return ErrDelayTooLong
+	}
+
+	name := DelayBucketName(exchange, bucket)
+	if !p.declared[name] {
+		if err := p.declareBucket(exchange, name); err != nil {
+			helper.LogError("Failed to declare delay bucket", err, name, map[string]interface{}{
+				"source":   "DelayedPublisher.publishBucket",
+				"exchange": exchange,
+			})
+			return err
+		}
+		p.declared[name] = true
+	}
+
+	// The fanout exchange keeps routingKey, so the expired message is dead-lettered with it
+	msg.Expiration = strconv.FormatInt(delay.Milliseconds(), 10)
+	return p.channel.Publish(name, routingKey, false, false, msg)
+}
+
+func (p *DelayedPublisher) declareBucket(exchange, name string) error {
+	if err := p.channel.ExchangeDeclare(name, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := p.channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": exchange,
+	}); err != nil {
+		return err
+	}
+	return p.channel.QueueBind(name, "", name, false, nil)
+}
+
+// Close closes the channel; the connection is owned by the caller
+func (p *DelayedPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channel == nil {
+		return nil
+	}
+	err := p.channel.Close()
+	p.channel = nil
+	return err
+}
+
+// DelayBucketName returns the bucket exchange and queue name, e.g. user_events.delay.24h
+func DelayBucketName(exchange string, bucket time.Duration) string {
+	if exchange == "" {
+		exchange = "default"
+	}
+
+	var label string
+	switch {
+	case bucket%time.Hour == 0:
+		label = fmt.Sprintf("%dh", bucket/time.Hour)
+	case bucket%time.Minute == 0:
+		label = fmt.Sprintf("%dm", bucket/time.Minute)
+	default:
+		label = fmt.Sprintf("%ds", bucket/time.Second)
+	}
+	return exchange + DelaySuffix + label
+}
+
+// delayBucket returns the smallest bucket that fits delay
+func delayBucket(delay time.Duration) (time.Duration, bool) {
+	for _, bucket := range DelayBuckets {
+		if delay <= bucket {
+			return bucket, true
+		}
+	}
+	return 0, false
+}
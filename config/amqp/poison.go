@@ -0,0 +1,97 @@
+package amqp
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Headers added to a message moved to its error queue
+const (
+	ErrorHeader              = "x-error"
+	ErrorConsumerHeader      = "x-error-consumer"
+	ErrorTimeHeader          = "x-error-time"
+	OriginalQueueHeader      = "x-original-queue"
+	OriginalExchangeHeader   = "x-original-exchange"
+	OriginalRoutingKeyHeader = "x-original-routing-key"
+)
+
+// PermanentError marks a failure that redelivery cannot fix (bad payload, failed validation).
+// Consumers move such messages to the error queue instead of requeuing them.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a permanent failure; a nil err stays nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err is a permanent failure: marked with Permanent,
+// a JSON decoding error, an invalid CloudEvent or an event type nobody handles.
+// Everything else (database down, timeouts) is transient and worth a retry.
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &permanent) ||
+		errors.As(err, &syntaxErr) ||
+		errors.As(err, &typeErr) ||
+		errors.Is(err, ErrInvalidCloudEvent) ||
+		errors.Is(err, ErrUnhandledEvent)
+}
+
+// ErrorQueueName returns the error queue of queue
+func ErrorQueueName(queue string) string {
+	return queue + ErrorQueueSuffix
+}
+
+// ErrorPublishing copies d for the error queue, keeping its properties and headers
+// and adding the failure headers, so it can be inspected and replayed as is
+func ErrorPublishing(d amqp.Delivery, queue, consumer string, cause error) amqp.Publishing {
+	msg := DeliveryPublishing(d)
+	msg.Headers[ErrorHeader] = cause.Error()
+	msg.Headers[ErrorConsumerHeader] = consumer
+	msg.Headers[ErrorTimeHeader] = time.Now().UTC()
+	msg.Headers[OriginalQueueHeader] = queue
+	msg.Headers[OriginalExchangeHeader] = d.Exchange
+	msg.Headers[OriginalRoutingKeyHeader] = d.RoutingKey
+	return msg
+}
+
+// DeliveryPublishing copies a delivery into a persistent publishing with a copy of its headers
+func DeliveryPublishing(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
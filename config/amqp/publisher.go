@@ -0,0 +1,291 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DefaultPublisherPoolSize is the number of confirm channels kept open
+	DefaultPublisherPoolSize = 8
+	// DefaultConfirmTimeout bounds the wait for the broker ack
+	DefaultConfirmTimeout = 5 * time.Second
+)
+
+var (
+	ErrPublishNacked      = errors.New("message nacked by the broker")
+	ErrConfirmTimeout     = errors.New("timed out waiting for the broker to confirm the message")
+	ErrPublisherClosed    = errors.New("publisher closed")
+	ErrConfirmChannelDown = errors.New("confirm channel closed before the message was confirmed")
+)
+
+// ReturnedError reports a mandatory message the broker could not route to any queue
+type ReturnedError struct {
+	Exchange   string
+	RoutingKey string
+	ReplyCode  uint16
+	ReplyText  string
+}
+
+func (e *ReturnedError) Error() string {
+	return fmt.Sprintf("message to exchange '%s' with routing key '%s' returned: %d %s", e.Exchange, e.RoutingKey, e.ReplyCode, e.ReplyText)
+}
+
+// PublisherOptions configures a Publisher
+type PublisherOptions struct {
+	// PoolSize is the maximum number of confirm channels (and concurrent publishes)
+	PoolSize int
+	// ConfirmTimeout bounds the wait for the broker ack; a ctx deadline can shorten it
+	ConfirmTimeout time.Duration
+	// Mandatory publishes with the mandatory flag, so unroutable messages fail with *ReturnedError
+	Mandatory bool
+}
+
+// DefaultPublisherOptions returns the options used by NewPublisher when fields are left zero
+func DefaultPublisherOptions() PublisherOptions {
+	return PublisherOptions{
+		PoolSize:       DefaultPublisherPoolSize,
+		ConfirmTimeout: DefaultConfirmTimeout,
+		Mandatory:      true,
+	}
+}
+
+// Publisher publishes over a pool of confirm-mode channels. Publish blocks until
+// the broker acks the message, so a nil error means the broker took it. It is safe
+// for concurrent use: every publish has a channel to itself.
+type Publisher struct {
+	conn IAMQPConnection
+	opts PublisherOptions
+
+	slots chan struct{}        // one token per channel that may be open
+	idle  chan *confirmChannel // open channels not in use
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// confirmChannel is a channel in confirm mode with its notification listeners
+type confirmChannel struct {
+	channel  IAMQPChannel
+	raw      RawChannel // the channel confirm mode was enabled on
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+}
+
+// NewPublisher creates a publisher on conn. Channels are opened on demand.
+func NewPublisher(conn IAMQPConnection, opts PublisherOptions) *Publisher {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = DefaultPublisherPoolSize
+	}
+	if opts.ConfirmTimeout <= 0 {
+		opts.ConfirmTimeout = DefaultConfirmTimeout
+	}
+
+	return &Publisher{
+		conn:  conn,
+		opts:  opts,
+		slots: make(chan struct{}, opts.PoolSize),
+		idle:  make(chan *confirmChannel, opts.PoolSize),
+	}
+}
+
+// Publish publishes msg and waits for the broker confirm. An empty MessageId is
+// generated, a zero Timestamp is set to now and a zero DeliveryMode is persistent;
+// Headers, Priority and Expiration (ms) are sent as given.
+func (p *Publisher) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	if msg.DeliveryMode == 0 {
+		msg.DeliveryMode = amqp.Persistent
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var cc *confirmChannel
+		if cc, err = p.acquire(ctx); err != nil {
+			return err
+		}
+		var healthy bool
+		healthy, err = cc.publish(ctx, exchange, routingKey, p.opts.Mandatory, msg, p.opts.ConfirmTimeout)
+		p.release(cc, healthy)
+		// The channel was lost before the message went out (a broker
+		// reconnect in progress): try once more on another channel
+		if !errors.Is(err, amqp.ErrClosed) {
+			break
+		}
+	}
+	if err != nil {
+		helper.LogError("AMQP confirmed publish failed", err, exchange, map[string]interface{}{
+			"source":      "Publisher.Publish",
+			"exchange":    exchange,
+			"routing_key": routingKey,
+			"message_id":  msg.MessageId,
+		})
+	}
+	return err
+}
+
+// Close closes the idle channels; channels in use are closed when their publish returns
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for {
+		select {
+		case cc := <-p.idle:
+			cc.channel.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// acquire takes a usable idle channel (stale ones are closed) or opens one,
+// waiting while all PoolSize channels are in use
+func (p *Publisher) acquire(ctx context.Context) (*confirmChannel, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		<-p.slots
+		return nil, ErrPublisherClosed
+	}
+
+	for idle := true; idle; {
+		select {
+		case cc := <-p.idle:
+			if cc.usable() {
+				return cc, nil
+			}
+			cc.channel.Close()
+		default:
+			idle = false
+		}
+	}
+
+	cc, err := openConfirmChannel(p.conn)
+	if err != nil {
+		<-p.slots
+		helper.LogError("Failed to open AMQP confirm channel", err, "", map[string]interface{}{
+			"source": "Publisher.acquire",
+		})
+		return nil, err
+	}
+	return cc, nil
+}
+
+// release returns a healthy channel to the pool; others are closed
+func (p *Publisher) release(cc *confirmChannel, healthy bool) {
+	p.mu.Lock()
+	if healthy && !p.closed {
+		p.idle <- cc
+	} else {
+		cc.channel.Close()
+	}
+	p.mu.Unlock()
+	<-p.slots
+}
+
+func openConfirmChannel(conn IAMQPConnection) (*confirmChannel, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := channel.GetChannel()
+	if err := raw.Confirm(false); err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	// One publish is in flight per channel, so one buffered slot each is enough
+	return &confirmChannel{
+		channel:  channel,
+		raw:      raw,
+		confirms: raw.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		returns:  raw.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
+
+// usable reports whether cc can still publish. After a reconnect, the channel
+// wraps a new raw channel, not in confirm mode: IsClosed does not tell, only
+// the raw channel changing does.
+func (cc *confirmChannel) usable() bool {
+	return !cc.channel.IsClosed() && cc.channel.GetChannel() == cc.raw
+}
+
+// publish publishes msg and waits for its confirm. healthy is false when the
+// channel may still owe a confirm (timeout, cancel) or is closed, so it is not reused.
+func (cc *confirmChannel) publish(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp.Publishing, timeout time.Duration) (healthy bool, err error) {
+	if err := cc.raw.Publish(exchange, routingKey, mandatory, false, msg); err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var returned *amqp.Return
+	for {
+		select {
+		case r, ok := <-cc.returns:
+			if !ok {
+				return false, ErrConfirmChannelDown
+			}
+			returned = &r
+
+		case confirm, ok := <-cc.confirms:
+			if !ok {
+				return false, ErrConfirmChannelDown
+			}
+			if !confirm.Ack {
+				return true, ErrPublishNacked
+			}
+			// The broker sends basic.return before basic.ack, so a return is already buffered
+			if returned == nil {
+				select {
+				case r, ok := <-cc.returns:
+					if ok {
+						returned = &r
+					}
+				default:
+				}
+			}
+			if returned != nil {
+				return true, &ReturnedError{
+					Exchange:   returned.Exchange,
+					RoutingKey: returned.RoutingKey,
+					ReplyCode:  returned.ReplyCode,
+					ReplyText:  returned.ReplyText,
+				}
+			}
+			return true, nil
+
+		case <-timer.C:
+			return false, ErrConfirmTimeout
+
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
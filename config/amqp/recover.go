@@ -0,0 +1,45 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/streadway/amqp"
+)
+
+// PanicError is a panic recovered from a message handler
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// IsPanic reports whether err is a recovered panic
+func IsPanic(err error) bool {
+	var panicErr *PanicError
+	return errors.As(err, &panicErr)
+}
+
+// Recover calls fn and turns a panic into a *PanicError, logged with its stack
+// trace, so one bad message cannot kill the goroutine consuming the queue.
+// A panic is treated as transient: redelivery may succeed once the cause is gone.
+func Recover(source string, d amqp.Delivery, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			helper.LogError("Recovered panic in message handler", panicErr, "", map[string]interface{}{
+				"source":      source,
+				"message_id":  d.MessageId,
+				"routing_key": d.RoutingKey,
+				"stack":       string(panicErr.Stack),
+			})
+			err = panicErr
+		}
+	}()
+	return fn()
+}
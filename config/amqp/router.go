@@ -0,0 +1,63 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	ErrUnhandledEvent = errors.New("no handler registered for event type and schema version")
+)
+
+// EventHandler handles a single CloudEvent; ctx carries the deadline of the delivery
+type EventHandler func(ctx context.Context, evt *CloudEvent) error
+
+// EventRouter dispatches deliveries to handlers by CloudEvent type and dataschema version.
+// Legacy bare payloads are dispatched as legacyType/legacyVersion so existing producers
+// keep working while they migrate to the envelope.
+type EventRouter struct {
+	handlers      map[string]EventHandler
+	legacyType    string
+	legacyVersion string
+}
+
+// NewEventRouter creates a router; legacy payloads are treated as legacyType at legacyVersion
+func NewEventRouter(legacyType, legacyVersion string) *EventRouter {
+	return &EventRouter{
+		handlers:      make(map[string]EventHandler),
+		legacyType:    legacyType,
+		legacyVersion: legacyVersion,
+	}
+}
+
+// Handle registers a handler for an event type and dataschema version
+func (r *EventRouter) Handle(eventType, version string, handler EventHandler) *EventRouter {
+	r.handlers[routeKey(eventType, version)] = handler
+	return r
+}
+
+// Dispatch parses the delivery and calls the matching handler with ctx
+func (r *EventRouter) Dispatch(ctx context.Context, d amqp.Delivery) error {
+	evt, err := ParseCloudEvent(d)
+	if err != nil {
+		return err
+	}
+
+	eventType, version := evt.Type, evt.SchemaVersion()
+	if evt.Legacy {
+		eventType, version = r.legacyType, r.legacyVersion
+	}
+
+	handler, ok := r.handlers[routeKey(eventType, version)]
+	if !ok {
+		return fmt.Errorf("%w: type=%q version=%q", ErrUnhandledEvent, eventType, version)
+	}
+	return handler(ctx, evt)
+}
+
+func routeKey(eventType, version string) string {
+	return eventType + "|" + version
+}
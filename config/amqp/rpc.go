@@ -0,0 +1,281 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DirectReplyTo is RabbitMQ's pseudo-queue for replies without a declared queue
+	DirectReplyTo = "amq.rabbitmq.reply-to"
+	// RPCErrorHeader carries the handler error of a failed call
+	RPCErrorHeader = "x-rpc-error"
+)
+
+// RPCReplyMode selects where an RPCClient receives replies
+type RPCReplyMode string
+
+const (
+	// RPCReplyDirect uses direct reply-to (no queue is declared)
+	RPCReplyDirect RPCReplyMode = "direct"
+	// RPCReplyExclusive declares a server-named exclusive queue per client
+	RPCReplyExclusive RPCReplyMode = "exclusive"
+)
+
+var (
+	ErrRPCClosed = errors.New("rpc client closed")
+)
+
+// RPCError is returned by Call when the server handler failed
+type RPCError struct {
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "rpc: " + e.Message
+}
+
+// RPCClient publishes requests with ReplyTo/CorrelationId and waits for the matching reply.
+// It is safe for concurrent use; all calls share one channel and one reply consumer.
+type RPCClient struct {
+	channel    IAMQPChannel
+	replyQueue string
+
+	mu      sync.Mutex
+	pending map[string]chan amqp.Delivery
+	closed  bool
+}
+
+// NewRPCClient opens a channel and starts consuming replies
+func NewRPCClient(conn IAMQPConnection, mode RPCReplyMode) (*RPCClient, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		helper.LogError("Failed to get AMQP channel for RPC client", err, "", map[string]interface{}{
+			"source": "NewRPCClient",
+		})
+		return nil, err
+	}
+
+	replyQueue := DirectReplyTo
+	if mode == RPCReplyExclusive {
+		q, err := channel.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			channel.Close()
+			return nil, err
+		}
+		replyQueue = q.Name
+	}
+
+	// Consume on the raw channel so the reply consumer exists before the first
+	// publish (direct reply-to requires it). Replies are auto-acked.
+	replies, err := channel.GetChannel().Consume(replyQueue, "", true, true, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	c := &RPCClient{
+		channel:    channel,
+		replyQueue: replyQueue,
+		pending:    make(map[string]chan amqp.Delivery),
+	}
+	go c.dispatch(replies)
+	return c, nil
+}
+
+// dispatch hands each reply to the call waiting for its correlation ID
+func (c *RPCClient) dispatch(replies <-chan amqp.Delivery) {
+	for d := range replies {
+		c.mu.Lock()
+		waiting, ok := c.pending[d.CorrelationId]
+		delete(c.pending, d.CorrelationId)
+		c.mu.Unlock()
+
+		if !ok {
+			// The caller gave up (deadline) before the reply arrived
+			helper.LogDebug("RPC reply without waiting caller dropped", map[string]interface{}{
+				"source":         "RPCClient.dispatch",
+				"correlation_id": d.CorrelationId,
+			})
+			continue
+		}
+		waiting <- d
+	}
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		helper.LogError("RPC reply consumer stopped, recreate the client", ErrRPCClosed, "", map[string]interface{}{
+			"source":      "RPCClient.dispatch",
+			"reply_queue": c.replyQueue,
+		})
+	}
+}
+
+// Call publishes req to exchange/routingKey and waits for the reply until ctx is done.
+// The remaining time of the ctx deadline is sent as the message expiration, so
+// requests nobody picked up in time are dropped by the broker.
+func (c *RPCClient) Call(ctx context.Context, exchange, routingKey string, req amqp.Publishing) (amqp.Delivery, error) {
+	req.CorrelationId = uuid.NewString()
+	req.ReplyTo = c.replyQueue
+	if deadline, ok := ctx.Deadline(); ok {
+		ttl := time.Until(deadline).Milliseconds()
+		if ttl < 1 {
+			return amqp.Delivery{}, context.DeadlineExceeded
+		}
+		req.Expiration = strconv.FormatInt(ttl, 10)
+	}
+
+	reply := make(chan amqp.Delivery, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return amqp.Delivery{}, ErrRPCClosed
+	}
+	c.pending[req.CorrelationId] = reply
+	// Publish under the lock: a channel must not be used for concurrent publishes
+	err := c.channel.Publish(exchange, routingKey, false, false, req)
+	if err != nil {
+		delete(c.pending, req.CorrelationId)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		helper.LogError("RPC request publish failed", err, exchange, map[string]interface{}{
+			"source":      "RPCClient.Call",
+			"exchange":    exchange,
+			"routing_key": routingKey,
+		})
+		return amqp.Delivery{}, err
+	}
+
+	select {
+	case d, ok := <-reply:
+		if !ok {
+			return amqp.Delivery{}, ErrRPCClosed
+		}
+		if msg, failed := d.Headers[RPCErrorHeader].(string); failed {
+			return d, &RPCError{Message: msg}
+		}
+		return d, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, req.CorrelationId)
+		c.mu.Unlock()
+		return amqp.Delivery{}, ctx.Err()
+	}
+}
+
+// Close closes the channel; calls still waiting fail with ErrRPCClosed
+func (c *RPCClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for id, waiting := range c.pending {
+		close(waiting)
+		delete(c.pending, id)
+	}
+	return c.channel.Close()
+}
+
+// RPCHandler handles a request and returns the reply. The ctx deadline follows the
+// request expiration set by the caller, or DefaultMessageTimeout without one.
+type RPCHandler func(ctx context.Context, req amqp.Delivery) (amqp.Publishing, error)
+
+// RPCServer consumes a queue and replies to every request with the handler result.
+// A handler error, or a recovered panic, is sent back in the RPCErrorHeader header;
+// the request is acked either way, so failed calls are not redelivered.
+type RPCServer struct {
+	channel IAMQPChannel
+	queue   string
+	handler RPCHandler
+}
+
+// NewRPCServer opens a channel for serving queue (declared by the topology)
+func NewRPCServer(conn IAMQPConnection, queue string, handler RPCHandler) (*RPCServer, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		helper.LogError("Failed to get AMQP channel for RPC server", err, "", map[string]interface{}{
+			"source": "NewRPCServer",
+			"queue":  queue,
+		})
+		return nil, err
+	}
+	return &RPCServer{channel: channel, queue: queue, handler: handler}, nil
+}
+
+// Serve handles requests until ctx is done or the channel is closed. A request
+// being handled when ctx is done is finished and answered first.
+func (s *RPCServer) Serve(ctx context.Context) error {
+	requests, err := s.channel.ReadMessage(ctx, amqp.Queue{Name: s.queue})
+	if err != nil {
+		return err
+	}
+
+	helper.LogInfo("Started serving RPC requests", map[string]interface{}{
+		"source": "RPCServer.Serve",
+		"queue":  s.queue,
+	})
+
+	for req := range requests {
+		s.handle(ctx, req)
+	}
+	return nil
+}
+
+// Close closes the channel
+func (s *RPCServer) Close() error {
+	return s.channel.Close()
+}
+
+func (s *RPCServer) handle(ctx context.Context, req amqp.Delivery) {
+	timeout := DefaultMessageTimeout
+	if ms, err := strconv.ParseInt(req.Expiration, 10, 64); err == nil {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := MessageContext(ctx, timeout)
+	defer cancel()
+
+	var reply amqp.Publishing
+	err := Recover("RPCServer.handle", req, func() (err error) {
+		reply, err = s.handler(ctx, req)
+		return err
+	})
+	if err != nil {
+		helper.LogError("RPC handler failed", err, "", map[string]interface{}{
+			"source":         "RPCServer.handle",
+			"queue":          s.queue,
+			"correlation_id": req.CorrelationId,
+		})
+		reply = amqp.Publishing{Headers: amqp.Table{RPCErrorHeader: err.Error()}}
+	}
+
+	if req.ReplyTo == "" {
+		helper.LogInfo("RPC request without ReplyTo, no reply sent", map[string]interface{}{
+			"source":         "RPCServer.handle",
+			"queue":          s.queue,
+			"correlation_id": req.CorrelationId,
+		})
+	} else {
+		reply.CorrelationId = req.CorrelationId
+		if err := s.channel.Publish("", req.ReplyTo, false, false, reply); err != nil {
+			helper.LogError("RPC reply publish failed", err, "", map[string]interface{}{
+				"source":         "RPCServer.handle",
+				"queue":          s.queue,
+				"correlation_id": req.CorrelationId,
+			})
+		}
+	}
+	req.Ack(false)
+}
@@ -0,0 +1,297 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// StreamOffsetArg is the consume argument selecting where a stream consumer starts
+	StreamOffsetArg = "x-stream-offset"
+	// StreamOffsetHeader carries the offset of every message delivered from a stream
+	StreamOffsetHeader = "x-stream-offset"
+	// DefaultStreamPrefetch is the QoS of stream consumers; streams require one
+	DefaultStreamPrefetch = 100
+)
+
+var (
+	ErrNoStreamOffset = errors.New("delivery has no x-stream-offset header")
+)
+
+// StreamOffset is where a stream consumer starts reading. The zero value is OffsetNext.
+type StreamOffset struct {
+	spec interface{} // "first", "last", "next", int64 or time.Time
+}
+
+var (
+	// OffsetFirst starts at the oldest message kept by the stream
+	OffsetFirst = StreamOffset{spec: "first"}
+	// OffsetLast starts at the last chunk written, so the latest messages are seen again
+	OffsetLast = StreamOffset{spec: "last"}
+	// OffsetNext starts with the messages published after the consumer attached
+	OffsetNext = StreamOffset{spec: "next"}
+)
+
+// OffsetAt starts at the given offset
+func OffsetAt(offset int64) StreamOffset {
+	return StreamOffset{spec: offset}
+}
+
+// OffsetTimestamp starts at the first message stored at or after t. RabbitMQ
+// resolves timestamps per chunk, so a few earlier messages may be delivered too.
+func OffsetTimestamp(t time.Time) StreamOffset {
+	return StreamOffset{spec: t}
+}
+
+// ParseStreamOffset parses first, last, next, an offset or an RFC 3339 timestamp
+func ParseStreamOffset(s string) (StreamOffset, error) {
+	switch s {
+	case "first":
+		return OffsetFirst, nil
+	case "last":
+		return OffsetLast, nil
+	case "", "next":
+		return OffsetNext, nil
+	}
+	if offset, err := strconv.ParseInt(s, 10, 64); err == nil && offset >= 0 {
+		return OffsetAt(offset), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return OffsetTimestamp(t), nil
+	}
+	return StreamOffset{}, fmt.Errorf("invalid stream offset %q: want first, last, next, an offset or an RFC 3339 timestamp", s)
+}
+
+// String returns the offset as accepted by ParseStreamOffset
+func (o StreamOffset) String() string {
+	switch v := o.Arg().(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Arg returns the value of the x-stream-offset consume argument
+func (o StreamOffset) Arg() interface{} {
+	if o.spec == nil {
+		return "next"
+	}
+	return o.spec
+}
+
+// DeliveryOffset returns the stream offset of d
+func DeliveryOffset(d amqp.Delivery) (int64, error) {
+	switch v := d.Headers[StreamOffsetHeader].(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	}
+	return 0, ErrNoStreamOffset
+}
+
+// OffsetStore persists, per stream and consumer name, the next offset to read
+type OffsetStore interface {
+	// LoadOffset returns the stored offset; ok is false when nothing was stored yet
+	LoadOffset(ctx context.Context, stream, consumer string) (offset int64, ok bool, err error)
+	// SaveOffset stores the next offset to read
+	SaveOffset(ctx context.Context, stream, consumer string, offset int64) error
+}
+
+// StreamHandler handles one stream message; ctx carries the message deadline
+type StreamHandler func(ctx context.Context, d amqp.Delivery) error
+
+// StreamConsumerOptions configures a StreamConsumer
+type StreamConsumerOptions struct {
+	// Start is used when the store has no offset for the consumer (default OffsetNext)
+	Start StreamOffset
+	// Prefetch is the number of unacked messages in flight (default DefaultStreamPrefetch)
+	Prefetch int
+	// CommitEvery saves the offset after this many messages (default 1, every message);
+	// pending progress is saved when Run returns
+	CommitEvery int
+	// MessageTimeout bounds the handler (default DefaultMessageTimeout)
+	MessageTimeout time.Duration
+}
+
+// StreamConsumer reads a stream queue and records its progress in an OffsetStore,
+// so a restart resumes after the last processed message. Streams keep their
+// history, so a consumer with a new name (or a rewound offset) can rebuild a read
+// model from the start.
+type StreamConsumer struct {
+	conn   IAMQPConnection
+	stream string
+	name   string
+	store  OffsetStore
+	opts   StreamConsumerOptions
+}
+
+// NewStreamConsumer creates a consumer named name for stream (a queue with type stream)
+func NewStreamConsumer(conn IAMQPConnection, stream, name string, store OffsetStore, opts StreamConsumerOptions) *StreamConsumer {
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = DefaultStreamPrefetch
+	}
+	if opts.CommitEvery <= 0 {
+		opts.CommitEvery = 1
+	}
+	return &StreamConsumer{conn: conn, stream: stream, name: name, store: store, opts: opts}
+}
+
+// Run consumes the stream until ctx is done. Every message is handled, then its
+// offset is committed and it is acked. A permanent handler error (see Permanent)
+// is logged and the message skipped; any other error stops Run and is returned
+// without committing, so the message is read again on the next Run.
+func (c *StreamConsumer) Run(ctx context.Context, handler StreamHandler) error {
+	start, err := c.startOffset(ctx)
+	if err != nil {
+		return err
+	}
+
+	channel, err := c.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	if err := channel.SetPrefetch(c.opts.Prefetch); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deliveries, err := channel.Consume(ctx, c.stream, "", false, false, false, false, amqp.Table{
+		StreamOffsetArg: start.Arg(),
+	})
+	if err != nil {
+		return err
+	}
+
+	helper.LogInfo("Started consuming stream", map[string]interface{}{
+		"source":   "StreamConsumer.Run",
+		"stream":   c.stream,
+		"consumer": c.name,
+		"offset":   start.String(),
+	})
+
+	var next int64 = -1 // offset to commit, -1 while nothing is pending
+	uncommitted := 0
+	commit := func() error {
+		if next < 0 {
+			return nil
+		}
+		// The consumer ctx may be done already; the commit must still happen
+		commitCtx, cancelCommit := MessageContext(ctx, c.opts.MessageTimeout)
+		defer cancelCommit()
+		if err := c.store.SaveOffset(commitCtx, c.stream, c.name, next); err != nil {
+			helper.LogError("Failed to commit stream offset", err, "", map[string]interface{}{
+				"source":   "StreamConsumer.Run",
+				"stream":   c.stream,
+				"consumer": c.name,
+				"offset":   next,
+			})
+			return err
+		}
+		next, uncommitted = -1, 0
+		return nil
+	}
+
+	for d := range deliveries {
+		offset, err := DeliveryOffset(d)
+		if err != nil {
+			d.Ack(false)
+			continue
+		}
+
+		if err := c.handle(ctx, d, handler); err != nil {
+			cancel()
+			if commitErr := commit(); commitErr != nil {
+				return commitErr
+			}
+			return fmt.Errorf("stream %s offset %d: %w", c.stream, offset, err)
+		}
+
+		next = offset + 1
+		uncommitted++
+		if uncommitted >= c.opts.CommitEvery {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+		d.Ack(false)
+	}
+	return commit()
+}
+
+// handle runs handler with the message deadline; permanent errors are logged and
+// swallowed, a panic is recovered and stops Run like any transient error
+func (c *StreamConsumer) handle(ctx context.Context, d amqp.Delivery, handler StreamHandler) error {
+	ctx, cancel := MessageContext(ctx, c.opts.MessageTimeout)
+	defer cancel()
+
+	err := Recover("StreamConsumer.handle", d, func() error { return handler(ctx, d) })
+	if err != nil && IsPermanent(err) {
+		helper.LogError("Skipping stream message after permanent failure", err, "", map[string]interface{}{
+			"source":     "StreamConsumer.handle",
+			"stream":     c.stream,
+			"consumer":   c.name,
+			"message_id": d.MessageId,
+		})
+		return nil
+	}
+	return err
+}
+
+// startOffset returns the stored offset, or opts.Start for a new consumer
+func (c *StreamConsumer) startOffset(ctx context.Context) (StreamOffset, error) {
+	offset, ok, err := c.store.LoadOffset(ctx, c.stream, c.name)
+	if err != nil {
+		return StreamOffset{}, fmt.Errorf("loading offset of %s/%s: %w", c.stream, c.name, err)
+	}
+	if ok {
+		return OffsetAt(offset), nil
+	}
+	return c.opts.Start, nil
+}
+
+// ResolveStreamOffset returns the offset of the first message at or after start,
+// for example to rewind a consumer to a timestamp. found is false when no such
+// message arrives before ctx is done.
+func ResolveStreamOffset(ctx context.Context, conn IAMQPConnection, stream string, start StreamOffset) (offset int64, found bool, err error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, false, err
+	}
+	defer channel.Close()
+
+	if err := channel.SetPrefetch(1); err != nil {
+		return 0, false, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deliveries, err := channel.Consume(ctx, stream, "", false, false, false, false, amqp.Table{
+		StreamOffsetArg: start.Arg(),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	d, ok := <-deliveries
+	if !ok {
+		return 0, false, nil
+	}
+	d.Ack(false)
+	offset, err = DeliveryOffset(d)
+	return offset, err == nil, err
+}
@@ -0,0 +1,553 @@
+package amqp
+
+import (
+	"boilerblade/helper"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/streadway/amqp"
+	"gopkg.in/yaml.v3"
+)
+
+// Default topology files, one per feature. Environment overrides live in a
+// subdirectory named after MODE (e.g. topology/production/*.yaml).
+//
+//go:embed topology
+var embedTopology embed.FS
+
+const topologyRoot = "topology"
+
+var (
+	exchangeTypes = map[string]bool{"direct": true, "topic": true, "fanout": true, "headers": true}
+	queueTypes    = map[string]bool{"quorum": true, "classic": true, "stream": true}
+)
+
+// Topology describes the exchanges, queues and bindings declared at startup
+type Topology struct {
+	Exchanges []ExchangeSpec `yaml:"exchanges"`
+	Queues    []QueueSpec    `yaml:"queues"`
+	Bindings  []BindingSpec  `yaml:"bindings"`
+}
+
+// ExchangeSpec describes an exchange
+type ExchangeSpec struct {
+	Name       string                 `yaml:"name"`
+	Type       string                 `yaml:"type"` // direct, topic, fanout or headers
+	AutoDelete bool                   `yaml:"auto_delete"`
+	Internal   bool                   `yaml:"internal"`
+	Arguments  map[string]interface{} `yaml:"arguments"`
+}
+
+// QueueSpec describes a queue. All queues are durable.
+type QueueSpec struct {
+	Name                 string                 `yaml:"name"`
+	Type                 string                 `yaml:"type"` // quorum, classic or stream
+	DeadLetterExchange   string                 `yaml:"dead_letter_exchange"`
+	DeadLetterRoutingKey string                 `yaml:"dead_letter_routing_key"`
+	MessageTTL           int                    `yaml:"message_ttl"` // milliseconds
+	Retry                *RetrySpec             `yaml:"retry"`
+	ErrorQueue           *bool                  `yaml:"error_queue"` // "<queue>.error" for poison messages; default true except for streams
+	Arguments            map[string]interface{} `yaml:"arguments"`
+}
+
+// HasErrorQueue reports whether "<queue>.error" is declared for the queue
+func (q QueueSpec) HasErrorQueue() bool {
+	if q.ErrorQueue != nil {
+		return *q.ErrorQueue
+	}
+	return q.Type != "stream"
+}
+
+// RetrySpec enables the delayed retry flow for a queue. Rejected messages are
+// dead-lettered to "<exchange>.retry", wait Interval ms in "<queue>.retry" and
+// are routed back to the queue. Exchange and routing key come from the queue's
+// first binding.
+type RetrySpec struct {
+	Interval int `yaml:"interval"` // milliseconds
+}
+
+// BindingSpec binds a queue to an exchange
+type BindingSpec struct {
+	Exchange   string                 `yaml:"exchange"`
+	Queue      string                 `yaml:"queue"`
+	RoutingKey string                 `yaml:"routing_key"`
+	Arguments  map[string]interface{} `yaml:"arguments"`
+}
+
+// LoadTopology loads and merges all topology files. dir is a directory on disk;
+// when empty the embedded default is used. Files in the env subdirectory
+// (e.g. "production") override entries with the same name.
+func LoadTopology(dir, env string) (*Topology, error) {
+	var fsys fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(embedTopology, topologyRoot)
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	} else {
+		fsys = os.DirFS(dir)
+	}
+
+	topology := &Topology{}
+	if err := topology.mergeDir(fsys, "."); err != nil {
+		return nil, err
+	}
+	if env != "" {
+		if _, err := fs.Stat(fsys, env); err == nil {
+			if err := topology.mergeDir(fsys, env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
+	return topology, nil
+}
+
+// ParseTopology parses a single topology document. ${VAR} references are expanded from the environment.
+func ParseTopology(data []byte) (*Topology, error) {
+	var topology Topology
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &topology); err != nil {
+		return nil, err
+	}
+	return &topology, nil
+}
+
+// mergeDir merges every *.yaml/*.yml file of dir (non-recursive, sorted by name)
+func (t *Topology) mergeDir(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("read topology dir: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml")) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("read topology file %s: %w", name, err)
+		}
+		other, err := ParseTopology(data)
+		if err != nil {
+			return fmt.Errorf("parse topology file %s: %w", name, err)
+		}
+		t.Merge(other)
+	}
+	return nil
+}
+
+// Merge adds other's entries; entries with the same name (or the same
+// exchange/queue/routing key for bindings) replace the existing ones
+func (t *Topology) Merge(other *Topology) {
+	for _, e := range other.Exchanges {
+		if i := t.exchangeIndex(e.Name); i >= 0 {
+			t.Exchanges[i] = e
+		} else {
+			t.Exchanges = append(t.Exchanges, e)
+		}
+	}
+	for _, q := range other.Queues {
+		if i := t.queueIndex(q.Name); i >= 0 {
+			t.Queues[i] = q
+		} else {
+			t.Queues = append(t.Queues, q)
+		}
+	}
+	for _, b := range other.Bindings {
+		replaced := false
+		for i, existing := range t.Bindings {
+			if existing.Exchange == b.Exchange && existing.Queue == b.Queue && existing.RoutingKey == b.RoutingKey {
+				t.Bindings[i] = b
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			t.Bindings = append(t.Bindings, b)
+		}
+	}
+}
+
+// Validate checks types and references
+func (t *Topology) Validate() error {
+	for _, e := range t.Exchanges {
+		if e.Name == "" {
+			return fmt.Errorf("topology: exchange without name")
+		}
+		if !exchangeTypes[e.Type] {
+			return fmt.Errorf("topology: exchange %s has invalid type %q", e.Name, e.Type)
+		}
+	}
+	for _, q := range t.Queues {
+		if q.Name == "" {
+			return fmt.Errorf("topology: queue without name")
+		}
+		if !queueTypes[q.Type] {
+			return fmt.Errorf("topology: queue %s has invalid type %q", q.Name, q.Type)
+		}
+		if q.Retry != nil {
+			if q.Type == "stream" {
+				return fmt.Errorf("topology: stream queue %s cannot use retry (streams do not dead-letter)", q.Name)
+			}
+			if q.Retry.Interval <= 0 {
+				return fmt.Errorf("topology: queue %s retry interval must be positive", q.Name)
+			}
+			if _, ok := t.firstBinding(q.Name); !ok {
+				return fmt.Errorf("topology: queue %s uses retry but has no binding", q.Name)
+			}
+		}
+		if q.Type == "stream" && q.HasErrorQueue() {
+			return fmt.Errorf("topology: stream queue %s cannot use an error queue", q.Name)
+		}
+	}
+	for _, b := range t.Bindings {
+		if t.exchangeIndex(b.Exchange) < 0 && !strings.HasPrefix(b.Exchange, "amq.") {
+			return fmt.Errorf("topology: binding references unknown exchange %s", b.Exchange)
+		}
+		if t.queueIndex(b.Queue) < 0 {
+			return fmt.Errorf("topology: binding references unknown queue %s", b.Queue)
+		}
+	}
+	return nil
+}
+
+// Exchange returns the exchange spec with the given name (nil-safe)
+func (t *Topology) Exchange(name string) (ExchangeSpec, bool) {
+	if i := t.exchangeIndex(name); i >= 0 {
+		return t.Exchanges[i], true
+	}
+	return ExchangeSpec{}, false
+}
+
+// Queue returns the queue spec with the given name (nil-safe)
+func (t *Topology) Queue(name string) (QueueSpec, bool) {
+	if i := t.queueIndex(name); i >= 0 {
+		return t.Queues[i], true
+	}
+	return QueueSpec{}, false
+}
+
+func (t *Topology) exchangeIndex(name string) int {
+	if t == nil {
+		return -1
+	}
+	for i, e := range t.Exchanges {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Topology) queueIndex(name string) int {
+	if t == nil {
+		return -1
+	}
+	for i, q := range t.Queues {
+		if q.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Topology) firstBinding(queue string) (BindingSpec, bool) {
+	for _, b := range t.Bindings {
+		if b.Queue == queue {
+			return b, true
+		}
+	}
+	return BindingSpec{}, false
+}
+
+// Route returns the queues a message published to exchange with routingKey is
+// delivered to, following the bindings like the broker would. The default
+// exchange ("") routes to the queue named routingKey, including error queues.
+func (t *Topology) Route(exchange, routingKey string) []string {
+	if exchange == "" {
+		if t.queueIndex(routingKey) >= 0 {
+			return []string{routingKey}
+		}
+		if base := strings.TrimSuffix(routingKey, ErrorQueueSuffix); base != routingKey {
+			if q, ok := t.Queue(base); ok && q.HasErrorQueue() {
+				return []string{routingKey}
+			}
+		}
+		return nil
+	}
+
+	kind := "direct"
+	if e, ok := t.Exchange(exchange); ok {
+		kind = e.Type
+	}
+
+	var queues []string
+	seen := make(map[string]bool)
+	for _, b := range t.Bindings {
+		if b.Exchange != exchange || seen[b.Queue] {
+			continue
+		}
+		var match bool
+		switch kind {
+		case "fanout":
+			match = true
+		case "topic":
+			match = MatchTopic(b.RoutingKey, routingKey)
+		default:
+			match = b.RoutingKey == routingKey
+		}
+		if match {
+			seen[b.Queue] = true
+			queues = append(queues, b.Queue)
+		}
+	}
+	return queues
+}
+
+// MatchTopic reports whether a routing key matches a topic binding pattern
+// ("*" matches one word, "#" zero or more)
+func MatchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
+
+// Expand returns the topology with retry and error queue settings turned into
+// the concrete exchanges, queues and bindings that are declared on the broker.
+// Error queues are unbound: poison messages are published to them through the
+// default exchange.
+func (t *Topology) Expand() *Topology {
+	out := &Topology{}
+	out.Exchanges = append(out.Exchanges, t.Exchanges...)
+	out.Bindings = append(out.Bindings, t.Bindings...)
+
+	for _, q := range t.Queues {
+		if q.HasErrorQueue() {
+			disabled := false
+			out.Queues = append(out.Queues, QueueSpec{
+				Name:       q.Name + ErrorQueueSuffix,
+				Type:       q.Type,
+				ErrorQueue: &disabled,
+			})
+		}
+
+		if q.Retry == nil {
+			out.Queues = append(out.Queues, q)
+			continue
+		}
+
+		binding, _ := t.firstBinding(q.Name)
+		retryExchange := binding.Exchange + RetrySuffix
+		retryKey := ""
+		if binding.RoutingKey != "" {
+			retryKey = binding.RoutingKey + RetrySuffix
+		}
+
+		if out.exchangeIndex(retryExchange) < 0 {
+			exchangeType := "direct"
+			if e, ok := t.Exchange(binding.Exchange); ok {
+				exchangeType = e.Type
+			}
+			out.Exchanges = append(out.Exchanges, ExchangeSpec{Name: retryExchange, Type: exchangeType})
+		}
+
+		primary := q
+		primary.Retry = nil
+		primary.DeadLetterExchange = retryExchange
+		primary.DeadLetterRoutingKey = retryKey
+		out.Queues = append(out.Queues, primary)
+
+		out.Queues = append(out.Queues, QueueSpec{
+			Name:                 q.Name + QueueRetrySuffix,
+			Type:                 q.Type,
+			DeadLetterExchange:   binding.Exchange,
+			DeadLetterRoutingKey: binding.RoutingKey,
+			MessageTTL:           q.Retry.Interval,
+		})
+		out.Bindings = append(out.Bindings, BindingSpec{
+			Exchange:   retryExchange,
+			Queue:      q.Name + QueueRetrySuffix,
+			RoutingKey: retryKey,
+		})
+	}
+	return out
+}
+
+// queueArgs builds the x-arguments of a queue declaration
+func (q QueueSpec) queueArgs() amqp.Table {
+	args := amqp.Table{"x-queue-type": q.Type}
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL
+	}
+	for k, v := range q.Arguments {
+		args[k] = v
+	}
+	return args
+}
+
+// Apply declares the expanded topology on the channel. Declarations are idempotent;
+// an existing entity with different settings makes the broker reject the declaration.
+func (t *Topology) Apply(ch IAMQPChannel) error {
+	expanded := t.Expand()
+
+	for _, e := range expanded.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Type, true, e.AutoDelete, e.Internal, false, amqp.Table(e.Arguments)); err != nil {
+			helper.LogError("AMQP topology exchange declare failed", err, e.Name, map[string]interface{}{
+				"exchange_name": e.Name,
+				"exchange_type": e.Type,
+			})
+			return fmt.Errorf("declare exchange %s: %w", e.Name, err)
+		}
+	}
+	for _, q := range expanded.Queues {
+		if _, err := ch.QueueDeclare(q.Name, true, false, false, false, q.queueArgs()); err != nil {
+			helper.LogError("AMQP topology queue declare failed", err, q.Name, map[string]interface{}{
+				"queue":      q.Name,
+				"queue_type": q.Type,
+			})
+			return fmt.Errorf("declare queue %s: %w", q.Name, err)
+		}
+	}
+	for _, b := range expanded.Bindings {
+		if err := ch.QueueBind(b.Queue, b.RoutingKey, b.Exchange, false, amqp.Table(b.Arguments)); err != nil {
+			helper.LogError("AMQP topology queue bind failed", err, b.Queue, map[string]interface{}{
+				"queue":       b.Queue,
+				"routing_key": b.RoutingKey,
+				"exchange":    b.Exchange,
+			})
+			return fmt.Errorf("bind queue %s to %s: %w", b.Queue, b.Exchange, err)
+		}
+	}
+
+	helper.LogInfo("AMQP topology applied", map[string]interface{}{
+		"exchanges": len(expanded.Exchanges),
+		"queues":    len(expanded.Queues),
+		"bindings":  len(expanded.Bindings),
+	})
+	return nil
+}
+
+// TopologyChange is one line of a topology diff
+type TopologyChange struct {
+	Action string // create, ok, conflict
+	Kind   string // exchange, queue
+	Name   string
+	Detail string
+}
+
+// Diff compares the expanded topology with the broker. AMQP cannot list
+// bindings or read arguments, so existing entities are re-declared with the
+// desired settings: a no-op when they match and a precondition failure when
+// they differ. Missing entities are reported, never created.
+func (t *Topology) Diff(conn IAMQPConnection) ([]TopologyChange, error) {
+	expanded := t.Expand()
+	var changes []TopologyChange
+
+	// Every failed check closes the channel, so each check gets its own
+	check := func(fn func(ch IAMQPChannel) error) error {
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		defer ch.Close()
+		return fn(ch)
+	}
+
+	for _, e := range expanded.Exchanges {
+		change := TopologyChange{Kind: "exchange", Name: e.Name}
+		err := check(func(ch IAMQPChannel) error {
+			return ch.ExchangeDeclarePassive(e.Name, e.Type, true, e.AutoDelete, e.Internal, false, nil)
+		})
+		if err != nil {
+			if !isNotFound(err) {
+				return nil, err
+			}
+			change.Action, change.Detail = "create", e.Type
+			changes = append(changes, change)
+			continue
+		}
+		err = check(func(ch IAMQPChannel) error {
+			return ch.ExchangeDeclare(e.Name, e.Type, true, e.AutoDelete, e.Internal, false, amqp.Table(e.Arguments))
+		})
+		change.Action, change.Detail = diffResult(err)
+		changes = append(changes, change)
+	}
+
+	for _, q := range expanded.Queues {
+		change := TopologyChange{Kind: "queue", Name: q.Name}
+		var state amqp.Queue
+		err := check(func(ch IAMQPChannel) error {
+			var err error
+			state, err = ch.QueueInspect(q.Name)
+			return err
+		})
+		if err != nil {
+			if !isNotFound(err) {
+				return nil, err
+			}
+			change.Action, change.Detail = "create", q.Type
+			changes = append(changes, change)
+			continue
+		}
+		err = check(func(ch IAMQPChannel) error {
+			_, err := ch.QueueDeclare(q.Name, true, false, false, false, q.queueArgs())
+			return err
+		})
+		change.Action, change.Detail = diffResult(err)
+		if change.Action == "ok" {
+			change.Detail = fmt.Sprintf("%d messages, %d consumers", state.Messages, state.Consumers)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func diffResult(err error) (string, string) {
+	if err == nil {
+		return "ok", ""
+	}
+	if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.PreconditionFailed {
+		return "conflict", amqpErr.Reason
+	}
+	return "conflict", err.Error()
+}
+
+func isNotFound(err error) bool {
+	amqpErr, ok := err.(*amqp.Error)
+	return ok && amqpErr.Code == amqp.NotFound
+}
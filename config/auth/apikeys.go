@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidAPIKey is returned for an API key no service holds
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// Service is the caller authenticated by an API key
+type Service struct {
+	Name   string   // service the key belongs to
+	KeyID  uint     // ID of a stored key, 0 for AUTH_API_KEYS keys
+	Scopes []string // permissions of the key
+}
+
+// APIKeys authenticates services by the static API keys of AUTH_API_KEYS.
+// They carry no scopes: they only open routes without permission checks.
+type APIKeys struct {
+	services map[string][sha256.Size]byte
+}
+
+// ParseAPIKeys parses "service:key" pairs separated by commas (AUTH_API_KEYS)
+func ParseAPIKeys(s string) (*APIKeys, error) {
+	keys := &APIKeys{services: map[string][sha256.Size]byte{}}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		service, key, ok := strings.Cut(pair, ":")
+		if !ok || service == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key of %q (want service:key)", service)
+		}
+		if _, dup := keys.services[service]; dup {
+			return nil, fmt.Errorf("duplicate API key service %q", service)
+		}
+		keys.services[service] = sha256.Sum256([]byte(key))
+	}
+	return keys, nil
+}
+
+// AuthenticateAPIKey returns the service holding key. Digests are compared in
+// constant time so the comparison does not leak how much of a key matched.
+func (k *APIKeys) AuthenticateAPIKey(key string) (*Service, error) {
+	digest := sha256.Sum256([]byte(key))
+	for service, expected := range k.services {
+		if subtle.ConstantTimeCompare(digest[:], expected[:]) == 1 {
+			return &Service{Name: service}, nil
+		}
+	}
+	return nil, ErrInvalidAPIKey
+}
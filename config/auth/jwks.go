@@ -0,0 +1,401 @@
+package auth
+
+import (
+	"boilerblade/helper"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSRefresh is how often the JWKS is fetched again in the background
+	DefaultJWKSRefresh = time.Hour
+	// DefaultJWKSMinRefresh is the minimum time between two fetches triggered by
+	// an unknown kid, so tokens with random kids cannot hammer the identity provider
+	DefaultJWKSMinRefresh = time.Minute
+	// DefaultJWKSTimeout bounds one fetch of the JWKS URL
+	DefaultJWKSTimeout = 10 * time.Second
+)
+
+// Asymmetric algorithms accepted with JWKS keys
+var asymmetricMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// JWKSOptions configures a JWKS; exactly one of URL and File is set
+type JWKSOptions struct {
+	URL  string // fetched over HTTP(S)
+	File string // read from disk
+
+	Refresh    time.Duration // background refresh interval, default DefaultJWKSRefresh
+	MinRefresh time.Duration // minimum interval of refreshes for an unknown kid, default DefaultJWKSMinRefresh
+	Client     *http.Client  // default a client with DefaultJWKSTimeout
+}
+
+// JWKS caches the public keys of a JSON Web Key Set (RFC 7517) by kid. Keys are
+// fetched again every Refresh interval, and when a token names a kid the cache
+// does not know (the provider rotated its keys); a failed fetch keeps the
+// cached keys.
+type JWKS struct {
+	opts JWKSOptions
+
+	mu          sync.RWMutex
+	keys        map[string]jwk
+	lastRefresh time.Time
+
+	refreshMu sync.Mutex
+}
+
+// jwk is a parsed key of the set
+type jwk struct {
+	alg string // optional alg the key is restricted to
+	key interface{}
+}
+
+// rawJWK is a key as found in the JWKS document
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWKS creates a JWKS; call Start to load it
+func NewJWKS(opts JWKSOptions) (*JWKS, error) {
+	if (opts.URL == "") == (opts.File == "") {
+		return nil, errors.New("jwks: exactly one of URL and File must be set")
+	}
+	if opts.Refresh <= 0 {
+		opts.Refresh = DefaultJWKSRefresh
+	}
+	if opts.MinRefresh <= 0 {
+		opts.MinRefresh = DefaultJWKSMinRefresh
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultJWKSTimeout}
+	}
+	return &JWKS{opts: opts, keys: map[string]jwk{}}, nil
+}
+
+// Start loads the keys and refreshes them in the background until ctx is done.
+// The error of the first load is returned, but the refresh loop runs anyway so
+// the keys show up once the provider is reachable.
+func (j *JWKS) Start(ctx context.Context) error {
+	err := j.Refresh(ctx)
+	go j.refreshLoop(ctx)
+	return err
+}
+
+func (j *JWKS) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(j.opts.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh fetches the key set and replaces the cached keys. On failure the
+// cached keys are kept and the error is logged and returned.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.refresh(ctx)
+}
+
+// refreshIfStale refreshes the set unless it was refreshed within MinRefresh;
+// concurrent callers wait for one fetch
+func (j *JWKS) refreshIfStale(ctx context.Context) {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	j.mu.RLock()
+	stale := time.Since(j.lastRefresh) >= j.opts.MinRefresh
+	j.mu.RUnlock()
+	if stale {
+		j.refresh(ctx)
+	}
+}
+
+// refresh loads the set; the caller holds refreshMu
+func (j *JWKS) refresh(ctx context.Context) error {
+	keys, err := j.load(ctx)
+
+	j.mu.Lock()
+	j.lastRefresh = time.Now()
+	if err == nil {
+		j.keys = keys
+	}
+	j.mu.Unlock()
+
+	if err != nil {
+		helper.LogError("Failed to refresh JWKS", err, "", map[string]interface{}{
+			"source": "JWKS.Refresh",
+			"jwks":   j.source(),
+		})
+		return err
+	}
+	helper.LogInfo("JWKS refreshed", map[string]interface{}{
+		"source": "JWKS.Refresh",
+		"jwks":   j.source(),
+		"keys":   len(keys),
+	})
+	return nil
+}
+
+// Kids returns the kids of the cached keys
+func (j *JWKS) Kids() []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	kids := make([]string, 0, len(j.keys))
+	for kid := range j.keys {
+		kids = append(kids, kid)
+	}
+	return kids
+}
+
+// Key returns the public key of kid for a token signed with alg. An unknown kid
+// refreshes the set first, at most once per MinRefresh. A token without kid is
+// accepted only when the set holds a single key usable with alg.
+func (j *JWKS) Key(kid, alg string) (interface{}, error) {
+	if key, err := j.lookup(kid, alg); !errors.Is(err, ErrUnknownKey) {
+		return key, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultJWKSTimeout)
+	defer cancel()
+	j.refreshIfStale(ctx)
+	return j.lookup(kid, alg)
+}
+
+func (j *JWKS) lookup(kid, alg string) (interface{}, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if kid == "" {
+		var found *jwk
+		for _, k := range j.keys {
+			if k.accepts(alg) {
+				if found != nil {
+					return nil, fmt.Errorf("%w: token has no kid and the JWKS has several %s keys", ErrUnknownKey, alg)
+				}
+				found = &k
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%w: no %s key in the JWKS", ErrUnknownKey, alg)
+		}
+		return found.key, nil
+	}
+
+	k, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+	if !k.accepts(alg) {
+		return nil, fmt.Errorf("%w: key %q cannot verify %s", ErrUnsupportedAlgorithm, kid, alg)
+	}
+	return k.key, nil
+}
+
+// accepts reports whether the key can verify a token signed with alg
+func (k jwk) accepts(alg string) bool {
+	if k.alg != "" && k.alg != alg {
+		return false
+	}
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return true
+		}
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return key.Curve == elliptic.P256()
+		case "ES384":
+			return key.Curve == elliptic.P384()
+		case "ES512":
+			return key.Curve == elliptic.P521()
+		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+func (j *JWKS) source() string {
+	if j.opts.URL != "" {
+		return j.opts.URL
+	}
+	return j.opts.File
+}
+
+// load reads and parses the key set
+func (j *JWKS) load(ctx context.Context) (map[string]jwk, error) {
+	var data []byte
+	var err error
+	if j.opts.File != "" {
+		data, err = os.ReadFile(j.opts.File)
+	} else {
+		data, err = j.fetch(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.opts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := j.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: GET %s: %s", j.opts.URL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS parses a JWKS document. Keys that are not signature keys or of an
+// unsupported type are skipped; a set without usable key is an error.
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var doc struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := map[string]jwk{}
+	for i, raw := range doc.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		key, err := raw.publicKey()
+		if err != nil {
+			helper.LogError("Skipping JWKS key", err, "", map[string]interface{}{
+				"source": "parseJWKS",
+				"kid":    raw.Kid,
+				"index":  i,
+			})
+			continue
+		}
+		if _, dup := keys[raw.Kid]; dup {
+			return nil, fmt.Errorf("jwks: duplicate kid %q", raw.Kid)
+		}
+		keys[raw.Kid] = jwk{alg: raw.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no usable signing key")
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key material of raw
+func (raw rawJWK) publicKey() (interface{}, error) {
+	switch raw.Kty {
+	case "RSA":
+		n, err := decodeBase64URL("n", raw.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL("e", raw.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key of %d bits is too short", key.N.BitLen())
+		}
+		return key, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch raw.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", raw.Crv)
+		}
+		x, err := decodeBase64URL("x", raw.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL("y", raw.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid %s coordinates", raw.Crv)
+		}
+		point := append(append([]byte{4}, x...), y...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+
+	case "OKP":
+		if raw.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", raw.Crv)
+		}
+		x, err := decodeBase64URL("x", raw.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", raw.Kty)
+	}
+}
+
+func decodeBase64URL(name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing %q", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q: %w", name, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrUnknownKey is returned when no key matches the kid of a token
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrUnsupportedAlgorithm is returned for a token signed with an algorithm
+	// no configured key can verify
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// HMAC algorithms accepted with HMAC keys
+var hmacMethods = []string{"HS256", "HS384", "HS512"}
+
+// Keyring holds the keys access tokens are verified with: HMAC secrets by kid
+// (our own tokens) and optionally a JWKS (tokens of an identity provider).
+type Keyring struct {
+	hmac map[string][]byte
+	jwks *JWKS
+}
+
+// NewKeyring creates a keyring. hmacKeys maps a kid to its secret; the "" kid
+// verifies tokens without a kid header (APP_KEY). jwks may be nil.
+func NewKeyring(hmacKeys map[string][]byte, jwks *JWKS) *Keyring {
+	keys := make(map[string][]byte, len(hmacKeys))
+	for kid, key := range hmacKeys {
+		if len(key) > 0 {
+			keys[kid] = key
+		}
+	}
+	return &Keyring{hmac: keys, jwks: jwks}
+}
+
+// ParseHMACKeys parses "kid:secret" pairs separated by commas (AUTH_HMAC_KEYS)
+func ParseHMACKeys(s string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid HMAC key %q (want kid:secret)", pair)
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, fmt.Errorf("duplicate HMAC key id %q", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// HMACKey returns the HMAC secret of kid
+func (k *Keyring) HMACKey(kid string) ([]byte, bool) {
+	key, ok := k.hmac[kid]
+	return key, ok
+}
+
+// JWKS returns the JWKS of the keyring, nil when none is configured
+func (k *Keyring) JWKS() *JWKS {
+	return k.jwks
+}
+
+// Methods returns the signing algorithms the keyring can verify, for jwt.WithValidMethods
+func (k *Keyring) Methods() []string {
+	var methods []string
+	if len(k.hmac) > 0 {
+		methods = append(methods, hmacMethods...)
+	}
+	if k.jwks != nil {
+		methods = append(methods, asymmetricMethods...)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Keyfunc selects the verification key of token by its alg and kid headers; it
+// is a jwt.Keyfunc. HMAC tokens are verified with the HMAC secrets only and
+// asymmetric ones with the JWKS only, so a public key is never used as an HMAC secret.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		key, ok := k.hmac[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+		}
+		return key, nil
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		if k.jwks == nil {
+			return nil, fmt.Errorf("%w: %s (no JWKS configured)", ErrUnsupportedAlgorithm, token.Method.Alg())
+		}
+		return k.jwks.Key(kid, token.Method.Alg())
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, token.Method.Alg())
+	}
+}
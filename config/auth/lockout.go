@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// LoginFailuresKeyPrefix prefixes the failed login counter of an account
+	// ("login-failures:<email>"), kept for the lockout window
+	LoginFailuresKeyPrefix = "login-failures:"
+	// LoginLockedKeyPrefix prefixes the lock of an account ("login-locked:<email>")
+	LoginLockedKeyPrefix = "login-locked:"
+)
+
+// recordFailure counts a failed login in the window started by the first one;
+// the failure reaching the limit locks the account and clears the counter. It
+// returns the lock duration in milliseconds, 0 when not locked.
+var recordFailure = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if failures >= tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+	redis.call('DEL', KEYS[1])
+	return tonumber(ARGV[3])
+end
+return 0
+`)
+
+// LockoutOptions configures RedisLockout
+type LockoutOptions struct {
+	MaxAttempts int           // failed logins within Window that lock the account
+	Window      time.Duration // counting starts at the first failure
+	Duration    time.Duration // how long the account stays locked
+}
+
+// RedisLockout locks an account after too many failed logins, with counters
+// shared by every instance in Redis. Accounts are keyed by lowercased email,
+// so unknown emails are counted too and lockouts tell nothing about which
+// emails are registered.
+type RedisLockout struct {
+	client *redis.Client
+	opts   LockoutOptions
+}
+
+// NewRedisLockout creates a lockout on client
+func NewRedisLockout(client *redis.Client, opts LockoutOptions) *RedisLockout {
+	return &RedisLockout{client: client, opts: opts}
+}
+
+// Locked returns how long the account stays locked, 0 when it is not
+func (l *RedisLockout) Locked(ctx context.Context, email string) (time.Duration, error) {
+	ttl, err := l.client.PTTL(ctx, LoginLockedKeyPrefix+lockoutKey(email)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	if ttl < 0 {
+		// -2: no lock, -1: no expiry (never set by Fail)
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Fail records a failed login and returns how long the account is locked for
+// when it reached the limit, 0 otherwise
+func (l *RedisLockout) Fail(ctx context.Context, email string) (time.Duration, error) {
+	key := lockoutKey(email)
+	ms, err := recordFailure.Run(ctx, l.client,
+		[]string{LoginFailuresKeyPrefix + key, LoginLockedKeyPrefix + key},
+		l.opts.MaxAttempts, l.opts.Window.Milliseconds(), l.opts.Duration.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Reset clears the failures and the lock of the account, after a successful
+// login or a password reset
+func (l *RedisLockout) Reset(ctx context.Context, email string) error {
+	key := lockoutKey(email)
+	return l.client.Del(ctx, LoginFailuresKeyPrefix+key, LoginLockedKeyPrefix+key).Err()
+}
+
+// lockoutKey normalizes email the way logins match it
+func lockoutKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
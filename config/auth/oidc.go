@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultOIDCTimeout bounds one request to the identity provider
+const DefaultOIDCTimeout = 10 * time.Second
+
+// DefaultOIDCScopes are requested when OIDCOptions.Scopes is empty
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+var (
+	// ErrOIDCDiscovery is returned when the discovery document cannot be loaded
+	// or does not describe the configured issuer
+	ErrOIDCDiscovery = errors.New("oidc: discovery failed")
+	// ErrOIDCExchange is returned when the token endpoint refuses the code
+	ErrOIDCExchange = errors.New("oidc: code exchange failed")
+	// ErrOIDCInvalidIDToken is returned for an ID token that fails validation
+	ErrOIDCInvalidIDToken = errors.New("oidc: invalid ID token")
+)
+
+// OIDCOptions configures an OIDC relying party
+type OIDCOptions struct {
+	Issuer       string   // issuer URL; discovery is read from <Issuer>/.well-known/openid-configuration
+	ClientID     string   // also the audience of ID tokens
+	ClientSecret string   // sent with HTTP basic auth; empty for a public client
+	RedirectURL  string   // callback URL registered at the provider
+	Scopes       []string // default DefaultOIDCScopes; openid is always requested
+
+	Leeway time.Duration // clock skew tolerated on the ID token, default DefaultLeeway
+	Client *http.Client  // default a client with DefaultOIDCTimeout
+}
+
+// OIDCIdentity is the user an ID token was issued for
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCProvider is the relying party of one OpenID Connect provider: it builds
+// authorization URLs (code flow with PKCE), exchanges codes and validates ID
+// tokens. The discovery document is loaded on first use and again after a
+// failure, so a provider that is down at startup does not prevent it.
+type OIDCProvider struct {
+	opts OIDCOptions
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	verifier  *Verifier
+}
+
+// oidcDiscovery is the part of the discovery document the relying party uses
+type oidcDiscovery struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+// NewOIDCProvider creates a relying party; nothing is fetched until it is used
+func NewOIDCProvider(opts OIDCOptions) (*OIDCProvider, error) {
+	if opts.Issuer == "" || opts.ClientID == "" || opts.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client ID and redirect URL are required")
+	}
+	opts.Issuer = strings.TrimSuffix(opts.Issuer, "/")
+	if len(opts.Scopes) == 0 {
+		opts.Scopes = DefaultOIDCScopes
+	}
+	if !slices.Contains(opts.Scopes, "openid") {
+		opts.Scopes = append([]string{"openid"}, opts.Scopes...)
+	}
+	if opts.Leeway <= 0 {
+		opts.Leeway = DefaultLeeway
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultOIDCTimeout}
+	}
+	return &OIDCProvider{opts: opts}, nil
+}
+
+// Issuer returns the issuer URL, which identifies the provider of external identities
+func (p *OIDCProvider) Issuer() string {
+	return p.opts.Issuer
+}
+
+// discover returns the discovery document and the ID token verifier, loading
+// them on first use
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, *Verifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.verifier, nil
+	}
+
+	doc, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrOIDCDiscovery, err)
+	}
+	// The JWKS is fetched when the first ID token names a kid it does not know
+	jwks, err := NewJWKS(JWKSOptions{URL: doc.JWKSURI, Client: p.opts.Client})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrOIDCDiscovery, err)
+	}
+	p.discovery = doc
+	p.verifier = NewVerifier(NewKeyring(nil, jwks), ClaimsOptions{
+		Issuers:   []string{p.opts.Issuer},
+		Audiences: []string{p.opts.ClientID},
+		Leeway:    p.opts.Leeway,
+		Required:  []string{"exp", "iat", "sub"},
+	})
+	return p.discovery, p.verifier, nil
+}
+
+func (p *OIDCProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.opts.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	// The issuer must match exactly, or tokens of another issuer could be accepted
+	if strings.TrimSuffix(doc.Issuer, "/") != p.opts.Issuer {
+		return nil, fmt.Errorf("issuer %q does not match %q", doc.Issuer, p.opts.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("authorization_endpoint, token_endpoint and jwks_uri are required")
+	}
+	if len(doc.CodeChallengeMethodsSupported) > 0 && !slices.Contains(doc.CodeChallengeMethodsSupported, "S256") {
+		return nil, errors.New("provider does not support PKCE with S256")
+	}
+	return &doc, nil
+}
+
+// AuthCodeURL returns the authorization endpoint URL the user is redirected to.
+// state and nonce are random values checked on the callback, codeChallenge is
+// PKCEChallenge of the code verifier kept until then.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.opts.ClientID},
+		"redirect_uri":          {p.opts.RedirectURL},
+		"scope":                 {strings.Join(p.opts.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens at the token endpoint and
+// returns the identity of the validated ID token; nonce is the value sent with
+// AuthCodeURL
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	doc, _, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.opts.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.opts.ClientSecret == "" {
+		form.Set("client_id", p.opts.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrOIDCExchange, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s %s", ErrOIDCExchange, resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in the response", ErrOIDCExchange)
+	}
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature (JWKS of the provider), issuer, audience,
+// expiry and nonce of an ID token and returns its identity
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, idToken, nonce string) (*OIDCIdentity, error) {
+	_, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifier.Verify(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidIDToken, err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); nonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidIDToken)
+	}
+	// With several audiences, the authorized party must be this client
+	audiences, _ := claims.GetAudience()
+	azp, hasAZP := claims["azp"].(string)
+	if (len(audiences) > 1 || hasAZP) && azp != p.opts.ClientID {
+		return nil, fmt.Errorf("%w: authorized party %q is not the client", ErrOIDCInvalidIDToken, azp)
+	}
+
+	identity := &OIDCIdentity{Issuer: p.opts.Issuer}
+	identity.Subject, _ = claims.GetSubject()
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.EmailVerified = claimBool(claims, "email_verified")
+	return identity, nil
+}
+
+// claimBool reads a boolean claim; some providers send "true" as a string
+func claimBool(claims jwt.MapClaims, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier (RFC 7636), 43 characters
+func NewPKCEVerifier() (string, error) {
+	return randomToken(32)
+}
+
+// PKCEChallenge returns the S256 code challenge of verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewOIDCNonce returns a random value for the state or nonce parameter
+func NewOIDCNonce() (string, error) {
+	return randomToken(24)
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"boilerblade/helper"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultRevocationCacheTTL is how long a lookup is cached locally; it bounds
+	// how stale an instance is when an invalidation message is lost
+	DefaultRevocationCacheTTL = 30 * time.Second
+	// revocationCacheSize bounds the local cache; it is emptied when full
+	revocationCacheSize = 100000
+)
+
+// Cache keys of Revocations, also sent as invalidation messages
+const (
+	tokenKeyPrefix = "jti:"
+	userKeyPrefix  = "user:"
+)
+
+// RevocationStore keeps revoked token IDs (jti) and per-user watermarks:
+// tokens of a user issued before its watermark are revoked
+type RevocationStore interface {
+	// RevokeToken revokes jti until the token expires at expiresAt
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUserTokens revokes the tokens of userID issued before before
+	RevokeUserTokens(ctx context.Context, userID string, before time.Time) error
+	TokenRevoked(ctx context.Context, jti string) (bool, error)
+	// UserTokensRevokedBefore returns the watermark of userID, zero when none
+	UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error)
+}
+
+// RevocationNotifier is implemented by stores shared between instances. Listen
+// calls invalidate with the cache key of every revocation made by any instance,
+// and with "" when messages may have been missed, until ctx is done.
+type RevocationNotifier interface {
+	Listen(ctx context.Context, invalidate func(key string))
+}
+
+// RevocationOptions configures Revocations
+type RevocationOptions struct {
+	CacheTTL time.Duration // default DefaultRevocationCacheTTL
+	// Leeway is added to the lifetime of revoked token IDs, as tokens are
+	// accepted that long after exp
+	Leeway time.Duration
+	// FailOpen accepts tokens when the store cannot be reached; by default
+	// Check returns the store error
+	FailOpen bool
+}
+
+type revocationEntry struct {
+	revoked bool      // jti entries
+	before  time.Time // user entries
+	expires time.Time
+}
+
+// Revocations checks tokens against a RevocationStore, with a local cache so
+// most requests do not reach the store. Revocations made through it are
+// evicted at once; those of other instances when the store notifies them.
+type Revocations struct {
+	store RevocationStore
+	opts  RevocationOptions
+
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+	// generation counts invalidations, so a lookup that raced with one is
+	// not cached
+	generation uint64
+}
+
+// NewRevocations creates revocations on store
+func NewRevocations(store RevocationStore, opts RevocationOptions) *Revocations {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultRevocationCacheTTL
+	}
+	return &Revocations{
+		store:   store,
+		opts:    opts,
+		entries: make(map[string]revocationEntry),
+	}
+}
+
+// Start listens for the revocations of other instances until ctx is done, when
+// the store notifies them
+func (r *Revocations) Start(ctx context.Context) {
+	if notifier, ok := r.store.(RevocationNotifier); ok {
+		go notifier.Listen(ctx, r.Invalidate)
+	}
+}
+
+// Invalidate drops the cached lookup of key, or every lookup when key is ""
+func (r *Revocations) Invalidate(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	if key == "" {
+		r.entries = make(map[string]revocationEntry)
+		return
+	}
+	delete(r.entries, key)
+}
+
+// RevokeToken revokes the token jti, which expires at expiresAt
+func (r *Revocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := r.store.RevokeToken(ctx, jti, expiresAt.Add(r.opts.Leeway)); err != nil {
+		return err
+	}
+	r.Invalidate(tokenKeyPrefix + jti)
+	return nil
+}
+
+// RevokeUserTokens revokes every token of userID issued before before. iat has
+// second precision, so the watermark is before rounded up to the next second:
+// the tokens issued in the second of before are revoked too. It returns once
+// the watermark has passed, so a login right after it (e.g. after a password
+// change) gets a token issued at or after the watermark.
+func (r *Revocations) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	watermark := before.Truncate(time.Second)
+	if watermark.Before(before) {
+		watermark = watermark.Add(time.Second)
+	}
+	if err := r.store.RevokeUserTokens(ctx, userID, watermark); err != nil {
+		return err
+	}
+	r.Invalidate(userKeyPrefix + userID)
+
+	timer := time.NewTimer(time.Until(watermark))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UserTokensRevokedBefore returns the watermark of userID, zero when none
+func (r *Revocations) UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	entry, generation, ok := r.cached(userKeyPrefix + userID)
+	if ok {
+		return entry.before, nil
+	}
+	before, err := r.store.UserTokensRevokedBefore(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.cache(userKeyPrefix+userID, revocationEntry{before: before}, time.Time{}, generation)
+	return before, nil
+}
+
+// Check returns a *ValidationError with ReasonRevoked when the jti of token is
+// revoked or the token was issued before the watermark of its user. A token
+// without iat is revoked by any watermark of its user. Watermarks are kept by
+// Token.Subject, so those of local users never apply to the tokens of an
+// identity provider with the same sub.
+func (r *Revocations) Check(ctx context.Context, token *Token) error {
+	err := r.check(ctx, token.Claims, token.Subject())
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ValidationError); !ok && r.opts.FailOpen {
+		helper.LogError("Token revocation check failed, token accepted", err, "", map[string]interface{}{
+			"source": "Revocations.Check",
+		})
+		return nil
+	}
+	return err
+}
+
+func (r *Revocations) check(ctx context.Context, claims jwt.MapClaims, userID string) error {
+	if jti, _ := claims["jti"].(string); jti != "" {
+		revoked, err := r.tokenRevoked(ctx, jti, claims)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return &ValidationError{Reason: ReasonRevoked}
+		}
+	}
+
+	if userID == "" {
+		return nil
+	}
+	before, err := r.UserTokensRevokedBefore(ctx, userID)
+	if err != nil || before.IsZero() {
+		return err
+	}
+	// Watermarks are whole seconds, see RevokeUserTokens
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil || issuedAt.Before(before) {
+		return &ValidationError{Reason: ReasonRevoked, Detail: "issued before the tokens of its user were revoked"}
+	}
+	return nil
+}
+
+// tokenRevoked looks jti up; a revoked jti stays cached until the token expires
+func (r *Revocations) tokenRevoked(ctx context.Context, jti string, claims jwt.MapClaims) (bool, error) {
+	key := tokenKeyPrefix + jti
+	entry, generation, ok := r.cached(key)
+	if ok {
+		return entry.revoked, nil
+	}
+	revoked, err := r.store.TokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	var until time.Time
+	if exp, _ := claims.GetExpirationTime(); revoked && exp != nil {
+		until = exp.Add(r.opts.Leeway)
+	}
+	r.cache(key, revocationEntry{revoked: revoked}, until, generation)
+	return revoked, nil
+}
+
+// cached returns the cached lookup of key, and the generation to cache a
+// fresh lookup with
+func (r *Revocations) cached(key string) (revocationEntry, uint64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return revocationEntry{}, r.generation, false
+	}
+	return entry, r.generation, true
+}
+
+// cache stores entry for the cache TTL, or until until when it is later,
+// unless an invalidation happened since generation
+func (r *Revocations) cache(key string, entry revocationEntry, until time.Time, generation uint64) {
+	entry.expires = time.Now().Add(r.opts.CacheTTL)
+	if until.After(entry.expires) {
+		entry.expires = until
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation != generation {
+		return
+	}
+	if len(r.entries) >= revocationCacheSize {
+		r.entries = make(map[string]revocationEntry)
+	}
+	r.entries[key] = entry
+}
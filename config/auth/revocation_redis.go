@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RevokedTokenKeyPrefix prefixes the key of a revoked jti ("revoked-jti:<jti>")
+	RevokedTokenKeyPrefix = "revoked-jti:"
+	// RevokedUserKeyPrefix prefixes the watermark of a user ("revoked-before:<user>"),
+	// in Unix milliseconds
+	RevokedUserKeyPrefix = "revoked-before:"
+	// RevocationChannel carries the cache keys of revocations to every instance
+	RevocationChannel = "auth-revocations"
+)
+
+// setWatermark keeps the latest of the stored and the new watermark
+var setWatermark = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current or tonumber(current) < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// RedisRevocationStore keeps revocations in Redis and publishes them on
+// RevocationChannel; it implements RevocationStore and RevocationNotifier
+type RedisRevocationStore struct {
+	client *redis.Client
+	// retention is how long a watermark is kept: the longest a token issued
+	// before it can stay valid
+	retention time.Duration
+}
+
+// NewRedisRevocationStore creates a store on client; watermarks are kept for
+// retention
+func NewRedisRevocationStore(client *redis.Client, retention time.Duration) *RedisRevocationStore {
+	return &RedisRevocationStore{client: client, retention: retention}
+}
+
+// RevokeToken stores jti until expiresAt; an expired token is not stored
+func (s *RedisRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, RevokedTokenKeyPrefix+jti, 1, ttl).Err(); err != nil {
+		return err
+	}
+	return s.publish(ctx, tokenKeyPrefix+jti)
+}
+
+// RevokeUserTokens stores the watermark of userID, unless a later one is stored
+func (s *RedisRevocationStore) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	err := setWatermark.Run(ctx, s.client, []string{RevokedUserKeyPrefix + userID}, before.UnixMilli(), s.retention.Milliseconds()).Err()
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, userKeyPrefix+userID)
+}
+
+// TokenRevoked tells whether jti is revoked
+func (s *RedisRevocationStore) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, RevokedTokenKeyPrefix+jti).Result()
+	return n > 0, err
+}
+
+// UserTokensRevokedBefore returns the watermark of userID, zero when none
+func (s *RedisRevocationStore) UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	ms, err := s.client.Get(ctx, RevokedUserKeyPrefix+userID).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// publish notifies the other instances; the revocation is stored already, so a
+// failure is logged and they catch up when their cache expires
+func (s *RedisRevocationStore) publish(ctx context.Context, key string) error {
+	if err := s.client.Publish(ctx, RevocationChannel, key).Err(); err != nil {
+		helper.LogError("Failed to publish token revocation", err, "", map[string]interface{}{
+			"source":  "RedisRevocationStore.publish",
+			"channel": RevocationChannel,
+			"key":     key,
+		})
+	}
+	return nil
+}
+
+// Listen subscribes to RevocationChannel until ctx is done. Everything is
+// invalidated on (re)subscription and on errors, when messages may be lost.
+func (s *RedisRevocationStore) Listen(ctx context.Context, invalidate func(key string)) {
+	pubsub := s.client.Subscribe(ctx, RevocationChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			helper.LogError("Token revocation subscription failed, retrying", err, "", map[string]interface{}{
+				"source":  "RedisRevocationStore.Listen",
+				"channel": RevocationChannel,
+			})
+			invalidate("")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			invalidate("")
+		case *redis.Message:
+			invalidate(m.Payload)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultLeeway is the clock skew tolerated on exp, nbf and iat
+const DefaultLeeway = 30 * time.Second
+
+// Rejection reasons of ValidationError
+const (
+	ReasonMalformed            = "malformed"
+	ReasonUnsupportedAlgorithm = "unsupported_algorithm"
+	ReasonUnknownKey           = "unknown_key"
+	ReasonInvalidSignature     = "invalid_signature"
+	ReasonExpired              = "expired"
+	ReasonNotYetValid          = "not_yet_valid"
+	ReasonIssuedInFuture       = "issued_in_future"
+	ReasonTooOld               = "too_old"
+	ReasonInvalidIssuer        = "invalid_issuer"
+	ReasonInvalidAudience      = "invalid_audience"
+	ReasonMissingClaim         = "missing_claim"
+	ReasonRevoked              = "revoked"
+	ReasonInvalid              = "invalid"
+)
+
+// Claims that can be required; "sub" is satisfied by sub or user_id
+var requirableClaims = []string{"exp", "iat", "nbf", "iss", "aud", "sub", "jti"}
+
+// ClaimsOptions configures the claim checks of a Verifier
+type ClaimsOptions struct {
+	Issuers   []string      // accepted iss values (empty = any)
+	Audiences []string      // the aud of a token must contain one of them (empty = any)
+	Leeway    time.Duration // clock skew tolerated on exp, nbf, iat and MaxAge
+	MaxAge    time.Duration // maximum age since iat (0 = no limit); implies iat is required
+	Required  []string      // claims that must be present, see ParseRequiredClaims
+	// TrustedIssuers are the identity providers whose roles, permissions and
+	// scope claims are trusted (see Token.Trusted)
+	TrustedIssuers []string
+}
+
+// DefaultClaimsOptions requires exp and a subject, with DefaultLeeway
+func DefaultClaimsOptions() ClaimsOptions {
+	return ClaimsOptions{
+		Leeway:   DefaultLeeway,
+		Required: []string{"exp", "sub"},
+	}
+}
+
+// ParseRequiredClaims parses a comma separated list of claim names
+// (AUTH_REQUIRED_CLAIMS): exp, iat, nbf, iss, aud, jti, and sub, which a
+// user_id claim satisfies too
+func ParseRequiredClaims(s string) ([]string, error) {
+	var claims []string
+	for _, claim := range strings.Split(s, ",") {
+		claim = strings.TrimSpace(claim)
+		if claim == "" {
+			continue
+		}
+		if !slices.Contains(requirableClaims, claim) {
+			return nil, fmt.Errorf("unsupported required claim %q (want one of %s)", claim, strings.Join(requirableClaims, ", "))
+		}
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// ValidationError tells why a token was rejected. Its message is safe to return
+// to the client and to log: it never contains the token.
+type ValidationError struct {
+	Reason string // one of the Reason constants
+	Detail string // claim name or expected values, for the message
+	Alg    string // alg header, when the token could be decoded
+	Kid    string // kid header, when the token could be decoded
+	Err    error  // underlying parser error
+}
+
+func (e *ValidationError) Error() string {
+	message := "token " + strings.ReplaceAll(e.Reason, "_", " ")
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	return message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Fingerprint identifies a token in logs without revealing it: the first 12 hex
+// characters of its SHA-256
+func Fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Verifier checks the signature of access tokens with a Keyring and their
+// claims with ClaimsOptions
+type Verifier struct {
+	keyring *Keyring
+	opts    ClaimsOptions
+}
+
+// NewVerifier creates a verifier
+func NewVerifier(keyring *Keyring, opts ClaimsOptions) *Verifier {
+	if opts.MaxAge > 0 && !slices.Contains(opts.Required, "iat") {
+		opts.Required = append(slices.Clone(opts.Required), "iat")
+	}
+	return &Verifier{keyring: keyring, opts: opts}
+}
+
+// Token is an access token accepted by a Verifier
+type Token struct {
+	Claims jwt.MapClaims
+	// Local is true for the tokens of this app, signed with an HMAC secret of
+	// the keyring, and false for those of an identity provider, signed with a
+	// key of its JWKS
+	Local bool
+	// Trusted is true for local tokens and those of a TrustedIssuers provider:
+	// their roles, permissions and scope claims grant permissions
+	Trusted bool
+}
+
+// UserID returns the local user of the token: user_id, or sub, of a local
+// token. The sub of an identity provider is not a local user ID: "" for its
+// tokens (see Subject).
+func (t *Token) UserID() string {
+	if !t.Local {
+		return ""
+	}
+	if userID, ok := t.Claims["user_id"].(string); ok && userID != "" {
+		return userID
+	}
+	sub, _ := t.Claims["sub"].(string)
+	return sub
+}
+
+// Subject identifies the owner of the token: its UserID when local, else
+// "<iss>#<sub>", as a sub is only unique within its issuer
+func (t *Token) Subject() string {
+	if t.Local {
+		return t.UserID()
+	}
+	sub, _ := t.Claims["sub"].(string)
+	if sub == "" {
+		return ""
+	}
+	issuer, _ := t.Claims["iss"].(string)
+	return issuer + "#" + sub
+}
+
+// Verify parses token and returns its claims, or a *ValidationError
+func (v *Verifier) Verify(token string) (jwt.MapClaims, error) {
+	verified, err := v.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return verified.Claims, nil
+}
+
+// VerifyToken parses token and returns it with its origin, or a *ValidationError
+func (v *Verifier) VerifyToken(token string) (*Token, error) {
+	methods := v.keyring.Methods()
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(v.opts.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if slices.Contains(v.opts.Required, "exp") {
+		parserOptions = append(parserOptions, jwt.WithExpirationRequired())
+	}
+
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, v.keyring.Keyfunc, parserOptions...)
+	verr := &ValidationError{}
+	if parsed != nil {
+		verr.Alg, _ = parsed.Header["alg"].(string)
+		verr.Kid, _ = parsed.Header["kid"].(string)
+	}
+	if err != nil {
+		verr.Err = err
+		verr.Reason, verr.Detail = parseReason(err, verr.Alg, methods)
+		return nil, verr
+	}
+
+	if reason, detail := v.checkClaims(claims); reason != "" {
+		verr.Reason, verr.Detail = reason, detail
+		return nil, verr
+	}
+	_, local := parsed.Method.(*jwt.SigningMethodHMAC)
+	issuer, _ := claims.GetIssuer()
+	return &Token{
+		Claims:  claims,
+		Local:   local,
+		Trusted: local || slices.Contains(v.opts.TrustedIssuers, issuer),
+	}, nil
+}
+
+// parseReason maps an error of jwt.ParseWithClaims to a reason
+func parseReason(err error, alg string, methods []string) (string, string) {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonMalformed, ""
+	case errors.Is(err, ErrUnknownKey):
+		return ReasonUnknownKey, ""
+	case errors.Is(err, ErrUnsupportedAlgorithm):
+		return ReasonUnsupportedAlgorithm, alg
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		// The parser reports an algorithm outside methods as a signature error
+		if !slices.Contains(methods, alg) {
+			return ReasonUnsupportedAlgorithm, alg
+		}
+		return ReasonInvalidSignature, ""
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ReasonMissingClaim, "exp"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonExpired, ""
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return ReasonNotYetValid, ""
+	case errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonIssuedInFuture, ""
+	default:
+		return ReasonInvalid, ""
+	}
+}
+
+// checkClaims applies the required claims, issuer, audience and max age checks
+func (v *Verifier) checkClaims(claims jwt.MapClaims) (string, string) {
+	for _, claim := range v.opts.Required {
+		if !hasClaim(claims, claim) {
+			if claim == "sub" {
+				return ReasonMissingClaim, "sub or user_id"
+			}
+			return ReasonMissingClaim, claim
+		}
+	}
+
+	if len(v.opts.Issuers) > 0 {
+		issuer, _ := claims.GetIssuer()
+		if !slices.Contains(v.opts.Issuers, issuer) {
+			return ReasonInvalidIssuer, ""
+		}
+	}
+
+	if len(v.opts.Audiences) > 0 {
+		audiences, _ := claims.GetAudience()
+		if !slices.ContainsFunc(audiences, func(aud string) bool { return slices.Contains(v.opts.Audiences, aud) }) {
+			return ReasonInvalidAudience, ""
+		}
+	}
+
+	if v.opts.MaxAge > 0 {
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil {
+			return ReasonMissingClaim, "iat"
+		}
+		if time.Since(issuedAt.Time) > v.opts.MaxAge+v.opts.Leeway {
+			return ReasonTooOld, ""
+		}
+	}
+	return "", ""
+}
+
+// hasClaim reports whether claim is present and not empty
+func hasClaim(claims jwt.MapClaims, claim string) bool {
+	if claim == "sub" {
+		return hasClaim(claims, "user_id") || nonEmpty(claims["sub"])
+	}
+	return nonEmpty(claims[claim])
+}
+
+func nonEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,146 @@
+package broker
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"context"
+	"sync"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// amqpBroker runs on an AMQP connection; queues, exchanges and retry flows come from the applied topology
+type amqpBroker struct {
+	conn      amqp.IAMQPConnection
+	topology  *amqp.Topology
+	publisher *amqp.Publisher
+
+	mu       sync.Mutex
+	channel  amqp.IAMQPChannel // declaration channel, opened on first use
+	declared map[string]bool
+}
+
+// NewAMQP creates a broker on an AMQP connection with the default publisher options.
+// topology is the already applied topology; exchanges missing from it are declared
+// as direct on first publish.
+func NewAMQP(conn amqp.IAMQPConnection, topology *amqp.Topology) Broker {
+	opts := amqp.DefaultPublisherOptions()
+	opts.Mandatory = false
+	return NewAMQPWithOptions(conn, topology, opts)
+}
+
+// NewAMQPWithOptions creates a broker whose publishes wait for publisher confirms.
+// Events are fanned out to whoever subscribed, so opts.Mandatory is usually false.
+func NewAMQPWithOptions(conn amqp.IAMQPConnection, topology *amqp.Topology, opts amqp.PublisherOptions) Broker {
+	return &amqpBroker{
+		conn:      conn,
+		topology:  topology,
+		publisher: amqp.NewPublisher(conn, opts),
+		declared:  make(map[string]bool),
+	}
+}
+
+// Backend returns "amqp"
+func (b *amqpBroker) Backend() string {
+	return BackendAMQP
+}
+
+// Publish publishes msg through the confirm publisher and returns once the broker acked it
+func (b *amqpBroker) Publish(ctx context.Context, exchange, routingKey string, msg amqplib.Publishing) error {
+	if err := b.declare(exchange); err != nil {
+		return err
+	}
+	return b.publisher.Publish(ctx, exchange, routingKey, msg)
+}
+
+// declare declares exchange as direct the first time it is used when the topology does not know it
+func (b *amqpBroker) declare(exchange string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if exchange == "" || b.declared[exchange] {
+		return nil
+	}
+	if _, ok := b.topology.Exchange(exchange); !ok {
+		if b.channel == nil || b.channel.IsClosed() {
+			channel, err := b.conn.Channel()
+			if err != nil {
+				helper.LogError("Failed to get AMQP channel for publishing", err, "", map[string]interface{}{
+					"source": "amqpBroker.Publish",
+				})
+				return err
+			}
+			b.channel = channel
+		}
+		if err := b.channel.ExchangeDeclare(exchange, "direct", true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+	b.declared[exchange] = true
+	return nil
+}
+
+// Consume opens a dedicated channel for the queue
+func (b *amqpBroker) Consume(ctx context.Context, queue, consumer string, opts ...ConsumeOption) (Subscription, error) {
+	channel, err := b.conn.Channel()
+	if err != nil {
+		helper.LogError("Failed to get AMQP channel for consumer", err, "", map[string]interface{}{
+			"source":   "amqpBroker.Consume",
+			"queue":    queue,
+			"consumer": consumer,
+		})
+		return nil, err
+	}
+
+	if o := consumeOptions(opts); o.Prefetch > 0 {
+		if err := channel.SetPrefetch(o.Prefetch); err != nil {
+			channel.Close()
+			return nil, err
+		}
+	}
+
+	deliveries, err := channel.ReadMessage(ctx, amqplib.Queue{Name: queue})
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+	return &amqpSubscription{channel: channel, deliveries: deliveries}, nil
+}
+
+// Retries reports whether rejected messages of the queue are dead-lettered
+// (to its retry queue) rather than dropped
+func (b *amqpBroker) Retries(queue string) bool {
+	q, ok := b.topology.Queue(queue)
+	return ok && (q.Retry != nil || q.DeadLetterExchange != "")
+}
+
+// Close closes the publisher and declaration channels; the connection is owned by the caller
+func (b *amqpBroker) Close() error {
+	b.publisher.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.channel == nil {
+		return nil
+	}
+	err := b.channel.Close()
+	b.channel = nil
+	return err
+}
+
+// amqpSubscription is a consumer on its own AMQP channel
+type amqpSubscription struct {
+	channel    amqp.IAMQPChannel
+	deliveries <-chan amqplib.Delivery
+}
+
+// Deliveries returns the AMQP deliveries
+func (s *amqpSubscription) Deliveries() <-chan amqplib.Delivery {
+	return s.deliveries
+}
+
+// Close closes the channel; unacked deliveries are requeued by the broker
+func (s *amqpSubscription) Close() error {
+	return s.channel.Close()
+}
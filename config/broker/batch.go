@@ -0,0 +1,202 @@
+package broker
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+const (
+	// DefaultBatchSize is the number of deliveries collected per batch
+	DefaultBatchSize = 100
+	// DefaultBatchWait is how long a batch waits to fill after its first delivery
+	DefaultBatchWait = 500 * time.Millisecond
+)
+
+// BatchOptions configures ConsumeBatches
+type BatchOptions struct {
+	// Size is the maximum number of deliveries per batch (default DefaultBatchSize).
+	// Consume the queue WithPrefetch(Size), otherwise a batch cannot fill up.
+	Size int
+	// Wait is the longest a batch waits for more deliveries (default DefaultBatchWait)
+	Wait time.Duration
+	// MessageTimeout bounds the handling of a whole batch (default amqp.DefaultMessageTimeout)
+	MessageTimeout time.Duration
+	// Guard runs the batch handler, replacing MessageTimeout with its own timeout.
+	// Without one, panics are still recovered but do not pause the consumer.
+	Guard *Guard
+	// Queue and Consumer name the error queue and are recorded on parked messages
+	Queue    string
+	Consumer string
+}
+
+// BatchHandler handles a batch of decoded messages. errs[i] is the outcome of
+// items[i]; a nil slice means every item succeeded. Permanent errors (see
+// amqp.Permanent) park the message in the error queue, others requeue it. A
+// panic or a timeout sends the whole batch to the retry path (see Retry).
+type BatchHandler[T any] func(ctx context.Context, items []T) (errs []error)
+
+// ConsumeBatches reads sub until its deliveries are closed, collecting up to
+// Size deliveries or whatever arrived within Wait of the first one. Each
+// delivery is decoded (a decode error is permanent), the batch is handed to
+// handle, and the deliveries are settled: failures one by one, then the
+// successes with a single multiple-ack when the backend allows it.
+func ConsumeBatches[T any](ctx context.Context, b Broker, sub Subscription, opts BatchOptions, decode func(amqplib.Delivery) (T, error), handle BatchHandler[T]) {
+	if opts.Size <= 0 {
+		opts.Size = DefaultBatchSize
+	}
+	if opts.Wait <= 0 {
+		opts.Wait = DefaultBatchWait
+	}
+	if opts.Guard == nil {
+		opts.Guard = newGuard(opts.Consumer+"/"+opts.Queue, GuardOptions{Timeout: opts.MessageTimeout})
+	}
+
+	deliveries := sub.Deliveries()
+	for {
+		first, ok := <-deliveries
+		if !ok {
+			return
+		}
+		batch, open := collectBatch(deliveries, first, opts.Size, opts.Wait)
+		handleBatch(ctx, b, batch, opts, decode, handle)
+		if !open {
+			return
+		}
+	}
+}
+
+// collectBatch adds deliveries to first until size is reached or wait elapsed.
+// open is false when deliveries was closed meanwhile.
+func collectBatch(deliveries <-chan amqplib.Delivery, first amqplib.Delivery, size int, wait time.Duration) (batch []amqplib.Delivery, open bool) {
+	batch = append(make([]amqplib.Delivery, 0, size), first)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for len(batch) < size {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, d)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// handleBatch decodes and handles one batch through opts.Guard, then settles
+// every delivery of it
+func handleBatch[T any](ctx context.Context, b Broker, batch []amqplib.Delivery, opts BatchOptions, decode func(amqplib.Delivery) (T, error), handle BatchHandler[T]) {
+	// The handler goroutine is abandoned on a timeout and may still finish
+	// later: its outcome is handed over, never shared, and only read on success
+	results := make(chan []error, 1)
+	err := opts.Guard.Run(ctx, batch[0], func(ctx context.Context) error {
+		results <- runBatch(ctx, batch, decode, handle)
+		return nil
+	})
+	var errs []error
+	if err == nil {
+		errs = <-results
+	} else {
+		errs = make([]error, len(batch))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	settleBatch(context.WithoutCancel(ctx), b, batch, errs, opts)
+}
+
+// runBatch decodes batch and hands the decoded items to handle; errs[i] is the
+// outcome of batch[i]
+func runBatch[T any](ctx context.Context, batch []amqplib.Delivery, decode func(amqplib.Delivery) (T, error), handle BatchHandler[T]) []error {
+	errs := make([]error, len(batch))
+	items := make([]T, 0, len(batch))
+	index := make([]int, 0, len(batch)) // position in batch of items[i]
+	for i, d := range batch {
+		item, err := decode(d)
+		if err != nil {
+			errs[i] = amqp.Permanent(err)
+			continue
+		}
+		items = append(items, item)
+		index = append(index, i)
+	}
+
+	if len(items) > 0 {
+		results := handle(ctx, items)
+		if results != nil && len(results) != len(items) {
+			err := fmt.Errorf("batch handler returned %d results for %d items", len(results), len(items))
+			results = make([]error, len(items))
+			for i := range results {
+				results[i] = err
+			}
+		}
+		for i, err := range results {
+			errs[index[i]] = err
+		}
+	}
+	return errs
+}
+
+// settleBatch parks or requeues the failed deliveries one by one, then acks the
+// rest. On AMQP, once the failures are settled the successes are the only
+// unacked deliveries up to the last of them, so one multiple-ack covers them
+// all; that needs them to come from one channel, i.e. not to span a reconnect.
+func settleBatch(ctx context.Context, b Broker, batch []amqplib.Delivery, errs []error, opts BatchOptions) {
+	var succeeded []amqplib.Delivery
+	for i, d := range batch {
+		err := errs[i]
+		switch {
+		case err == nil:
+			succeeded = append(succeeded, d)
+		case amqp.IsPermanent(err):
+			MoveToErrorQueue(ctx, b, d, opts.Queue, opts.Consumer, err)
+		case amqp.IsPanic(err) || errors.Is(err, ErrMessageTimeout):
+			Retry(b, d, opts.Queue)
+		default:
+			helper.LogError("Failed to process batch message", err, "", map[string]interface{}{
+				"source":      "ConsumeBatches",
+				"queue":       opts.Queue,
+				"message_id":  d.MessageId,
+				"routing_key": d.RoutingKey,
+			})
+			d.Nack(false, true)
+		}
+	}
+	if len(succeeded) == 0 {
+		return
+	}
+
+	if b.Backend() == BackendAMQP && sameAcknowledger(succeeded) {
+		last := succeeded[0]
+		for _, d := range succeeded[1:] {
+			if d.DeliveryTag > last.DeliveryTag {
+				last = d
+			}
+		}
+		last.Ack(true)
+		return
+	}
+	for _, d := range succeeded {
+		d.Ack(false)
+	}
+}
+
+// sameAcknowledger reports whether every delivery was received on the same channel
+func sameAcknowledger(deliveries []amqplib.Delivery) bool {
+	for _, d := range deliveries[1:] {
+		if d.Acknowledger != deliveries[0].Acknowledger {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+// Package broker abstracts the message transport used by consumers and
+// publishers. Messages keep the AMQP shapes (amqp.Publishing in, amqp.Delivery
+// out, acked through delivery.Ack/Nack), so CloudEvent parsing, EventRouter and
+// existing handlers work unchanged on every backend.
+package broker
+
+import (
+	"context"
+	"errors"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+const (
+	// BackendAMQP uses RabbitMQ (config/amqp)
+	BackendAMQP = "amqp"
+	// BackendRedis uses Redis Streams with consumer groups
+	BackendRedis = "redis"
+)
+
+var (
+	ErrUnknownBackend = errors.New("unknown broker backend")
+	ErrClosed         = errors.New("broker closed")
+	// ErrUnsupportedField is returned by Publish for a publishing field the
+	// backend cannot honor
+	ErrUnsupportedField = errors.New("publishing field not supported by the broker backend")
+)
+
+// Broker publishes messages and consumes queues
+type Broker interface {
+	// Publish routes msg by exchange and routing key, following the declared topology.
+	// ctx bounds the wait for the backend to accept the message.
+	// Consumers get every field of msg back, headers with their Go types; Redis
+	// Streams reject Priority and Expiration with ErrUnsupportedField.
+	Publish(ctx context.Context, exchange, routingKey string, msg amqplib.Publishing) error
+	// Consume starts consuming a queue until ctx is done or the subscription is closed.
+	// Every delivery must be acked or nacked; a nack with requeue redelivers the
+	// message (up to the backend's retry limit).
+	Consume(ctx context.Context, queue, consumer string, opts ...ConsumeOption) (Subscription, error)
+	// Retries reports whether the messages of queue rejected without requeue
+	// are retried after the retry interval of the topology rather than dropped
+	// or dead-lettered at once (see Retry)
+	Retries(queue string) bool
+	// Backend returns the backend name (amqp or redis)
+	Backend() string
+	Close() error
+}
+
+// ConsumeOptions tunes a subscription
+type ConsumeOptions struct {
+	// Prefetch is the number of deliveries handed out before earlier ones are
+	// settled (the AMQP QoS, the XREADGROUP count on Redis); 0 keeps the default
+	Prefetch int
+}
+
+// ConsumeOption sets a field of ConsumeOptions
+type ConsumeOption func(*ConsumeOptions)
+
+// WithPrefetch sets ConsumeOptions.Prefetch, e.g. to the size of a batch
+func WithPrefetch(count int) ConsumeOption {
+	return func(o *ConsumeOptions) {
+		o.Prefetch = count
+	}
+}
+
+func consumeOptions(opts []ConsumeOption) ConsumeOptions {
+	var o ConsumeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Subscription is an active consumer of a queue
+type Subscription interface {
+	// Deliveries returns the delivery channel; it is closed promptly when the
+	// subscription is closed or its ctx is done
+	Deliveries() <-chan amqplib.Delivery
+	Close() error
+}
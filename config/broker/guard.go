@@ -0,0 +1,284 @@
+package broker
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// Guard states reported by GuardStatus
+const (
+	GuardClosed   = "closed"    // consuming
+	GuardOpen     = "open"      // paused after repeated panics
+	GuardHalfOpen = "half-open" // pause over, the next message decides
+)
+
+const (
+	// DefaultPanicThreshold is the number of panics within PanicWindow that pauses a consumer
+	DefaultPanicThreshold = 5
+	// DefaultPanicWindow is the period panics are counted over
+	DefaultPanicWindow = time.Minute
+	// DefaultPause is how long a consumer stays paused
+	DefaultPause = 30 * time.Second
+)
+
+// ErrMessageTimeout is returned by Guard.Run when the handler outlived its deadline
+var ErrMessageTimeout = errors.New("message processing timed out")
+
+// GuardOptions configures a Guard
+type GuardOptions struct {
+	// Timeout bounds the handling of one message (default amqp.DefaultMessageTimeout)
+	Timeout time.Duration
+	// PanicThreshold panics within PanicWindow open the circuit (default DefaultPanicThreshold)
+	PanicThreshold int
+	PanicWindow    time.Duration
+	// Pause is how long an open circuit holds the consumer back (default DefaultPause)
+	Pause time.Duration
+}
+
+// GuardStatus is a snapshot of a Guard, as reported by the health check
+type GuardStatus struct {
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	Panics      int        `json:"panics"` // within the panic window
+	Trips       int        `json:"trips"`  // times the circuit opened
+	LastPanic   string     `json:"last_panic,omitempty"`
+	LastPanicAt *time.Time `json:"last_panic_at,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+}
+
+// Guard runs the message handler of one consumer: it recovers panics, enforces
+// the per-message timeout and pauses the consumer once panics repeat (the
+// circuit opens). After the pause one message is let through; the circuit
+// closes when it does not panic and opens again when it does.
+type Guard struct {
+	name string
+	opts GuardOptions
+
+	mu          sync.Mutex
+	state       string
+	panics      []time.Time // within the panic window
+	trips       int
+	lastPanic   string
+	lastPanicAt time.Time
+	pausedUntil time.Time
+}
+
+// guards are the registered guards reported by Guards
+var guards = struct {
+	sync.Mutex
+	m map[string]*Guard
+}{m: make(map[string]*Guard)}
+
+// NewGuard creates a guard and registers it under name for Guards, replacing
+// a guard registered under the same name. Close unregisters it.
+func NewGuard(name string, opts GuardOptions) *Guard {
+	g := newGuard(name, opts)
+	guards.Lock()
+	guards.m[name] = g
+	guards.Unlock()
+	return g
+}
+
+// newGuard creates a guard without registering it
+func newGuard(name string, opts GuardOptions) *Guard {
+	if opts.Timeout <= 0 {
+		opts.Timeout = amqp.DefaultMessageTimeout
+	}
+	if opts.PanicThreshold <= 0 {
+		opts.PanicThreshold = DefaultPanicThreshold
+	}
+	if opts.PanicWindow <= 0 {
+		opts.PanicWindow = DefaultPanicWindow
+	}
+	if opts.Pause <= 0 {
+		opts.Pause = DefaultPause
+	}
+	return &Guard{name: name, opts: opts, state: GuardClosed}
+}
+
+// Guards returns the status of every registered guard, sorted by name
+func Guards() []GuardStatus {
+	guards.Lock()
+	list := make([]*Guard, 0, len(guards.m))
+	for _, g := range guards.m {
+		list = append(list, g)
+	}
+	guards.Unlock()
+
+	statuses := make([]GuardStatus, len(list))
+	for i, g := range list {
+		statuses[i] = g.Status()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Close unregisters the guard
+func (g *Guard) Close() {
+	guards.Lock()
+	defer guards.Unlock()
+	if guards.m[g.name] == g {
+		delete(guards.m, g.name)
+	}
+}
+
+// Status returns a snapshot of the guard
+func (g *Guard) Status() GuardStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.state == GuardOpen && !now.Before(g.pausedUntil) {
+		g.state = GuardHalfOpen
+	}
+	g.prune(now)
+
+	status := GuardStatus{
+		Name:      g.name,
+		State:     g.state,
+		Panics:    len(g.panics),
+		Trips:     g.trips,
+		LastPanic: g.lastPanic,
+	}
+	if !g.lastPanicAt.IsZero() {
+		at := g.lastPanicAt
+		status.LastPanicAt = &at
+	}
+	if g.state == GuardOpen {
+		until := g.pausedUntil
+		status.PausedUntil = &until
+	}
+	return status
+}
+
+// Run waits while the circuit is open, then calls handle with the message
+// deadline. A panic is returned as an *amqp.PanicError; a handler still running
+// at the deadline is left behind and ErrMessageTimeout is returned, so the
+// consumer can settle d and move on. ctx only cancels the wait.
+func (g *Guard) Run(ctx context.Context, d amqplib.Delivery, handle func(ctx context.Context) error) error {
+	if err := g.wait(ctx); err != nil {
+		return err
+	}
+
+	msgCtx, cancel := amqp.MessageContext(ctx, g.opts.Timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		err := amqp.Recover(g.name, d, func() error { return handle(msgCtx) })
+		g.record(err)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if errors.Is(err, context.DeadlineExceeded) && msgCtx.Err() != nil {
+			return fmt.Errorf("%w after %s: %v", ErrMessageTimeout, g.opts.Timeout, err)
+		}
+		return err
+	case <-msgCtx.Done():
+		helper.LogError("Message handler exceeded its timeout", msgCtx.Err(), "", map[string]interface{}{
+			"source":      "Guard.Run",
+			"consumer":    g.name,
+			"timeout":     g.opts.Timeout.String(),
+			"message_id":  d.MessageId,
+			"routing_key": d.RoutingKey,
+		})
+		return fmt.Errorf("%w after %s", ErrMessageTimeout, g.opts.Timeout)
+	}
+}
+
+// wait blocks while the circuit is open
+func (g *Guard) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		if g.state != GuardOpen {
+			g.mu.Unlock()
+			return nil
+		}
+		remaining := time.Until(g.pausedUntil)
+		if remaining <= 0 {
+			g.state = GuardHalfOpen
+			g.mu.Unlock()
+			helper.LogInfo("Consumer pause over, trying the next message", map[string]interface{}{
+				"source":   "Guard.wait",
+				"consumer": g.name,
+			})
+			return nil
+		}
+		g.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// record updates the circuit with the outcome of a handler
+func (g *Guard) record(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !amqp.IsPanic(err) {
+		if g.state == GuardHalfOpen {
+			g.state = GuardClosed
+			helper.LogInfo("Consumer resumed", map[string]interface{}{
+				"source":   "Guard.record",
+				"consumer": g.name,
+			})
+		}
+		return
+	}
+
+	now := time.Now()
+	g.lastPanic = err.Error()
+	g.lastPanicAt = now
+	g.panics = append(g.panics, now)
+	g.prune(now)
+	if g.state != GuardHalfOpen && len(g.panics) < g.opts.PanicThreshold {
+		return
+	}
+
+	g.state = GuardOpen
+	g.pausedUntil = now.Add(g.opts.Pause)
+	g.trips++
+	helper.LogError("Consumer paused after repeated panics", err, "", map[string]interface{}{
+		"source":       "Guard.record",
+		"consumer":     g.name,
+		"panics":       len(g.panics),
+		"paused_until": g.pausedUntil,
+	})
+	g.panics = nil
+}
+
+// prune drops the panics older than the panic window; callers hold g.mu
+func (g *Guard) prune(now time.Time) {
+	cutoff := now.Add(-g.opts.PanicWindow)
+	i := 0
+	for i < len(g.panics) && g.panics[i].Before(cutoff) {
+		i++
+	}
+	g.panics = g.panics[i:]
+}
+
+// Retry settles a delivery whose handler panicked or timed out: it is rejected
+// into the retry queue of queue when the topology gives it one, so it comes back
+// after the retry interval instead of immediately, and requeued otherwise.
+func Retry(b Broker, d amqplib.Delivery, queue string) error {
+	if b.Retries(queue) {
+		return d.Nack(false, false)
+	}
+	return d.Nack(false, true)
+}
@@ -0,0 +1,39 @@
+package broker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OffsetKeyPrefix prefixes the Redis hash holding the consumer offsets of a
+// stream ("stream-offsets:<stream>", one field per consumer)
+const OffsetKeyPrefix = "stream-offsets:"
+
+// RedisOffsetStore keeps AMQP stream consumer offsets in Redis; it implements amqp.OffsetStore
+type RedisOffsetStore struct {
+	client *redis.Client
+}
+
+// NewRedisOffsetStore creates an offset store on client
+func NewRedisOffsetStore(client *redis.Client) *RedisOffsetStore {
+	return &RedisOffsetStore{client: client}
+}
+
+// LoadOffset returns the next offset consumer reads from stream
+func (s *RedisOffsetStore) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	offset, err := s.client.HGet(ctx, OffsetKeyPrefix+stream, consumer).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return offset, true, nil
+}
+
+// SaveOffset stores the next offset consumer reads from stream
+func (s *RedisOffsetStore) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	return s.client.HSet(ctx, OffsetKeyPrefix+stream, consumer, offset).Err()
+}
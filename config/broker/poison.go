@@ -0,0 +1,36 @@
+package broker
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"context"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// MoveToErrorQueue publishes d to the error queue of queue (see amqp.ErrorPublishing
+// for the headers) and acks it. When the publish fails the delivery is requeued
+// instead, so a poison message is never lost.
+func MoveToErrorQueue(ctx context.Context, b Broker, d amqplib.Delivery, queue, consumer string, cause error) error {
+	errorQueue := amqp.ErrorQueueName(queue)
+	if err := b.Publish(ctx, "", errorQueue, amqp.ErrorPublishing(d, queue, consumer, cause)); err != nil {
+		helper.LogError("Failed to move message to error queue, requeuing", err, "", map[string]interface{}{
+			"source":      "MoveToErrorQueue",
+			"queue":       queue,
+			"error_queue": errorQueue,
+			"message_id":  d.MessageId,
+		})
+		d.Nack(false, true)
+		return err
+	}
+
+	helper.LogError("Message moved to error queue", cause, "", map[string]interface{}{
+		"source":      "MoveToErrorQueue",
+		"queue":       queue,
+		"error_queue": errorQueue,
+		"consumer":    consumer,
+		"message_id":  d.MessageId,
+		"routing_key": d.RoutingKey,
+	})
+	return d.Ack(false)
+}
@@ -0,0 +1,643 @@
+package broker
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	amqplib "github.com/streadway/amqp"
+)
+
+const (
+	// StreamPrefix prefixes the stream of every queue ("stream:<queue>")
+	StreamPrefix = "stream:"
+	// DeadLetterSuffix names the dead-letter stream of a queue ("stream:<queue>.dead")
+	DeadLetterSuffix = ".dead"
+	// RetrySuffix names the stream holding the rejected messages of a queue
+	// until their retry ("stream:<queue>.retry"), like the AMQP retry queue
+	RetrySuffix = ".retry"
+	// RetryDueSuffix names the sorted set of their due times, in Unix
+	// milliseconds ("stream:<queue>.retry:due")
+	RetryDueSuffix = ":due"
+	// RetryCountHeader carries the number of redeliveries of a Redis message
+	RetryCountHeader = "x-retry-count"
+
+	redisReadCount = 20
+	redisReadBlock = 2 * time.Second
+	redisMaxLen    = 100000
+)
+
+// scheduleRetry moves a rejected entry (ARGV[2]) out of the queue stream
+// (KEYS[1]) into its retry stream (KEYS[2]), due at ARGV[3] in the due set
+// (KEYS[3]). ARGV[1] is the group and ARGV[4...] the fields of the entry.
+var scheduleRetry = redis.NewScript(`
+local fields = {}
+for i = 4, #ARGV do
+	fields[#fields + 1] = ARGV[i]
+end
+local id = redis.call('XADD', KEYS[2], '*', unpack(fields))
+redis.call('ZADD', KEYS[3], ARGV[3], id)
+redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+return id
+`)
+
+// releaseRetries moves up to ARGV[2] entries of the retry stream (KEYS[2])
+// due by ARGV[1] (KEYS[3]) back to the queue stream (KEYS[1]), capped at
+// ARGV[3] entries. It returns the number of entries released.
+var releaseRetries = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	local entries = redis.call('XRANGE', KEYS[2], id, id)
+	if #entries > 0 then
+		redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[3], '*', unpack(entries[1][2]))
+		redis.call('XDEL', KEYS[2], id)
+	end
+	redis.call('ZREM', KEYS[3], id)
+end
+return #ids
+`)
+
+// RedisOptions configures the Redis Streams backend
+type RedisOptions struct {
+	// Group is the consumer group shared by all instances (one per queue stream)
+	Group string
+	// Consumer identifies this instance in the group; defaults to hostname-pid
+	Consumer string
+	// MaxRetries is the number of redeliveries before a message goes to the dead-letter stream
+	MaxRetries int
+	// ClaimIdle is how long a delivery may stay unacked before another consumer reclaims it
+	ClaimIdle time.Duration
+}
+
+// redisBroker maps queues to streams: publishing routes through the topology
+// bindings and XADDs to the stream of every matching queue; consuming reads the
+// queue's stream through a consumer group.
+type redisBroker struct {
+	client   *redis.Client
+	topology *amqp.Topology
+	options  RedisOptions
+
+	mu     sync.Mutex
+	groups map[string]bool
+}
+
+// NewRedis creates a Redis Streams broker. topology provides routing (exchanges
+// and bindings) and the queues whose rejected messages are retried.
+func NewRedis(client *redis.Client, topology *amqp.Topology, options RedisOptions) Broker {
+	if options.Consumer == "" {
+		host, _ := os.Hostname()
+		options.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = 5
+	}
+	if options.ClaimIdle <= 0 {
+		options.ClaimIdle = 30 * time.Second
+	}
+	return &redisBroker{
+		client:   client,
+		topology: topology,
+		options:  options,
+		groups:   make(map[string]bool),
+	}
+}
+
+// Backend returns "redis"
+func (b *redisBroker) Backend() string {
+	return BackendRedis
+}
+
+// Publish adds msg to the stream of every queue bound to exchange/routingKey
+func (b *redisBroker) Publish(ctx context.Context, exchange, routingKey string, msg amqplib.Publishing) error {
+	queues := b.topology.Route(exchange, routingKey)
+	if len(queues) == 0 {
+		helper.LogDebug("Redis stream message unroutable, dropped", map[string]interface{}{
+			"source":      "redisBroker.Publish",
+			"exchange":    exchange,
+			"routing_key": routingKey,
+		})
+		return nil
+	}
+
+	values, err := encodeMessage(exchange, routingKey, msg, 0)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	for _, queue := range queues {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: StreamPrefix + queue,
+			MaxLen: redisMaxLen,
+			Approx: true,
+			Values: values,
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		helper.LogError("Redis stream publish failed", err, exchange, map[string]interface{}{
+			"source":      "redisBroker.Publish",
+			"exchange":    exchange,
+			"routing_key": routingKey,
+			"queues":      queues,
+		})
+		return err
+	}
+	return nil
+}
+
+// Consume reads the queue's stream through the consumer group until ctx is done or Close
+func (b *redisBroker) Consume(ctx context.Context, queue, consumer string, opts ...ConsumeOption) (Subscription, error) {
+	stream := StreamPrefix + queue
+	if err := b.ensureGroup(stream); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &redisSubscription{
+		broker:     b,
+		queue:      queue,
+		stream:     stream,
+		consumer:   b.options.Consumer + "-" + consumer,
+		count:      redisReadCount,
+		deliveries: make(chan amqplib.Delivery),
+		pending:    make(map[uint64]redis.XMessage),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if o := consumeOptions(opts); int64(o.Prefetch) > sub.count {
+		sub.count = int64(o.Prefetch)
+	}
+	go sub.run()
+	return sub, nil
+}
+
+// Close is a no-op; the Redis client is owned by the caller
+func (b *redisBroker) Close() error {
+	return nil
+}
+
+// ensureGroup creates the consumer group (and the stream) once
+func (b *redisBroker) ensureGroup(stream string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.groups[stream] {
+		return nil
+	}
+	// Start at 0 so messages published before the first consumer are not lost
+	err := b.client.XGroupCreateMkStream(context.Background(), stream, b.options.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		helper.LogError("Redis consumer group create failed", err, stream, map[string]interface{}{
+			"source": "redisBroker.ensureGroup",
+			"stream": stream,
+			"group":  b.options.Group,
+		})
+		return err
+	}
+	b.groups[stream] = true
+	return nil
+}
+
+// Retries reports whether rejected messages of the queue are retried
+func (b *redisBroker) Retries(queue string) bool {
+	return b.retryInterval(queue) > 0
+}
+
+// retryInterval returns how long rejected messages of the queue wait before
+// their retry, the interval of its topology retry; 0 when it has none
+func (b *redisBroker) retryInterval(queue string) time.Duration {
+	q, ok := b.topology.Queue(queue)
+	if !ok || q.Retry == nil {
+		return 0
+	}
+	return time.Duration(q.Retry.Interval) * time.Millisecond
+}
+
+// redisSubscription is a consumer in the queue's consumer group
+type redisSubscription struct {
+	broker     *redisBroker
+	queue      string
+	stream     string
+	consumer   string
+	count      int64 // entries per XREADGROUP
+	deliveries chan amqplib.Delivery
+
+	mu      sync.Mutex
+	nextTag uint64
+	pending map[uint64]redis.XMessage
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// Deliveries returns the delivery channel
+func (s *redisSubscription) Deliveries() <-chan amqplib.Delivery {
+	return s.deliveries
+}
+
+// Close stops reading; unacked messages stay pending and are reclaimed by other consumers
+func (s *redisSubscription) Close() error {
+	s.closeOnce.Do(s.cancel)
+	return nil
+}
+
+// run reclaims idle pending entries and releases due retries, then reads new
+// entries, until closed. Retries are released between reads, so they come
+// back up to redisReadBlock after their due time.
+func (s *redisSubscription) run() {
+	defer close(s.deliveries)
+
+	lastClaim := time.Time{}
+	retries := s.broker.Retries(s.queue)
+	for s.ctx.Err() == nil {
+		if time.Since(lastClaim) >= s.broker.options.ClaimIdle/2 {
+			lastClaim = time.Now()
+			if !s.reclaim() {
+				return
+			}
+		}
+		if retries {
+			s.releaseRetries()
+		}
+
+		streams, err := s.broker.client.XReadGroup(s.ctx, &redis.XReadGroupArgs{
+			Group:    s.broker.options.Group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    s.count,
+			Block:    redisReadBlock,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if s.ctx.Err() != nil {
+				return
+			}
+			helper.LogError("Redis stream read failed", err, s.stream, map[string]interface{}{
+				"source": "redisSubscription.run",
+				"stream": s.stream,
+				"group":  s.broker.options.Group,
+			})
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(redisReadBlock):
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if !s.deliver(msg, false) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// reclaim takes over entries left pending by crashed consumers (XAUTOCLAIM).
+// Entries delivered more than MaxRetries times are dead-lettered instead.
+// It returns false when the subscription was closed.
+func (s *redisSubscription) reclaim() bool {
+	client := s.broker.client
+	start := "0-0"
+	for {
+		messages, next, err := client.XAutoClaim(s.ctx, &redis.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.broker.options.Group,
+			Consumer: s.consumer,
+			MinIdle:  s.broker.options.ClaimIdle,
+			Start:    start,
+			Count:    redisReadCount,
+		}).Result()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return false
+			}
+			helper.LogError("Redis stream reclaim failed", err, s.stream, map[string]interface{}{
+				"source": "redisSubscription.reclaim",
+				"stream": s.stream,
+			})
+			return true
+		}
+
+		for _, msg := range messages {
+			if s.deliveryCount(msg.ID) > int64(s.broker.options.MaxRetries)+1 {
+				s.deadLetter(msg, "max-retries")
+				continue
+			}
+			if !s.deliver(msg, true) {
+				return false
+			}
+		}
+
+		if next == "0-0" || len(messages) == 0 {
+			return true
+		}
+		start = next
+	}
+}
+
+// releaseRetries moves the retries that are due back to the queue stream. Every
+// consumer of the queue runs it; the script releases each entry once.
+func (s *redisSubscription) releaseRetries() {
+	retryStream := s.stream + RetrySuffix
+	err := releaseRetries.Run(s.ctx, s.broker.client,
+		[]string{s.stream, retryStream, retryStream + RetryDueSuffix},
+		time.Now().UnixMilli(), redisReadCount, redisMaxLen,
+	).Err()
+	if err != nil && s.ctx.Err() == nil {
+		helper.LogError("Redis stream retry release failed", err, s.stream, map[string]interface{}{
+			"source": "redisSubscription.releaseRetries",
+			"stream": s.stream,
+		})
+	}
+}
+
+// deliveryCount returns how many times the entry was delivered
+func (s *redisSubscription) deliveryCount(id string) int64 {
+	pending, err := s.broker.client.XPendingExt(s.ctx, &redis.XPendingExtArgs{
+		Stream: s.stream,
+		Group:  s.broker.options.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// deliver hands msg to the consumer; it returns false when the subscription was closed
+func (s *redisSubscription) deliver(msg redis.XMessage, redelivered bool) bool {
+	s.mu.Lock()
+	s.nextTag++
+	tag := s.nextTag
+	s.pending[tag] = msg
+	s.mu.Unlock()
+
+	d, err := decodeMessage(msg)
+	if err != nil {
+		helper.LogError("Redis stream message malformed, dead-lettered", err, s.stream, map[string]interface{}{
+			"source":     "redisSubscription.deliver",
+			"stream":     s.stream,
+			"message_id": msg.ID,
+		})
+		s.settle(tag, false, func(msg redis.XMessage) { s.deadLetter(msg, "malformed") })
+		return true
+	}
+	d.Acknowledger = s
+	d.DeliveryTag = tag
+	d.ConsumerTag = s.consumer
+	d.Redelivered = redelivered || d.Headers[RetryCountHeader] != nil
+
+	select {
+	case s.deliveries <- d:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// Ack acknowledges the delivery (XACK)
+func (s *redisSubscription) Ack(tag uint64, multiple bool) error {
+	return s.settle(tag, multiple, func(msg redis.XMessage) {
+		s.broker.client.XAck(context.Background(), s.stream, s.broker.options.Group, msg.ID)
+	})
+}
+
+// Nack re-adds the message with an incremented retry count, or dead-letters it once
+// MaxRetries is reached or when it is rejected without requeue on a queue without retry.
+// Like on AMQP, a message requeued comes back at once, while one rejected on a
+// queue with retry waits out the retry interval of the topology first.
+func (s *redisSubscription) Nack(tag uint64, multiple bool, requeue bool) error {
+	return s.settle(tag, multiple, func(msg redis.XMessage) {
+		retryCount, _ := strconv.Atoi(fmt.Sprint(msg.Values["retry_count"]))
+		if (!requeue && !s.broker.Retries(s.queue)) || retryCount >= s.broker.options.MaxRetries {
+			reason := "rejected"
+			if retryCount >= s.broker.options.MaxRetries {
+				reason = "max-retries"
+			}
+			s.deadLetter(msg, reason)
+			return
+		}
+
+		values := copyValues(msg.Values)
+		values["retry_count"] = retryCount + 1
+		if interval := s.broker.retryInterval(s.queue); !requeue && interval > 0 {
+			s.scheduleRetry(msg, values, time.Now().Add(interval))
+			return
+		}
+
+		ctx := context.Background()
+		pipe := s.broker.client.TxPipeline()
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: s.stream, MaxLen: redisMaxLen, Approx: true, Values: values})
+		pipe.XAck(ctx, s.stream, s.broker.options.Group, msg.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			helper.LogError("Redis stream requeue failed", err, s.stream, map[string]interface{}{
+				"source":     "redisSubscription.Nack",
+				"stream":     s.stream,
+				"message_id": msg.ID,
+			})
+		}
+	})
+}
+
+// scheduleRetry moves msg, with values, to the retry stream of the queue until due
+func (s *redisSubscription) scheduleRetry(msg redis.XMessage, values map[string]interface{}, due time.Time) {
+	args := make([]interface{}, 0, 3+2*len(values))
+	args = append(args, s.broker.options.Group, msg.ID, due.UnixMilli())
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+
+	retryStream := s.stream + RetrySuffix
+	err := scheduleRetry.Run(context.Background(), s.broker.client,
+		[]string{s.stream, retryStream, retryStream + RetryDueSuffix}, args...,
+	).Err()
+	if err != nil {
+		helper.LogError("Redis stream retry failed", err, s.stream, map[string]interface{}{
+			"source":     "redisSubscription.scheduleRetry",
+			"stream":     s.stream,
+			"message_id": msg.ID,
+		})
+	}
+}
+
+// Reject rejects a single delivery
+func (s *redisSubscription) Reject(tag uint64, requeue bool) error {
+	return s.Nack(tag, false, requeue)
+}
+
+// settle removes the pending delivery (or every delivery up to tag when multiple)
+// and runs fn on each, in tag order
+func (s *redisSubscription) settle(tag uint64, multiple bool, fn func(redis.XMessage)) error {
+	s.mu.Lock()
+	var tags []uint64
+	if _, ok := s.pending[tag]; ok && !multiple {
+		tags = []uint64{tag}
+	} else if multiple {
+		for t := range s.pending {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	}
+	messages := make([]redis.XMessage, 0, len(tags))
+	for _, t := range tags {
+		messages = append(messages, s.pending[t])
+		delete(s.pending, t)
+	}
+	s.mu.Unlock()
+
+	if len(messages) == 0 {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	for _, msg := range messages {
+		fn(msg)
+	}
+	return nil
+}
+
+// deadLetter moves msg to the queue's dead-letter stream
+func (s *redisSubscription) deadLetter(msg redis.XMessage, reason string) {
+	values := copyValues(msg.Values)
+	values["dead_reason"] = reason
+	values["original_queue"] = s.queue
+	values["original_id"] = msg.ID
+
+	ctx := context.Background()
+	pipe := s.broker.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: s.stream + DeadLetterSuffix, MaxLen: redisMaxLen, Approx: true, Values: values})
+	pipe.XAck(ctx, s.stream, s.broker.options.Group, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		helper.LogError("Redis stream dead-letter failed", err, s.stream, map[string]interface{}{
+			"source":     "redisSubscription.deadLetter",
+			"stream":     s.stream,
+			"message_id": msg.ID,
+		})
+		return
+	}
+	helper.LogInfo("Redis stream message dead-lettered", map[string]interface{}{
+		"source":     "redisSubscription.deadLetter",
+		"stream":     s.stream,
+		"message_id": msg.ID,
+		"reason":     reason,
+	})
+}
+
+// encodeMessage flattens a publishing into stream entry fields. Every field
+// is kept except Priority and Expiration, which a stream cannot honor (entries
+// are read in order and never expire): a publishing setting them is rejected.
+func encodeMessage(exchange, routingKey string, msg amqplib.Publishing, retryCount int) (map[string]interface{}, error) {
+	if msg.Priority != 0 {
+		return nil, fmt.Errorf("%w: priority", ErrUnsupportedField)
+	}
+	if msg.Expiration != "" {
+		return nil, fmt.Errorf("%w: expiration", ErrUnsupportedField)
+	}
+	headers, err := encodeHeaders(msg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("encode headers: %w", err)
+	}
+	values := map[string]interface{}{
+		"exchange":      exchange,
+		"routing_key":   routingKey,
+		"content_type":  msg.ContentType,
+		"message_id":    msg.MessageId,
+		"type":          msg.Type,
+		"typed_headers": headers,
+		"body":          msg.Body,
+		"retry_count":   retryCount,
+	}
+	optional := map[string]string{
+		"content_encoding": msg.ContentEncoding,
+		"correlation_id":   msg.CorrelationId,
+		"reply_to":         msg.ReplyTo,
+		"user_id":          msg.UserId,
+		"app_id":           msg.AppId,
+	}
+	for name, value := range optional {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	if msg.DeliveryMode != 0 {
+		values["delivery_mode"] = msg.DeliveryMode
+	}
+	if !msg.Timestamp.IsZero() {
+		values["timestamp"] = msg.Timestamp.UnixNano()
+	}
+	return values, nil
+}
+
+// decodeMessage turns a stream entry back into a delivery
+func decodeMessage(msg redis.XMessage) (amqplib.Delivery, error) {
+	field := func(name string) string {
+		v, _ := msg.Values[name].(string)
+		return v
+	}
+
+	d := amqplib.Delivery{
+		Exchange:        field("exchange"),
+		RoutingKey:      field("routing_key"),
+		ContentType:     field("content_type"),
+		ContentEncoding: field("content_encoding"),
+		MessageId:       field("message_id"),
+		Type:            field("type"),
+		CorrelationId:   field("correlation_id"),
+		ReplyTo:         field("reply_to"),
+		UserId:          field("user_id"),
+		AppId:           field("app_id"),
+		Body:            []byte(field("body")),
+	}
+
+	if raw := field("typed_headers"); raw != "" {
+		headers, err := decodeHeaders(raw)
+		if err != nil {
+			return d, fmt.Errorf("decode headers: %w", err)
+		}
+		d.Headers = headers
+	} else if raw := field("headers"); raw != "" && raw != "null" {
+		// Entries published before the headers were typed
+		if err := json.Unmarshal([]byte(raw), &d.Headers); err != nil {
+			return d, fmt.Errorf("decode headers: %w", err)
+		}
+	}
+	if mode, err := strconv.ParseUint(field("delivery_mode"), 10, 8); err == nil {
+		d.DeliveryMode = uint8(mode)
+	}
+	if ts, err := strconv.ParseInt(field("timestamp"), 10, 64); err == nil {
+		d.Timestamp = time.Unix(0, ts).UTC()
+	}
+	if retryCount, err := strconv.Atoi(field("retry_count")); err == nil && retryCount > 0 {
+		if d.Headers == nil {
+			d.Headers = amqplib.Table{}
+		}
+		d.Headers[RetryCountHeader] = int64(retryCount)
+	}
+	return d, nil
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
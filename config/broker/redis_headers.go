@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// headerValue is a header value tagged with its Go type, so that it is
+// decoded to the type it was published with: plain JSON would turn every
+// number into a float64
+type headerValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// encodeHeaders encodes headers to typed JSON; it accepts the value types of
+// an AMQP table (see amqplib.Table.Validate)
+func encodeHeaders(headers amqplib.Table) (string, error) {
+	if headers == nil {
+		return "", nil
+	}
+	encoded, err := encodeHeaderValue(headers)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(encoded)
+	return string(raw), err
+}
+
+// decodeHeaders decodes the typed JSON of encodeHeaders
+func decodeHeaders(raw string) (amqplib.Table, error) {
+	var encoded headerValue
+	if err := json.Unmarshal([]byte(raw), &encoded); err != nil {
+		return nil, err
+	}
+	value, err := decodeHeaderValue(encoded)
+	if err != nil {
+		return nil, err
+	}
+	headers, ok := value.(amqplib.Table)
+	if !ok {
+		return nil, fmt.Errorf("headers are a %s, not a table", encoded.Type)
+	}
+	return headers, nil
+}
+
+func encodeHeaderValue(value interface{}) (headerValue, error) {
+	var typ string
+	switch v := value.(type) {
+	case nil:
+		return headerValue{Type: "nil"}, nil
+	case bool:
+		typ = "bool"
+	case byte:
+		typ = "byte"
+	case int:
+		typ = "int"
+	case int16:
+		typ = "int16"
+	case int32:
+		typ = "int32"
+	case int64:
+		typ = "int64"
+	case float32:
+		typ = "float32"
+	case float64:
+		typ = "float64"
+	case string:
+		typ = "string"
+	case []byte:
+		typ = "bytes"
+	case amqplib.Decimal:
+		typ = "decimal"
+	case time.Time:
+		typ = "time"
+	case []interface{}:
+		items := make([]headerValue, len(v))
+		for i, item := range v {
+			encoded, err := encodeHeaderValue(item)
+			if err != nil {
+				return headerValue{}, fmt.Errorf("in array %w", err)
+			}
+			items[i] = encoded
+		}
+		return marshalHeaderValue("array", items)
+	case amqplib.Table:
+		fields := make(map[string]headerValue, len(v))
+		for name, field := range v {
+			encoded, err := encodeHeaderValue(field)
+			if err != nil {
+				return headerValue{}, fmt.Errorf("table field %q %w", name, err)
+			}
+			fields[name] = encoded
+		}
+		return marshalHeaderValue("table", fields)
+	default:
+		return headerValue{}, fmt.Errorf("value %T not supported", value)
+	}
+	return marshalHeaderValue(typ, value)
+}
+
+func marshalHeaderValue(typ string, value interface{}) (headerValue, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return headerValue{}, err
+	}
+	return headerValue{Type: typ, Value: raw}, nil
+}
+
+func decodeHeaderValue(encoded headerValue) (interface{}, error) {
+	switch encoded.Type {
+	case "nil":
+		return nil, nil
+	case "bool":
+		return unmarshalHeaderValue[bool](encoded.Value)
+	case "byte":
+		return unmarshalHeaderValue[byte](encoded.Value)
+	case "int":
+		return unmarshalHeaderValue[int](encoded.Value)
+	case "int16":
+		return unmarshalHeaderValue[int16](encoded.Value)
+	case "int32":
+		return unmarshalHeaderValue[int32](encoded.Value)
+	case "int64":
+		return unmarshalHeaderValue[int64](encoded.Value)
+	case "float32":
+		return unmarshalHeaderValue[float32](encoded.Value)
+	case "float64":
+		return unmarshalHeaderValue[float64](encoded.Value)
+	case "string":
+		return unmarshalHeaderValue[string](encoded.Value)
+	case "bytes":
+		return unmarshalHeaderValue[[]byte](encoded.Value)
+	case "decimal":
+		return unmarshalHeaderValue[amqplib.Decimal](encoded.Value)
+	case "time":
+		return unmarshalHeaderValue[time.Time](encoded.Value)
+	case "array":
+		items, err := unmarshalHeaderValue[[]headerValue](encoded.Value)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, len(items))
+		for i, item := range items {
+			if array[i], err = decodeHeaderValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case "table":
+		fields, err := unmarshalHeaderValue[map[string]headerValue](encoded.Value)
+		if err != nil {
+			return nil, err
+		}
+		table := make(amqplib.Table, len(fields))
+		for name, field := range fields {
+			if table[name], err = decodeHeaderValue(field); err != nil {
+				return nil, err
+			}
+		}
+		return table, nil
+	default:
+		return nil, fmt.Errorf("unknown header type %q", encoded.Type)
+	}
+}
+
+func unmarshalHeaderValue[T any](raw json.RawMessage) (T, error) {
+	var value T
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
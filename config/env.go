@@ -1,11 +1,74 @@
 package config
 
+import (
+	"boilerblade/config/auth"
+	"boilerblade/config/mail"
+	"boilerblade/helper"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
 type Env struct {
 	MODE           string `envconfig:"MODE" default:"development"`
 	FIBER_PORT     string `envconfig:"FIBER_PORT" default:"3000"`
 	FIBER_APP_NAME string `envconfig:"FIBER_APP_NAME" default:"boilerblade"`
 	APP_KEY        string `envconfig:"APP_KEY" default:""`
 	SERVER_MODE    string `envconfig:"SERVER_MODE" default:"both"` // http, amqp, or both
+	HEALTH_PORT    string `envconfig:"HEALTH_PORT" default:""`     // SERVER_MODE=amqp: serve GET /health on this port (empty = off)
+
+	AUTH_ALLOW_PLAINTEXT_PASSWORDS bool `envconfig:"AUTH_ALLOW_PLAINTEXT_PASSWORDS" default:"false"` // accept passwords stored before hashing, until auth hash-passwords has run
+
+	AUTH_ACCESS_TOKEN_TTL       int    `envconfig:"AUTH_ACCESS_TOKEN_TTL" default:"900"`        // seconds an access token is valid
+	AUTH_REFRESH_TOKEN_TTL      int    `envconfig:"AUTH_REFRESH_TOKEN_TTL" default:"2592000"`   // seconds a refresh token is valid
+	AUTH_PASSWORD_ALGORITHM     string `envconfig:"AUTH_PASSWORD_ALGORITHM" default:"argon2id"` // argon2id or bcrypt
+	AUTH_ARGON2_MEMORY          int    `envconfig:"AUTH_ARGON2_MEMORY" default:"19456"`         // KiB
+	AUTH_ARGON2_ITERATIONS      int    `envconfig:"AUTH_ARGON2_ITERATIONS" default:"2"`
+	AUTH_ARGON2_PARALLELISM     int    `envconfig:"AUTH_ARGON2_PARALLELISM" default:"1"`
+	AUTH_BCRYPT_COST            int    `envconfig:"AUTH_BCRYPT_COST" default:"12"`
+	AUTH_HMAC_KEYS              string `envconfig:"AUTH_HMAC_KEYS" default:""`                       // kid:secret,kid:secret
+	AUTH_HMAC_KEY_ID            string `envconfig:"AUTH_HMAC_KEY_ID" default:""`                     // kid of the key issued tokens are signed with (empty = APP_KEY)
+	AUTH_JWKS_URL               string `envconfig:"AUTH_JWKS_URL" default:""`                        // identity provider JWKS
+	AUTH_JWKS_FILE              string `envconfig:"AUTH_JWKS_FILE" default:""`                       // local JWKS file, instead of AUTH_JWKS_URL
+	AUTH_JWKS_REFRESH           int    `envconfig:"AUTH_JWKS_REFRESH" default:"3600"`                // seconds between JWKS refreshes
+	AUTH_TOKEN_ISSUER           string `envconfig:"AUTH_TOKEN_ISSUER" default:""`                    // iss of issued tokens
+	AUTH_TOKEN_AUDIENCE         string `envconfig:"AUTH_TOKEN_AUDIENCE" default:""`                  // aud of issued tokens
+	AUTH_ISSUERS                string `envconfig:"AUTH_ISSUERS" default:""`                         // accepted iss values, comma separated (empty = any)
+	AUTH_AUDIENCES              string `envconfig:"AUTH_AUDIENCES" default:""`                       // accepted aud values, comma separated (empty = any)
+	AUTH_TRUSTED_ISSUERS        string `envconfig:"AUTH_TRUSTED_ISSUERS" default:""`                 // identity provider issuers whose role and permission claims are trusted
+	AUTH_TOKEN_LEEWAY           int    `envconfig:"AUTH_TOKEN_LEEWAY" default:"30"`                  // seconds of clock skew tolerated
+	AUTH_TOKEN_MAX_AGE          int    `envconfig:"AUTH_TOKEN_MAX_AGE" default:"0"`                  // seconds since iat a token is accepted (0 = no limit)
+	AUTH_REQUIRED_CLAIMS        string `envconfig:"AUTH_REQUIRED_CLAIMS" default:"exp,sub"`          // claims every token must carry
+	AUTH_API_KEYS               string `envconfig:"AUTH_API_KEYS" default:""`                        // service:key,service:key for API key routes
+	AUTH_MTLS_SUBJECTS          string `envconfig:"AUTH_MTLS_SUBJECTS" default:""`                   // client certificate CNs accepted on mTLS routes (empty = any verified)
+	AUTH_REVOCATION_CACHE_TTL   int    `envconfig:"AUTH_REVOCATION_CACHE_TTL" default:"30"`          // seconds a revocation lookup is cached locally
+	AUTH_REVOCATION_FAIL_OPEN   bool   `envconfig:"AUTH_REVOCATION_FAIL_OPEN" default:"false"`       // accept tokens when Redis cannot be reached
+	AUTH_OIDC_ISSUER            string `envconfig:"AUTH_OIDC_ISSUER" default:""`                     // OpenID Connect provider to log in with (empty = disabled)
+	AUTH_OIDC_CLIENT_ID         string `envconfig:"AUTH_OIDC_CLIENT_ID" default:""`                  // client ID, the audience of ID tokens
+	AUTH_OIDC_CLIENT_SECRET     string `envconfig:"AUTH_OIDC_CLIENT_SECRET" default:""`              // empty for a public client
+	AUTH_OIDC_REDIRECT_URL      string `envconfig:"AUTH_OIDC_REDIRECT_URL" default:""`               // callback URL registered at the provider
+	AUTH_OIDC_SCOPES            string `envconfig:"AUTH_OIDC_SCOPES" default:"openid,email,profile"` // scopes requested, comma separated
+	AUTH_EMAIL_VERIFICATION_URL string `envconfig:"AUTH_EMAIL_VERIFICATION_URL" default:""`          // frontend page verification emails link to (empty = bare token)
+	AUTH_EMAIL_VERIFICATION_TTL int    `envconfig:"AUTH_EMAIL_VERIFICATION_TTL" default:"86400"`     // seconds a verification token is valid
+	AUTH_PASSWORD_RESET_URL     string `envconfig:"AUTH_PASSWORD_RESET_URL" default:""`              // frontend page password reset emails link to (empty = bare token)
+	AUTH_PASSWORD_RESET_TTL     int    `envconfig:"AUTH_PASSWORD_RESET_TTL" default:"3600"`          // seconds a password reset token is valid
+	AUTH_REQUIRE_VERIFIED_EMAIL bool   `envconfig:"AUTH_REQUIRE_VERIFIED_EMAIL" default:"false"`     // refuse logins until the email is verified
+	AUTH_LOCKOUT_MAX_ATTEMPTS   int    `envconfig:"AUTH_LOCKOUT_MAX_ATTEMPTS" default:"5"`           // failed logins that lock an account (0 = no lockout)
+	AUTH_LOCKOUT_WINDOW         int    `envconfig:"AUTH_LOCKOUT_WINDOW" default:"900"`               // seconds failed logins are counted over
+	AUTH_LOCKOUT_DURATION       int    `envconfig:"AUTH_LOCKOUT_DURATION" default:"900"`             // seconds a locked account stays locked
+	MAIL_DRIVER                 string `envconfig:"MAIL_DRIVER" default:""`                          // log or smtp (empty = log, in development only)
+	MAIL_FROM                   string `envconfig:"MAIL_FROM" default:""`                            // sender address of emails
+	SMTP_HOST                   string `envconfig:"SMTP_HOST" default:""`                            // SMTP server of MAIL_DRIVER=smtp
+	SMTP_PORT                   int    `envconfig:"SMTP_PORT" default:"587"`                         // upgraded with STARTTLS when offered
+	SMTP_USERNAME               string `envconfig:"SMTP_USERNAME" default:""`                        // empty = no authentication
+	SMTP_PASSWORD               string `envconfig:"SMTP_PASSWORD" default:""`                        // password of SMTP_USERNAME
+	SERVER_TLS_CERT             string `envconfig:"SERVER_TLS_CERT" default:""`                      // serve HTTPS with this certificate file
+	SERVER_TLS_KEY              string `envconfig:"SERVER_TLS_KEY" default:""`                       // private key file of SERVER_TLS_CERT
+	SERVER_TLS_CLIENT_CA        string `envconfig:"SERVER_TLS_CLIENT_CA" default:""`                 // CA file client certificates of mTLS routes are verified with
 
 	// Connection enable flags
 	ENABLE_DB    bool `envconfig:"ENABLE_DB" default:"true"`
@@ -31,4 +94,216 @@ type Env struct {
 	AMQP_PORT     string `envconfig:"AMQP_PORT" default:"5672"`
 	AMQP_USER     string `envconfig:"AMQP_USER" default:"guest"`
 	AMQP_PASSWORD string `envconfig:"AMQP_PASSWORD" default:"guest"`
+
+	AMQP_CLOUDEVENTS_MODE       string `envconfig:"AMQP_CLOUDEVENTS_MODE" default:"binary"`      // binary or structured
+	AMQP_TOPOLOGY_DIR           string `envconfig:"AMQP_TOPOLOGY_DIR" default:""`                // empty = embedded config/amqp/topology
+	AMQP_DELAYED_MESSAGE_PLUGIN bool   `envconfig:"AMQP_DELAYED_MESSAGE_PLUGIN" default:"false"` // rabbitmq_delayed_message_exchange is enabled
+	AMQP_PUBLISHER_POOL_SIZE    int    `envconfig:"AMQP_PUBLISHER_POOL_SIZE" default:"8"`        // confirm channels for publishing
+	AMQP_PUBLISH_TIMEOUT        int    `envconfig:"AMQP_PUBLISH_TIMEOUT" default:"5000"`         // ms to wait for the broker to confirm a publish
+	AMQP_STREAM_OFFSET_STORE    string `envconfig:"AMQP_STREAM_OFFSET_STORE" default:"redis"`    // where stream consumers commit offsets: redis or db
+	AMQP_BATCH_SIZE             int    `envconfig:"AMQP_BATCH_SIZE" default:"100"`               // deliveries per batch of batch consumers
+	AMQP_BATCH_WAIT             int    `envconfig:"AMQP_BATCH_WAIT" default:"500"`               // ms a batch waits to fill up
+	AMQP_MESSAGE_TIMEOUT        int    `envconfig:"AMQP_MESSAGE_TIMEOUT" default:"30000"`        // ms a consumer may spend on one message (or batch)
+	AMQP_CIRCUIT_PANICS         int    `envconfig:"AMQP_CIRCUIT_PANICS" default:"5"`             // panics within AMQP_CIRCUIT_WINDOW that pause a consumer
+	AMQP_CIRCUIT_WINDOW         int    `envconfig:"AMQP_CIRCUIT_WINDOW" default:"60000"`         // ms panics are counted over
+	AMQP_CIRCUIT_PAUSE          int    `envconfig:"AMQP_CIRCUIT_PAUSE" default:"30000"`          // ms a paused consumer waits before trying again
+
+	BROKER                   string `envconfig:"BROKER" default:"amqp"`                   // amqp or redis (Redis Streams)
+	REDIS_STREAM_GROUP       string `envconfig:"REDIS_STREAM_GROUP" default:""`           // empty = FIBER_APP_NAME
+	REDIS_STREAM_MAX_RETRIES int    `envconfig:"REDIS_STREAM_MAX_RETRIES" default:"5"`    // redeliveries before the dead-letter stream
+	REDIS_STREAM_CLAIM_IDLE  int    `envconfig:"REDIS_STREAM_CLAIM_IDLE" default:"30000"` // ms before a pending entry is reclaimed
+}
+
+// PasswordHasher returns the password hasher configured by AUTH_PASSWORD_ALGORITHM
+// and its AUTH_ARGON2_* or AUTH_BCRYPT_COST parameters, accepting legacy
+// plaintext rows only with AUTH_ALLOW_PLAINTEXT_PASSWORDS
+func (e *Env) PasswordHasher() helper.PasswordHasher {
+	return helper.PasswordHasher{
+		Algorithm:   e.AUTH_PASSWORD_ALGORITHM,
+		Memory:      uint32(e.AUTH_ARGON2_MEMORY),
+		Iterations:  uint32(e.AUTH_ARGON2_ITERATIONS),
+		Parallelism: uint8(e.AUTH_ARGON2_PARALLELISM),
+		BcryptCost:  e.AUTH_BCRYPT_COST,
+
+		AllowPlaintext: e.AUTH_ALLOW_PLAINTEXT_PASSWORDS,
+	}
+}
+
+// HMACKeys returns the HMAC keys access tokens are verified with: AUTH_HMAC_KEYS
+// by kid, and APP_KEY for tokens without kid
+func (e *Env) HMACKeys() (map[string][]byte, error) {
+	keys, err := auth.ParseHMACKeys(e.AUTH_HMAC_KEYS)
+	if err != nil {
+		return nil, fmt.Errorf("AUTH_HMAC_KEYS: %w", err)
+	}
+	if e.APP_KEY != "" {
+		keys[""] = []byte(e.APP_KEY)
+	}
+	if _, ok := keys[e.AUTH_HMAC_KEY_ID]; e.AUTH_HMAC_KEY_ID != "" && !ok {
+		return nil, fmt.Errorf("AUTH_HMAC_KEY_ID %q is not in AUTH_HMAC_KEYS", e.AUTH_HMAC_KEY_ID)
+	}
+	return keys, nil
+}
+
+// SigningKey returns the kid and HMAC key issued access tokens are signed with:
+// the AUTH_HMAC_KEY_ID key, or APP_KEY without kid
+func (e *Env) SigningKey() (string, []byte) {
+	keys, err := e.HMACKeys()
+	if err != nil || e.AUTH_HMAC_KEY_ID == "" {
+		return "", []byte(e.APP_KEY)
+	}
+	return e.AUTH_HMAC_KEY_ID, keys[e.AUTH_HMAC_KEY_ID]
+}
+
+// ClaimsOptions returns the claim rules access tokens are verified with. The
+// issuer of our own tokens (AUTH_TOKEN_ISSUER) is accepted with AUTH_ISSUERS.
+func (e *Env) ClaimsOptions() (auth.ClaimsOptions, error) {
+	required, err := auth.ParseRequiredClaims(e.AUTH_REQUIRED_CLAIMS)
+	if err != nil {
+		return auth.ClaimsOptions{}, fmt.Errorf("AUTH_REQUIRED_CLAIMS: %w", err)
+	}
+	if e.AUTH_TOKEN_LEEWAY < 0 || e.AUTH_TOKEN_MAX_AGE < 0 {
+		return auth.ClaimsOptions{}, fmt.Errorf("AUTH_TOKEN_LEEWAY and AUTH_TOKEN_MAX_AGE must not be negative")
+	}
+
+	issuers := splitList(e.AUTH_ISSUERS)
+	if len(issuers) > 0 && e.AUTH_TOKEN_ISSUER != "" && !slices.Contains(issuers, e.AUTH_TOKEN_ISSUER) {
+		issuers = append(issuers, e.AUTH_TOKEN_ISSUER)
+	}
+	return auth.ClaimsOptions{
+		Issuers:        issuers,
+		Audiences:      splitList(e.AUTH_AUDIENCES),
+		TrustedIssuers: splitList(e.AUTH_TRUSTED_ISSUERS),
+		Leeway:         time.Duration(e.AUTH_TOKEN_LEEWAY) * time.Second,
+		MaxAge:         time.Duration(e.AUTH_TOKEN_MAX_AGE) * time.Second,
+		Required:       required,
+	}, nil
+}
+
+// APIKeys returns the service API keys of AUTH_API_KEYS
+func (e *Env) APIKeys() (*auth.APIKeys, error) {
+	keys, err := auth.ParseAPIKeys(e.AUTH_API_KEYS)
+	if err != nil {
+		return nil, fmt.Errorf("AUTH_API_KEYS: %w", err)
+	}
+	return keys, nil
+}
+
+// MTLSSubjects returns the client certificate common names of AUTH_MTLS_SUBJECTS
+func (e *Env) MTLSSubjects() []string {
+	return splitList(e.AUTH_MTLS_SUBJECTS)
+}
+
+// OIDCOptions returns the OpenID Connect provider users log in with, nil when
+// AUTH_OIDC_ISSUER is not set
+func (e *Env) OIDCOptions() (*auth.OIDCOptions, error) {
+	if e.AUTH_OIDC_ISSUER == "" {
+		return nil, nil
+	}
+	if e.AUTH_OIDC_CLIENT_ID == "" || e.AUTH_OIDC_REDIRECT_URL == "" {
+		return nil, fmt.Errorf("AUTH_OIDC_ISSUER requires AUTH_OIDC_CLIENT_ID and AUTH_OIDC_REDIRECT_URL")
+	}
+	return &auth.OIDCOptions{
+		Issuer:       e.AUTH_OIDC_ISSUER,
+		ClientID:     e.AUTH_OIDC_CLIENT_ID,
+		ClientSecret: e.AUTH_OIDC_CLIENT_SECRET,
+		RedirectURL:  e.AUTH_OIDC_REDIRECT_URL,
+		Scopes:       splitList(e.AUTH_OIDC_SCOPES),
+		Leeway:       time.Duration(e.AUTH_TOKEN_LEEWAY) * time.Second,
+	}, nil
+}
+
+// LockoutOptions returns the login lockout configured by AUTH_LOCKOUT_*, nil
+// when AUTH_LOCKOUT_MAX_ATTEMPTS is 0
+func (e *Env) LockoutOptions() (*auth.LockoutOptions, error) {
+	if e.AUTH_LOCKOUT_MAX_ATTEMPTS < 0 {
+		return nil, fmt.Errorf("AUTH_LOCKOUT_MAX_ATTEMPTS must not be negative")
+	}
+	if e.AUTH_LOCKOUT_MAX_ATTEMPTS == 0 {
+		return nil, nil
+	}
+	if e.AUTH_LOCKOUT_WINDOW <= 0 || e.AUTH_LOCKOUT_DURATION <= 0 {
+		return nil, fmt.Errorf("AUTH_LOCKOUT_WINDOW and AUTH_LOCKOUT_DURATION must be positive")
+	}
+	return &auth.LockoutOptions{
+		MaxAttempts: e.AUTH_LOCKOUT_MAX_ATTEMPTS,
+		Window:      time.Duration(e.AUTH_LOCKOUT_WINDOW) * time.Second,
+		Duration:    time.Duration(e.AUTH_LOCKOUT_DURATION) * time.Second,
+	}, nil
+}
+
+// Mailer returns the mailer emails are delivered with, selected by MAIL_DRIVER:
+// log (written to the log) or smtp (SMTP_* and MAIL_FROM). The log mailer
+// writes verification and reset links to the log, so outside of development
+// MAIL_DRIVER has to be set explicitly instead of defaulting to it.
+func (e *Env) Mailer() (mail.Mailer, error) {
+	switch e.MAIL_DRIVER {
+	case "":
+		if e.MODE != "development" {
+			return nil, fmt.Errorf("MAIL_DRIVER is required when MODE=%s (set smtp, or log to write emails with their links to the log)", e.MODE)
+		}
+		return mail.NewLogMailer(), nil
+	case "log":
+		return mail.NewLogMailer(), nil
+	case "smtp":
+		mailer, err := mail.NewSMTPMailer(mail.SMTPOptions{
+			Host:     e.SMTP_HOST,
+			Port:     e.SMTP_PORT,
+			Username: e.SMTP_USERNAME,
+			Password: e.SMTP_PASSWORD,
+			From:     e.MAIL_FROM,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp: %w (set SMTP_HOST and MAIL_FROM)", err)
+		}
+		return mailer, nil
+	default:
+		return nil, fmt.Errorf("invalid MAIL_DRIVER %q (want log or smtp)", e.MAIL_DRIVER)
+	}
+}
+
+// TLSConfig returns the TLS configuration of the HTTP server, nil when
+// SERVER_TLS_CERT is not set. With SERVER_TLS_CLIENT_CA, client certificates
+// are verified when presented but not required: routes declare whether they
+// need one (mTLS), so public and JWT routes keep working without.
+func (e *Env) TLSConfig() (*tls.Config, error) {
+	if e.SERVER_TLS_CERT == "" {
+		if e.SERVER_TLS_CLIENT_CA != "" {
+			return nil, fmt.Errorf("SERVER_TLS_CLIENT_CA requires SERVER_TLS_CERT and SERVER_TLS_KEY")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(e.SERVER_TLS_CERT, e.SERVER_TLS_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("SERVER_TLS_CERT: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if e.SERVER_TLS_CLIENT_CA != "" {
+		pem, err := os.ReadFile(e.SERVER_TLS_CLIENT_CA)
+		if err != nil {
+			return nil, fmt.Errorf("SERVER_TLS_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SERVER_TLS_CLIENT_CA: no certificate found in %s", e.SERVER_TLS_CLIENT_CA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// splitList splits a comma separated value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -2,8 +2,11 @@ package config
 
 import (
 	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
 	"boilerblade/helper"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/redis/go-redis/v9"
@@ -16,10 +19,12 @@ var (
 
 // AppConfig holds all application configuration and connections
 type AppConfig struct {
-	Env      *Env
-	Database *gorm.DB
-	Redis    *redis.Client
-	AMQP     amqp.IAMQPConnection
+	Env          *Env
+	Database     *gorm.DB
+	Redis        *redis.Client
+	AMQP         amqp.IAMQPConnection
+	AMQPTopology *amqp.Topology
+	Broker       broker.Broker // message broker selected by BROKER (nil until its backend is connected)
 }
 
 // ConnectionOptions defines which connections to initialize
@@ -79,6 +84,29 @@ func InitializeWithOptions(env *Env, options *ConnectionOptions) (*AppConfig, er
 		Env: env,
 	}
 
+	// Passwords are hashed and verified with the configured algorithm everywhere
+	helper.SetPasswordHasher(env.PasswordHasher())
+
+	// Fail fast on malformed token and API keys and claim rules rather than rejecting every request
+	if _, err := env.HMACKeys(); err != nil {
+		return nil, err
+	}
+	if _, err := env.ClaimsOptions(); err != nil {
+		return nil, err
+	}
+	if _, err := env.APIKeys(); err != nil {
+		return nil, err
+	}
+	if _, err := env.OIDCOptions(); err != nil {
+		return nil, err
+	}
+	if _, err := env.LockoutOptions(); err != nil {
+		return nil, err
+	}
+	if _, err := env.Mailer(); err != nil {
+		return nil, err
+	}
+
 	// Initialize Database if enabled
 	if options.EnableDB {
 		cfg.Database = env.InitDatabase()
@@ -111,6 +139,9 @@ func InitializeWithOptions(env *Env, options *ConnectionOptions) (*AppConfig, er
 		amqpConn = env.InitAMQP()
 		if amqpConn != nil {
 			cfg.AMQP = *amqpConn
+			if err := cfg.ApplyAMQPTopology(); err != nil {
+				return nil, err
+			}
 		}
 		helper.LogInfo("AMQP connection initialization attempted", map[string]interface{}{
 			"enabled": true,
@@ -122,6 +153,13 @@ func InitializeWithOptions(env *Env, options *ConnectionOptions) (*AppConfig, er
 		})
 	}
 
+	// Initialize the message broker when its backend is connected
+	if (env.BROKER == broker.BackendRedis && cfg.Redis != nil) || (env.BROKER != broker.BackendRedis && cfg.AMQP != nil) {
+		if err := cfg.EnsureBroker(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Log initialization summary
 	helper.LogInfo("Application configuration initialized", map[string]interface{}{
 		"mode":          env.MODE,
@@ -134,6 +172,8 @@ func InitializeWithOptions(env *Env, options *ConnectionOptions) (*AppConfig, er
 		"redis_ready":   cfg.Redis != nil,
 		"amqp_enabled":  options.EnableAMQP,
 		"amqp_ready":    amqpConn != nil,
+		"broker":        env.BROKER,
+		"broker_ready":  cfg.Broker != nil,
 	})
 
 	return cfg, nil
@@ -165,7 +205,105 @@ func (cfg *AppConfig) EnsureAMQP() error {
 		helper.LogInfo("AMQP connection initialized", map[string]interface{}{
 			"source": "AppConfig.EnsureAMQP",
 		})
+
+		if err := cfg.ApplyAMQPTopology(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// ApplyAMQPTopology loads the declarative AMQP topology (AMQP_TOPOLOGY_DIR, with
+// MODE-specific overrides) and declares it on the broker
+func (cfg *AppConfig) ApplyAMQPTopology() error {
+	topology, err := cfg.loadAMQPTopology()
+	if err != nil {
+		return err
+	}
+
+	channel, err := cfg.AMQP.Channel()
+	if err != nil {
+		helper.LogError("Failed to get AMQP channel for topology", err, "", map[string]interface{}{
+			"source": "AppConfig.ApplyAMQPTopology",
+		})
+		return err
+	}
+	defer channel.Close()
+
+	if err := topology.Apply(channel); err != nil {
+		return err
+	}
+
+	cfg.AMQPTopology = topology
+	return nil
+}
+
+// loadAMQPTopology reads the topology from AMQP_TOPOLOGY_DIR (or the embedded default)
+func (cfg *AppConfig) loadAMQPTopology() (*amqp.Topology, error) {
+	topology, err := amqp.LoadTopology(cfg.Env.AMQP_TOPOLOGY_DIR, cfg.Env.MODE)
+	if err != nil {
+		helper.LogError("Failed to load AMQP topology", err, "", map[string]interface{}{
+			"source": "AppConfig.loadAMQPTopology",
+			"dir":    cfg.Env.AMQP_TOPOLOGY_DIR,
+			"mode":   cfg.Env.MODE,
+		})
+		return nil, err
+	}
+	return topology, nil
+}
+
+// EnsureBroker ensures the message broker selected by BROKER is initialized.
+// For amqp the AMQP connection is ensured (and the topology applied); for redis
+// the Redis client is ensured and the topology is only used for routing.
+func (cfg *AppConfig) EnsureBroker() error {
+	if cfg.Broker != nil {
+		return nil
+	}
+
+	switch cfg.Env.BROKER {
+	case broker.BackendAMQP, "":
+		if err := cfg.EnsureAMQP(); err != nil {
+			return err
+		}
+		cfg.Broker = broker.NewAMQPWithOptions(cfg.AMQP, cfg.AMQPTopology, amqp.PublisherOptions{
+			PoolSize:       cfg.Env.AMQP_PUBLISHER_POOL_SIZE,
+			ConfirmTimeout: time.Duration(cfg.Env.AMQP_PUBLISH_TIMEOUT) * time.Millisecond,
+		})
+
+	case broker.BackendRedis:
+		if cfg.Redis == nil {
+			cfg.Redis = cfg.Env.InitRedis()
+		}
+		if cfg.AMQPTopology == nil {
+			topology, err := cfg.loadAMQPTopology()
+			if err != nil {
+				return err
+			}
+			cfg.AMQPTopology = topology
+		}
+		group := cfg.Env.REDIS_STREAM_GROUP
+		if group == "" {
+			group = cfg.Env.FIBER_APP_NAME
+		}
+		cfg.Broker = broker.NewRedis(cfg.Redis, cfg.AMQPTopology, broker.RedisOptions{
+			Group:      group,
+			MaxRetries: cfg.Env.REDIS_STREAM_MAX_RETRIES,
+			ClaimIdle:  time.Duration(cfg.Env.REDIS_STREAM_CLAIM_IDLE) * time.Millisecond,
+		})
+
+	default:
+		err := fmt.Errorf("%w: %s", broker.ErrUnknownBackend, cfg.Env.BROKER)
+		helper.LogError("Failed to initialize message broker", err, "", map[string]interface{}{
+			"source": "AppConfig.EnsureBroker",
+			"broker": cfg.Env.BROKER,
+		})
+		return err
+	}
+
+	helper.LogInfo("Message broker initialized", map[string]interface{}{
+		"source":  "AppConfig.EnsureBroker",
+		"backend": cfg.Broker.Backend(),
+	})
+	return nil
+}
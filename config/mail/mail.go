@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"net/textproto"
+	"sync"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// Mailer sends emails. The usecases send through the queue mailer of
+// src/event, which the mail consumer delivers with SMTPMailer or LogMailer.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// IsPermanent tells whether err is a permanent SMTP failure (5xx reply, e.g. an
+// unknown recipient) that retrying cannot fix
+func IsPermanent(err error) bool {
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// LogMailer logs emails instead of sending them, for development: the links
+// of verification and password reset emails can be copied from the log
+type LogMailer struct{}
+
+// NewLogMailer creates a log-only mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs msg
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	helper.LogInfo("Email not sent (MAIL_DRIVER=log)", map[string]interface{}{
+		"source":  "LogMailer.Send",
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"text":    msg.Text,
+	})
+	return nil
+}
+
+// MemoryMailer keeps the emails it is given, for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates an in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send stores msg
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets the emails sent so far
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
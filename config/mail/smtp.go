@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPOptions configures SMTPMailer
+type SMTPOptions struct {
+	Host string
+	Port int // default 587
+	// Username and Password authenticate with PLAIN auth (empty = no auth);
+	// net/smtp only sends them over TLS or to localhost
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it
+type SMTPMailer struct {
+	opts SMTPOptions
+	// sendMail is smtp.SendMail; it cannot be cancelled, so ctx only stops a
+	// send that has not started yet
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPMailer creates an SMTP mailer
+func NewSMTPMailer(opts SMTPOptions) (*SMTPMailer, error) {
+	if opts.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	if opts.From == "" {
+		return nil, errors.New("smtp from address is required")
+	}
+	if opts.Port <= 0 {
+		opts.Port = 587
+	}
+	return &SMTPMailer{opts: opts, sendMail: smtp.SendMail}, nil
+}
+
+// Send sends msg to msg.To
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+	addr := net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port))
+	return m.sendMail(addr, auth, m.opts.From, []string{msg.To}, m.format(msg))
+}
+
+// headerReplacer keeps line breaks out of header values
+var headerReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// format renders msg as an RFC 5322 message; the subject is Q-encoded when it
+// is not ASCII
+func (m *SMTPMailer) format(msg Message) []byte {
+	subject := headerReplacer.Replace(msg.Subject)
+	var b strings.Builder
+	b.WriteString("From: " + m.opts.From + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
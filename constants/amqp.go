@@ -7,15 +7,52 @@ const (
 	// User Queue Names
 	UserCreatedQueueName = "user_created_queue"
 	UserUpdatedQueueName = "user_updated_queue"
+	UserImportQueueName  = "user_import_queue"
 
 	// User Routing Keys
 	UserCreatedRouteKey = "user.created"
 	UserUpdatedRouteKey = "user.updated"
+	UserImportRouteKey  = "user.import"
 
-	// Queue Type
-	QueueType = "quorum"
+	// Exchange/queue types, retry intervals and bindings are declared in
+	// config/amqp/topology/user.yaml and applied at startup
+)
+
+const (
+	// User domain event routing keys (published by this service on UserExchangeName).
+	// They differ from the command keys above so the service never consumes its own events.
+	UserCreatedEventRouteKey = "user.event.created"
+	UserUpdatedEventRouteKey = "user.event.updated"
+	UserDeletedEventRouteKey = "user.event.deleted"
+)
+
+const (
+	// User RPC (request/reply) queue and routing keys
+	UserRPCQueueName   = "user_rpc_queue"
+	UserGetRPCRouteKey = "user.rpc.get"
+)
+
+const (
+	// CloudEvents type and dataschema prefixes; the routing key completes both
+	// (e.g. type "boilerblade.user.created", dataschema "urn:boilerblade:schema:user.created:v1")
+	EventTypePrefix   = "boilerblade."
+	EventSchemaPrefix = "urn:boilerblade:schema:"
+
+	// Initial payload schema version
+	SchemaVersionV1 = "v1"
+
+	// CloudEvents types of consumed user messages
+	UserCreatedEventType = EventTypePrefix + UserCreatedRouteKey
+	UserUpdatedEventType = EventTypePrefix + UserUpdatedRouteKey
+)
+
+const (
+	// Mail exchange, queue and routing key: emails are sent asynchronously by
+	// the mail consumer (see config/amqp/topology/mail.yaml)
+	MailExchangeName = "mail"
+	MailQueueName    = "mail_queue"
+	MailSendRouteKey = "mail.send"
 
-	// Queue Interval (in milliseconds)
-	UserCreatedQueueInterval = 3000
-	UserUpdatedQueueInterval = 3000
+	// CloudEvents type of queued emails
+	MailSendEventType = EventTypePrefix + MailSendRouteKey
 )
@@ -40,12 +40,16 @@ func LogRequest(source, api string, payload, responseBody interface{}, statusCod
 // LogError logs error information
 func LogError(source string, err error, api string, payload interface{}) {
 	_, fn, line, _ := runtime.Caller(1)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
 	log.WithFields(logrus.Fields{
 		"filename": fn,
 		"line":     line,
 		"url":      api,
 		"payload":  payload,
-		"error":    err.Error(),
+		"error":    errMsg,
 	}).Error(source)
 }
 
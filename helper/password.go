@@ -0,0 +1,169 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords with argon2id (PHC string format) or bcrypt
+type PasswordHasher struct {
+	Algorithm string // PasswordArgon2id or PasswordBcrypt
+
+	// argon2id parameters
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+
+	// bcrypt cost
+	BcryptCost int
+
+	// AllowPlaintext accepts passwords stored in plaintext before hashing was
+	// introduced (and has them rehashed), until `auth hash-passwords` has run
+	AllowPlaintext bool
+}
+
+// DefaultPasswordHasher returns argon2id with the OWASP minimum parameters
+// (19 MiB, 2 iterations, 1 lane); bcrypt, when selected, uses cost 12.
+// Plaintext rows are refused.
+func DefaultPasswordHasher() PasswordHasher {
+	return PasswordHasher{
+		Algorithm:   PasswordArgon2id,
+		Memory:      19456,
+		Iterations:  2,
+		Parallelism: 1,
+		BcryptCost:  12,
+	}
+}
+
+var (
+	passwordHasherMu sync.RWMutex
+	passwordHasher   = DefaultPasswordHasher()
+)
+
+// SetPasswordHasher sets the hasher used by HashPassword and VerifyPassword
+func SetPasswordHasher(h PasswordHasher) {
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	passwordHasher = h
+}
+
+// GetPasswordHasher returns the hasher used by HashPassword and VerifyPassword
+func GetPasswordHasher() PasswordHasher {
+	passwordHasherMu.RLock()
+	defer passwordHasherMu.RUnlock()
+	return passwordHasher
+}
+
+// HashPassword hashes password with the configured hasher
+func HashPassword(password string) (string, error) {
+	return GetPasswordHasher().Hash(password)
+}
+
+// VerifyPassword checks password against a stored hash with the configured hasher.
+// rehash is true when the password matched a hash made with another algorithm or
+// other parameters (or a legacy plaintext value, see AllowPlaintext) and should
+// be hashed again.
+func VerifyPassword(stored, password string) (ok, rehash bool) {
+	return GetPasswordHasher().Verify(stored, password)
+}
+
+// IsPasswordHash reports whether stored is an argon2id or bcrypt hash rather
+// than a legacy plaintext password
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$") || isBcryptHash(stored)
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// Hash hashes password with h.Algorithm
+func (h PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == PasswordBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("hashing password: %w", err)
+		}
+		return string(hash), nil
+	}
+	if h.Algorithm != PasswordArgon2id {
+		return "", fmt.Errorf("unknown password hash algorithm %q", h.Algorithm)
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks password against stored, which is an argon2id or bcrypt hash,
+// or, with AllowPlaintext, a plaintext password stored before hashing was
+// introduced. See VerifyPassword.
+func (h PasswordHasher) Verify(stored, password string) (ok, rehash bool) {
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		var version int
+		var memory, iterations uint32
+		var parallelism uint8
+		parts := strings.Split(stored, "$")
+		if len(parts) != 6 {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+			return false, false
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, false
+		}
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil || len(key) == 0 {
+			return false, false
+		}
+		computed := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false
+		}
+		return true, h.Algorithm != PasswordArgon2id || memory != h.Memory || iterations != h.Iterations || parallelism != h.Parallelism
+
+	case isBcryptHash(stored):
+		if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+			return false, false
+		}
+		cost, _ := bcrypt.Cost([]byte(stored))
+		return true, h.Algorithm != PasswordBcrypt || cost != h.BcryptCost
+
+	default:
+		// Legacy plaintext row: accept it once and have it hashed
+		if !h.AllowPlaintext || stored == "" || subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return false, false
+		}
+		return true, true
+	}
+}
@@ -0,0 +1,317 @@
+package cli
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/amqp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// defaultTopologyDir is the topology directory relative to the project root
+const defaultTopologyDir = "config/amqp/topology"
+
+// HandleAMQPCommand processes the amqp command
+func HandleAMQPCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("amqp subcommand is required (topology, publish, tail, replay, stats, stream)")
+	}
+
+	switch args[0] {
+	case "topology":
+		return handleTopologyCommand(args[1:])
+	case "publish":
+		return handlePublishCommand(args[1:])
+	case "tail":
+		return handleTailCommand(args[1:])
+	case "replay":
+		return handleReplayCommand(args[1:])
+	case "stats":
+		return handleStatsCommand(args[1:])
+	case "stream":
+		return handleStreamCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown amqp subcommand: %s. Available: topology, publish, tail, replay, stats, stream", args[0])
+	}
+}
+
+// handlePublishCommand processes "amqp publish -exchange=x -key=y [-file=body.json] [-header k=v]"
+func handlePublishCommand(args []string) error {
+	opts := publishOptions{Headers: map[string]interface{}{}}
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	fs.StringVar(&opts.Exchange, "exchange", "", "Exchange (empty = default exchange)")
+	fs.StringVar(&opts.RoutingKey, "key", "", "Routing key (required)")
+	fs.StringVar(&opts.ContentType, "content-type", "application/json", "Content type")
+	fs.StringVar(&opts.MessageID, "message-id", "", "Message ID (generated when empty)")
+	fs.Var(headerFlags(opts.Headers), "header", "Header key=value (repeatable)")
+	file := fs.String("file", "-", "Body file (- = stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.RoutingKey == "" {
+		return fmt.Errorf("-key is required")
+	}
+
+	var body []byte
+	var err error
+	if *file == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("reading body: %w", err)
+	}
+
+	conn, err := connectAMQP()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return publishMessage(conn, opts, body, os.Stdout)
+}
+
+// handleTailCommand processes "amqp tail -queue=x [-n=10]"
+func handleTailCommand(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	queue := fs.String("queue", "", "Queue to peek at (required)")
+	limit := fs.Int("n", 10, "Number of messages to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *queue == "" {
+		return fmt.Errorf("-queue is required")
+	}
+
+	conn, err := connectAMQP()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return tailQueue(conn, *queue, *limit, os.Stdout)
+}
+
+// handleReplayCommand processes "amqp replay -queue=x.error [filters] [-dry-run]"
+func handleReplayCommand(args []string) error {
+	opts := replayOptions{Headers: map[string]interface{}{}}
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.StringVar(&opts.Queue, "queue", "", "Queue to replay from, e.g. user_created_queue.retry or user_created_queue.error (required)")
+	fs.StringVar(&opts.Exchange, "exchange", "", "Target exchange (default: the original exchange)")
+	fs.StringVar(&opts.RoutingKey, "key", "", "Target routing key (default: the original routing key)")
+	fs.StringVar(&opts.KeyFilter, "filter-key", "", "Only messages whose original routing key matches this topic pattern")
+	fs.Var(headerFlags(opts.Headers), "filter-header", "Only messages with header key=value (repeatable)")
+	fs.StringVar(&opts.Contains, "contains", "", "Only messages whose body contains this text")
+	fs.IntVar(&opts.Limit, "limit", 0, "Maximum number of messages to replay (0 = all)")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Show what would be replayed without moving anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.Queue == "" {
+		return fmt.Errorf("-queue is required")
+	}
+
+	conn, err := connectAMQP()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return replayMessages(conn, opts, os.Stdout)
+}
+
+// handleStatsCommand processes "amqp stats [-queue=a,b]"
+func handleStatsCommand(args []string) error {
+	env, err := loadEnv()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	dir := fs.String("dir", defaultTopologyDir, "Topology directory")
+	mode := fs.String("env", env.MODE, "Environment override subdirectory (defaults to MODE)")
+	extra := fs.String("queue", "", "Extra queues, comma separated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	topology, err := amqp.LoadTopology(*dir, *mode)
+	if err != nil {
+		return fmt.Errorf("loading topology: %w", err)
+	}
+
+	var queues []string
+	if *extra != "" {
+		queues = strings.Split(*extra, ",")
+	}
+
+	conn, err := dialAMQP(env)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return queueStats(conn, topology, queues, os.Stdout)
+}
+
+// handleStreamCommand processes "amqp stream read|replay"
+func handleStreamCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("stream action is required (read or replay)")
+	}
+
+	fs := flag.NewFlagSet("stream "+args[0], flag.ContinueOnError)
+	stream := fs.String("stream", "user_events_stream", "Stream queue")
+	wait := fs.Int("wait", 2000, "ms to wait for a message before giving up")
+
+	switch args[0] {
+	case "read":
+		from := fs.String("from", "first", "Start: first, last, next, an offset or an RFC 3339 timestamp")
+		limit := fs.Int("n", 10, "Number of messages to show")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		offset, err := amqp.ParseStreamOffset(*from)
+		if err != nil {
+			return err
+		}
+
+		conn, err := connectAMQP()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return readStream(conn, *stream, offset, *limit, time.Duration(*wait)*time.Millisecond, os.Stdout)
+
+	case "replay":
+		consumer := fs.String("consumer", "", "Stream consumer name whose offset is rewound (required)")
+		since := fs.String("since", "", "Replay from: first, an offset or an RFC 3339 timestamp (required)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *consumer == "" || *since == "" {
+			return fmt.Errorf("-consumer and -since are required")
+		}
+		offset, err := amqp.ParseStreamOffset(*since)
+		if err != nil {
+			return err
+		}
+
+		env, err := loadEnv()
+		if err != nil {
+			return err
+		}
+		store, err := openOffsetStore(env)
+		if err != nil {
+			return err
+		}
+		conn, err := dialAMQP(env)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*wait)*time.Millisecond)
+		defer cancel()
+		return rewindStream(ctx, conn, store, *stream, *consumer, offset, os.Stdout)
+
+	default:
+		return fmt.Errorf("unknown stream action: %s. Available: read, replay", args[0])
+	}
+}
+
+// handleTopologyCommand processes "amqp topology apply|diff"
+func handleTopologyCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("topology action is required (apply or diff)")
+	}
+	action := args[0]
+
+	env, err := loadEnv()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("topology", flag.ContinueOnError)
+	dir := fs.String("dir", defaultTopologyDir, "Topology directory")
+	mode := fs.String("env", env.MODE, "Environment override subdirectory (defaults to MODE)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	topology, err := amqp.LoadTopology(*dir, *mode)
+	if err != nil {
+		return fmt.Errorf("loading topology: %w", err)
+	}
+
+	conn, err := dialAMQP(env)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch action {
+	case "apply":
+		channel, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("opening channel: %w", err)
+		}
+		defer channel.Close()
+		if err := topology.Apply(channel); err != nil {
+			return err
+		}
+		expanded := topology.Expand()
+		fmt.Printf("✓ Topology applied: %d exchanges, %d queues, %d bindings\n",
+			len(expanded.Exchanges), len(expanded.Queues), len(expanded.Bindings))
+
+	case "diff":
+		changes, err := topology.Diff(conn)
+		if err != nil {
+			return err
+		}
+		symbols := map[string]string{"create": "+", "ok": "=", "conflict": "!"}
+		for _, change := range changes {
+			line := fmt.Sprintf("%s %-8s %s", symbols[change.Action], change.Kind, change.Name)
+			if change.Detail != "" {
+				line += " (" + change.Detail + ")"
+			}
+			fmt.Println(line)
+		}
+		fmt.Println("Bindings cannot be inspected over AMQP; apply re-declares them idempotently.")
+
+	default:
+		return fmt.Errorf("unknown topology action: %s. Available: apply, diff", action)
+	}
+
+	return nil
+}
+
+// loadEnv reads the same environment variables as the application
+func loadEnv() (*config.Env, error) {
+	env := &config.Env{}
+	if err := envconfig.Process("", env); err != nil {
+		return nil, fmt.Errorf("loading environment: %w", err)
+	}
+	return env, nil
+}
+
+// connectAMQP loads the environment and connects to AMQP
+func connectAMQP() (amqp.IAMQPConnection, error) {
+	env, err := loadEnv()
+	if err != nil {
+		return nil, err
+	}
+	return dialAMQP(env)
+}
+
+// dialAMQP connects with the application's AMQP_* settings
+func dialAMQP(env *config.Env) (amqp.IAMQPConnection, error) {
+	conn := env.InitAMQP()
+	if conn == nil {
+		return nil, fmt.Errorf("could not connect to AMQP at %s:%s", env.AMQP_HOST, env.AMQP_PORT)
+	}
+	return *conn, nil
+}
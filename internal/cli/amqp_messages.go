@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"boilerblade/config/amqp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// headerFlags collects repeated -header key=value flags
+type headerFlags amqplib.Table
+
+func (h headerFlags) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("header must be key=value, got %q", value)
+	}
+	h[key] = val
+	return nil
+}
+
+// publishOptions are the flags of "amqp publish"
+type publishOptions struct {
+	Exchange    string
+	RoutingKey  string
+	ContentType string
+	MessageID   string
+	Headers     amqplib.Table
+}
+
+// publishMessage publishes body with confirms; unroutable messages fail
+func publishMessage(conn amqp.IAMQPConnection, opts publishOptions, body []byte, out io.Writer) error {
+	publisher := amqp.NewPublisher(conn, amqp.DefaultPublisherOptions())
+	defer publisher.Close()
+
+	msg := amqplib.Publishing{
+		ContentType: opts.ContentType,
+		MessageId:   opts.MessageID,
+		Headers:     opts.Headers,
+		Body:        body,
+	}
+	if err := publisher.Publish(context.Background(), opts.Exchange, opts.RoutingKey, msg); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "✓ Published %d bytes to %s with routing key %s\n", len(body), exchangeLabel(opts.Exchange), opts.RoutingKey)
+	return nil
+}
+
+// tailQueue prints up to limit messages of queue without consuming them. The
+// messages are fetched unacked and requeued at the end, so they keep their place
+// at the head of the queue but are marked redelivered.
+func tailQueue(conn amqp.IAMQPConnection, queue string, limit int, out io.Writer) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("opening channel: %w", err)
+	}
+	defer channel.Close()
+
+	raw := channel.GetChannel()
+	var peeked []amqplib.Delivery
+	defer func() {
+		for _, d := range peeked {
+			d.Nack(false, true)
+		}
+	}()
+
+	for len(peeked) < limit {
+		d, ok, err := raw.Get(queue, false)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", queue, err)
+		}
+		if !ok {
+			break
+		}
+		peeked = append(peeked, d)
+		printDelivery(out, len(peeked), d)
+	}
+
+	fmt.Fprintf(out, "%d message(s) shown from %s\n", len(peeked), queue)
+	return nil
+}
+
+// replayOptions are the flags of "amqp replay"
+type replayOptions struct {
+	Queue      string
+	Exchange   string // overrides the original exchange
+	RoutingKey string // overrides the original routing key
+	KeyFilter  string // topic pattern on the original routing key
+	Headers    amqplib.Table
+	Contains   string
+	Limit      int
+	DryRun     bool
+}
+
+// replayMessages moves messages from a .retry or .error queue back to the exchange
+// they were originally published to. Messages that do not match the filters, and
+// all messages in a dry run, are left in the queue.
+func replayMessages(conn amqp.IAMQPConnection, opts replayOptions, out io.Writer) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("opening channel: %w", err)
+	}
+	defer channel.Close()
+
+	var publisher *amqp.Publisher
+	if !opts.DryRun {
+		publisher = amqp.NewPublisher(conn, amqp.DefaultPublisherOptions())
+		defer publisher.Close()
+	}
+
+	// Skipped messages stay unacked until the end, otherwise basic.get returns them again
+	raw := channel.GetChannel()
+	var kept []amqplib.Delivery
+	defer func() {
+		for _, d := range kept {
+			d.Nack(false, true)
+		}
+	}()
+
+	replayed := 0
+	for opts.Limit <= 0 || replayed < opts.Limit {
+		d, ok, err := raw.Get(opts.Queue, false)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", opts.Queue, err)
+		}
+		if !ok {
+			break
+		}
+
+		exchange, routingKey, found := originalDestination(d)
+		if opts.Exchange != "" {
+			exchange, found = opts.Exchange, true
+		}
+		if opts.RoutingKey != "" {
+			routingKey = opts.RoutingKey
+		}
+		if !found || !matchesReplay(d, routingKey, opts) {
+			kept = append(kept, d)
+			continue
+		}
+
+		if opts.DryRun {
+			fmt.Fprintf(out, "would replay %s → %s %s\n", d.MessageId, exchangeLabel(exchange), routingKey)
+			kept = append(kept, d)
+			replayed++
+			continue
+		}
+
+		if err := publisher.Publish(context.Background(), exchange, routingKey, replayPublishing(d)); err != nil {
+			kept = append(kept, d)
+			return fmt.Errorf("replaying %s: %w", d.MessageId, err)
+		}
+		d.Ack(false)
+		replayed++
+		fmt.Fprintf(out, "replayed %s → %s %s\n", d.MessageId, exchangeLabel(exchange), routingKey)
+	}
+
+	verb := "replayed"
+	if opts.DryRun {
+		verb = "would be replayed (dry run)"
+	}
+	fmt.Fprintf(out, "%d message(s) %s, %d left in %s\n", replayed, verb, len(kept), opts.Queue)
+	return nil
+}
+
+// queueStats prints depth and consumers of every queue of the expanded topology plus extra
+func queueStats(conn amqp.IAMQPConnection, topology *amqp.Topology, extra []string, out io.Writer) error {
+	var names []string
+	for _, q := range topology.Expand().Queues {
+		names = append(names, q.Name)
+	}
+	names = append(names, extra...)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tMESSAGES\tCONSUMERS")
+	for _, name := range names {
+		// A missing queue closes the channel, so each inspection gets its own
+		channel, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("opening channel: %w", err)
+		}
+		state, err := channel.QueueInspect(name)
+		channel.Close()
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t(%v)\n", name, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", name, state.Messages, state.Consumers)
+	}
+	return w.Flush()
+}
+
+// originalDestination returns where a parked message was first published: the
+// x-original-* headers of an error queue message, or the first x-death entry
+// of a dead-lettered (retry) message
+func originalDestination(d amqplib.Delivery) (exchange, routingKey string, ok bool) {
+	if key, found := d.Headers[amqp.OriginalRoutingKeyHeader].(string); found {
+		exchange, _ = d.Headers[amqp.OriginalExchangeHeader].(string)
+		return exchange, key, true
+	}
+
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	firstQueue, _ := d.Headers["x-first-death-queue"].(string)
+	for i := len(deaths) - 1; i >= 0; i-- {
+		death, isTable := deaths[i].(amqplib.Table)
+		if !isTable || (firstQueue != "" && death["queue"] != firstQueue) {
+			continue
+		}
+		exchange, _ = death["exchange"].(string)
+		if keys, _ := death["routing-keys"].([]interface{}); len(keys) > 0 {
+			routingKey, _ = keys[0].(string)
+		}
+		return exchange, routingKey, true
+	}
+	return "", "", false
+}
+
+func matchesReplay(d amqplib.Delivery, routingKey string, opts replayOptions) bool {
+	if opts.KeyFilter != "" && !amqp.MatchTopic(opts.KeyFilter, routingKey) {
+		return false
+	}
+	for k, v := range opts.Headers {
+		if fmt.Sprint(d.Headers[k]) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return opts.Contains == "" || strings.Contains(string(d.Body), opts.Contains)
+}
+
+// replayPublishing copies d without the dead-letter and error queue headers,
+// so the replayed message starts over
+func replayPublishing(d amqplib.Delivery) amqplib.Publishing {
+	publishing := amqp.DeliveryPublishing(d)
+	for k := range publishing.Headers {
+		if k == "x-death" || strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-error") || strings.HasPrefix(k, "x-original-") {
+			delete(publishing.Headers, k)
+		}
+	}
+	return publishing
+}
+
+func printDelivery(out io.Writer, n int, d amqplib.Delivery) {
+	fmt.Fprintf(out, "#%d exchange=%s routing_key=%s message_id=%s redelivered=%v\n", n, exchangeLabel(d.Exchange), d.RoutingKey, d.MessageId, d.Redelivered)
+	if len(d.Headers) > 0 {
+		headers, _ := json.Marshal(d.Headers)
+		fmt.Fprintf(out, "   headers: %s\n", headers)
+	}
+	fmt.Fprintf(out, "   body: %s\n", d.Body)
+}
+
+func exchangeLabel(exchange string) string {
+	if exchange == "" {
+		return "(default)"
+	}
+	return exchange
+}
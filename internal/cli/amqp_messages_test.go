@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// newOrdersBroker declares the orders exchange with orders_queue bound to
+// order.*, dead-lettering into orders_queue.retry, and orders_queue.error
+func newOrdersBroker(t *testing.T) *amqptest.Broker {
+	fake := amqptest.NewBroker()
+	ch, _ := fake.Channel()
+	defer ch.Close()
+
+	if err := ch.ExchangeDeclare("orders", "topic", true, false, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare exchange: %v", err)
+	}
+	queues := map[string]amqplib.Table{
+		"orders_queue": {
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "orders_queue.retry",
+		},
+		"orders_queue.retry": nil,
+		"orders_queue.error": nil,
+	}
+	for name, args := range queues {
+		if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+			t.Fatalf("Failed to declare queue %s: %v", name, err)
+		}
+	}
+	if err := ch.QueueBind("orders_queue", "order.*", "orders", false, nil); err != nil {
+		t.Fatalf("Failed to bind queue: %v", err)
+	}
+	return fake
+}
+
+// deadLetter publishes body to orders and rejects it into orders_queue.retry
+func deadLetter(t *testing.T, fake *amqptest.Broker, routingKey, body string) {
+	if err := fake.Deliver("orders", routingKey, amqplib.Publishing{MessageId: body, Body: []byte(body)}); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	d, ok, err := ch.GetChannel().Get("orders_queue", false)
+	if err != nil || !ok {
+		t.Fatalf("Get failed: ok=%v err=%v", ok, err)
+	}
+	d.Nack(false, false)
+}
+
+// park moves a message from orders_queue to orders_queue.error as a consumer would
+func park(t *testing.T, fake *amqptest.Broker, routingKey, body string) {
+	if err := fake.Deliver("orders", routingKey, amqplib.Publishing{MessageId: body, Body: []byte(body)}); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	d, ok, err := ch.GetChannel().Get("orders_queue", false)
+	if err != nil || !ok {
+		t.Fatalf("Get failed: ok=%v err=%v", ok, err)
+	}
+	msg := amqp.ErrorPublishing(d, "orders_queue", "test", errors.New("invalid payload"))
+	if err := ch.Publish("", amqp.ErrorQueueName("orders_queue"), false, false, msg); err != nil {
+		t.Fatalf("Publish to error queue failed: %v", err)
+	}
+	d.Ack(false)
+}
+
+func TestReplayMessages_FromRetryQueue(t *testing.T) {
+	fake := newOrdersBroker(t)
+	deadLetter(t, fake, "order.created", `{"id":1}`)
+
+	var out bytes.Buffer
+	if err := replayMessages(fake, replayOptions{Queue: "orders_queue.retry"}, &out); err != nil {
+		t.Fatalf("replayMessages failed: %v", err)
+	}
+
+	if stats := fake.Stats("orders_queue.retry"); stats.Ready != 0 {
+		t.Errorf("Expected the retry queue to be drained, got %+v", stats)
+	}
+	replayed := fake.ExpectPublished(t, "orders", "order.created")
+	if _, found := replayed.Headers["x-death"]; found {
+		t.Errorf("Expected x-death to be stripped, got %v", replayed.Headers)
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != 1 {
+		t.Errorf("Expected the message back in orders_queue, got %+v", stats)
+	}
+}
+
+func TestReplayMessages_FromErrorQueueWithFilters(t *testing.T) {
+	fake := newOrdersBroker(t)
+	park(t, fake, "order.created", `{"id":1}`)
+	park(t, fake, "order.cancelled", `{"id":2}`)
+	park(t, fake, "order.created", `{"id":3}`)
+
+	var out bytes.Buffer
+	opts := replayOptions{Queue: "orders_queue.error", KeyFilter: "order.created", Contains: `"id":3`}
+	if err := replayMessages(fake, opts, &out); err != nil {
+		t.Fatalf("replayMessages failed: %v", err)
+	}
+
+	replayed := fake.ExpectPublished(t, "orders", "order.created")
+	if string(replayed.Body) != `{"id":3}` {
+		t.Errorf("Expected only the matching message to be replayed, got %s", replayed.Body)
+	}
+	for k := range replayed.Headers {
+		if strings.HasPrefix(k, "x-error") || strings.HasPrefix(k, "x-original-") {
+			t.Errorf("Expected header %s to be stripped", k)
+		}
+	}
+	if stats := fake.Stats("orders_queue.error"); stats.Ready != 2 {
+		t.Errorf("Expected 2 non-matching messages to stay, got %+v", stats)
+	}
+}
+
+func TestReplayMessages_DryRunAndLimit(t *testing.T) {
+	fake := newOrdersBroker(t)
+	for _, body := range []string{"a", "b", "c"} {
+		park(t, fake, "order.created", body)
+	}
+
+	var out bytes.Buffer
+	if err := replayMessages(fake, replayOptions{Queue: "orders_queue.error", Limit: 2, DryRun: true}, &out); err != nil {
+		t.Fatalf("replayMessages failed: %v", err)
+	}
+	if strings.Count(out.String(), "would replay") != 2 {
+		t.Errorf("Expected 2 messages listed, got:\n%s", out.String())
+	}
+	if stats := fake.Stats("orders_queue.error"); stats.Ready != 3 {
+		t.Errorf("Expected a dry run to leave every message in place, got %+v", stats)
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != 0 {
+		t.Errorf("Expected nothing to be replayed, got %+v", stats)
+	}
+}
+
+func TestTailQueue_LeavesMessages(t *testing.T) {
+	fake := newOrdersBroker(t)
+	for _, body := range []string{`{"id":1}`, `{"id":2}`} {
+		fake.Deliver("orders", "order.created", amqplib.Publishing{Body: []byte(body)})
+	}
+
+	var out bytes.Buffer
+	if err := tailQueue(fake, "orders_queue", 10, &out); err != nil {
+		t.Fatalf("tailQueue failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `{"id":2}`) || !strings.Contains(out.String(), "2 message(s) shown") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != 2 || stats.Unacked != 0 {
+		t.Errorf("Expected both messages to stay ready, got %+v", stats)
+	}
+}
+
+func TestPublishMessage(t *testing.T) {
+	fake := newOrdersBroker(t)
+	headers := amqplib.Table{}
+	if err := headerFlags(headers).Set("tenant=acme"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	opts := publishOptions{Exchange: "orders", RoutingKey: "order.created", ContentType: "application/json", Headers: headers}
+	if err := publishMessage(fake, opts, []byte(`{"id":1}`), &out); err != nil {
+		t.Fatalf("publishMessage failed: %v", err)
+	}
+	if msg := fake.ExpectPublished(t, "orders", "order.created"); msg.Headers["tenant"] != "acme" {
+		t.Errorf("Expected header tenant=acme, got %v", msg.Headers)
+	}
+
+	opts.Exchange, opts.RoutingKey = "", "missing_queue"
+	var returned *amqp.ReturnedError
+	if err := publishMessage(fake, opts, nil, &out); !errors.As(err, &returned) {
+		t.Errorf("Expected an unroutable message to fail, got %v", err)
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	fake := newOrdersBroker(t)
+	fake.Deliver("orders", "order.created", amqplib.Publishing{})
+
+	topology, err := amqp.ParseTopology([]byte(`
+exchanges:
+  - name: orders
+    type: topic
+queues:
+  - name: orders_queue
+bindings:
+  - exchange: orders
+    queue: orders_queue
+    routing_key: order.*
+`))
+	if err != nil {
+		t.Fatalf("ParseTopology failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := queueStats(fake, topology, []string{"missing_queue"}, &out); err != nil {
+		t.Fatalf("queueStats failed: %v", err)
+	}
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 3 {
+			rows[fields[0]] = fields
+		}
+	}
+	if row := rows["orders_queue"]; row == nil || row[1] != "1" || row[2] != "0" {
+		t.Errorf("Expected orders_queue with 1 message and no consumers:\n%s", out.String())
+	}
+	if rows[amqp.ErrorQueueName("orders_queue")] == nil {
+		t.Errorf("Expected the error queue of the expanded topology:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "missing_queue") {
+		t.Errorf("Expected the extra queue to be listed:\n%s", out.String())
+	}
+}
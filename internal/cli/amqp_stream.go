@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
+	"boilerblade/src/repository"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// readStream prints up to limit messages of stream starting at from. It attaches
+// a throwaway consumer, so no offset is committed; reading stops early once no
+// message arrived for idle.
+func readStream(conn amqp.IAMQPConnection, stream string, from amqp.StreamOffset, limit int, idle time.Duration, out io.Writer) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("opening channel: %w", err)
+	}
+	defer channel.Close()
+
+	if err := channel.SetPrefetch(limit); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deliveries, err := channel.Consume(ctx, stream, "", false, false, false, false, map[string]interface{}{
+		amqp.StreamOffsetArg: from.Arg(),
+	})
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", stream, err)
+	}
+
+	shown := 0
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for shown < limit {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				limit = shown
+				continue
+			}
+			d.Ack(false)
+			shown++
+			offset, _ := amqp.DeliveryOffset(d)
+			fmt.Fprintf(out, "offset=%d ", offset)
+			printDelivery(out, shown, d)
+			timer.Reset(idle)
+		case <-timer.C:
+			limit = shown
+		}
+	}
+
+	fmt.Fprintf(out, "%d message(s) shown from %s\n", shown, stream)
+	return nil
+}
+
+// rewindStream points consumer at the first message of stream at or after since,
+// so the next run of that consumer reprocesses the history from there.
+func rewindStream(ctx context.Context, conn amqp.IAMQPConnection, store amqp.OffsetStore, stream, consumer string, since amqp.StreamOffset, out io.Writer) error {
+	offset, found, err := amqp.ResolveStreamOffset(ctx, conn, stream, since)
+	if err != nil {
+		return fmt.Errorf("resolving %s in %s: %w", since, stream, err)
+	}
+	if !found {
+		return fmt.Errorf("no message in %s at or after %s", stream, since)
+	}
+	if err := store.SaveOffset(ctx, stream, consumer, offset); err != nil {
+		return fmt.Errorf("saving offset: %w", err)
+	}
+	fmt.Fprintf(out, "✓ Consumer %s of %s will resume at offset %d (%s)\n", consumer, stream, offset, since)
+	return nil
+}
+
+// openOffsetStore opens the offset store selected by AMQP_STREAM_OFFSET_STORE
+func openOffsetStore(env *config.Env) (amqp.OffsetStore, error) {
+	switch env.AMQP_STREAM_OFFSET_STORE {
+	case "redis", "":
+		client := env.InitRedis()
+		if client == nil {
+			return nil, fmt.Errorf("could not connect to Redis at %s:%s", env.REDIS_HOST, env.REDIS_PORT)
+		}
+		return broker.NewRedisOffsetStore(client), nil
+	case "db":
+		db := env.InitDatabase()
+		if db == nil {
+			return nil, fmt.Errorf("could not connect to the database")
+		}
+		return repository.NewStreamOffsetRepository(db), nil
+	default:
+		return nil, fmt.Errorf("invalid AMQP_STREAM_OFFSET_STORE %q (want redis or db)", env.AMQP_STREAM_OFFSET_STORE)
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// offsetMap is an in-memory amqp.OffsetStore
+type offsetMap map[string]int64
+
+func (m offsetMap) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	offset, ok := m[stream+"/"+consumer]
+	return offset, ok, nil
+}
+
+func (m offsetMap) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	m[stream+"/"+consumer] = offset
+	return nil
+}
+
+// newUserStream declares user_events_stream with a day of history per body
+func newUserStream(t *testing.T, bodies ...string) *amqptest.Broker {
+	fake := amqptest.NewBroker()
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	if _, err := ch.QueueDeclare("user_events_stream", true, false, false, false, amqplib.Table{"x-queue-type": "stream"}); err != nil {
+		t.Fatalf("Failed to declare stream: %v", err)
+	}
+	for _, body := range bodies {
+		fake.Advance(24 * time.Hour)
+		if err := fake.Deliver("", "user_events_stream", amqplib.Publishing{Body: []byte(body)}); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+	}
+	return fake
+}
+
+func TestReadStream(t *testing.T) {
+	fake := newUserStream(t, "a", "b", "c")
+
+	var out bytes.Buffer
+	if err := readStream(fake, "user_events_stream", amqp.OffsetAt(1), 10, 50*time.Millisecond, &out); err != nil {
+		t.Fatalf("readStream failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "offset=1 ") || !strings.Contains(out.String(), "offset=2 ") || strings.Contains(out.String(), "offset=0 ") {
+		t.Errorf("Expected offsets 1 and 2:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "2 message(s) shown") {
+		t.Errorf("Expected reading to stop at the end of the stream:\n%s", out.String())
+	}
+}
+
+func TestRewindStream(t *testing.T) {
+	fake := newUserStream(t, "a", "b", "c")
+	store := offsetMap{"user_events_stream/user-directory": 3}
+
+	// Between the first and second message
+	since := amqp.OffsetTimestamp(fake.Now().Add(-36 * time.Hour))
+	var out bytes.Buffer
+	if err := rewindStream(context.Background(), fake, store, "user_events_stream", "user-directory", since, &out); err != nil {
+		t.Fatalf("rewindStream failed: %v", err)
+	}
+	if offset := store["user_events_stream/user-directory"]; offset != 1 {
+		t.Errorf("Expected the consumer to be rewound to offset 1, got %d", offset)
+	}
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"boilerblade/src/dto"
+	"boilerblade/src/repository"
+	"boilerblade/src/usecase"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// HandleAPIKeyCommand processes the apikey command
+func HandleAPIKeyCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("apikey subcommand is required (create, list, rotate, revoke)")
+	}
+
+	switch args[0] {
+	case "create", "list", "rotate", "revoke":
+	default:
+		return fmt.Errorf("unknown apikey subcommand: %s. Available: create, list, rotate, revoke", args[0])
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	name := fs.String("name", "", "Service the key belongs to (create)")
+	scopes := fs.String("scopes", "", "Comma separated permissions, e.g. users:read (create)")
+	expiresInDays := fs.Int("expires-in-days", 0, "Lifetime in days, 0 = no expiry (create) or the old lifetime (rotate)")
+	id := fs.Uint("id", 0, "API key ID (rotate, revoke)")
+	grace := fs.Int("grace", int(usecase.DefaultAPIKeyGracePeriod.Seconds()), "Seconds the old key keeps working (rotate)")
+	all := fs.Bool("all", false, "Include revoked keys (list)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	env, err := loadEnv()
+	if err != nil {
+		return err
+	}
+	db := env.InitDatabase()
+	if db == nil {
+		return fmt.Errorf("could not connect to the database")
+	}
+	uc := usecase.NewAPIKeyUsecase(repository.NewAPIKeyRepository(db))
+
+	switch args[0] {
+	case "create":
+		req := &dto.CreateAPIKeyRequest{Name: *name, Scopes: splitScopes(*scopes), ExpiresInDays: *expiresInDays}
+		return createAPIKey(uc, req, os.Stdout)
+	case "list":
+		return listAPIKeys(uc, *all, os.Stdout)
+	case "rotate":
+		if *id == 0 {
+			return fmt.Errorf("-id is required")
+		}
+		return rotateAPIKey(uc, uint(*id), &dto.RotateAPIKeyRequest{ExpiresInDays: *expiresInDays, GracePeriod: grace}, os.Stdout)
+	default:
+		if *id == 0 {
+			return fmt.Errorf("-id is required")
+		}
+		if err := uc.Revoke(uint(*id)); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %d\n", *id)
+		return nil
+	}
+}
+
+// createAPIKey issues a key and prints it; it cannot be shown again
+func createAPIKey(uc usecase.APIKeyUsecase, req *dto.CreateAPIKeyRequest, out io.Writer) error {
+	if err := validator.New().Struct(req); err != nil {
+		return fmt.Errorf("invalid API key: %w", err)
+	}
+	created, err := uc.Create(req)
+	if err != nil {
+		return err
+	}
+	printCreatedAPIKey(created, out)
+	return nil
+}
+
+// rotateAPIKey replaces a key and prints the new one
+func rotateAPIKey(uc usecase.APIKeyUsecase, id uint, req *dto.RotateAPIKeyRequest, out io.Writer) error {
+	if err := validator.New().Struct(req); err != nil {
+		return fmt.Errorf("invalid rotation: %w", err)
+	}
+	created, err := uc.Rotate(id, req)
+	if err != nil {
+		return err
+	}
+	printCreatedAPIKey(created, out)
+	if req.GracePeriod != nil {
+		fmt.Fprintf(out, "API key %d keeps working for %d seconds\n", id, *req.GracePeriod)
+	}
+	return nil
+}
+
+func printCreatedAPIKey(created *dto.APIKeyCreatedResponse, out io.Writer) {
+	fmt.Fprintf(out, "API key %d for %s (scopes: %s)\n", created.APIKey.ID, created.APIKey.Name, strings.Join(created.APIKey.Scopes, " "))
+	fmt.Fprintf(out, "Key: %s\n", created.Key)
+	fmt.Fprintln(out, "Store it now: it cannot be shown again.")
+}
+
+// listAPIKeys prints every key, without the keys themselves
+func listAPIKeys(uc usecase.APIKeyUsecase, includeRevoked bool, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tSTATUS")
+	for offset := 0; ; offset += 100 {
+		page, err := uc.List(100, offset, includeRevoked)
+		if err != nil {
+			return err
+		}
+		for _, key := range page.APIKeys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix,
+				strings.Join(key.Scopes, " "), orDash(key.ExpiresAt), orDash(key.LastUsedAt), apiKeyStatus(key))
+		}
+		if len(page.APIKeys) < 100 {
+			break
+		}
+	}
+	return w.Flush()
+}
+
+func apiKeyStatus(key dto.APIKeyResponse) string {
+	switch {
+	case key.RevokedAt != nil:
+		return "revoked"
+	case key.ReplacedByID != nil:
+		return fmt.Sprintf("rotated to %d", *key.ReplacedByID)
+	default:
+		return "active"
+	}
+}
+
+func orDash(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
+
+// splitScopes splits the comma separated -scopes flag
+func splitScopes(s string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
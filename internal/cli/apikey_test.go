@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/src/dto"
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apiKeyList is an in-memory usecase.APIKeyUsecase for the apikey command
+type apiKeyList struct {
+	keys []dto.APIKeyResponse
+}
+
+func (l *apiKeyList) Create(req *dto.CreateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	key := dto.APIKeyResponse{ID: uint(len(l.keys) + 1), Name: req.Name, Prefix: "3f9a1c2b7d4e", Scopes: req.Scopes}
+	l.keys = append(l.keys, key)
+	return &dto.APIKeyCreatedResponse{Key: "bbk_3f9a1c2b7d4e_secret", APIKey: key}, nil
+}
+
+func (l *apiKeyList) List(limit, offset int, includeRevoked bool) (*dto.APIKeyListResponse, error) {
+	var keys []dto.APIKeyResponse
+	for _, key := range l.keys {
+		if includeRevoked || key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
+	}
+	if offset >= len(keys) {
+		return &dto.APIKeyListResponse{Total: int64(len(keys))}, nil
+	}
+	return &dto.APIKeyListResponse{APIKeys: keys[offset:min(offset+limit, len(keys))], Total: int64(len(keys))}, nil
+}
+
+func (l *apiKeyList) Rotate(id uint, req *dto.RotateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	return l.Create(&dto.CreateAPIKeyRequest{Name: l.keys[id-1].Name, Scopes: l.keys[id-1].Scopes})
+}
+
+func (l *apiKeyList) Revoke(id uint) error { return nil }
+
+func (l *apiKeyList) AuthenticateAPIKey(key string) (*auth.Service, error) {
+	return nil, auth.ErrInvalidAPIKey
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	keys := &apiKeyList{}
+	var out bytes.Buffer
+
+	err := createAPIKey(keys, &dto.CreateAPIKeyRequest{Name: "billing-job", Scopes: []string{"users:read", "orders:*"}}, &out)
+	if err != nil {
+		t.Fatalf("createAPIKey failed: %v", err)
+	}
+	for _, want := range []string{"API key 1 for billing-job (scopes: users:read orders:*)", "Key: bbk_3f9a1c2b7d4e_secret"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got %q", want, out.String())
+		}
+	}
+
+	if err := createAPIKey(keys, &dto.CreateAPIKeyRequest{}, &out); err == nil {
+		t.Error("Expected an error without a name")
+	}
+	if len(keys.keys) != 1 {
+		t.Errorf("Expected one key, got %d", len(keys.keys))
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	keys := &apiKeyList{keys: []dto.APIKeyResponse{{ID: 1, Name: "billing-job"}}}
+	var out bytes.Buffer
+
+	grace := 60
+	if err := rotateAPIKey(keys, 1, &dto.RotateAPIKeyRequest{GracePeriod: &grace}, &out); err != nil {
+		t.Fatalf("rotateAPIKey failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "API key 2 for billing-job") || !strings.Contains(out.String(), "API key 1 keeps working for 60 seconds") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	revokedAt, expiresAt, replacedBy := "2024-01-03 00:00:00", "2024-04-01 00:00:00", uint(4)
+	keys := &apiKeyList{keys: []dto.APIKeyResponse{
+		{ID: 1, Name: "active-job", Scopes: []string{"users:read"}, ExpiresAt: &expiresAt},
+		{ID: 2, Name: "revoked-job", RevokedAt: &revokedAt},
+		{ID: 3, Name: "rotated-job", ReplacedByID: &replacedBy},
+	}}
+
+	var out bytes.Buffer
+	if err := listAPIKeys(keys, false, &out); err != nil {
+		t.Fatalf("listAPIKeys failed: %v", err)
+	}
+	if strings.Contains(out.String(), "revoked-job") {
+		t.Errorf("Expected revoked keys to be hidden, got %q", out.String())
+	}
+	for _, want := range []string{"2024-04-01 00:00:00", "active", "rotated to 4"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got %q", want, out.String())
+		}
+	}
+
+	out.Reset()
+	listAPIKeys(keys, true, &out)
+	if !strings.Contains(out.String(), "revoked") {
+		t.Errorf("Expected revoked keys with -all, got %q", out.String())
+	}
+}
+
+func TestSplitScopes(t *testing.T) {
+	if got := splitScopes(" users:read, ,orders:* "); !slices.Equal(got, []string{"users:read", "orders:*"}) {
+		t.Errorf("splitScopes() = %v", got)
+	}
+	if got := splitScopes(""); got != nil {
+		t.Errorf("splitScopes(\"\") = %v, want nil", got)
+	}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"boilerblade/helper"
+	"boilerblade/src/repository"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// HandleAuthCommand processes the auth command
+func HandleAuthCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("auth subcommand is required (hash-passwords, assign-role, revoke-role)")
+	}
+
+	switch args[0] {
+	case "hash-passwords":
+		return handleHashPasswordsCommand(args[1:])
+	case "assign-role", "revoke-role":
+		return handleRoleCommand(args[0], args[1:])
+	default:
+		return fmt.Errorf("unknown auth subcommand: %s. Available: hash-passwords, assign-role, revoke-role", args[0])
+	}
+}
+
+// handleHashPasswordsCommand processes "auth hash-passwords [-batch=n] [-dry-run]"
+func handleHashPasswordsCommand(args []string) error {
+	fs := flag.NewFlagSet("hash-passwords", flag.ContinueOnError)
+	batch := fs.Int("batch", 100, "Users read per page")
+	dryRun := fs.Bool("dry-run", false, "Only count plaintext passwords")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("-batch must be positive")
+	}
+
+	env, err := loadEnv()
+	if err != nil {
+		return err
+	}
+	helper.SetPasswordHasher(env.PasswordHasher())
+	db := env.InitDatabase()
+	if db == nil {
+		return fmt.Errorf("could not connect to the database")
+	}
+
+	_, err = hashPlaintextPasswords(repository.NewUserRepository(db), *batch, *dryRun, os.Stdout)
+	return err
+}
+
+// hashPlaintextPasswords hashes every password stored in plaintext before
+// hashing was introduced and returns how many were (or, in a dry run, would be)
+// hashed. With AUTH_ALLOW_PLAINTEXT_PASSWORDS, users log in with plaintext rows
+// until then, which rehashes them one by one; once done, the flag should go.
+func hashPlaintextPasswords(repo repository.UserRepository, batch int, dryRun bool, out io.Writer) (int, error) {
+	hashed := 0
+	for offset := 0; ; offset += batch {
+		users, err := repo.GetAll(batch, offset)
+		if err != nil {
+			return hashed, fmt.Errorf("listing users: %w", err)
+		}
+
+		for i := range users {
+			user := &users[i]
+			if user.Password == "" || helper.IsPasswordHash(user.Password) {
+				continue
+			}
+			if !dryRun {
+				passwordHash, err := helper.HashPassword(user.Password)
+				if err != nil {
+					return hashed, fmt.Errorf("hashing password of user %d: %w", user.ID, err)
+				}
+				user.Password = passwordHash
+				if err := repo.Update(user); err != nil {
+					return hashed, fmt.Errorf("updating user %d: %w", user.ID, err)
+				}
+			}
+			hashed++
+		}
+
+		if len(users) < batch {
+			break
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "%d plaintext password(s) would be hashed\n", hashed)
+	} else {
+		fmt.Fprintf(out, "Hashed %d plaintext password(s)\n", hashed)
+		fmt.Fprintln(out, "Set AUTH_ALLOW_PLAINTEXT_PASSWORDS=false (the default) so logins no longer accept plaintext passwords")
+	}
+	return hashed, nil
+}
+
+// handleRoleCommand processes "auth assign-role|revoke-role -user=id -role=name"
+func handleRoleCommand(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	userID := fs.Uint("user", 0, "User ID")
+	roleName := fs.String("role", "", "Role name (e.g. admin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID == 0 || *roleName == "" {
+		return fmt.Errorf("-user and -role are required")
+	}
+
+	env, err := loadEnv()
+	if err != nil {
+		return err
+	}
+	db := env.InitDatabase()
+	if db == nil {
+		return fmt.Errorf("could not connect to the database")
+	}
+
+	return changeRole(repository.NewRoleRepository(db), command == "assign-role", uint(*userID), *roleName, os.Stdout)
+}
+
+// changeRole assigns the role named roleName to userID, or revokes it
+func changeRole(repo repository.RoleRepository, assign bool, userID uint, roleName string, out io.Writer) error {
+	role, err := repo.GetByName(roleName)
+	if err != nil {
+		return fmt.Errorf("role %q: %w", roleName, err)
+	}
+
+	if assign {
+		if err := repo.AssignRole(userID, role.ID); err != nil {
+			return fmt.Errorf("assigning role %q to user %d: %w", roleName, userID, err)
+		}
+		fmt.Fprintf(out, "Assigned role %s to user %d\n", roleName, userID)
+		return nil
+	}
+	if err := repo.RevokeRole(userID, role.ID); err != nil {
+		return fmt.Errorf("revoking role %q from user %d: %w", roleName, userID, err)
+	}
+	fmt.Fprintf(out, "Revoked role %s from user %d\n", roleName, userID)
+	return nil
+}
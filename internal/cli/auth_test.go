@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"boilerblade/helper"
+	"boilerblade/src/model"
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// userList is an in-memory repository.UserRepository for hashPlaintextPasswords
+type userList struct {
+	users   []model.User
+	updates int
+}
+
+func (l *userList) Create(user *model.User) error                     { return nil }
+func (l *userList) GetByID(id uint) (*model.User, error)              { return nil, nil }
+func (l *userList) GetByEmail(email string) (*model.User, error)      { return nil, nil }
+func (l *userList) GetByEmails(emails []string) ([]model.User, error) { return nil, nil }
+func (l *userList) Delete(id uint) error                              { return nil }
+func (l *userList) Count() (int64, error)                             { return int64(len(l.users)), nil }
+
+func (l *userList) CreateBatch(ctx context.Context, users []*model.User, batchSize int) error {
+	return nil
+}
+
+func (l *userList) GetAll(limit, offset int) ([]model.User, error) {
+	if offset >= len(l.users) {
+		return nil, nil
+	}
+	end := min(offset+limit, len(l.users))
+	return append([]model.User(nil), l.users[offset:end]...), nil
+}
+
+func (l *userList) Update(user *model.User) error {
+	l.updates++
+	for i := range l.users {
+		if l.users[i].ID == user.ID {
+			l.users[i] = *user
+		}
+	}
+	return nil
+}
+
+func newUserList(t *testing.T) *userList {
+	hashed, err := helper.HashPassword("already-hashed")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	return &userList{users: []model.User{
+		{ID: 1, Password: "secret1"},
+		{ID: 2, Password: hashed},
+		{ID: 3, Password: "secret3"},
+	}}
+}
+
+func TestHashPlaintextPasswords(t *testing.T) {
+	users := newUserList(t)
+	var out bytes.Buffer
+
+	hashed, err := hashPlaintextPasswords(users, 2, false, &out)
+	if err != nil {
+		t.Fatalf("hashPlaintextPasswords failed: %v", err)
+	}
+	if hashed != 2 || users.updates != 2 {
+		t.Errorf("Expected 2 passwords hashed, got %d (%d updates)", hashed, users.updates)
+	}
+	for _, user := range users.users {
+		if !helper.IsPasswordHash(user.Password) {
+			t.Errorf("User %d still has a plaintext password", user.ID)
+		}
+	}
+	if ok, _ := helper.VerifyPassword(users.users[2].Password, "secret3"); !ok {
+		t.Errorf("Hashed password does not verify")
+	}
+	if !strings.Contains(out.String(), "Hashed 2") || !strings.Contains(out.String(), "AUTH_ALLOW_PLAINTEXT_PASSWORDS=false") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+func TestHashPlaintextPasswords_DryRun(t *testing.T) {
+	users := newUserList(t)
+	var out bytes.Buffer
+
+	hashed, err := hashPlaintextPasswords(users, 100, true, &out)
+	if err != nil {
+		t.Fatalf("hashPlaintextPasswords failed: %v", err)
+	}
+	if hashed != 2 || users.updates != 0 || users.users[0].Password != "secret1" {
+		t.Errorf("Expected 2 counted and nothing updated, got %d (%d updates)", hashed, users.updates)
+	}
+	if !strings.Contains(out.String(), "2 plaintext password(s) would be hashed") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+// roleAssignments is an in-memory repository.RoleRepository for changeRole
+type roleAssignments struct {
+	roles    map[string]uint
+	assigned map[uint][]uint
+}
+
+func (r *roleAssignments) GetByName(name string) (*model.Role, error) {
+	id, ok := r.roles[name]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	return &model.Role{ID: id, Name: name}, nil
+}
+
+func (r *roleAssignments) UserRoles(userID uint) ([]string, error)          { return nil, nil }
+func (r *roleAssignments) RolePermissions(roles []string) ([]string, error) { return nil, nil }
+
+func (r *roleAssignments) AssignRole(userID, roleID uint) error {
+	r.assigned[userID] = append(r.assigned[userID], roleID)
+	return nil
+}
+
+func (r *roleAssignments) RevokeRole(userID, roleID uint) error {
+	r.assigned[userID] = slices.DeleteFunc(r.assigned[userID], func(id uint) bool { return id == roleID })
+	return nil
+}
+
+func TestChangeRole(t *testing.T) {
+	repo := &roleAssignments{roles: map[string]uint{"admin": 1}, assigned: map[uint][]uint{}}
+	var out bytes.Buffer
+
+	if err := changeRole(repo, true, 7, "admin", &out); err != nil {
+		t.Fatalf("changeRole failed: %v", err)
+	}
+	if !slices.Equal(repo.assigned[7], []uint{1}) || !strings.Contains(out.String(), "Assigned role admin to user 7") {
+		t.Errorf("Unexpected assignment %v, output %q", repo.assigned[7], out.String())
+	}
+
+	if err := changeRole(repo, false, 7, "admin", &out); err != nil {
+		t.Fatalf("changeRole failed: %v", err)
+	}
+	if len(repo.assigned[7]) != 0 {
+		t.Errorf("Expected the role to be revoked, got %v", repo.assigned[7])
+	}
+
+	if err := changeRole(repo, true, 7, "owner", &out); err == nil {
+		t.Error("Expected an error for an unknown role")
+	}
+}
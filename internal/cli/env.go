@@ -16,7 +16,72 @@ MODE=development
 FIBER_PORT=3000
 FIBER_APP_NAME=boilerblade
 APP_KEY=your-secret-key-for-jwt-min-32-chars
+# Access tokens are signed with APP_KEY; lifetimes in seconds
+AUTH_ACCESS_TOKEN_TTL=900
+AUTH_REFRESH_TOKEN_TTL=2592000
+# argon2id or bcrypt; passwords hashed otherwise are rehashed on the next login
+AUTH_PASSWORD_ALGORITHM=argon2id
+AUTH_ARGON2_MEMORY=19456
+AUTH_ARGON2_ITERATIONS=2
+AUTH_ARGON2_PARALLELISM=1
+AUTH_BCRYPT_COST=12
+# Accept passwords stored in plaintext before hashing (rehashed on login); off once auth hash-passwords has run
+AUTH_ALLOW_PLAINTEXT_PASSWORDS=false
+# Extra HMAC keys as kid:secret,kid:secret; tokens without kid use APP_KEY
+AUTH_HMAC_KEYS=
+# kid of the AUTH_HMAC_KEYS key issued tokens are signed with (empty = APP_KEY)
+AUTH_HMAC_KEY_ID=
+# Identity provider keys (RS256, ES256, EdDSA): a JWKS URL or file; refresh in seconds
+AUTH_JWKS_URL=
+AUTH_JWKS_FILE=
+AUTH_JWKS_REFRESH=3600
+# iss and aud of the tokens issued by /auth/login (empty = none)
+AUTH_TOKEN_ISSUER=
+AUTH_TOKEN_AUDIENCE=
+# Accepted iss and aud values, comma separated (empty = any); AUTH_TOKEN_ISSUER is always accepted
+AUTH_ISSUERS=
+AUTH_AUDIENCES=
+# Identity provider issuers whose roles, permissions and scope claims grant permissions, comma separated
+# (empty = none: their users get the permissions of their stored roles only)
+AUTH_TRUSTED_ISSUERS=
+# Clock skew tolerated on exp/nbf/iat and max token age since iat, in seconds (0 = no limit)
+AUTH_TOKEN_LEEWAY=30
+AUTH_TOKEN_MAX_AGE=0
+# Claims every token must carry (exp, iat, nbf, iss, aud, jti, sub; user_id satisfies sub)
+AUTH_REQUIRED_CLAIMS=exp,sub
+AUTH_API_KEYS=
+AUTH_MTLS_SUBJECTS=
+AUTH_REVOCATION_CACHE_TTL=30
+AUTH_REVOCATION_FAIL_OPEN=false
+# Log in with an OpenID Connect provider (empty issuer = disabled); the redirect URL ends in /api/v1/auth/oidc/callback
+AUTH_OIDC_ISSUER=
+AUTH_OIDC_CLIENT_ID=
+AUTH_OIDC_CLIENT_SECRET=
+AUTH_OIDC_REDIRECT_URL=
+AUTH_OIDC_SCOPES=openid,email,profile
+# Email verification and password reset links (the token is added as ?token=); lifetimes in seconds
+AUTH_EMAIL_VERIFICATION_URL=
+AUTH_EMAIL_VERIFICATION_TTL=86400
+AUTH_PASSWORD_RESET_URL=
+AUTH_PASSWORD_RESET_TTL=3600
+AUTH_REQUIRE_VERIFIED_EMAIL=false
+# Lock an account for AUTH_LOCKOUT_DURATION seconds after AUTH_LOCKOUT_MAX_ATTEMPTS failed logins within AUTH_LOCKOUT_WINDOW seconds (0 = disabled, needs Redis)
+AUTH_LOCKOUT_MAX_ATTEMPTS=5
+AUTH_LOCKOUT_WINDOW=900
+AUTH_LOCKOUT_DURATION=900
+# Emails: log (written to the log, links included) or smtp; sent asynchronously through the mail_queue
+# Empty = log in MODE=development; any other MODE refuses to start until it is set
+MAIL_DRIVER=
+MAIL_FROM=
+SMTP_HOST=
+SMTP_PORT=587
+SMTP_USERNAME=
+SMTP_PASSWORD=
+SERVER_TLS_CERT=
+SERVER_TLS_KEY=
+SERVER_TLS_CLIENT_CA=
 SERVER_MODE=both
+HEALTH_PORT=
 
 # --- Connection flags (true/false) ---
 ENABLE_DB=true
@@ -51,6 +116,23 @@ AMQP_HOST=localhost
 AMQP_PORT=5672
 AMQP_USER=guest
 AMQP_PASSWORD=guest
+# CloudEvents envelope for published events: binary (AMQP headers) or structured (JSON body)
+AMQP_CLOUDEVENTS_MODE=binary
+AMQP_TOPOLOGY_DIR=
+AMQP_DELAYED_MESSAGE_PLUGIN=false
+AMQP_PUBLISHER_POOL_SIZE=8
+AMQP_PUBLISH_TIMEOUT=5000
+AMQP_STREAM_OFFSET_STORE=redis
+AMQP_BATCH_SIZE=100
+AMQP_BATCH_WAIT=500
+AMQP_MESSAGE_TIMEOUT=30000
+AMQP_CIRCUIT_PANICS=5
+AMQP_CIRCUIT_WINDOW=60000
+AMQP_CIRCUIT_PAUSE=30000
+BROKER=amqp
+REDIS_STREAM_GROUP=
+REDIS_STREAM_MAX_RETRIES=5
+REDIS_STREAM_CLAIM_IDLE=30000
 `
 
 // EnsureEnvExample creates .env.example in dir if it does not exist.
@@ -11,6 +11,9 @@ func ShowHelp() {
 	fmt.Println("Commands:")
 	fmt.Println("  new <project-name>     Create a new Boilerblade project")
 	fmt.Println("  make <resource>        Generate code (model, repository, usecase, handler, dto, consumer, migration, all)")
+	fmt.Println("  amqp <subcommand>      Manage RabbitMQ (topology apply|diff, publish, tail, replay, stats, stream)")
+	fmt.Println("  auth <subcommand>      Manage authentication (hash-passwords, assign-role, revoke-role)")
+	fmt.Println("  apikey <subcommand>    Manage service API keys (create, list, rotate, revoke)")
 	fmt.Println("  version                Show version information")
 	fmt.Println("  help                    Show this help message")
 	fmt.Println()
@@ -20,6 +23,12 @@ func ShowHelp() {
 	fmt.Println("  boilerblade make all Product -fields=\"Name:string:required,Price:float64:required\"")
 	fmt.Println("  boilerblade make consumer -name=OrderEvents -title=\"Order Events\"")
 	fmt.Println("  boilerblade make migration -name=add_orders_table")
+	fmt.Println("  boilerblade amqp topology diff -env=production")
+	fmt.Println("  boilerblade amqp replay -queue=user_created_queue.error -dry-run")
+	fmt.Println("  boilerblade amqp stream replay -consumer=user-directory -since=2025-01-01T00:00:00Z")
+	fmt.Println("  boilerblade auth hash-passwords -dry-run")
+	fmt.Println("  boilerblade auth assign-role -user=1 -role=admin")
+	fmt.Println("  boilerblade apikey create -name=billing-job -scopes=users:read -expires-in-days=90")
 	fmt.Println()
 	fmt.Println("For more information, visit: https://github.com/ianyulistio/boilerblade")
 }
@@ -44,6 +44,10 @@ func HandleMakeCommand(args []string) error {
 			return fmt.Errorf("generating AMQP constants: %w", err)
 		}
 		fmt.Printf("✓ AMQP constants generated (constants/amqp_%s.go)\n", consumerGen.Identifier)
+		if err := consumerGen.GenerateTopology(); err != nil {
+			return fmt.Errorf("generating AMQP topology: %w", err)
+		}
+		fmt.Printf("✓ AMQP topology generated (config/amqp/topology/%s.yaml)\n", consumerGen.Identifier)
 		if err := consumerGen.GenerateConsumer(); err != nil {
 			return fmt.Errorf("generating consumer: %w", err)
 		}
@@ -85,27 +85,60 @@ func (c *ConsumerGen) GenerateAMQPConstants() error {
 	tmpl := `package constants
 
 // {{.ConstPrefix}} Exchange and Queues (generated — {{.Title}})
+// Types, retry intervals and bindings are declared in config/amqp/topology/{{.Identifier}}.yaml
 const (
-	{{.ConstPrefix}}ExchangeName           = "{{.ExchangeName}}"
-	{{.ConstPrefix}}CreatedQueueName       = "{{.CreatedQueueName}}"
-	{{.ConstPrefix}}UpdatedQueueName       = "{{.UpdatedQueueName}}"
-	{{.ConstPrefix}}CreatedRouteKey        = "{{.CreatedRouteKey}}"
-	{{.ConstPrefix}}UpdatedRouteKey        = "{{.UpdatedRouteKey}}"
-	{{.ConstPrefix}}CreatedQueueInterval   = {{.QueueInterval}}
-	{{.ConstPrefix}}UpdatedQueueInterval   = {{.QueueInterval}}
+	{{.ConstPrefix}}ExchangeName     = "{{.ExchangeName}}"
+	{{.ConstPrefix}}CreatedQueueName = "{{.CreatedQueueName}}"
+	{{.ConstPrefix}}UpdatedQueueName = "{{.UpdatedQueueName}}"
+	{{.ConstPrefix}}CreatedRouteKey  = "{{.CreatedRouteKey}}"
+	{{.ConstPrefix}}UpdatedRouteKey  = "{{.UpdatedRouteKey}}"
 )
 `
-	data := map[string]interface{}{
-		"ConstPrefix":        c.ConstPrefix,
-		"Title":              c.Title,
-		"ExchangeName":       c.Identifier + "_events",
-		"CreatedQueueName":   c.Identifier + "_created_queue",
-		"UpdatedQueueName":   c.Identifier + "_updated_queue",
-		"CreatedRouteKey":    c.Identifier + ".created",
-		"UpdatedRouteKey":    c.Identifier + ".updated",
-		"QueueInterval":      3000,
+	return c.writeFile("constants/amqp_"+c.Identifier+".go", tmpl, c.amqpNames())
+}
+
+// GenerateTopology writes config/amqp/topology/<identifier>.yaml, declared at startup.
+func (c *ConsumerGen) GenerateTopology() error {
+	tmpl := `# {{.Title}} topology (generated). Declared idempotently at startup.
+# Override per environment with a file of the same entries in topology/<MODE>/.
+exchanges:
+  - name: {{.ExchangeName}}
+    type: direct
+
+queues:
+  - name: {{.CreatedQueueName}}
+    type: quorum
+    retry:
+      interval: {{.QueueInterval}}
+  - name: {{.UpdatedQueueName}}
+    type: quorum
+    retry:
+      interval: {{.QueueInterval}}
+
+bindings:
+  - exchange: {{.ExchangeName}}
+    queue: {{.CreatedQueueName}}
+    routing_key: {{.CreatedRouteKey}}
+  - exchange: {{.ExchangeName}}
+    queue: {{.UpdatedQueueName}}
+    routing_key: {{.UpdatedRouteKey}}
+`
+	return c.writeFile("config/amqp/topology/"+c.Identifier+".yaml", tmpl, c.amqpNames())
+}
+
+// amqpNames returns the exchange, queue and routing key names shared by constants and topology.
+func (c *ConsumerGen) amqpNames() map[string]interface{} {
+	return map[string]interface{}{
+		"ConstPrefix":      c.ConstPrefix,
+		"Title":            c.Title,
+		"Identifier":       c.Identifier,
+		"ExchangeName":     c.Identifier + "_events",
+		"CreatedQueueName": c.Identifier + "_created_queue",
+		"UpdatedQueueName": c.Identifier + "_updated_queue",
+		"CreatedRouteKey":  c.Identifier + ".created",
+		"UpdatedRouteKey":  c.Identifier + ".updated",
+		"QueueInterval":    3000,
 	}
-	return c.writeFile("constants/amqp_"+c.Identifier+".go", tmpl, data)
 }
 
 // GenerateConsumer writes src/consumer/<identifier>.go (generic handler, no usecase/DTO).
@@ -114,83 +147,107 @@ func (c *ConsumerGen) GenerateConsumer() error {
 
 import (
 	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
 	"boilerblade/constants"
 	"boilerblade/helper"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 
 	amqplib "github.com/streadway/amqp"
 )
 
-// {{.StructName}}Consumer handles AMQP messages for {{.Title}}.
+// {{.StructName}}Consumer handles broker messages for {{.Title}}.
 // Add your business logic in handleCreatedMessage and handleUpdatedMessage.
+// Return amqp.Permanent(err) for failures a retry cannot fix (e.g. validation);
+// those messages go to the queue's error queue, other errors are requeued.
+// Panics are recovered and, like timeouts, sent to the queue's retry path.
 type {{.StructName}}Consumer struct {
-	subConnection amqp.IAMQPChannel
+	broker        broker.Broker
+	mu            sync.Mutex
+	subscriptions []broker.Subscription
+	guardOptions  broker.GuardOptions
+	guards        map[string]*broker.Guard
 }
 
-// New{{.StructName}}Consumer creates a new {{.Title}} consumer instance.
-func New{{.StructName}}Consumer(amqpConn amqp.IAMQPConnection) (*{{.StructName}}Consumer, error) {
-	channel, err := amqpConn.Channel()
-	if err != nil {
-		helper.LogError("Failed to get AMQP channel for {{.StructName}}Consumer", err, "", map[string]interface{}{
-			"source": "New{{.StructName}}Consumer",
-		})
-		return nil, err
-	}
-
-	exchangeName := constants.{{.ConstPrefix}}ExchangeName
-	if err := channel.DeclareExchange(exchangeName, "direct"); err != nil {
-		helper.LogError("Failed to declare exchange in {{.StructName}}Consumer", err, exchangeName, map[string]interface{}{
-			"source": "New{{.StructName}}Consumer",
-		})
-		channel.Close()
-		return nil, err
-	}
-
+// New{{.StructName}}Consumer creates a new {{.Title}} consumer instance (AMQP or Redis Streams).
+// Exchanges and queues are declared by the AMQP topology (config/amqp/topology/{{.Identifier}}.yaml).
+func New{{.StructName}}Consumer(b broker.Broker) (*{{.StructName}}Consumer, error) {
 	helper.LogInfo("{{.StructName}}Consumer initialized", map[string]interface{}{
-		"source":        "New{{.StructName}}Consumer",
-		"exchange":      exchangeName,
-		"exchange_type": "direct",
+		"source":   "New{{.StructName}}Consumer",
+		"exchange": constants.{{.ConstPrefix}}ExchangeName,
+		"broker":   b.Backend(),
 	})
 
 	return &{{.StructName}}Consumer{
-		subConnection: channel,
+		broker: b,
+		guards: make(map[string]*broker.Guard),
 	}, nil
 }
 
-// Close closes the AMQP channel.
+// SetGuardOptions sets the message timeout and panic circuit of the queues consumed afterwards.
+func (c *{{.StructName}}Consumer) SetGuardOptions(opts broker.GuardOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.guardOptions = opts
+}
+
+// Close stops all subscriptions.
 func (c *{{.StructName}}Consumer) Close() error {
-	if c.subConnection != nil {
-		return c.subConnection.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for _, sub := range c.subscriptions {
+		if err := sub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
+	c.subscriptions = nil
+	for queue, guard := range c.guards {
+		guard.Close()
+		delete(c.guards, queue)
+	}
+	return firstErr
 }
 
-// ProcessMessage starts all {{.Title}} consumers.
-func (c *{{.StructName}}Consumer) ProcessMessage() {
-	go c.ProcessCreated()
-	go c.ProcessUpdated()
+// guard returns the guard of queue, reported by the health check once used.
+func (c *{{.StructName}}Consumer) guard(queue string) *broker.Guard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.guards[queue]
+	if !ok {
+		g = broker.NewGuard("{{.StructName}}Consumer/"+queue, c.guardOptions)
+		c.guards[queue] = g
+	}
+	return g
 }
 
-// ProcessCreated consumes {{.Identifier}}.created messages.
-func (c *{{.StructName}}Consumer) ProcessCreated() {
-	var messages <-chan amqplib.Delivery
-
-	que, err := c.subConnection.NewQueue(
-		constants.{{.ConstPrefix}}ExchangeName,
-		constants.{{.ConstPrefix}}CreatedQueueName,
-		constants.QueueType,
-		constants.{{.ConstPrefix}}CreatedRouteKey,
-		constants.{{.ConstPrefix}}CreatedQueueInterval,
-	)
+// subscribe starts consuming a queue; the subscription is stopped when ctx is done or by Close.
+func (c *{{.StructName}}Consumer) subscribe(ctx context.Context, queue string) (broker.Subscription, error) {
+	sub, err := c.broker.Consume(ctx, queue, "{{.StructName}}Consumer")
 	if err != nil {
-		helper.LogError("({{.StructName}}Created) Error when declare queue", err, constants.{{.ConstPrefix}}CreatedQueueName, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+		return nil, err
 	}
+	c.mu.Lock()
+	c.subscriptions = append(c.subscriptions, sub)
+	c.mu.Unlock()
+	return sub, nil
+}
 
-	if messages, err = c.subConnection.ReadMessage(que); err != nil {
+// ProcessMessage starts all {{.Title}} consumers; they stop when ctx is done.
+func (c *{{.StructName}}Consumer) ProcessMessage(ctx context.Context) {
+	go c.ProcessCreated(ctx)
+	go c.ProcessUpdated(ctx)
+}
+
+// ProcessCreated consumes {{.Identifier}}.created messages until ctx is done.
+func (c *{{.StructName}}Consumer) ProcessCreated(ctx context.Context) {
+	sub, err := c.subscribe(ctx, constants.{{.ConstPrefix}}CreatedQueueName)
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
@@ -200,38 +257,15 @@ func (c *{{.StructName}}Consumer) ProcessCreated() {
 		"queue":  constants.{{.ConstPrefix}}CreatedQueueName,
 	})
 
-	for msg := range messages {
-		if err := c.handleCreatedMessage(msg); err != nil {
-			helper.LogError("Failed to process {{.Identifier}}.created message", err, "", map[string]interface{}{
-				"source":     "{{.StructName}}Consumer.ProcessCreated",
-				"message_id": msg.MessageId,
-			})
-			msg.Nack(false, true)
-			continue
-		}
-		msg.Ack(false)
+	for msg := range sub.Deliveries() {
+		c.handleDelivery(ctx, msg, constants.{{.ConstPrefix}}CreatedQueueName, c.handleCreatedMessage)
 	}
 }
 
-// ProcessUpdated consumes {{.Identifier}}.updated messages.
-func (c *{{.StructName}}Consumer) ProcessUpdated() {
-	var messages <-chan amqplib.Delivery
-
-	que, err := c.subConnection.NewQueue(
-		constants.{{.ConstPrefix}}ExchangeName,
-		constants.{{.ConstPrefix}}UpdatedQueueName,
-		constants.QueueType,
-		constants.{{.ConstPrefix}}UpdatedRouteKey,
-		constants.{{.ConstPrefix}}UpdatedQueueInterval,
-	)
+// ProcessUpdated consumes {{.Identifier}}.updated messages until ctx is done.
+func (c *{{.StructName}}Consumer) ProcessUpdated(ctx context.Context) {
+	sub, err := c.subscribe(ctx, constants.{{.ConstPrefix}}UpdatedQueueName)
 	if err != nil {
-		helper.LogError("({{.StructName}}Updated) Error when declare queue", err, constants.{{.ConstPrefix}}UpdatedQueueName, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	if messages, err = c.subConnection.ReadMessage(que); err != nil {
 		fmt.Println(err)
 		return
 	}
@@ -241,21 +275,41 @@ func (c *{{.StructName}}Consumer) ProcessUpdated() {
 		"queue":  constants.{{.ConstPrefix}}UpdatedQueueName,
 	})
 
-	for msg := range messages {
-		if err := c.handleUpdatedMessage(msg); err != nil {
-			helper.LogError("Failed to process {{.Identifier}}.updated message", err, "", map[string]interface{}{
-				"source":     "{{.StructName}}Consumer.ProcessUpdated",
-				"message_id": msg.MessageId,
-			})
-			msg.Nack(false, true)
-			continue
-		}
+	for msg := range sub.Deliveries() {
+		c.handleDelivery(ctx, msg, constants.{{.ConstPrefix}}UpdatedQueueName, c.handleUpdatedMessage)
+	}
+}
+
+// handleDelivery runs handle through the guard of queue, then acks the message,
+// nacks it for retry or parks it in the error queue.
+func (c *{{.StructName}}Consumer) handleDelivery(ctx context.Context, msg amqplib.Delivery, queue string, handle func(context.Context, amqplib.Delivery) error) {
+	err := c.guard(queue).Run(ctx, msg, func(ctx context.Context) error {
+		return handle(ctx, msg)
+	})
+	// Settle even when the consumer is shutting down
+	ctx = context.WithoutCancel(ctx)
+
+	switch {
+	case err == nil:
 		msg.Ack(false)
+	case amqp.IsPermanent(err):
+		// Redelivery cannot fix it: park it in the error queue for inspection
+		broker.MoveToErrorQueue(ctx, c.broker, msg, queue, "{{.StructName}}Consumer", err)
+	case amqp.IsPanic(err) || errors.Is(err, broker.ErrMessageTimeout):
+		broker.Retry(c.broker, msg, queue)
+	default:
+		helper.LogError("Failed to process {{.Title}} message", err, "", map[string]interface{}{
+			"source":     "{{.StructName}}Consumer.handleDelivery",
+			"queue":      queue,
+			"message_id": msg.MessageId,
+		})
+		msg.Nack(false, true)
 	}
 }
 
-// handleCreatedMessage processes a single .created message. Add your logic here.
-func (c *{{.StructName}}Consumer) handleCreatedMessage(msg amqplib.Delivery) error {
+// handleCreatedMessage processes a single .created message. Add your logic here;
+// pass ctx on to calls that accept it so they respect the message deadline.
+func (c *{{.StructName}}Consumer) handleCreatedMessage(ctx context.Context, msg amqplib.Delivery) error {
 	helper.LogInfo("Processing {{.Title}} created message", map[string]interface{}{
 		"source":       "{{.StructName}}Consumer.handleCreatedMessage",
 		"message_id":   msg.MessageId,
@@ -269,7 +323,7 @@ func (c *{{.StructName}}Consumer) handleCreatedMessage(msg amqplib.Delivery) err
 			"message_id": msg.MessageId,
 			"body":       string(msg.Body),
 		})
-		return err
+		return amqp.Permanent(err)
 	}
 
 	// TODO: add your business logic (e.g. call usecase, persist, notify)
@@ -279,7 +333,7 @@ func (c *{{.StructName}}Consumer) handleCreatedMessage(msg amqplib.Delivery) err
 }
 
 // handleUpdatedMessage processes a single .updated message. Add your logic here.
-func (c *{{.StructName}}Consumer) handleUpdatedMessage(msg amqplib.Delivery) error {
+func (c *{{.StructName}}Consumer) handleUpdatedMessage(ctx context.Context, msg amqplib.Delivery) error {
 	helper.LogInfo("Processing {{.Title}} updated message", map[string]interface{}{
 		"source":     "{{.StructName}}Consumer.handleUpdatedMessage",
 		"message_id": msg.MessageId,
@@ -291,7 +345,7 @@ func (c *{{.StructName}}Consumer) handleUpdatedMessage(msg amqplib.Delivery) err
 			"source":     "{{.StructName}}Consumer.handleUpdatedMessage",
 			"message_id": msg.MessageId,
 		})
-		return err
+		return amqp.Permanent(err)
 	}
 
 	// TODO: add your business logic
@@ -60,6 +60,7 @@ func (g *Generator) GenerateRepository() error {
 
 import (
 	"boilerblade/src/model"
+	"context"
 
 	"gorm.io/gorm"
 )
@@ -67,6 +68,7 @@ import (
 // {{.EntityName}}Repository defines the interface for {{.EntityNameLower}} data operations
 type {{.EntityName}}Repository interface {
 	Create({{.EntityNameLower}} *model.{{.EntityName}}) error
+	CreateBatch(ctx context.Context, {{.EntityNameLower}}s []*model.{{.EntityName}}, batchSize int) error
 	GetByID(id uint) (*model.{{.EntityName}}, error)
 	GetAll(limit, offset int) ([]model.{{.EntityName}}, error)
 	Update({{.EntityNameLower}} *model.{{.EntityName}}) error
@@ -91,6 +93,12 @@ func (r *{{.EntityNameLower}}Repository) Create({{.EntityNameLower}} *model.{{.E
 	return r.db.Create({{.EntityNameLower}}).Error
 }
 
+// CreateBatch inserts {{.EntityNameLower}}s with one INSERT per batchSize rows, in a single
+// transaction rolled back when ctx is done
+func (r *{{.EntityNameLower}}Repository) CreateBatch(ctx context.Context, {{.EntityNameLower}}s []*model.{{.EntityName}}, batchSize int) error {
+	return r.db.WithContext(ctx).CreateInBatches({{.EntityNameLower}}s, batchSize).Error
+}
+
 // GetByID retrieves a {{.EntityNameLower}} by ID
 func (r *{{.EntityNameLower}}Repository) GetByID(id uint) (*model.{{.EntityName}}, error) {
 	var {{.EntityNameLower}} model.{{.EntityName}}
@@ -134,8 +142,10 @@ func (g *Generator) GenerateUsecase() error {
 
 import (
 	"boilerblade/src/dto"
+	"boilerblade/src/event"
 	"boilerblade/src/model"
 	"boilerblade/src/repository"
+	"context"
 	"errors"
 	"math"
 )
@@ -147,20 +157,47 @@ type {{.EntityName}}Usecase interface {
 	GetAll{{.EntityName}}s(limit, offset int) (*dto.{{.EntityName}}ListResponse, error)
 	Update{{.EntityName}}(id uint, req *dto.Update{{.EntityName}}Request) (*dto.{{.EntityName}}Response, error)
 	Delete{{.EntityName}}(id uint) error
+	// WithContext returns the usecase with its mutations attributed to the
+	// audit metadata of ctx (see audit.WithMetadata)
+	WithContext(ctx context.Context) {{.EntityName}}Usecase
 }
 
 // {{.EntityNameLower}}Usecase implements {{.EntityName}}Usecase interface
 type {{.EntityNameLower}}Usecase struct {
 	{{.EntityNameLower}}Repo repository.{{.EntityName}}Repository
+	publisher event.Publisher
+	auditor Auditor
+	ctx context.Context
 }
 
-// New{{.EntityName}}Usecase creates a new {{.EntityNameLower}} usecase instance
-func New{{.EntityName}}Usecase({{.EntityNameLower}}Repo repository.{{.EntityName}}Repository) {{.EntityName}}Usecase {
+// New{{.EntityName}}Usecase creates a new {{.EntityNameLower}} usecase instance.
+// Domain events are sent through publisher; nil disables publishing.
+// Mutations are recorded through auditor; nil disables auditing.
+func New{{.EntityName}}Usecase({{.EntityNameLower}}Repo repository.{{.EntityName}}Repository, publisher event.Publisher, auditor Auditor) {{.EntityName}}Usecase {
+	if publisher == nil {
+		publisher = event.NewNoopPublisher()
+	}
 	return &{{.EntityNameLower}}Usecase{
 		{{.EntityNameLower}}Repo: {{.EntityNameLower}}Repo,
+		publisher: publisher,
+		auditor: auditor,
+		ctx: context.Background(),
 	}
 }
 
+// WithContext returns a copy of the usecase bound to ctx
+func (uc *{{.EntityNameLower}}Usecase) WithContext(ctx context.Context) {{.EntityName}}Usecase {
+	bound := *uc
+	bound.ctx = ctx
+	return &bound
+}
+
+// publish emits a {{.EntityNameLower}} domain event and records it in the audit log (see publishEvent)
+func (uc *{{.EntityNameLower}}Usecase) publish(action string, id uint, changes []event.FieldChange) {
+	publishEvent(uc.publisher, event.NewEntityEvent("{{.EntityNameLower}}", action, id, changes), "{{.EntityNameLower}}Usecase.publish")
+	recordAudit(uc.auditor, uc.ctx, "{{.EntityNameLower}}", action, id, changes)
+}
+
 // Create{{.EntityName}} creates a new {{.EntityNameLower}}
 func (uc *{{.EntityNameLower}}Usecase) Create{{.EntityName}}(req *dto.Create{{.EntityName}}Request) (*dto.{{.EntityName}}Response, error) {
 	// Create {{.EntityNameLower}} model
@@ -173,6 +210,8 @@ func (uc *{{.EntityNameLower}}Usecase) Create{{.EntityName}}(req *dto.Create{{.E
 		return nil, err
 	}
 
+	uc.publish(event.ActionCreated, {{.EntityNameLower}}.ID, nil)
+
 	// Return response DTO
 	return &dto.{{.EntityName}}Response{
 		ID: {{.EntityNameLower}}.ID,
@@ -252,13 +291,17 @@ func (uc *{{.EntityNameLower}}Usecase) Update{{.EntityName}}(id uint, req *dto.U
 		return nil, errors.New("{{.EntityNameLower}} not found")
 	}
 
-	// TODO: Update fields if provided
+	// TODO: Update fields if provided and record them for the event, e.g.
+	// changes = event.Diff(changes, "name", {{.EntityNameLower}}.Name, req.Name, false)
+	var changes []event.FieldChange
 
 	// Save updates
 	if err := uc.{{.EntityNameLower}}Repo.Update({{.EntityNameLower}}); err != nil {
 		return nil, err
 	}
 
+	uc.publish(event.ActionUpdated, {{.EntityNameLower}}.ID, changes)
+
 	// Return response DTO
 	return &dto.{{.EntityName}}Response{
 		ID: {{.EntityNameLower}}.ID,
@@ -277,7 +320,12 @@ func (uc *{{.EntityNameLower}}Usecase) Delete{{.EntityName}}(id uint) error {
 	}
 
 	// Delete {{.EntityNameLower}}
-	return uc.{{.EntityNameLower}}Repo.Delete(id)
+	if err := uc.{{.EntityNameLower}}Repo.Delete(id); err != nil {
+		return err
+	}
+
+	uc.publish(event.ActionDeleted, id, nil)
+	return nil
 }
 `
 
@@ -289,6 +337,7 @@ func (g *Generator) GenerateHandler() error {
 
 import (
 	"boilerblade/helper"
+	"boilerblade/middleware"
 	"boilerblade/src/dto"
 	"boilerblade/src/usecase"
 	"strconv"
@@ -311,13 +360,14 @@ func New{{.EntityName}}Handler({{.EntityNameLower}}Usecase usecase.{{.EntityName
 	}
 }
 
-// RegisterRoutes registers all {{.EntityNameLower}} routes to the router group
-func (h *{{.EntityName}}Handler) RegisterRoutes(router fiber.Router) {
-	router.Get("/{{.RouteName}}", h.GetAll{{.EntityName}}s)
-	router.Get("/{{.RouteName}}/:id", h.Get{{.EntityName}})
-	router.Post("/{{.RouteName}}", h.Create{{.EntityName}})
-	router.Put("/{{.RouteName}}/:id", h.Update{{.EntityName}})
-	router.Delete("/{{.RouteName}}/:id", h.Delete{{.EntityName}})
+// RegisterRoutes registers all {{.EntityNameLower}} routes to the router group, each
+// behind JWT authentication and its {{.Permission}}:<action> permission
+func (h *{{.EntityName}}Handler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/{{.RouteName}}", middleware.JWT, middleware.RequirePermission("{{.Permission}}:read"), h.GetAll{{.EntityName}}s)
+	router.Get("/{{.RouteName}}/:id", middleware.JWT, middleware.RequirePermission("{{.Permission}}:read"), h.Get{{.EntityName}})
+	router.Post("/{{.RouteName}}", middleware.JWT, middleware.RequirePermission("{{.Permission}}:create"), h.Create{{.EntityName}})
+	router.Put("/{{.RouteName}}/:id", middleware.JWT, middleware.RequirePermission("{{.Permission}}:update"), h.Update{{.EntityName}})
+	router.Delete("/{{.RouteName}}/:id", middleware.JWT, middleware.RequirePermission("{{.Permission}}:delete"), h.Delete{{.EntityName}})
 }
 
 // Create{{.EntityName}} handles the creation of a new {{.EntityNameLower}}
@@ -328,7 +378,7 @@ func (h *{{.EntityName}}Handler) Create{{.EntityName}}(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(helper.ErrBadRequest("Invalid request body"))
 	}
 
-	{{.EntityNameLower}}Response, err := h.{{.EntityNameLower}}Usecase.Create{{.EntityName}}(&req)
+	{{.EntityNameLower}}Response, err := h.{{.EntityNameLower}}Usecase.WithContext(middleware.AuditContext(c)).Create{{.EntityName}}(&req)
 	if err != nil {
 		return helper.HandleUsecaseError(c, err)
 	}
@@ -385,7 +435,7 @@ func (h *{{.EntityName}}Handler) Update{{.EntityName}}(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(helper.ErrBadRequest("Invalid request body"))
 	}
 
-	{{.EntityNameLower}}Response, err := h.{{.EntityNameLower}}Usecase.Update{{.EntityName}}(uint(id), &req)
+	{{.EntityNameLower}}Response, err := h.{{.EntityNameLower}}Usecase.WithContext(middleware.AuditContext(c)).Update{{.EntityName}}(uint(id), &req)
 	if err != nil {
 		return helper.HandleUsecaseError(c, err)
 	}
@@ -401,7 +451,7 @@ func (h *{{.EntityName}}Handler) Delete{{.EntityName}}(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(helper.ErrBadRequest("Invalid {{.EntityNameLower}} ID"))
 	}
 
-	if err := h.{{.EntityNameLower}}Usecase.Delete{{.EntityName}}(uint(id)); err != nil {
+	if err := h.{{.EntityNameLower}}Usecase.WithContext(middleware.AuditContext(c)).Delete{{.EntityName}}(uint(id)); err != nil {
 		return helper.HandleUsecaseError(c, err)
 	}
 
@@ -551,6 +601,7 @@ func (g *Generator) prepareHandlerData() map[string]interface{} {
 		"EntityName":      g.EntityName,
 		"EntityNameLower": g.EntityNameLower,
 		"RouteName":       g.getRouteName(),
+		"Permission":      g.getRouteName(),
 	}
 }
 
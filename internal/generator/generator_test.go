@@ -282,6 +282,43 @@ func TestPrepareHandlerData(t *testing.T) {
 	if data["RouteName"] != "products" {
 		t.Errorf("Expected RouteName 'products', got '%v'", data["RouteName"])
 	}
+
+	if data["Permission"] != "products" {
+		t.Errorf("Expected Permission 'products', got '%v'", data["Permission"])
+	}
+}
+
+func TestGenerateHandler_PermissionGuards(t *testing.T) {
+	testDir := "test_output_guards"
+	os.MkdirAll(testDir, 0755)
+	defer os.RemoveAll(testDir)
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(testDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	gen := NewGenerator("Product", "product", nil)
+	if err := gen.GenerateHandler(); err != nil {
+		t.Fatalf("Failed to generate handler: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join("src", "handler", "product.go"))
+	if err != nil {
+		t.Fatalf("Failed to read generated handler: %v", err)
+	}
+	for _, guard := range []string{
+		`router.Get("/products", middleware.JWT, middleware.RequirePermission("products:read"), h.GetAllProducts)`,
+		`router.Get("/products/:id", middleware.JWT, middleware.RequirePermission("products:read"), h.GetProduct)`,
+		`router.Post("/products", middleware.JWT, middleware.RequirePermission("products:create"), h.CreateProduct)`,
+		`router.Put("/products/:id", middleware.JWT, middleware.RequirePermission("products:update"), h.UpdateProduct)`,
+		`router.Delete("/products/:id", middleware.JWT, middleware.RequirePermission("products:delete"), h.DeleteProduct)`,
+	} {
+		if !strings.Contains(string(content), guard) {
+			t.Errorf("Generated handler is missing %s", guard)
+		}
+	}
 }
 
 func TestPrepareDTOData(t *testing.T) {
@@ -32,6 +32,11 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Service API key.
+
 func main() {
 	// Load environment variables
 	env := &config.Env{}
@@ -68,6 +73,13 @@ func main() {
 	case "amqp":
 		// Start AMQP consumers only
 		log.Println("Starting AMQP consumers only...")
+		if env.HEALTH_PORT != "" {
+			go func() {
+				if err := app.ServeHealth(env.HEALTH_PORT); err != nil {
+					log.Println("Health check server stopped:", err)
+				}
+			}()
+		}
 		if err := app.AMQPServe(); err != nil {
 			log.Fatal("Failed to start AMQP consumers:", err)
 		}
@@ -82,14 +94,17 @@ func main() {
 		}()
 
 		// Start AMQP consumers in goroutine
+		amqpDone := make(chan struct{})
 		go func() {
+			defer close(amqpDone)
 			if err := app.AMQPServe(); err != nil {
 				log.Fatal("Failed to start AMQP consumers:", err)
 			}
 		}()
 
-		// Wait for shutdown signal
+		// Wait for shutdown signal, then for the consumers to settle their messages
 		app.WaitForShutdown()
+		<-amqpDone
 
 	default:
 		log.Fatalf("Invalid SERVER_MODE: %s. Valid options: http, amqp, both", serverMode)
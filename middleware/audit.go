@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"boilerblade/src/audit"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxAuditIDLength caps the client-supplied IDs kept in the audit log: the
+// X-Request-ID and the subject of an identity provider token
+const maxAuditIDLength = 255
+
+// AuditContext returns the user context of the request carrying its audit
+// metadata: the actor set by the route authentication (user_id,
+// external_subject, service or client_subject in c.Locals), the request ID set by the requestid middleware
+// and the HTTP source. Handlers bind usecases to it with WithContext.
+func AuditContext(c *fiber.Ctx) context.Context {
+	meta := audit.Metadata{ActorType: audit.ActorAnonymous, Source: audit.SourceHTTP}
+	if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		meta.ActorType, meta.ActorID = audit.ActorUser, userID
+	} else if subject, ok := c.Locals("external_subject").(string); ok && subject != "" {
+		meta.ActorType, meta.ActorID = audit.ActorExternal, truncate(subject, maxAuditIDLength)
+	} else if service, ok := c.Locals("service").(string); ok && service != "" {
+		meta.ActorType, meta.ActorID = audit.ActorAPIKey, service
+	} else if subject, ok := c.Locals("client_subject").(string); ok && subject != "" {
+		meta.ActorType, meta.ActorID = audit.ActorClient, subject
+	}
+	if requestID, ok := c.Locals("requestid").(string); ok {
+		meta.RequestID = truncate(requestID, maxAuditIDLength)
+	}
+	return audit.WithMetadata(c.UserContext(), meta)
+}
+
+// truncate cuts s to n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
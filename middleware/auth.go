@@ -2,25 +2,28 @@ package middleware
 
 import (
 	"boilerblade/config"
+	"boilerblade/config/auth"
 	"boilerblade/helper"
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthValidator validates JWT token from Authorization header
+// AuthValidator validates JWT token from Authorization header. Tokens are
+// checked by the *auth.Verifier in c.Locals("verifier"); without one, by the
+// *auth.Keyring in c.Locals("keyring") or APP_KEY, with the claim rules of env.
+// Valid tokens are then checked against the *auth.Revocations in
+// c.Locals("revocations"), when set. A rejected token gets a 401 naming the
+// reason (expired, invalid audience, revoked, ...).
+//
+// Only the tokens of this app name a local user (c.Locals("user_id")). The
+// owner of an identity provider token is stored as "<iss>#<sub>" in
+// c.Locals("external_subject"): its sub belongs to the provider, and "1" there
+// is not user 1.
 func AuthValidator(token string, c *fiber.Ctx) (bool, error) {
-	// Get APP_KEY from context or environment
-	env := c.Locals("env")
-	var appKey string
-	if env != nil {
-		if envConfig, ok := env.(*config.Env); ok {
-			appKey = envConfig.APP_KEY
-		}
-	}
-
-	if appKey == "" {
+	verifier := requestVerifier(c)
+	if verifier == nil {
 		helper.LogError("JWT validation failed: APP_KEY not configured", nil, "", nil)
 		return false, fiber.NewError(fiber.StatusInternalServerError, "Server configuration error")
 	}
@@ -34,38 +37,45 @@ func AuthValidator(token string, c *fiber.Ctx) (bool, error) {
 		return false, fiber.NewError(fiber.StatusUnauthorized, "Missing or invalid token")
 	}
 
-	// Parse and validate JWT token
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token signing method")
+	// Verify signature and claims, then revocation; the token itself is never logged
+	verified, err := verifier.VerifyToken(token)
+	if revocations, ok := c.Locals("revocations").(*auth.Revocations); ok && revocations != nil && err == nil {
+		if err = revocations.Check(c.Context(), verified); err != nil && !errors.As(err, new(*auth.ValidationError)) {
+			helper.LogError("Token revocation check failed", err, "", map[string]interface{}{
+				"path":        c.Path(),
+				"fingerprint": auth.Fingerprint(token),
+			})
+			return false, fiber.NewError(fiber.StatusServiceUnavailable, "Token revocation check unavailable")
 		}
-		return []byte(appKey), nil
-	})
-
-	if err != nil {
-		helper.LogError("JWT validation failed", err, "", map[string]interface{}{
-			"token": token[:min(20, len(token))] + "...",
-		})
-		return false, fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
 	}
-
-	if !parsedToken.Valid {
-		helper.LogError("JWT validation failed: invalid token", nil, "", nil)
-		return false, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	if err != nil {
+		payload := map[string]interface{}{
+			"path":        c.Path(),
+			"fingerprint": auth.Fingerprint(token),
+		}
+		var verr *auth.ValidationError
+		if errors.As(err, &verr) {
+			payload["reason"] = verr.Reason
+			payload["alg"] = verr.Alg
+			payload["kid"] = verr.Kid
+		}
+		helper.LogError("JWT validation failed", err, "", payload)
+		return false, fiber.NewError(fiber.StatusUnauthorized, err.Error())
 	}
 
-	// Extract claims and store in context
-	if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok {
-		// Store user ID and other claims in context for use in handlers
-		if userID, ok := claims["user_id"].(string); ok {
+	// Store user ID and other claims in context for use in handlers
+	if verified.Local {
+		if userID := verified.UserID(); userID != "" {
 			c.Locals("user_id", userID)
 		}
-		if email, ok := claims["email"].(string); ok {
-			c.Locals("email", email)
-		}
-		c.Locals("claims", claims)
+	} else if subject := verified.Subject(); subject != "" {
+		c.Locals("external_subject", subject)
+	}
+	if email, ok := verified.Claims["email"].(string); ok {
+		c.Locals("email", email)
 	}
+	c.Locals("claims", verified.Claims)
+	c.Locals("access_token", verified)
 
 	helper.LogInfo("JWT validation successful", map[string]interface{}{
 		"path":   c.Path(),
@@ -75,10 +85,26 @@ func AuthValidator(token string, c *fiber.Ctx) (bool, error) {
 	return true, nil
 }
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
+// requestVerifier returns the verifier stored by the server, or one built from
+// the stored keyring or APP_KEY; nil when none is configured
+func requestVerifier(c *fiber.Ctx) *auth.Verifier {
+	if verifier, ok := c.Locals("verifier").(*auth.Verifier); ok && verifier != nil {
+		return verifier
+	}
+
+	env, _ := c.Locals("env").(*config.Env)
+	opts := auth.DefaultClaimsOptions()
+	if env != nil {
+		if envOpts, err := env.ClaimsOptions(); err == nil {
+			opts = envOpts
+		}
+	}
+
+	if keyring, ok := c.Locals("keyring").(*auth.Keyring); ok && keyring != nil {
+		return auth.NewVerifier(keyring, opts)
+	}
+	if env != nil && env.APP_KEY != "" {
+		return auth.NewVerifier(auth.NewKeyring(map[string][]byte{"": []byte(env.APP_KEY)}, nil), opts)
 	}
-	return b
+	return nil
 }
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/helper"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminRole is the role holding every permission, whether it comes from the
+// token or the role tables
+const AdminRole = "admin"
+
+// RoleStore loads the roles stored for a user and the permissions of roles
+// (repository.RoleRepository in the app)
+type RoleStore interface {
+	UserRoles(userID uint) ([]string, error)
+	RolePermissions(roles []string) ([]string, error)
+}
+
+// Principal is the authenticated caller with its roles and permissions: a user
+// (UserID) or a service calling with an API key (Service, its scopes as
+// Permissions)
+type Principal struct {
+	UserID      string
+	Service     string
+	Roles       []string
+	Permissions []string
+}
+
+// HasRole reports whether the principal has role
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// IsAdmin reports whether the principal has AdminRole
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(AdminRole)
+}
+
+// Can reports whether the principal holds permission, directly, through a
+// wildcard ("*" grants everything and "users:*" every users permission) or as
+// an admin
+func (p *Principal) Can(permission string) bool {
+	if p.IsAdmin() {
+		return true
+	}
+	for _, granted := range p.Permissions {
+		if granted == "*" || granted == permission {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(granted, "*"); ok && strings.HasPrefix(permission, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns reports whether userID is the principal's own user ID
+func (p *Principal) Owns(userID string) bool {
+	return p.UserID != "" && p.UserID == userID
+}
+
+// CurrentPrincipal returns the caller authenticated by AuthValidator or an API
+// key, nil when the request is not authenticated. For users, roles and
+// permissions come from the user's stored roles, when a RoleStore is in
+// c.Locals("role_store"), and from the "roles", "permissions" and OAuth
+// "scope" claims of trusted tokens: ours and those of AUTH_TRUSTED_ISSUERS
+// (see auth.Token.Trusted). Anyone can get a token from some identity
+// provider, so other tokens grant nothing by their claims. The principal is
+// resolved once per request.
+func CurrentPrincipal(c *fiber.Ctx) (*Principal, error) {
+	if principal, ok := c.Locals("principal").(*Principal); ok {
+		return principal, nil
+	}
+	token, ok := c.Locals("access_token").(*auth.Token)
+	if !ok || token == nil {
+		return nil, nil
+	}
+
+	principal := &Principal{UserID: token.UserID()}
+	if token.Trusted {
+		principal.Roles = claimList(token.Claims["roles"])
+		principal.Permissions = append(claimList(token.Claims["permissions"]), claimList(token.Claims["scope"])...)
+	}
+
+	if store, ok := c.Locals("role_store").(RoleStore); ok && store != nil {
+		if userID, err := strconv.ParseUint(principal.UserID, 10, 32); err == nil {
+			stored, err := store.UserRoles(uint(userID))
+			if err != nil {
+				return nil, err
+			}
+			principal.Roles = appendMissing(principal.Roles, stored...)
+		}
+		permissions, err := store.RolePermissions(principal.Roles)
+		if err != nil {
+			return nil, err
+		}
+		principal.Permissions = appendMissing(principal.Permissions, permissions...)
+	}
+
+	c.Locals("principal", principal)
+	return principal, nil
+}
+
+// RequirePermission allows the request when the caller holds every permission,
+// e.g. RequirePermission("users:delete"). It answers 401 without an
+// authenticated caller and 403 naming the missing permission otherwise.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := requirePrincipal(c)
+		if principal == nil {
+			return err
+		}
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				return forbidden(c, principal, "missing permission "+permission)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// RequireOwnerOrPermission allows the request when the route parameter param is
+// the caller's own user ID, or when the caller holds permission, e.g.
+// RequireOwnerOrPermission("id", "users:update") lets users update themselves
+// only while admins ("*") update anyone.
+func RequireOwnerOrPermission(param, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, err := requirePrincipal(c)
+		if principal == nil {
+			return err
+		}
+		if !principal.Owns(c.Params(param)) && !principal.Can(permission) {
+			return forbidden(c, principal, "only the owner or a caller with "+permission+" may do this")
+		}
+		return c.Next()
+	}
+}
+
+// requirePrincipal returns the principal, or nil and the error response sent
+func requirePrincipal(c *fiber.Ctx) (*Principal, error) {
+	principal, err := CurrentPrincipal(c)
+	if err != nil {
+		helper.LogError("Failed to load roles", err, c.Path(), nil)
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load permissions",
+		})
+	}
+	if principal == nil {
+		return nil, unauthorized(c, "Authentication required")
+	}
+	return principal, nil
+}
+
+func forbidden(c *fiber.Ctx, principal *Principal, message string) error {
+	helper.LogInfo("Authorization denied", map[string]interface{}{
+		"path":    c.Path(),
+		"method":  c.Method(),
+		"user_id": principal.UserID,
+		"reason":  message,
+	})
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":   "Forbidden",
+		"message": message,
+	})
+}
+
+// claimList reads a claim holding a list: a JSON array, or a string separated
+// by spaces or commas (the OAuth scope format)
+func claimList(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case string:
+		items = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				items = append(items, s)
+			}
+		}
+	case []string:
+		items = append(items, v...)
+	}
+	return items
+}
+
+// appendMissing appends the items of add not in list yet
+func appendMissing(list []string, add ...string) []string {
+	for _, item := range add {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
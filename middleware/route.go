@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/auth"
+	"boilerblade/helper"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/keyauth/v2"
+)
+
+// APIKeyHeader is the header API keys are sent in
+const APIKeyHeader = "X-API-Key"
+
+// Auth is the authentication a route requires
+type Auth string
+
+const (
+	// Public routes need no credentials
+	Public Auth = "public"
+	// JWT routes need a bearer token accepted by AuthValidator
+	JWT Auth = "jwt"
+	// APIKey routes need a service API key in the X-API-Key header
+	APIKey Auth = "api_key"
+	// MTLS routes need a client certificate verified by the TLS listener
+	MTLS Auth = "mtls"
+	// JWTOrAPIKey routes accept a service API key when the X-API-Key header is
+	// sent, a bearer token otherwise
+	JWTOrAPIKey Auth = "jwt_or_api_key"
+)
+
+// SecuritySchemes returns the Swagger security definitions documenting a, any
+// of which is accepted; none for Public and MTLS (Swagger 2.0 cannot describe
+// client certificates)
+func (a Auth) SecuritySchemes() []string {
+	switch a {
+	case JWT:
+		return []string{"BearerAuth"}
+	case APIKey:
+		return []string{"ApiKeyAuth"}
+	case JWTOrAPIKey:
+		return []string{"BearerAuth", "ApiKeyAuth"}
+	default:
+		return nil
+	}
+}
+
+// APIKeyAuthenticator checks an API key and returns the service it belongs to,
+// or auth.ErrInvalidAPIKey
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*auth.Service, error)
+}
+
+// APIKeyAuthenticators tries each authenticator in turn, e.g. the static
+// AUTH_API_KEYS then the keys stored in the database
+type APIKeyAuthenticators []APIKeyAuthenticator
+
+// AuthenticateAPIKey returns the service of the first authenticator knowing key
+func (a APIKeyAuthenticators) AuthenticateAPIKey(key string) (*auth.Service, error) {
+	for _, authenticator := range a {
+		service, err := authenticator.AuthenticateAPIKey(key)
+		if !errors.Is(err, auth.ErrInvalidAPIKey) {
+			return service, err
+		}
+	}
+	return nil, auth.ErrInvalidAPIKey
+}
+
+// Route is a route registered through a Router
+type Route struct {
+	Method string
+	Path   string
+	Auth   Auth
+}
+
+// Router registers routes on a fiber.Router, each declaring the authentication
+// it requires:
+//
+//	r := middleware.NewRouter(apiV1Group)
+//	r.Post("/users", middleware.Public, h.CreateUser)
+//	r.Delete("/users/:id", middleware.JWT, middleware.RequirePermission("users:delete"), h.DeleteUser)
+type Router struct {
+	router fiber.Router
+	prefix string
+	routes *[]Route
+}
+
+// NewRouter creates a router registering routes on router
+func NewRouter(router fiber.Router) *Router {
+	return &Router{router: router, routes: &[]Route{}}
+}
+
+// Group returns a router registering routes under prefix
+func (r *Router) Group(prefix string) *Router {
+	return &Router{router: r.router.Group(prefix), prefix: r.prefix + prefix, routes: r.routes}
+}
+
+// Get registers a GET route
+func (r *Router) Get(path string, mode Auth, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodGet, path, mode, handlers...)
+}
+
+// Post registers a POST route
+func (r *Router) Post(path string, mode Auth, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPost, path, mode, handlers...)
+}
+
+// Put registers a PUT route
+func (r *Router) Put(path string, mode Auth, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPut, path, mode, handlers...)
+}
+
+// Patch registers a PATCH route
+func (r *Router) Patch(path string, mode Auth, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPatch, path, mode, handlers...)
+}
+
+// Delete registers a DELETE route
+func (r *Router) Delete(path string, mode Auth, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodDelete, path, mode, handlers...)
+}
+
+// Add registers a route behind the authentication middleware of mode. It
+// panics on an unknown Auth, so a typo fails at startup instead of exposing
+// the route.
+func (r *Router) Add(method, path string, mode Auth, handlers ...fiber.Handler) {
+	if authenticate := Authenticate(mode); authenticate != nil {
+		handlers = append([]fiber.Handler{authenticate}, handlers...)
+	}
+	r.router.Add(method, path, handlers...)
+	*r.routes = append(*r.routes, Route{Method: method, Path: r.prefix + path, Auth: mode})
+}
+
+// Routes returns the routes registered so far, through this router or any of
+// its groups
+func (r *Router) Routes() []Route {
+	return slices.Clone(*r.routes)
+}
+
+// Authenticate returns the middleware enforcing mode, nil for Public
+func Authenticate(mode Auth) fiber.Handler {
+	switch mode {
+	case Public:
+		return nil
+	case JWT:
+		return jwtAuth
+	case APIKey:
+		return apiKeyAuth
+	case MTLS:
+		return mtlsAuth
+	case JWTOrAPIKey:
+		return jwtOrAPIKeyAuth
+	default:
+		panic("middleware: unknown route auth " + string(mode))
+	}
+}
+
+// jwtAuth validates the bearer token with AuthValidator; its server side
+// failures keep their status
+var jwtAuth = keyauth.New(keyauth.Config{
+	KeyLookup: "header:Authorization",
+	Validator: func(c *fiber.Ctx, key string) (bool, error) {
+		return AuthValidator(key, c)
+	},
+	ErrorHandler: func(c *fiber.Ctx, err error) error {
+		var ferr *fiber.Error
+		if errors.As(err, &ferr) && ferr.Code >= fiber.StatusInternalServerError {
+			return c.Status(ferr.Code).JSON(fiber.Map{"error": ferr.Message})
+		}
+		return unauthorized(c, err.Error())
+	},
+})
+
+// apiKeyAuth checks the X-API-Key header with the APIKeyAuthenticator in
+// c.Locals("api_keys"). The service name is stored in c.Locals("service"), as
+// user_id is for users, and its principal, holding the key scopes as
+// permissions, in c.Locals("principal").
+func apiKeyAuth(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get(APIKeyHeader))
+	if key == "" {
+		return unauthorized(c, "Missing API key")
+	}
+
+	authenticator, ok := c.Locals("api_keys").(APIKeyAuthenticator)
+	if !ok || authenticator == nil {
+		return unauthorized(c, auth.ErrInvalidAPIKey.Error())
+	}
+	service, err := authenticator.AuthenticateAPIKey(key)
+	if errors.Is(err, auth.ErrInvalidAPIKey) {
+		helper.LogInfo("API key rejected", map[string]interface{}{
+			"path":   c.Path(),
+			"method": c.Method(),
+		})
+		return unauthorized(c, err.Error())
+	}
+	if err != nil {
+		helper.LogError("API key validation failed", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate API key",
+		})
+	}
+
+	c.Locals("service", service.Name)
+	c.Locals("principal", &Principal{
+		Service:     service.Name,
+		Permissions: slices.Clone(service.Scopes),
+	})
+	return c.Next()
+}
+
+// jwtOrAPIKeyAuth authenticates with the API key when one is sent
+func jwtOrAPIKeyAuth(c *fiber.Ctx) error {
+	if c.Get(APIKeyHeader) != "" {
+		return apiKeyAuth(c)
+	}
+	return jwtAuth(c)
+}
+
+// mtlsAuth requires a client certificate verified against SERVER_TLS_CLIENT_CA
+// and, when AUTH_MTLS_SUBJECTS is set, one of its common names. The common
+// name is stored in c.Locals("client_subject").
+func mtlsAuth(c *fiber.Ctx) error {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return unauthorized(c, "Client certificate required")
+	}
+	subject := state.VerifiedChains[0][0].Subject.CommonName
+
+	if env, ok := c.Locals("env").(*config.Env); ok && env != nil {
+		if allowed := env.MTLSSubjects(); len(allowed) > 0 && !slices.Contains(allowed, subject) {
+			helper.LogInfo("Client certificate rejected", map[string]interface{}{
+				"path":    c.Path(),
+				"subject": subject,
+			})
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Forbidden",
+				"message": "client certificate not allowed",
+			})
+		}
+	}
+
+	c.Locals("client_subject", subject)
+	return c.Next()
+}
+
+func unauthorized(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":   "Unauthorized",
+		"message": message,
+	})
+}
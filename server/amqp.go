@@ -1,36 +1,56 @@
 package server
 
 import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
 	"boilerblade/constants"
 	"boilerblade/helper"
 	"boilerblade/src/consumer"
+	"boilerblade/src/event"
 	"boilerblade/src/repository"
 	"boilerblade/src/usecase"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
 )
 
-// AMQPServe initializes and serves AMQP consumers
-// This method ensures AMQP connection is available before use
-// If AMQP was disabled via ENABLE_AMQP=false, it will be force-enabled
+// AMQPServe initializes and serves message consumers on the broker selected by BROKER
+// It returns after the shutdown signal, once the messages being handled are settled
+// This method ensures the broker connection is available before use
+// If AMQP was disabled via ENABLE_AMQP=false, it will be force-enabled (BROKER=amqp)
 func (a *App) AMQPServe() error {
-	// Ensure AMQP connection is initialized (using method from config)
-	if err := a.Config.EnsureAMQP(); err != nil {
-		helper.LogError("Failed to ensure AMQP connection for AMQPServe", err, "", map[string]interface{}{
+	// Ensure the message broker is initialized (using method from config)
+	if err := a.Config.EnsureBroker(); err != nil {
+		helper.LogError("Failed to ensure message broker for AMQPServe", err, "", map[string]interface{}{
 			"source": "AMQPServe",
 		})
 		return err
 	}
 
-	// AMQP connection is now available
+	// Broker is now available
 	helper.LogInfo("AMQP serve started", map[string]interface{}{
 		"source": "AMQPServe",
+		"broker": a.Config.Broker.Backend(),
 	})
 
 	// Initialize consumer dependencies
-	userRepo := repository.NewUserRepository(a.Config.Database)
-	userUsecase := usecase.NewUserUsecase(userRepo)
+	inboxRepo := repository.NewInboxRepository(a.Config.Database)
+	newUserUsecase := func(tx *gorm.DB, deferred *event.Deferred) usecase.UserUsecase {
+		if tx == nil {
+			tx = a.Config.Database
+		}
+		publisher := a.EventPublisher()
+		if deferred != nil {
+			publisher = deferred.Publisher(publisher)
+		}
+		// Audit logs are written in the transaction of the message
+		auditor := usecase.NewAuditor(repository.NewAuditLogRepository(tx))
+		return usecase.NewUserUsecase(repository.NewUserRepository(tx), publisher, a.TokenRevoker(), auditor)
+	}
 
-	// Create user.created consumer (channel and exchange are set up in NewUserConsumer)
-	userCreatedConsumer, err := consumer.NewUserConsumer(a.Config.AMQP, userUsecase)
+	// Create user.created consumer (queues are declared by the AMQP topology)
+	userCreatedConsumer, err := consumer.NewUserConsumer(a.Config.Broker, inboxRepo, newUserUsecase)
 	if err != nil {
 		helper.LogError("Failed to create user.created consumer", err, "", map[string]interface{}{
 			"source": "AMQPServe",
@@ -38,8 +58,8 @@ func (a *App) AMQPServe() error {
 		return err
 	}
 
-	// Create user.updated consumer (channel and exchange are set up in NewUserConsumer)
-	userUpdatedConsumer, err := consumer.NewUserConsumer(a.Config.AMQP, userUsecase)
+	// Create user.updated consumer (queues are declared by the AMQP topology)
+	userUpdatedConsumer, err := consumer.NewUserConsumer(a.Config.Broker, inboxRepo, newUserUsecase)
 	if err != nil {
 		helper.LogError("Failed to create user.updated consumer", err, "", map[string]interface{}{
 			"source": "AMQPServe",
@@ -48,25 +68,109 @@ func (a *App) AMQPServe() error {
 		return err
 	}
 
+	// Create user.import batch consumer (queues are declared by the AMQP topology)
+	userImportConsumer, err := consumer.NewUserConsumer(a.Config.Broker, inboxRepo, newUserUsecase)
+	if err != nil {
+		helper.LogError("Failed to create user.import consumer", err, "", map[string]interface{}{
+			"source": "AMQPServe",
+		})
+		userCreatedConsumer.Close()
+		userUpdatedConsumer.Close()
+		return err
+	}
+
+	// Message timeout and panic circuit; paused consumers are reported by /health
+	guardOptions := a.GuardOptions()
+	userCreatedConsumer.SetGuardOptions(guardOptions)
+	userUpdatedConsumer.SetGuardOptions(guardOptions)
+	userImportConsumer.SetGuardOptions(guardOptions)
+
+	// Send queued emails through the MAIL_DRIVER mailer
+	mailConsumer := consumer.NewMailConsumer(a.Config.Broker, a.Mailer(), guardOptions)
+
+	// Consumers stop taking deliveries when ctx is cancelled and finish the one in hand
+	ctx := a.ShutdownContext()
+	var wg sync.WaitGroup
+
 	// Start consuming user.created messages
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		defer userCreatedConsumer.Close()
-		userCreatedConsumer.ProcessUserCreated()
+		userCreatedConsumer.ProcessUserCreated(ctx)
 	}()
 
 	// Start consuming user.updated messages
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		defer userUpdatedConsumer.Close()
-		userUpdatedConsumer.ProcessUserUpdated()
+		userUpdatedConsumer.ProcessUserUpdated(ctx)
 	}()
 
+	// Start consuming user.import messages in batches
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer userImportConsumer.Close()
+		userImportConsumer.ProcessUserImports(ctx, broker.BatchOptions{
+			Size:           a.Config.Env.AMQP_BATCH_SIZE,
+			Wait:           time.Duration(a.Config.Env.AMQP_BATCH_WAIT) * time.Millisecond,
+			MessageTimeout: guardOptions.Timeout,
+		})
+	}()
+
+	// Start sending queued emails
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer mailConsumer.Close()
+		mailConsumer.ProcessMail(ctx)
+	}()
+
+	queues := []string{constants.UserCreatedQueueName, constants.UserUpdatedQueueName, constants.UserImportQueueName, constants.MailQueueName}
+
+	// Serve user RPC requests (request/reply needs AMQP, it is not available on Redis Streams)
+	if a.Config.Broker.Backend() == broker.BackendAMQP {
+		userRPCServer, err := amqp.NewRPCServer(a.Config.AMQP, constants.UserRPCQueueName, consumer.NewUserRPCHandler(newUserUsecase(nil, nil)))
+		if err != nil {
+			helper.LogError("Failed to create user RPC server", err, "", map[string]interface{}{
+				"source": "AMQPServe",
+			})
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer userRPCServer.Close()
+			userRPCServer.Serve(ctx)
+		}()
+		queues = append(queues, constants.UserRPCQueueName)
+	}
+
 	helper.LogInfo("All AMQP consumers started", map[string]interface{}{
 		"source": "AMQPServe",
-		"queues": []string{constants.UserCreatedQueueName, constants.UserUpdatedQueueName},
+		"queues": queues,
 	})
 
 	// Wait for interrupt signal to gracefully shutdown
 	a.WaitForShutdown()
+	wg.Wait()
 
+	helper.LogInfo("All AMQP consumers stopped", map[string]interface{}{
+		"source": "AMQPServe",
+	})
 	return nil
 }
+
+// GuardOptions returns the consumer message timeout and panic circuit configured
+// by AMQP_MESSAGE_TIMEOUT and AMQP_CIRCUIT_*
+func (a *App) GuardOptions() broker.GuardOptions {
+	env := a.Config.Env
+	return broker.GuardOptions{
+		Timeout:        time.Duration(env.AMQP_MESSAGE_TIMEOUT) * time.Millisecond,
+		PanicThreshold: env.AMQP_CIRCUIT_PANICS,
+		PanicWindow:    time.Duration(env.AMQP_CIRCUIT_WINDOW) * time.Millisecond,
+		Pause:          time.Duration(env.AMQP_CIRCUIT_PAUSE) * time.Millisecond,
+	}
+}
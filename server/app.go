@@ -2,17 +2,48 @@ package server
 
 import (
 	"boilerblade/config"
+	"boilerblade/config/amqp"
+	"boilerblade/config/auth"
+	"boilerblade/config/broker"
+	"boilerblade/config/mail"
+	"boilerblade/helper"
+	"boilerblade/src/event"
+	"boilerblade/src/repository"
+	"boilerblade/src/usecase"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// App is the HTTP and AMQP server. Its getters build services from Config.Env
+// on first use and ignore the errors of the Env parsers they call: NewApp
+// validates every such setting up front, in config.InitializeWithOptions.
 type App struct {
 	*fiber.App
 	Config *config.AppConfig
+
+	publisherOnce sync.Once
+	publisher     event.Publisher
+
+	delayedPublisherOnce sync.Once
+	delayedPublisher     event.DelayedPublisher
+
+	keyringOnce sync.Once
+	keyring     *auth.Keyring
+
+	revocationsOnce sync.Once
+	revocations     *auth.Revocations
+
+	shutdownOnce sync.Once
+	shutdownCtx  context.Context
+	shutdown     context.CancelFunc
 }
 
 // NewApp creates a new App instance with initialized configuration
@@ -30,10 +61,200 @@ func NewApp(env *config.Env) (*App, error) {
 	return app, nil
 }
 
+// ShutdownContext returns the context consumers run with; it is cancelled on
+// SIGINT or SIGTERM, or by Shutdown
+func (a *App) ShutdownContext() context.Context {
+	a.shutdownOnce.Do(func() {
+		a.shutdownCtx, a.shutdown = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	})
+	return a.shutdownCtx
+}
+
+// Shutdown cancels the shutdown context, as an interrupt signal would
+func (a *App) Shutdown() {
+	a.ShutdownContext()
+	a.shutdown()
+}
+
 // WaitForShutdown waits for interrupt signal to gracefully shutdown
 func (a *App) WaitForShutdown() {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
+	<-a.ShutdownContext().Done()
 	log.Println("Shutting down servers...")
 }
+
+// EventPublisher returns the domain event publisher shared by HTTP and AMQP usecases.
+// Events are published through the message broker (BROKER) when it is available, otherwise discarded.
+func (a *App) EventPublisher() event.Publisher {
+	a.publisherOnce.Do(func() {
+		a.publisher = event.NewNoopPublisher()
+		if a.Config.Broker == nil {
+			helper.LogInfo("Message broker not available, domain events disabled", map[string]interface{}{
+				"source": "App.EventPublisher",
+				"broker": a.Config.Env.BROKER,
+			})
+			return
+		}
+		mode := amqp.CloudEventMode(a.Config.Env.AMQP_CLOUDEVENTS_MODE)
+		a.publisher = event.NewBrokerPublisher(a.Config.Broker, a.Config.Env.FIBER_APP_NAME, mode)
+	})
+	return a.publisher
+}
+
+// DelayedPublisher returns the publisher for scheduled messages. Delays need AMQP
+// (BROKER=amqp); without a connection scheduled messages are discarded.
+func (a *App) DelayedPublisher() event.DelayedPublisher {
+	a.delayedPublisherOnce.Do(func() {
+		a.delayedPublisher = event.NewNoopDelayedPublisher()
+		if a.Config.AMQP == nil || a.Config.Env.BROKER == broker.BackendRedis {
+			helper.LogInfo("AMQP not available, delayed messages disabled", map[string]interface{}{
+				"source": "App.DelayedPublisher",
+				"broker": a.Config.Env.BROKER,
+			})
+			return
+		}
+		a.delayedPublisher = amqp.NewDelayedPublisher(a.Config.AMQP, a.Config.Env.AMQP_DELAYED_MESSAGE_PLUGIN)
+	})
+	return a.delayedPublisher
+}
+
+// StreamOffsetStore returns where stream consumers commit their offsets, selected
+// by AMQP_STREAM_OFFSET_STORE: a Redis hash per stream (redis) or the
+// stream_offsets table (db).
+func (a *App) StreamOffsetStore() (amqp.OffsetStore, error) {
+	switch a.Config.Env.AMQP_STREAM_OFFSET_STORE {
+	case "redis", "":
+		if a.Config.Redis == nil {
+			return nil, fmt.Errorf("stream offset store redis: Redis not available")
+		}
+		return broker.NewRedisOffsetStore(a.Config.Redis), nil
+	case "db":
+		if a.Config.Database == nil {
+			return nil, fmt.Errorf("stream offset store db: database not available")
+		}
+		return repository.NewStreamOffsetRepository(a.Config.Database), nil
+	default:
+		return nil, fmt.Errorf("invalid AMQP_STREAM_OFFSET_STORE %q (want redis or db)", a.Config.Env.AMQP_STREAM_OFFSET_STORE)
+	}
+}
+
+// Keyring returns the keys access tokens are verified with: the HMAC keys of
+// APP_KEY and AUTH_HMAC_KEYS, plus the identity provider JWKS (AUTH_JWKS_URL or
+// AUTH_JWKS_FILE) refreshed in the background until shutdown.
+func (a *App) Keyring() *auth.Keyring {
+	a.keyringOnce.Do(func() {
+		env := a.Config.Env
+		hmacKeys, _ := env.HMACKeys()
+
+		var jwks *auth.JWKS
+		if env.AUTH_JWKS_URL != "" || env.AUTH_JWKS_FILE != "" {
+			var err error
+			jwks, err = auth.NewJWKS(auth.JWKSOptions{
+				URL:     env.AUTH_JWKS_URL,
+				File:    env.AUTH_JWKS_FILE,
+				Refresh: time.Duration(env.AUTH_JWKS_REFRESH) * time.Second,
+			})
+			if err != nil {
+				log.Fatal("Invalid JWKS configuration:", err)
+			}
+			// A provider that is down at startup is retried by the refresh loop
+			jwks.Start(a.ShutdownContext())
+		}
+
+		a.keyring = auth.NewKeyring(hmacKeys, jwks)
+	})
+	return a.keyring
+}
+
+// Verifier returns the access token verifier: the Keyring and the claim rules
+// of AUTH_ISSUERS, AUTH_AUDIENCES, AUTH_TOKEN_LEEWAY, AUTH_TOKEN_MAX_AGE and
+// AUTH_REQUIRED_CLAIMS
+func (a *App) Verifier() *auth.Verifier {
+	opts, _ := a.Config.Env.ClaimsOptions()
+	return auth.NewVerifier(a.Keyring(), opts)
+}
+
+// Revocations returns the token revocation list kept in Redis, nil when Redis
+// is disabled. Lookups are cached for AUTH_REVOCATION_CACHE_TTL seconds and
+// invalidated by the revocations of every instance until shutdown.
+func (a *App) Revocations() *auth.Revocations {
+	a.revocationsOnce.Do(func() {
+		if a.Config.Redis == nil {
+			helper.LogInfo("Redis not available, token revocation disabled", map[string]interface{}{
+				"source": "App.Revocations",
+			})
+			return
+		}
+		env := a.Config.Env
+		opts, _ := env.ClaimsOptions()
+
+		// Watermarks outlive every token issued before them: refresh tokens are
+		// checked against them too
+		retention := time.Duration(max(env.AUTH_ACCESS_TOKEN_TTL, env.AUTH_REFRESH_TOKEN_TTL))*time.Second + opts.Leeway
+		a.revocations = auth.NewRevocations(auth.NewRedisRevocationStore(a.Config.Redis, retention), auth.RevocationOptions{
+			CacheTTL: time.Duration(env.AUTH_REVOCATION_CACHE_TTL) * time.Second,
+			Leeway:   opts.Leeway,
+			FailOpen: env.AUTH_REVOCATION_FAIL_OPEN,
+		})
+		a.revocations.Start(a.ShutdownContext())
+	})
+	return a.revocations
+}
+
+// OIDCProvider returns the OpenID Connect provider users log in with, nil when
+// AUTH_OIDC_ISSUER is not set. Its discovery document is loaded on first use.
+func (a *App) OIDCProvider() usecase.OIDCProvider {
+	opts, _ := a.Config.Env.OIDCOptions()
+	if opts == nil {
+		return nil
+	}
+	provider, err := auth.NewOIDCProvider(*opts)
+	if err != nil {
+		log.Fatal("Invalid OIDC configuration:", err)
+	}
+	return provider
+}
+
+// TokenRevoker returns Revocations for the usecases, nil when Redis is disabled
+func (a *App) TokenRevoker() usecase.TokenRevoker {
+	if revocations := a.Revocations(); revocations != nil {
+		return revocations
+	}
+	return nil
+}
+
+// Mailer returns the mailer emails are delivered with, selected by MAIL_DRIVER
+// (log or smtp). The mail consumer sends the queued emails through it.
+func (a *App) Mailer() mail.Mailer {
+	mailer, _ := a.Config.Env.Mailer()
+	return mailer
+}
+
+// AccountMailer returns the mailer of the account emails: the mail queue when
+// the message broker is available, so requests do not wait for SMTP and failed
+// sends are retried, otherwise Mailer directly
+func (a *App) AccountMailer() mail.Mailer {
+	if a.Config.Broker == nil {
+		helper.LogInfo("Message broker not available, emails sent synchronously", map[string]interface{}{
+			"source": "App.AccountMailer",
+			"broker": a.Config.Env.BROKER,
+		})
+		return a.Mailer()
+	}
+	return event.NewQueueMailer(a.EventPublisher())
+}
+
+// LoginLockout returns the login lockout kept in Redis, configured by
+// AUTH_LOCKOUT_*; nil when it is disabled or Redis is not available
+func (a *App) LoginLockout() usecase.LoginLockout {
+	opts, _ := a.Config.Env.LockoutOptions()
+	if opts == nil {
+		return nil
+	}
+	if a.Config.Redis == nil {
+		helper.LogInfo("Redis not available, login lockout disabled", map[string]interface{}{
+			"source": "App.LoginLockout",
+		})
+		return nil
+	}
+	return auth.NewRedisLockout(a.Config.Redis, *opts)
+}
@@ -1,18 +1,21 @@
 package server
 
 import (
+	"boilerblade/config/broker"
 	"boilerblade/middleware"
 	"boilerblade/src/handler"
 	"boilerblade/src/repository"
 	"boilerblade/src/usecase"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/gofiber/keyauth/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 )
 
@@ -22,9 +25,14 @@ func (a *App) Routes() {
 	// Swagger documentation route (before authentication)
 	a.Get("/swagger/*", swagger.HandlerDefault)
 
+	// Health check (before authentication), reports paused consumers
+	handler.NewHealthHandler(broker.Guards).RegisterRoutes(a.App)
+
 	apiV1Group := a.Group("/api/v1")
 
 	apiV1Group.Use(recover.New())
+	// X-Request-ID (kept when sent), recorded in the audit log
+	apiV1Group.Use(requestid.New())
 	apiV1Group.Use(logger.New())
 
 	// Allow all origins, methods, and headers
@@ -33,33 +41,101 @@ func (a *App) Routes() {
 		AllowMethods: fmt.Sprintf("%s,%s,%s,%s", fiber.MethodPut, fiber.MethodPost, fiber.MethodGet, fiber.MethodDelete),
 	}))
 
-	// Store env in context for middleware access
+	// Store env, the token verifier and revocations, the API keys and the role
+	// store in context for middleware access
+	verifier := a.Verifier()
+	revocations := a.Revocations()
+	revoker := a.TokenRevoker()
+	staticAPIKeys, _ := a.Config.Env.APIKeys()
+	apiKeys := middleware.APIKeyAuthenticators{staticAPIKeys}
+	apiKeyUsecase := usecase.NewAPIKeyUsecase(repository.NewAPIKeyRepository(a.Config.Database))
+	var roleStore middleware.RoleStore
+	if a.Config.Database != nil {
+		roleStore = repository.NewRoleRepository(a.Config.Database)
+		apiKeys = append(apiKeys, apiKeyUsecase)
+	}
 	apiV1Group.Use(func(c *fiber.Ctx) error {
 		c.Locals("env", a.Config.Env)
+		c.Locals("verifier", verifier)
+		if revocations != nil {
+			c.Locals("revocations", revocations)
+		}
+		c.Locals("api_keys", apiKeys)
+		if roleStore != nil {
+			c.Locals("role_store", roleStore)
+		}
 		return c.Next()
 	})
 
-	// JWT Authentication middleware
-	apiV1Group.Use(keyauth.New(keyauth.Config{
-		KeyLookup: "header:Authorization",
-		Validator: func(c *fiber.Ctx, key string) (bool, error) {
-			return middleware.AuthValidator(key, c)
-		},
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Unauthorized",
-				"message": err.Error(),
-			})
+	// Each route declares its authentication (public, JWT, API key or mTLS)
+	router := middleware.NewRouter(apiV1Group)
+
+	// Auth routes: login, refresh, logout and revocation
+	signingKeyID, signingKey := a.Config.Env.SigningKey()
+	lockout := a.LoginLockout()
+	authOptions := usecase.AuthOptions{
+		SigningKey:      signingKey,
+		SigningKeyID:    signingKeyID,
+		Issuer:          a.Config.Env.AUTH_TOKEN_ISSUER,
+		Audience:        a.Config.Env.AUTH_TOKEN_AUDIENCE,
+		AccessTokenTTL:  time.Duration(a.Config.Env.AUTH_ACCESS_TOKEN_TTL) * time.Second,
+		RefreshTokenTTL: time.Duration(a.Config.Env.AUTH_REFRESH_TOKEN_TTL) * time.Second,
+		Revoker:         revoker,
+		// Failed logins are counted in Redis; unverified emails are refused
+		// when AUTH_REQUIRE_VERIFIED_EMAIL is set
+		Lockout:              lockout,
+		RequireVerifiedEmail: a.Config.Env.AUTH_REQUIRE_VERIFIED_EMAIL,
+	}
+	auditLogRepo := repository.NewAuditLogRepository(a.Config.Database)
+	auditor := usecase.NewAuditor(auditLogRepo)
+	authUsecase := usecase.NewAuthUsecase(
+		repository.NewUserRepository(a.Config.Database),
+		repository.NewRefreshTokenRepository(a.Config.Database),
+		authOptions,
+	)
+	handler.NewAuthHandler(authUsecase).RegisterRoutes(router)
+
+	// Email verification and password reset, mailed through the mail queue
+	accountUsecase := usecase.NewAccountUsecase(
+		repository.NewUserRepository(a.Config.Database),
+		repository.NewUserTokenRepository(a.Config.Database),
+		a.AccountMailer(),
+		a.EventPublisher(),
+		auditor,
+		usecase.AccountOptions{
+			VerificationTTL:  time.Duration(a.Config.Env.AUTH_EMAIL_VERIFICATION_TTL) * time.Second,
+			PasswordResetTTL: time.Duration(a.Config.Env.AUTH_PASSWORD_RESET_TTL) * time.Second,
+			VerificationURL:  a.Config.Env.AUTH_EMAIL_VERIFICATION_URL,
+			PasswordResetURL: a.Config.Env.AUTH_PASSWORD_RESET_URL,
+			Revoker:          revoker,
+			Lockout:          lockout,
 		},
-	}))
+	)
+	handler.NewAccountHandler(accountUsecase).RegisterRoutes(router)
+
+	// Login with an OpenID Connect provider, when configured
+	if provider := a.OIDCProvider(); provider != nil {
+		oidcUsecase := usecase.NewOIDCUsecase(
+			provider,
+			repository.NewUserRepository(a.Config.Database),
+			repository.NewExternalIdentityRepository(a.Config.Database),
+			repository.NewRefreshTokenRepository(a.Config.Database),
+			a.EventPublisher(),
+			auditor,
+			authOptions,
+		)
+		handler.NewOIDCHandler(oidcUsecase).RegisterRoutes(router)
+	}
 
 	// Initialize dependencies
 	userRepo := repository.NewUserRepository(a.Config.Database)
-	userUsecase := usecase.NewUserUsecase(userRepo)
+	userUsecase := usecase.NewUserUsecase(userRepo, a.EventPublisher(), revoker, auditor)
 	userHandler := handler.NewUserHandler(userUsecase)
 
 	// Register handler routes
-	userHandler.RegisterRoutes(apiV1Group)
+	userHandler.RegisterRoutes(router)
+	handler.NewAPIKeyHandler(apiKeyUsecase).RegisterRoutes(router)
+	handler.NewAuditHandler(usecase.NewAuditUsecase(auditLogRepo)).RegisterRoutes(router)
 }
 
 func (a *App) ServeHTTP() {
@@ -78,5 +154,29 @@ func (a *App) ServeHTTP() {
 	}
 
 	listenerPort := fmt.Sprintf(":%s", port)
-	log.Fatal(a.Listen(listenerPort))
+
+	// HTTPS when SERVER_TLS_CERT is set; client certificates are checked by mTLS routes
+	tlsConfig, err := a.Config.Env.TLSConfig()
+	if err != nil {
+		log.Fatal("Invalid TLS configuration:", err)
+	}
+	if tlsConfig == nil {
+		log.Fatal(a.Listen(listenerPort))
+	}
+	ln, err := tls.Listen("tcp", listenerPort, tlsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(a.Listener(ln))
+}
+
+// ServeHealth serves only GET /health on port, for SERVER_MODE=amqp where the
+// HTTP API does not run; it returns when the listener fails
+func (a *App) ServeHealth(port string) error {
+	health := fiber.New(fiber.Config{
+		AppName:               a.Config.Env.FIBER_APP_NAME,
+		DisableStartupMessage: true,
+	})
+	handler.NewHealthHandler(broker.Guards).RegisterRoutes(health)
+	return health.Listen(fmt.Sprintf(":%s", port))
 }
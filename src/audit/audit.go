@@ -0,0 +1,47 @@
+package audit
+
+import "context"
+
+// Actor types: who made a change
+const (
+	ActorUser      = "user"      // a user, by the user_id claim of its access token
+	ActorExternal  = "external"  // a user of an identity provider, by the iss#sub of its access token
+	ActorAPIKey    = "api_key"   // a service API key, by its service name
+	ActorClient    = "client"    // an mTLS client, by its certificate subject
+	ActorConsumer  = "consumer"  // an AMQP consumer, by its queue
+	ActorSystem    = "system"    // the application itself (CLI, login provisioning)
+	ActorAnonymous = "anonymous" // an unauthenticated request
+)
+
+// Sources: through which channel a change came in
+const (
+	SourceHTTP   = "http"
+	SourceAMQP   = "amqp"
+	SourceSystem = "system"
+)
+
+// Metadata describes the origin of the mutations made under a context
+type Metadata struct {
+	ActorType string
+	ActorID   string
+	RequestID string // HTTP request ID or AMQP message ID
+	Source    string
+}
+
+type contextKey struct{}
+
+// WithMetadata returns a copy of ctx carrying m
+func WithMetadata(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the metadata carried by ctx; mutations made without
+// any are attributed to the system
+func FromContext(ctx context.Context) Metadata {
+	if ctx != nil {
+		if m, ok := ctx.Value(contextKey{}).(Metadata); ok {
+			return m
+		}
+	}
+	return Metadata{ActorType: ActorSystem, Source: SourceSystem}
+}
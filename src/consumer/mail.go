@@ -0,0 +1,134 @@
+package consumer
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
+	"boilerblade/config/mail"
+	"boilerblade/constants"
+	"boilerblade/helper"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// MailConsumer sends the emails queued by the queue mailer (event.NewQueueMailer)
+type MailConsumer struct {
+	broker       broker.Broker
+	mailer       mail.Mailer
+	router       *amqp.EventRouter
+	mu           sync.Mutex
+	subscription broker.Subscription
+	guard        *broker.Guard
+}
+
+// NewMailConsumer creates a mail consumer sending through mailer (SMTP or log).
+// Emails carry no side effect but the send, so they skip the inbox: a
+// redelivery after a lost ack sends the email twice.
+func NewMailConsumer(b broker.Broker, mailer mail.Mailer, guardOptions broker.GuardOptions) *MailConsumer {
+	helper.LogInfo("MailConsumer initialized", map[string]interface{}{
+		"source":   "NewMailConsumer",
+		"exchange": constants.MailExchangeName,
+		"broker":   b.Backend(),
+	})
+
+	c := &MailConsumer{
+		broker: b,
+		mailer: mailer,
+		guard:  broker.NewGuard("MailConsumer/"+constants.MailQueueName, guardOptions),
+	}
+	c.router = amqp.NewEventRouter(constants.MailSendEventType, constants.SchemaVersionV1).
+		Handle(constants.MailSendEventType, constants.SchemaVersionV1, c.handleMailMessage)
+	return c
+}
+
+// Close stops consuming
+func (c *MailConsumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if c.subscription != nil {
+		err = c.subscription.Close()
+		c.subscription = nil
+	}
+	c.guard.Close()
+	return err
+}
+
+// ProcessMail sends queued emails until ctx is done.
+// It returns once the email being sent at cancellation is settled.
+func (c *MailConsumer) ProcessMail(ctx context.Context) {
+	// Subscribe to the queue (declared by the AMQP topology)
+	sub, err := c.broker.Consume(ctx, constants.MailQueueName, "MailConsumer")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	c.mu.Lock()
+	c.subscription = sub
+	c.mu.Unlock()
+
+	helper.LogInfo("Started consuming mail.send messages", map[string]interface{}{
+		"source": "MailConsumer.ProcessMail",
+		"queue":  constants.MailQueueName,
+	})
+
+	for msg := range sub.Deliveries() {
+		c.handleDelivery(ctx, msg)
+	}
+}
+
+// handleDelivery sends msg through the guard, then acks it, retries it later or
+// parks it in the error queue. Failed sends go through broker.Retry so an SMTP
+// outage is not hammered with redeliveries.
+func (c *MailConsumer) handleDelivery(ctx context.Context, msg amqplib.Delivery) {
+	err := c.guard.Run(ctx, msg, func(ctx context.Context) error {
+		return c.router.Dispatch(ctx, msg)
+	})
+	// Settle even when the consumer is shutting down
+	ctx = context.WithoutCancel(ctx)
+
+	switch {
+	case err == nil:
+		msg.Ack(false)
+	case amqp.IsPermanent(err):
+		// Redelivery cannot fix it: park it in the error queue for inspection
+		broker.MoveToErrorQueue(ctx, c.broker, msg, constants.MailQueueName, "MailConsumer", err)
+	default:
+		helper.LogError("Failed to send email, retrying", err, "", map[string]interface{}{
+			"source":     "MailConsumer.handleDelivery",
+			"queue":      constants.MailQueueName,
+			"message_id": msg.MessageId,
+		})
+		broker.Retry(c.broker, msg, constants.MailQueueName)
+	}
+}
+
+// handleMailMessage sends one queued email
+func (c *MailConsumer) handleMailMessage(ctx context.Context, evt *amqp.CloudEvent) error {
+	var msg mail.Message
+	if err := evt.Decode(&msg); err != nil {
+		return amqp.Permanent(err)
+	}
+	if msg.To == "" {
+		return amqp.Permanent(errors.New("invalid mail message: to is required"))
+	}
+
+	if err := c.mailer.Send(ctx, msg); err != nil {
+		if mail.IsPermanent(err) {
+			return amqp.Permanent(err)
+		}
+		return err
+	}
+
+	helper.LogInfo("Email sent", map[string]interface{}{
+		"source":     "MailConsumer.handleMailMessage",
+		"message_id": evt.ID,
+		"to":         msg.To,
+		"subject":    msg.Subject,
+	})
+	return nil
+}
@@ -2,54 +2,71 @@ package consumer
 
 import (
 	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
 	"boilerblade/constants"
 	"boilerblade/helper"
+	"boilerblade/src/audit"
 	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/repository"
 	"boilerblade/src/usecase"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 
 	amqplib "github.com/streadway/amqp"
+	"gorm.io/gorm"
 )
 
-// UserConsumer handles AMQP messages for user operations
+// UserUsecaseFactory builds a UserUsecase whose writes go through tx.
+// A nil tx means the default (non-transactional) database connection.
+// With a non-nil deferred, the usecase queues its events on it (see
+// event.Deferred.Publisher) instead of publishing them, for the caller to
+// flush once tx has committed.
+type UserUsecaseFactory func(tx *gorm.DB, deferred *event.Deferred) usecase.UserUsecase
+
+// UserConsumer handles broker messages for user operations
 type UserConsumer struct {
-	subConnection amqp.IAMQPChannel
-	userUsecase   usecase.UserUsecase
+	broker         broker.Broker
+	mu             sync.Mutex
+	subscriptions  []broker.Subscription
+	inbox          repository.InboxRepository
+	newUserUsecase UserUsecaseFactory
+	createdRouter  *amqp.EventRouter
+	updatedRouter  *amqp.EventRouter
+	guardOptions   broker.GuardOptions
+	guards         map[string]*broker.Guard
 }
 
 // NewUserConsumer creates a new user consumer instance
-// It sets up the channel and declares the exchange
-func NewUserConsumer(amqpConn amqp.IAMQPConnection, userUsecase usecase.UserUsecase) (*UserConsumer, error) {
-	// Get AMQP channel
-	channel, err := amqpConn.Channel()
-	if err != nil {
-		helper.LogError("Failed to get AMQP channel for UserConsumer", err, "", map[string]interface{}{
-			"source": "NewUserConsumer",
-		})
-		return nil, err
-	}
+// It runs on any broker backend; exchanges and queues are declared by the AMQP topology at startup.
+// Deliveries are de-duplicated through inbox; a nil inbox disables de-duplication.
+func NewUserConsumer(b broker.Broker, inbox repository.InboxRepository, newUserUsecase UserUsecaseFactory) (*UserConsumer, error) {
+	helper.LogInfo("UserConsumer initialized", map[string]interface{}{
+		"source":   "NewUserConsumer",
+		"exchange": constants.UserExchangeName,
+		"broker":   b.Backend(),
+	})
 
-	// Declare exchange for user events
-	exchangeName := constants.UserExchangeName
-	if err := channel.DeclareExchange(exchangeName, "direct"); err != nil {
-		helper.LogError("Failed to declare exchange in UserConsumer", err, exchangeName, map[string]interface{}{
-			"source": "NewUserConsumer",
-		})
-		channel.Close()
-		return nil, err
+	c := &UserConsumer{
+		broker:         b,
+		inbox:          inbox,
+		newUserUsecase: newUserUsecase,
+		guards:         make(map[string]*broker.Guard),
 	}
 
-	helper.LogInfo("UserConsumer initialized with channel and exchange", map[string]interface{}{
-		"source":        "NewUserConsumer",
-		"exchange":      exchangeName,
-		"exchange_type": "direct",
-	})
+	// Dispatch on CloudEvents type + dataschema version; bare payloads are treated as v1
+	c.createdRouter = amqp.NewEventRouter(constants.UserCreatedEventType, constants.SchemaVersionV1).
+		Handle(constants.UserCreatedEventType, constants.SchemaVersionV1, func(ctx context.Context, evt *amqp.CloudEvent) error {
+			return c.processOnce(ctx, evt, constants.UserCreatedQueueName, c.handleUserCreatedMessage)
+		})
+	c.updatedRouter = amqp.NewEventRouter(constants.UserUpdatedEventType, constants.SchemaVersionV1).
+		Handle(constants.UserUpdatedEventType, constants.SchemaVersionV1, func(ctx context.Context, evt *amqp.CloudEvent) error {
+			return c.processOnce(ctx, evt, constants.UserUpdatedQueueName, c.handleUserUpdatedMessage)
+		})
 
-	return &UserConsumer{
-		subConnection: channel,
-		userUsecase:   userUsecase,
-	}, nil
+	return c, nil
 }
 
 // UserCreateMessage represents the message payload for creating a user
@@ -59,41 +76,71 @@ type UserCreateMessage struct {
 	Password string `json:"password"`
 }
 
-// Close closes the AMQP channel
+// SetGuardOptions sets the message timeout and panic circuit of the queues
+// consumed afterwards
+func (c *UserConsumer) SetGuardOptions(opts broker.GuardOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.guardOptions = opts
+}
+
+// Close stops all subscriptions started by the consumer
 func (c *UserConsumer) Close() error {
-	if c.subConnection != nil {
-		return c.subConnection.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for _, sub := range c.subscriptions {
+		if err := sub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return nil
+	c.subscriptions = nil
+	for queue, guard := range c.guards {
+		guard.Close()
+		delete(c.guards, queue)
+	}
+	return firstErr
 }
 
-// ProcessMessage processes messages (placeholder)
-func (c *UserConsumer) ProcessMessage() {
-	go c.ProcessUserCreated()
-	go c.ProcessUserUpdated()
+// guard returns the guard of queue, registered as UserConsumer/<queue> for the
+// health check on first use
+func (c *UserConsumer) guard(queue string) *broker.Guard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.guards[queue]
+	if !ok {
+		g = broker.NewGuard("UserConsumer/"+queue, c.guardOptions)
+		c.guards[queue] = g
+	}
+	return g
 }
 
-// ProcessUserCreated processes user creation messages from AMQP
-func (c *UserConsumer) ProcessUserCreated() {
-	var messages <-chan amqplib.Delivery
-
-	// Declare queue
-	que, err := c.subConnection.NewQueue(
-		constants.UserExchangeName,
-		constants.UserCreatedQueueName,
-		constants.QueueType,
-		constants.UserCreatedRouteKey,
-		constants.UserCreatedQueueInterval,
-	)
+// subscribe starts consuming a queue; the subscription is stopped when ctx is done or by Close
+func (c *UserConsumer) subscribe(ctx context.Context, queue string, opts ...broker.ConsumeOption) (broker.Subscription, error) {
+	sub, err := c.broker.Consume(ctx, queue, "UserConsumer", opts...)
 	if err != nil {
-		helper.LogError("(UserCreated) Error when declare queue", err, constants.UserCreatedQueueName, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+		return nil, err
 	}
+	c.mu.Lock()
+	c.subscriptions = append(c.subscriptions, sub)
+	c.mu.Unlock()
+	return sub, nil
+}
+
+// ProcessMessage processes messages (placeholder)
+func (c *UserConsumer) ProcessMessage(ctx context.Context) {
+	go c.ProcessUserCreated(ctx)
+	go c.ProcessUserUpdated(ctx)
+}
 
-	// Read messages
-	if messages, err = c.subConnection.ReadMessage(que); err != nil {
+// ProcessUserCreated processes user creation messages until ctx is done.
+// It returns once the message being handled at cancellation is settled.
+func (c *UserConsumer) ProcessUserCreated(ctx context.Context) {
+	// Subscribe to the queue (declared by the AMQP topology)
+	sub, err := c.subscribe(ctx, constants.UserCreatedQueueName)
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
@@ -104,42 +151,17 @@ func (c *UserConsumer) ProcessUserCreated() {
 	})
 
 	// Process messages
-	for msg := range messages {
-		if err := c.handleUserCreatedMessage(msg); err != nil {
-			helper.LogError("Failed to process user.created message", err, "", map[string]interface{}{
-				"source":     "UserConsumer.ProcessUserCreated",
-				"message_id": msg.MessageId,
-			})
-			// Nack message to retry
-			msg.Nack(false, true)
-			continue
-		}
-		// Ack message on success
-		msg.Ack(false)
+	for msg := range sub.Deliveries() {
+		c.handleDelivery(ctx, msg, c.createdRouter, constants.UserCreatedQueueName)
 	}
 }
 
-// ProcessUserUpdated processes user update messages from AMQP
-func (c *UserConsumer) ProcessUserUpdated() {
-	var messages <-chan amqplib.Delivery
-
-	// Declare queue
-	que, err := c.subConnection.NewQueue(
-		constants.UserExchangeName,
-		constants.UserUpdatedQueueName,
-		constants.QueueType,
-		constants.UserUpdatedRouteKey,
-		constants.UserUpdatedQueueInterval,
-	)
+// ProcessUserUpdated processes user update messages until ctx is done.
+// It returns once the message being handled at cancellation is settled.
+func (c *UserConsumer) ProcessUserUpdated(ctx context.Context) {
+	// Subscribe to the queue (declared by the AMQP topology)
+	sub, err := c.subscribe(ctx, constants.UserUpdatedQueueName)
 	if err != nil {
-		helper.LogError("(UserUpdated) Error when declare queue", err, constants.UserUpdatedQueueName, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	// Read messages
-	if messages, err = c.subConnection.ReadMessage(que); err != nil {
 		fmt.Println(err)
 		return
 	}
@@ -150,48 +172,144 @@ func (c *UserConsumer) ProcessUserUpdated() {
 	})
 
 	// Process messages
-	for msg := range messages {
-		if err := c.handleUserUpdatedMessage(msg); err != nil {
-			helper.LogError("Failed to process user.updated message", err, "", map[string]interface{}{
-				"source":     "UserConsumer.ProcessUserUpdated",
-				"message_id": msg.MessageId,
-			})
-			// Nack message to retry
-			msg.Nack(false, true)
-			continue
-		}
+	for msg := range sub.Deliveries() {
+		c.handleDelivery(ctx, msg, c.updatedRouter, constants.UserUpdatedQueueName)
+	}
+}
+
+// ProcessUserImports creates users from user.import messages in batches until
+// ctx is done. A batch is inserted with UserUsecase.CreateUsers; imports skip the
+// inbox, a redelivered row is recognized by its existing email instead.
+func (c *UserConsumer) ProcessUserImports(ctx context.Context, opts broker.BatchOptions) {
+	if opts.Size <= 0 {
+		opts.Size = broker.DefaultBatchSize
+	}
+	opts.Queue = constants.UserImportQueueName
+	opts.Consumer = "UserConsumer"
+	opts.Guard = c.guard(constants.UserImportQueueName)
+
+	// Prefetch a whole batch, otherwise batches never fill up
+	sub, err := c.subscribe(ctx, constants.UserImportQueueName, broker.WithPrefetch(opts.Size))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	helper.LogInfo("Started consuming user.import messages", map[string]interface{}{
+		"source":     "UserConsumer.ProcessUserImports",
+		"queue":      constants.UserImportQueueName,
+		"batch_size": opts.Size,
+	})
+
+	broker.ConsumeBatches(ctx, c.broker, sub, opts, decodeUserImport, c.handleUserImportBatch)
+}
+
+// handleDelivery dispatches msg through the guard of queue, then acks it, nacks
+// it for retry or parks it in the error queue. A panic or a timeout goes to the
+// retry path (see broker.Retry) so it is not redelivered right away.
+func (c *UserConsumer) handleDelivery(ctx context.Context, msg amqplib.Delivery, router *amqp.EventRouter, queue string) {
+	err := c.guard(queue).Run(ctx, msg, func(ctx context.Context) error {
+		return router.Dispatch(ctx, msg)
+	})
+	// Settle even when the consumer is shutting down
+	ctx = context.WithoutCancel(ctx)
+
+	switch {
+	case err == nil:
 		// Ack message on success
 		msg.Ack(false)
+	case amqp.IsPermanent(err):
+		// Redelivery cannot fix it: park it in the error queue for inspection
+		broker.MoveToErrorQueue(ctx, c.broker, msg, queue, "UserConsumer", err)
+	case amqp.IsPanic(err) || errors.Is(err, broker.ErrMessageTimeout):
+		broker.Retry(c.broker, msg, queue)
+	default:
+		helper.LogError("Failed to process message", err, "", map[string]interface{}{
+			"source":      "UserConsumer.handleDelivery",
+			"queue":       queue,
+			"message_id":  msg.MessageId,
+			"routing_key": msg.RoutingKey,
+		})
+		// Nack message to retry
+		msg.Nack(false, true)
 	}
 }
 
+// processOnce runs handle at most once per message ID for the given consumer.
+// The inbox record and the handler's writes share one transaction, so a failed
+// handler leaves no record and the redelivery is processed again.
+// The key is the CloudEvent ID (the AMQP MessageId for legacy payloads);
+// events without an ID cannot be de-duplicated and are handled directly.
+// ctx carries the message deadline and bounds the inbox transaction.
+// Events are published only once the transaction has committed; token
+// revocation is not deferred, as it must precede the change (a rolled-back
+// change then only costs the user a new login).
+func (c *UserConsumer) processOnce(ctx context.Context, evt *amqp.CloudEvent, consumerName string, handle func(*amqp.CloudEvent, usecase.UserUsecase) error) error {
+	auditCtx := auditContext(ctx, consumerName, evt.ID)
+	if c.inbox == nil || evt.ID == "" {
+		return handle(evt, c.newUserUsecase(nil, nil).WithContext(auditCtx))
+	}
+
+	deferred := event.NewDeferred()
+	processed, err := c.inbox.RunOnce(ctx, evt.ID, consumerName, func(tx *gorm.DB) error {
+		return handle(evt, c.newUserUsecase(tx, deferred).WithContext(auditCtx))
+	})
+	if err != nil {
+		return err
+	}
+
+	if processed {
+		// The change is committed: a failed publish is logged, not retried
+		if err := deferred.Flush(); err != nil {
+			helper.LogError("Failed to publish event", err, "", map[string]interface{}{
+				"source":     "UserConsumer.processOnce",
+				"message_id": evt.ID,
+				"consumer":   consumerName,
+			})
+		}
+	} else {
+		helper.LogInfo("Duplicate message skipped", map[string]interface{}{
+			"source":     "UserConsumer.processOnce",
+			"message_id": evt.ID,
+			"consumer":   consumerName,
+		})
+	}
+	return nil
+}
+
+// auditContext attributes the mutations made for a message of queue to the
+// consumer of queue
+func auditContext(ctx context.Context, queue, messageID string) context.Context {
+	return audit.WithMetadata(ctx, audit.Metadata{
+		ActorType: audit.ActorConsumer,
+		ActorID:   queue,
+		RequestID: messageID,
+		Source:    audit.SourceAMQP,
+	})
+}
+
 // handleUserCreatedMessage processes a single user creation message
-func (c *UserConsumer) handleUserCreatedMessage(msg amqplib.Delivery) error {
+func (c *UserConsumer) handleUserCreatedMessage(evt *amqp.CloudEvent, userUsecase usecase.UserUsecase) error {
 	helper.LogInfo("Processing user creation message", map[string]interface{}{
 		"source":      "UserConsumer.handleUserCreatedMessage",
-		"message_id":  msg.MessageId,
-		"routing_key": msg.RoutingKey,
+		"message_id":  evt.ID,
+		"routing_key": evt.Delivery.RoutingKey,
 	})
 
 	// Parse message body
 	var userMsg UserCreateMessage
-	if err := json.Unmarshal(msg.Body, &userMsg); err != nil {
+	if err := evt.Decode(&userMsg); err != nil {
 		helper.LogError("Failed to unmarshal user message", err, "", map[string]interface{}{
 			"source":     "UserConsumer.handleUserCreatedMessage",
-			"message_id": msg.MessageId,
-			"body":       string(msg.Body),
+			"message_id": evt.ID,
+			"body":       string(evt.Data),
 		})
-		return err
+		return amqp.Permanent(err)
 	}
 
 	// Validate required fields
 	if userMsg.Name == "" || userMsg.Email == "" {
-		helper.LogError("Invalid user message: missing required fields", nil, "", map[string]interface{}{
-			"source":     "UserConsumer.handleUserCreatedMessage",
-			"message_id": msg.MessageId,
-			"user_msg":   userMsg,
-		})
-		return nil // Return nil to ack the message even if invalid
+		return amqp.Permanent(errors.New("invalid user message: name and email are required"))
 	}
 
 	// Create user using usecase
@@ -201,13 +319,13 @@ func (c *UserConsumer) handleUserCreatedMessage(msg amqplib.Delivery) error {
 		Password: userMsg.Password,
 	}
 
-	userResponse, err := c.userUsecase.CreateUser(createReq)
+	userResponse, err := userUsecase.CreateUser(createReq)
 	if err != nil {
 		// Check if error is due to email already exists
 		if err.Error() == "email already exists" {
 			helper.LogInfo("User already exists, skipping", map[string]interface{}{
 				"source":     "UserConsumer.handleUserCreatedMessage",
-				"message_id": msg.MessageId,
+				"message_id": evt.ID,
 				"email":      userMsg.Email,
 			})
 			return nil // User already exists, ack the message
@@ -215,7 +333,7 @@ func (c *UserConsumer) handleUserCreatedMessage(msg amqplib.Delivery) error {
 
 		helper.LogError("Failed to create user from message", err, "", map[string]interface{}{
 			"source":     "UserConsumer.handleUserCreatedMessage",
-			"message_id": msg.MessageId,
+			"message_id": evt.ID,
 			"email":      userMsg.Email,
 		})
 		return err // Return error to nack and retry
@@ -223,7 +341,7 @@ func (c *UserConsumer) handleUserCreatedMessage(msg amqplib.Delivery) error {
 
 	helper.LogInfo("User created successfully from message", map[string]interface{}{
 		"source":     "UserConsumer.handleUserCreatedMessage",
-		"message_id": msg.MessageId,
+		"message_id": evt.ID,
 		"user_id":    userResponse.ID,
 		"email":      userResponse.Email,
 	})
@@ -231,11 +349,60 @@ func (c *UserConsumer) handleUserCreatedMessage(msg amqplib.Delivery) error {
 	return nil // Success, message will be acked
 }
 
+// decodeUserImport parses and validates a user.import message
+func decodeUserImport(d amqplib.Delivery) (UserCreateMessage, error) {
+	var userMsg UserCreateMessage
+	evt, err := amqp.ParseCloudEvent(d)
+	if err != nil {
+		return userMsg, err
+	}
+	if err := evt.Decode(&userMsg); err != nil {
+		return userMsg, err
+	}
+	if userMsg.Name == "" || userMsg.Email == "" {
+		return userMsg, errors.New("invalid user message: name and email are required")
+	}
+	return userMsg, nil
+}
+
+// handleUserImportBatch creates the users of a batch of user.import messages
+func (c *UserConsumer) handleUserImportBatch(ctx context.Context, msgs []UserCreateMessage) []error {
+	reqs := make([]*dto.CreateUserRequest, len(msgs))
+	for i, userMsg := range msgs {
+		reqs[i] = &dto.CreateUserRequest{
+			Name:     userMsg.Name,
+			Email:    userMsg.Email,
+			Password: userMsg.Password,
+		}
+	}
+
+	userUsecase := c.newUserUsecase(nil, nil).WithContext(auditContext(ctx, constants.UserImportQueueName, ""))
+	_, errs := userUsecase.CreateUsers(reqs)
+	created := 0
+	for i, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		// Same as a single user.created message: an existing user is not an error
+		if err.Error() == "email already exists" {
+			errs[i] = nil
+		}
+	}
+
+	helper.LogInfo("User import batch processed", map[string]interface{}{
+		"source":  "UserConsumer.handleUserImportBatch",
+		"batch":   len(msgs),
+		"created": created,
+	})
+	return errs
+}
+
 // handleUserUpdatedMessage processes a single user update message
-func (c *UserConsumer) handleUserUpdatedMessage(msg amqplib.Delivery) error {
+func (c *UserConsumer) handleUserUpdatedMessage(evt *amqp.CloudEvent, userUsecase usecase.UserUsecase) error {
 	helper.LogInfo("Processing user update message", map[string]interface{}{
 		"source":     "UserConsumer.handleUserUpdatedMessage",
-		"message_id": msg.MessageId,
+		"message_id": evt.ID,
 	})
 
 	// Parse message body
@@ -245,21 +412,17 @@ func (c *UserConsumer) handleUserUpdatedMessage(msg amqplib.Delivery) error {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	if err := json.Unmarshal(msg.Body, &userMsg); err != nil {
+	if err := evt.Decode(&userMsg); err != nil {
 		helper.LogError("Failed to unmarshal user update message", err, "", map[string]interface{}{
 			"source":     "UserConsumer.handleUserUpdatedMessage",
-			"message_id": msg.MessageId,
+			"message_id": evt.ID,
 		})
-		return err
+		return amqp.Permanent(err)
 	}
 
 	// Validate user ID
 	if userMsg.ID == 0 {
-		helper.LogError("Invalid user ID in update message", nil, "", map[string]interface{}{
-			"source":     "UserConsumer.handleUserUpdatedMessage",
-			"message_id": msg.MessageId,
-		})
-		return nil // Return nil to ack the message even if invalid
+		return amqp.Permanent(errors.New("invalid user update message: id is required"))
 	}
 
 	// Update user using usecase
@@ -269,13 +432,13 @@ func (c *UserConsumer) handleUserUpdatedMessage(msg amqplib.Delivery) error {
 		Password: userMsg.Password,
 	}
 
-	userResponse, err := c.userUsecase.UpdateUser(userMsg.ID, updateReq)
+	userResponse, err := userUsecase.UpdateUser(userMsg.ID, updateReq)
 	if err != nil {
 		// Check if error is due to user not found
 		if err.Error() == "user not found" {
 			helper.LogInfo("User not found for update, skipping", map[string]interface{}{
 				"source":     "UserConsumer.handleUserUpdatedMessage",
-				"message_id": msg.MessageId,
+				"message_id": evt.ID,
 				"user_id":    userMsg.ID,
 			})
 			return nil // User not found, ack message
@@ -283,7 +446,7 @@ func (c *UserConsumer) handleUserUpdatedMessage(msg amqplib.Delivery) error {
 
 		helper.LogError("Failed to update user from message", err, "", map[string]interface{}{
 			"source":     "UserConsumer.handleUserUpdatedMessage",
-			"message_id": msg.MessageId,
+			"message_id": evt.ID,
 			"user_id":    userMsg.ID,
 		})
 		return err
@@ -291,7 +454,7 @@ func (c *UserConsumer) handleUserUpdatedMessage(msg amqplib.Delivery) error {
 
 	helper.LogInfo("User updated successfully from message", map[string]interface{}{
 		"source":     "UserConsumer.handleUserUpdatedMessage",
-		"message_id": msg.MessageId,
+		"message_id": evt.ID,
 		"user_id":    userResponse.ID,
 	})
 
@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/helper"
+	"boilerblade/src/usecase"
+	"context"
+	"encoding/json"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// UserGetRequest is the request of the user.rpc.get call
+type UserGetRequest struct {
+	ID uint `json:"id"`
+}
+
+// NewUserRPCHandler answers user.rpc.get calls with the user as JSON (dto.UserResponse).
+// Unknown users are answered with the "user not found" error.
+func NewUserRPCHandler(userUsecase usecase.UserUsecase) amqp.RPCHandler {
+	return func(ctx context.Context, req amqplib.Delivery) (amqplib.Publishing, error) {
+		var getReq UserGetRequest
+		if err := json.Unmarshal(req.Body, &getReq); err != nil {
+			return amqplib.Publishing{}, err
+		}
+
+		user, err := userUsecase.GetUserByID(getReq.ID)
+		if err != nil {
+			return amqplib.Publishing{}, err
+		}
+
+		body, err := json.Marshal(user)
+		if err != nil {
+			return amqplib.Publishing{}, err
+		}
+
+		helper.LogDebug("User RPC answered", map[string]interface{}{
+			"source":         "UserRPCHandler",
+			"user_id":        getReq.ID,
+			"correlation_id": req.CorrelationId,
+		})
+		return amqplib.Publishing{ContentType: "application/json", Body: body}, nil
+	}
+}
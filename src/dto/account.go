@@ -0,0 +1,21 @@
+package dto
+
+// AccountEmailRequest represents the request payload for sending a
+// verification or password reset email
+// @Description Email address of the account
+type AccountEmailRequest struct {
+	Email string `json:"email" validate:"required,email" example:"john.doe@example.com"` // Account email address
+}
+
+// VerifyEmailRequest represents the request payload for verifying an email
+// @Description Token from the verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required" example:"q0yT3Vd8..."` // Verification token
+}
+
+// ResetPasswordRequest represents the request payload for resetting a password
+// @Description Token from the password reset email and the new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required" example:"Xs8d0PqL..."`                    // Password reset token
+	Password string `json:"password" validate:"required,min=6,max=72" example:"newpassword123"` // New password (6 to 72 characters)
+}
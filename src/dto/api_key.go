@@ -0,0 +1,44 @@
+package dto
+
+// CreateAPIKeyRequest represents the request payload for creating an API key
+// @Description Service name, scopes and lifetime of a new API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,min=2,max=100" example:"billing-job"`     // Service the key belongs to
+	Scopes        []string `json:"scopes" validate:"dive,required,max=150" example:"users:read"`     // Permissions of the key
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=3650" example:"90"` // Lifetime in days (0 = no expiry)
+}
+
+// RotateAPIKeyRequest represents the request payload for rotating an API key
+// @Description Lifetime of the new key and grace period of the old one
+type RotateAPIKeyRequest struct {
+	ExpiresInDays int  `json:"expires_in_days" validate:"omitempty,min=1,max=3650" example:"90"`    // Lifetime in days (0 = the lifetime of the old key)
+	GracePeriod   *int `json:"grace_period" validate:"omitempty,min=0,max=2592000" example:"86400"` // Seconds the old key keeps working (default 86400)
+}
+
+// APIKeyResponse represents an API key; the key itself is never returned again
+type APIKeyResponse struct {
+	ID           uint     `json:"id" example:"1"`                                       // API key ID
+	Name         string   `json:"name" example:"billing-job"`                           // Service the key belongs to
+	Prefix       string   `json:"prefix" example:"3f9a1c2b7d4e"`                        // Lookup prefix, part of the key
+	Scopes       []string `json:"scopes" example:"users:read"`                          // Permissions of the key
+	ExpiresAt    *string  `json:"expires_at,omitempty" example:"2024-04-01 00:00:00"`   // Expiry, if any
+	LastUsedAt   *string  `json:"last_used_at,omitempty" example:"2024-01-02 00:00:00"` // Last use, at most a minute off
+	RevokedAt    *string  `json:"revoked_at,omitempty" example:"2024-01-03 00:00:00"`   // Revocation, if revoked
+	ReplacedByID *uint    `json:"replaced_by_id,omitempty" example:"2"`                 // Key it was rotated to
+	CreatedAt    string   `json:"created_at" example:"2024-01-01 00:00:00"`             // Creation timestamp
+}
+
+// APIKeyCreatedResponse represents a created or rotated API key
+// @Description The key is only shown in this response
+type APIKeyCreatedResponse struct {
+	Key    string         `json:"key" example:"bbk_3f9a1c2b7d4e_Jx2..."` // Send as the X-API-Key header
+	APIKey APIKeyResponse `json:"api_key"`
+}
+
+// APIKeyListResponse represents paginated API key list response
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`           // List of API keys
+	Total   int64            `json:"total" example:"3"`  // Total number of API keys
+	Limit   int              `json:"limit" example:"10"` // Number of items per page
+	Offset  int              `json:"offset" example:"0"` // Offset for pagination
+}
@@ -0,0 +1,45 @@
+package dto
+
+// AuditLogQuery represents the filters of the audit log list
+type AuditLogQuery struct {
+	Entity    string `query:"entity" validate:"omitempty,max=64"`                            // Entity name, e.g. user
+	EntityID  uint   `query:"entity_id"`                                                     // Entity ID
+	ActorType string `query:"actor_type" validate:"omitempty,max=32"`                        // user, api_key, client, consumer, system or anonymous
+	ActorID   string `query:"actor_id" validate:"omitempty,max=255"`                         // User ID, service name, certificate subject or queue
+	Action    string `query:"action" validate:"omitempty,oneof=created updated deleted"`     // Action
+	Source    string `query:"source" validate:"omitempty,oneof=http amqp system"`            // Channel of the change
+	RequestID string `query:"request_id" validate:"omitempty,max=255"`                       // HTTP request ID or AMQP message ID
+	Since     string `query:"since" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // RFC 3339, inclusive
+	Until     string `query:"until" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"` // RFC 3339, exclusive
+	Limit     int    `query:"limit"`                                                         // Number of items per page (default: 10, max: 100)
+	Offset    int    `query:"offset"`                                                        // Offset for pagination
+}
+
+// AuditLogChange represents a changed field; secret values are redacted
+type AuditLogChange struct {
+	Field  string      `json:"field" example:"email"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditLogResponse represents an audit log record
+type AuditLogResponse struct {
+	ID        uint             `json:"id" example:"1"`                                            // Audit log ID
+	ActorType string           `json:"actor_type" example:"user"`                                 // Kind of actor
+	ActorID   string           `json:"actor_id" example:"42"`                                     // Actor within its kind
+	Entity    string           `json:"entity" example:"user"`                                     // Changed entity
+	EntityID  uint             `json:"entity_id" example:"7"`                                     // ID of the changed entity
+	Action    string           `json:"action" example:"updated"`                                  // created, updated or deleted
+	Changes   []AuditLogChange `json:"changes"`                                                   // Changed fields
+	RequestID string           `json:"request_id" example:"9f0c3e1a-5b7d-4c2e-8a61-2d4f0b9e7c13"` // HTTP request ID or AMQP message ID
+	Source    string           `json:"source" example:"http"`                                     // http, amqp or system
+	CreatedAt string           `json:"created_at" example:"2024-01-01 00:00:00"`                  // Time of the change
+}
+
+// AuditLogListResponse represents paginated audit log list response
+type AuditLogListResponse struct {
+	AuditLogs []AuditLogResponse `json:"audit_logs"`         // List of audit logs
+	Total     int64              `json:"total" example:"25"` // Number of matching audit logs
+	Limit     int                `json:"limit" example:"10"` // Number of items per page
+	Offset    int                `json:"offset" example:"0"` // Offset for pagination
+}
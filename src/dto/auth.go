@@ -0,0 +1,24 @@
+package dto
+
+// LoginRequest represents the request payload for logging in
+// @Description Credentials exchanged for an access and a refresh token
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email" example:"john.doe@example.com"` // User's email address
+	Password string `json:"password" validate:"required" example:"password123"`            // User's password
+}
+
+// RefreshTokenRequest represents the request payload for refreshing or logging out
+// @Description Refresh token issued by login or a previous refresh
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required" example:"8J0n1m9x..."` // Refresh token
+}
+
+// TokenResponse represents the tokens issued by login and refresh
+// @Description Access token (JWT) and rotating refresh token
+type TokenResponse struct {
+	AccessToken      string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIs..."` // JWT for the Authorization header
+	TokenType        string `json:"token_type" example:"Bearer"`                    // Always Bearer
+	ExpiresIn        int64  `json:"expires_in" example:"900"`                       // Access token lifetime in seconds
+	RefreshToken     string `json:"refresh_token" example:"8J0n1m9x..."`            // Single-use refresh token
+	RefreshExpiresIn int64  `json:"refresh_expires_in" example:"2592000"`           // Refresh token lifetime in seconds
+}
@@ -5,7 +5,7 @@ package dto
 type CreateUserRequest struct {
 	Name     string `json:"name" validate:"required,min=3,max=100" example:"John Doe"`       // User's full name
 	Email    string `json:"email" validate:"required,email" example:"john.doe@example.com"`  // User's email address
-	Password string `json:"password" validate:"required,min=6" example:"password123"`        // User's password (min 6 characters)
+	Password string `json:"password" validate:"required,min=6,max=72" example:"password123"` // User's password (6 to 72 characters)
 }
 
 // UpdateUserRequest represents the request payload for updating a user
@@ -13,7 +13,7 @@ type CreateUserRequest struct {
 type UpdateUserRequest struct {
 	Name     string `json:"name" validate:"omitempty,min=3,max=100" example:"John Doe Updated"`       // User's full name (optional)
 	Email    string `json:"email" validate:"omitempty,email" example:"john.doe.updated@example.com"` // User's email address (optional)
-	Password string `json:"password" validate:"omitempty,min=6" example:"newpassword123"`             // User's password (optional, min 6 characters)
+	Password string `json:"password" validate:"omitempty,min=6,max=72" example:"newpassword123"`      // User's password (optional, 6 to 72 characters)
 }
 
 // UserResponse represents the user response data
@@ -0,0 +1,38 @@
+package event
+
+import "time"
+
+// Entity event actions
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// EntityEvent is a generic domain event used by generated usecases.
+// It is published on "<entity>_events" with routing key "<entity>.event.<action>",
+// matching the exchange naming used by generated consumers.
+type EntityEvent struct {
+	Entity     string        `json:"entity"`
+	Action     string        `json:"action"`
+	ID         uint          `json:"id"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// NewEntityEvent creates an EntityEvent for the given entity, action and ID
+func NewEntityEvent(entity, action string, id uint, changes []FieldChange) *EntityEvent {
+	return &EntityEvent{
+		Entity:     entity,
+		Action:     action,
+		ID:         id,
+		Changes:    changes,
+		OccurredAt: now(),
+	}
+}
+
+// Exchange returns the entity events exchange
+func (e *EntityEvent) Exchange() string { return e.Entity + "_events" }
+
+// RoutingKey returns the entity event routing key
+func (e *EntityEvent) RoutingKey() string { return e.Entity + ".event." + e.Action }
@@ -0,0 +1,64 @@
+package event
+
+import (
+	"boilerblade/constants"
+	"time"
+)
+
+// Event is a domain event emitted by a usecase after a successful mutation
+type Event interface {
+	// Exchange returns the AMQP exchange the event is published to
+	Exchange() string
+	// RoutingKey returns the AMQP routing key of the event
+	RoutingKey() string
+}
+
+// Versioned is implemented by events whose payload schema moved past the initial version
+type Versioned interface {
+	SchemaVersion() string
+}
+
+// Type returns the CloudEvents type of an event (derived from its routing key)
+func Type(e Event) string {
+	return constants.EventTypePrefix + e.RoutingKey()
+}
+
+// DataSchema returns the CloudEvents dataschema of an event, ending with its schema version
+func DataSchema(e Event) string {
+	version := constants.SchemaVersionV1
+	if v, ok := e.(Versioned); ok {
+		version = v.SchemaVersion()
+	}
+	return constants.EventSchemaPrefix + e.RoutingKey() + ":" + version
+}
+
+// FieldChange describes a single field modified by an update
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// redactedValue replaces secret values in field changes
+const redactedValue = "***"
+
+// Diff appends a FieldChange to changes when before and after differ.
+// Secret fields keep their name but have both values redacted.
+func Diff(changes []FieldChange, field string, before, after interface{}, secret bool) []FieldChange {
+	if before == after {
+		return changes
+	}
+	if secret {
+		before, after = redactedValue, redactedValue
+	}
+	return append(changes, FieldChange{
+		Field:  field,
+		Before: before,
+		After:  after,
+	})
+}
+
+// now returns the event timestamp (UTC)
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,47 @@
+package event
+
+import (
+	"boilerblade/config/mail"
+	"boilerblade/constants"
+	"context"
+	"time"
+)
+
+// MailRequested asks the mail consumer to send an email
+type MailRequested struct {
+	mail.Message
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// NewMailRequested creates a MailRequested event
+func NewMailRequested(msg mail.Message) *MailRequested {
+	return &MailRequested{
+		Message:    msg,
+		OccurredAt: now(),
+	}
+}
+
+// Exchange returns the mail exchange
+func (e *MailRequested) Exchange() string { return constants.MailExchangeName }
+
+// RoutingKey returns the mail send routing key
+func (e *MailRequested) RoutingKey() string { return constants.MailSendRouteKey }
+
+// queueMailer queues emails on the message broker
+type queueMailer struct {
+	publisher Publisher
+}
+
+// NewQueueMailer creates a mailer that publishes each email as a MailRequested
+// event; the mail consumer sends it, so a slow or unavailable SMTP server does
+// not hold up the request and failed sends are retried
+func NewQueueMailer(publisher Publisher) mail.Mailer {
+	return &queueMailer{
+		publisher: publisher,
+	}
+}
+
+// Send queues msg
+func (m *queueMailer) Send(ctx context.Context, msg mail.Message) error {
+	return m.publisher.Publish(NewMailRequested(msg))
+}
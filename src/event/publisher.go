@@ -0,0 +1,183 @@
+package event
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Publisher publishes domain events
+type Publisher interface {
+	Publish(event Event) error
+}
+
+// DelayedPublisher schedules a message for delivery to exchange/routingKey after delay
+// (e.g. a reminder 24h after signup). It is implemented by amqp.DelayedPublisher.
+type DelayedPublisher interface {
+	PublishDelayed(ctx context.Context, exchange, routingKey string, body []byte, delay time.Duration) error
+}
+
+// brokerPublisher publishes events as CloudEvents through the message broker
+type brokerPublisher struct {
+	broker broker.Broker
+	source string
+	mode   amqp.CloudEventMode
+}
+
+// NewBrokerPublisher creates a publisher that sends events through the given broker (AMQP or Redis Streams).
+// Events are wrapped in a CloudEvents envelope with the given source, in binary or structured mode.
+func NewBrokerPublisher(b broker.Broker, source string, mode amqp.CloudEventMode) Publisher {
+	if mode != amqp.CloudEventModeStructured {
+		mode = amqp.CloudEventModeBinary
+	}
+
+	return &brokerPublisher{
+		broker: b,
+		source: source,
+		mode:   mode,
+	}
+}
+
+// NewAMQPPublisher creates a publisher that sends events over the given AMQP connection.
+// Exchanges missing from topology (which is already applied) are declared as direct on first use.
+func NewAMQPPublisher(amqpConn amqp.IAMQPConnection, source string, mode amqp.CloudEventMode, topology *amqp.Topology) (Publisher, error) {
+	return NewBrokerPublisher(broker.NewAMQP(amqpConn, topology), source, mode), nil
+}
+
+// Publish wraps the event in a CloudEvent and publishes it to its exchange and routing key
+func (p *brokerPublisher) Publish(event Event) error {
+	ce, err := amqp.NewCloudEvent(uuid.NewString(), p.source, Type(event), DataSchema(event), event)
+	if err != nil {
+		return err
+	}
+
+	msg, err := ce.ToPublishing(p.mode)
+	if err != nil {
+		return err
+	}
+
+	// Usecases publish without a request context; the wait is bounded by the publisher confirm timeout
+	return p.broker.Publish(context.Background(), event.Exchange(), event.RoutingKey(), msg)
+}
+
+// noopPublisher discards all events and delayed messages
+type noopPublisher struct{}
+
+// NewNoopPublisher creates a publisher that discards all events
+func NewNoopPublisher() Publisher {
+	return noopPublisher{}
+}
+
+// NewNoopDelayedPublisher creates a delayed publisher that discards all messages
+func NewNoopDelayedPublisher() DelayedPublisher {
+	return noopPublisher{}
+}
+
+// PublishDelayed discards the message
+func (noopPublisher) PublishDelayed(ctx context.Context, exchange, routingKey string, body []byte, delay time.Duration) error {
+	return nil
+}
+
+// Publish discards the event
+func (noopPublisher) Publish(event Event) error {
+	return nil
+}
+
+// Deferred holds events back until the transaction that produced them has
+// committed: publishers obtained from Publisher queue their events, and Flush
+// sends them. Events of a rolled-back transaction are dropped with the Deferred.
+type Deferred struct {
+	mu      sync.Mutex
+	pending []deferredEvent
+}
+
+type deferredEvent struct {
+	target Publisher
+	event  Event
+}
+
+// NewDeferred creates an empty Deferred
+func NewDeferred() *Deferred {
+	return &Deferred{}
+}
+
+// Publisher returns a publisher that queues events for target on d
+func (d *Deferred) Publisher(target Publisher) Publisher {
+	return deferredPublisher{deferred: d, target: target}
+}
+
+// Flush publishes the queued events in order and empties the queue. Every
+// event is attempted; the errors of the failed ones are joined.
+func (d *Deferred) Flush() error {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	var errs []error
+	for _, p := range pending {
+		if err := p.target.Publish(p.event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deferredPublisher queues events on a Deferred
+type deferredPublisher struct {
+	deferred *Deferred
+	target   Publisher
+}
+
+// Publish queues the event; it is sent by Flush
+func (p deferredPublisher) Publish(event Event) error {
+	p.deferred.mu.Lock()
+	defer p.deferred.mu.Unlock()
+	p.deferred.pending = append(p.deferred.pending, deferredEvent{target: p.target, event: event})
+	return nil
+}
+
+// RecordingPublisher keeps published events in memory for assertions in tests
+type RecordingPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	// Err, when set, is returned by Publish and the event is not recorded
+	Err error
+}
+
+// NewRecordingPublisher creates an empty RecordingPublisher
+func NewRecordingPublisher() *RecordingPublisher {
+	return &RecordingPublisher{}
+}
+
+// Publish records the event
+func (p *RecordingPublisher) Publish(event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns a copy of the recorded events in publish order
+func (p *RecordingPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events := make([]Event, len(p.events))
+	copy(events, p.events)
+	return events
+}
+
+// Reset clears the recorded events
+func (p *RecordingPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = nil
+}
@@ -0,0 +1,72 @@
+package event
+
+import (
+	"boilerblade/constants"
+	"time"
+)
+
+// UserCreated is emitted after a user has been created
+type UserCreated struct {
+	UserID     uint      `json:"user_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// NewUserCreated creates a UserCreated event
+func NewUserCreated(userID uint, name, email string) *UserCreated {
+	return &UserCreated{
+		UserID:     userID,
+		Name:       name,
+		Email:      email,
+		OccurredAt: now(),
+	}
+}
+
+// Exchange returns the user events exchange
+func (e *UserCreated) Exchange() string { return constants.UserExchangeName }
+
+// RoutingKey returns the user created event routing key
+func (e *UserCreated) RoutingKey() string { return constants.UserCreatedEventRouteKey }
+
+// UserUpdated is emitted after a user has been updated, with the before/after diff
+type UserUpdated struct {
+	UserID     uint          `json:"user_id"`
+	Changes    []FieldChange `json:"changes"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// NewUserUpdated creates a UserUpdated event
+func NewUserUpdated(userID uint, changes []FieldChange) *UserUpdated {
+	return &UserUpdated{
+		UserID:     userID,
+		Changes:    changes,
+		OccurredAt: now(),
+	}
+}
+
+// Exchange returns the user events exchange
+func (e *UserUpdated) Exchange() string { return constants.UserExchangeName }
+
+// RoutingKey returns the user updated event routing key
+func (e *UserUpdated) RoutingKey() string { return constants.UserUpdatedEventRouteKey }
+
+// UserDeleted is emitted after a user has been deleted
+type UserDeleted struct {
+	UserID     uint      `json:"user_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// NewUserDeleted creates a UserDeleted event
+func NewUserDeleted(userID uint) *UserDeleted {
+	return &UserDeleted{
+		UserID:     userID,
+		OccurredAt: now(),
+	}
+}
+
+// Exchange returns the user events exchange
+func (e *UserDeleted) Exchange() string { return constants.UserExchangeName }
+
+// RoutingKey returns the user deleted event routing key
+func (e *UserDeleted) RoutingKey() string { return constants.UserDeletedEventRouteKey }
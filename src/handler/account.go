@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/usecase"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AccountHandler handles HTTP requests for email verification and password reset
+type AccountHandler struct {
+	accountUsecase usecase.AccountUsecase
+	validator      *validator.Validate
+}
+
+// NewAccountHandler creates a new account handler instance
+func NewAccountHandler(accountUsecase usecase.AccountUsecase) *AccountHandler {
+	return &AccountHandler{
+		accountUsecase: accountUsecase,
+		validator:      validator.New(),
+	}
+}
+
+// RegisterRoutes registers the account routes. They are public: the emailed
+// token authenticates verification and reset.
+func (h *AccountHandler) RegisterRoutes(router *middleware.Router) {
+	router.Post("/auth/email/verification", middleware.Public, h.RequestEmailVerification)
+	router.Post("/auth/email/verify", middleware.Public, h.VerifyEmail)
+	router.Post("/auth/password/forgot", middleware.Public, h.RequestPasswordReset)
+	router.Post("/auth/password/reset", middleware.Public, h.ResetPassword)
+}
+
+// RequestEmailVerification handles POST /auth/email/verification
+// @Summary      Send a verification email
+// @Description  Email a verification link to the account. The response is the same for unknown and already verified emails.
+// @Tags         auth
+// @Accept       json
+// @Param        account  body  dto.AccountEmailRequest  true  "Account email"
+// @Success      202      "Verification email queued, if the account exists and is unverified"
+// @Failure      400      {object}  map[string]interface{}  "Invalid request body or validation failed"
+// @Failure      500      {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/email/verification [post]
+func (h *AccountHandler) RequestEmailVerification(c *fiber.Ctx) error {
+	var req dto.AccountEmailRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	if err := h.accountUsecase.WithContext(middleware.AuditContext(c)).RequestEmailVerification(req.Email); err != nil {
+		helper.LogError("Failed to send verification email", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// VerifyEmail handles POST /auth/email/verify
+// @Summary      Verify an email
+// @Description  Verify the email of the account with the token of its verification email. Tokens are single-use.
+// @Tags         auth
+// @Accept       json
+// @Param        token  body  dto.VerifyEmailRequest  true  "Verification token"
+// @Success      204    "Email verified"
+// @Failure      400    {object}  map[string]interface{}  "Invalid request body, validation failed or invalid token"
+// @Failure      500    {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/email/verify [post]
+func (h *AccountHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req dto.VerifyEmailRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	if err := h.accountUsecase.WithContext(middleware.AuditContext(c)).VerifyEmail(req.Token); err != nil {
+		return h.tokenError(c, "Failed to verify email", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RequestPasswordReset handles POST /auth/password/forgot
+// @Summary      Send a password reset email
+// @Description  Email a password reset link to the account. The response is the same for unknown emails.
+// @Tags         auth
+// @Accept       json
+// @Param        account  body  dto.AccountEmailRequest  true  "Account email"
+// @Success      202      "Password reset email queued, if the account exists"
+// @Failure      400      {object}  map[string]interface{}  "Invalid request body or validation failed"
+// @Failure      500      {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/password/forgot [post]
+func (h *AccountHandler) RequestPasswordReset(c *fiber.Ctx) error {
+	var req dto.AccountEmailRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	if err := h.accountUsecase.WithContext(middleware.AuditContext(c)).RequestPasswordReset(req.Email); err != nil {
+		helper.LogError("Failed to send password reset email", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send password reset email",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// ResetPassword handles POST /auth/password/reset
+// @Summary      Reset the password
+// @Description  Set a new password with the token of a password reset email. Tokens are single-use; every token of the user is revoked.
+// @Tags         auth
+// @Accept       json
+// @Param        reset  body  dto.ResetPasswordRequest  true  "Reset token and new password"
+// @Success      204    "Password reset"
+// @Failure      400    {object}  map[string]interface{}  "Invalid request body, validation failed or invalid token"
+// @Failure      500    {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/password/reset [post]
+func (h *AccountHandler) ResetPassword(c *fiber.Ctx) error {
+	var req dto.ResetPasswordRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	if err := h.accountUsecase.WithContext(middleware.AuditContext(c)).ResetPassword(req.Token, req.Password); err != nil {
+		return h.tokenError(c, "Failed to reset password", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// tokenError maps a verification or reset error to its response
+func (h *AccountHandler) tokenError(c *fiber.Ctx, message string, err error) error {
+	if errors.Is(err, usecase.ErrInvalidAccountToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	helper.LogError(message, err, c.Path(), nil)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// parse reads and validates the request body into req; it returns the 400
+// response body on failure
+func (h *AccountHandler) parse(c *fiber.Ctx, req interface{}) fiber.Map {
+	if err := c.BodyParser(req); err != nil {
+		helper.LogError("Failed to parse request body", err, c.Path(), nil)
+		return fiber.Map{"error": "Invalid request body"}
+	}
+	if err := h.validator.Struct(req); err != nil {
+		return fiber.Map{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		}
+	}
+	return nil
+}
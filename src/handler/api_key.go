@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/usecase"
+	"errors"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHandler handles HTTP requests for managing service API keys
+type APIKeyHandler struct {
+	apiKeyUsecase usecase.APIKeyUsecase
+	validator     *validator.Validate
+}
+
+// NewAPIKeyHandler creates a new API key handler instance
+func NewAPIKeyHandler(apiKeyUsecase usecase.APIKeyUsecase) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyUsecase: apiKeyUsecase,
+		validator:     validator.New(),
+	}
+}
+
+// RegisterRoutes registers the admin API key routes, each behind JWT
+// authentication and its api_keys:<action> permission
+func (h *APIKeyHandler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/admin/api-keys", middleware.JWT, middleware.RequirePermission("api_keys:read"), h.ListAPIKeys)
+	router.Post("/admin/api-keys", middleware.JWT, middleware.RequirePermission("api_keys:create"), h.CreateAPIKey)
+	router.Post("/admin/api-keys/:id/rotate", middleware.JWT, middleware.RequirePermission("api_keys:update"), h.RotateAPIKey)
+	router.Delete("/admin/api-keys/:id", middleware.JWT, middleware.RequirePermission("api_keys:delete"), h.RevokeAPIKey)
+}
+
+// CreateAPIKey handles POST /admin/api-keys
+// @Summary      Create an API key
+// @Description  Issue an API key for a service. The key is only returned in this response.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        api_key  body      dto.CreateAPIKeyRequest    true  "Service and scopes"
+// @Success      201      {object}  dto.APIKeyCreatedResponse  "API key created"
+// @Failure      400      {object}  map[string]interface{}     "Invalid request body or validation failed"
+// @Failure      401      {object}  map[string]interface{}     "Missing or invalid token"
+// @Failure      403      {object}  map[string]interface{}     "Missing permission"
+// @Failure      500      {object}  map[string]interface{}     "Internal server error"
+// @Security     BearerAuth
+// @Router       /admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req dto.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		helper.LogError("Failed to parse request body", err, c.Path(), nil)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Struct(&req); err != nil {
+		helper.LogError("Validation failed", err, c.Path(), req)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	}
+
+	created, err := h.apiKeyUsecase.Create(&req)
+	if err != nil {
+		helper.LogError("Failed to create API key", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// ListAPIKeys handles GET /admin/api-keys
+// @Summary      List API keys
+// @Description  List API keys, newest first, without the keys themselves
+// @Tags         admin
+// @Produce      json
+// @Param        limit            query     int   false  "Limit number of results (default: 10, max: 100)"
+// @Param        offset           query     int   false  "Offset for pagination (default: 0)"
+// @Param        include_revoked  query     bool  false  "Include revoked keys"
+// @Success      200              {object}  dto.APIKeyListResponse  "List of API keys"
+// @Failure      401              {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      403              {object}  map[string]interface{}  "Missing permission"
+// @Failure      500              {object}  map[string]interface{}  "Internal server error"
+// @Security     BearerAuth
+// @Router       /admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+
+	keys, err := h.apiKeyUsecase.List(limit, offset, c.QueryBool("include_revoked"))
+	if err != nil {
+		helper.LogError("Failed to list API keys", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve API keys",
+		})
+	}
+
+	return c.JSON(keys)
+}
+
+// RotateAPIKey handles POST /admin/api-keys/:id/rotate
+// @Summary      Rotate an API key
+// @Description  Issue a new key with the same service and scopes. The old key keeps working for the grace period (default one day).
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int                        true   "API key ID"
+// @Param        rotation  body      dto.RotateAPIKeyRequest    false  "Lifetime and grace period"
+// @Success      201       {object}  dto.APIKeyCreatedResponse  "New API key"
+// @Failure      400       {object}  map[string]interface{}     "Invalid ID or request body"
+// @Failure      401       {object}  map[string]interface{}     "Missing or invalid token"
+// @Failure      403       {object}  map[string]interface{}     "Missing permission"
+// @Failure      404       {object}  map[string]interface{}     "API key not found"
+// @Failure      409       {object}  map[string]interface{}     "API key revoked or already rotated"
+// @Failure      500       {object}  map[string]interface{}     "Internal server error"
+// @Security     BearerAuth
+// @Router       /admin/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	// The body is optional
+	var req dto.RotateAPIKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			helper.LogError("Failed to parse request body", err, c.Path(), nil)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	if err := h.validator.Struct(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	}
+
+	created, err := h.apiKeyUsecase.Rotate(uint(id), &req)
+	if err != nil {
+		return h.keyError(c, "Failed to rotate API key", err, id)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// RevokeAPIKey handles DELETE /admin/api-keys/:id
+// @Summary      Revoke an API key
+// @Description  Disable an API key immediately
+// @Tags         admin
+// @Param        id   path  int  true  "API key ID"
+// @Success      204  "API key revoked"
+// @Failure      400  {object}  map[string]interface{}  "Invalid API key ID"
+// @Failure      401  {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      403  {object}  map[string]interface{}  "Missing permission"
+// @Failure      404  {object}  map[string]interface{}  "API key not found"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Security     BearerAuth
+// @Router       /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	if err := h.apiKeyUsecase.Revoke(uint(id)); err != nil {
+		return h.keyError(c, "Failed to revoke API key", err, id)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// keyError maps a usecase error about the key id to its response
+func (h *APIKeyHandler) keyError(c *fiber.Ctx, message string, err error, id uint64) error {
+	switch {
+	case errors.Is(err, usecase.ErrAPIKeyNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, usecase.ErrAPIKeyInactive):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		helper.LogError(message, err, c.Path(), map[string]interface{}{"id": id})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": message})
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/usecase"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditHandler handles HTTP requests for querying the audit log
+type AuditHandler struct {
+	auditUsecase usecase.AuditUsecase
+	validator    *validator.Validate
+}
+
+// NewAuditHandler creates a new audit handler instance
+func NewAuditHandler(auditUsecase usecase.AuditUsecase) *AuditHandler {
+	return &AuditHandler{
+		auditUsecase: auditUsecase,
+		validator:    validator.New(),
+	}
+}
+
+// RegisterRoutes registers the admin audit log route, behind JWT
+// authentication and the audit_logs:read permission
+func (h *AuditHandler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/admin/audit-logs", middleware.JWT, middleware.RequirePermission("audit_logs:read"), h.ListAuditLogs)
+}
+
+// ListAuditLogs handles GET /admin/audit-logs
+// @Summary      List audit logs
+// @Description  List the recorded creations, updates and deletions, newest first, with their actor and changed fields (secrets redacted)
+// @Tags         admin
+// @Produce      json
+// @Param        entity      query     string  false  "Entity, e.g. user"
+// @Param        entity_id   query     int     false  "Entity ID"
+// @Param        actor_type  query     string  false  "Actor type (user, api_key, client, consumer, system, anonymous)"
+// @Param        actor_id    query     string  false  "Actor ID"
+// @Param        action      query     string  false  "Action (created, updated, deleted)"
+// @Param        source      query     string  false  "Source (http, amqp, system)"
+// @Param        request_id  query     string  false  "HTTP request ID or AMQP message ID"
+// @Param        since       query     string  false  "From this time (RFC 3339, inclusive)"
+// @Param        until       query     string  false  "Until this time (RFC 3339, exclusive)"
+// @Param        limit       query     int     false  "Limit number of results (default: 10, max: 100)"
+// @Param        offset      query     int     false  "Offset for pagination (default: 0)"
+// @Success      200         {object}  dto.AuditLogListResponse  "List of audit logs"
+// @Failure      400         {object}  map[string]interface{}    "Invalid filter"
+// @Failure      401         {object}  map[string]interface{}    "Missing or invalid token"
+// @Failure      403         {object}  map[string]interface{}    "Missing permission"
+// @Failure      500         {object}  map[string]interface{}    "Internal server error"
+// @Security     BearerAuth
+// @Router       /admin/audit-logs [get]
+func (h *AuditHandler) ListAuditLogs(c *fiber.Ctx) error {
+	var query dto.AuditLogQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+	}
+	if err := h.validator.Struct(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+	}
+
+	logs, err := h.auditUsecase.GetAuditLogs(&query)
+	if err != nil {
+		helper.LogError("Failed to list audit logs", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve audit logs",
+		})
+	}
+
+	return c.JSON(logs)
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/usecase"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthHandler handles HTTP requests for authentication
+type AuthHandler struct {
+	authUsecase usecase.AuthUsecase
+	validator   *validator.Validate
+}
+
+// NewAuthHandler creates a new auth handler instance
+func NewAuthHandler(authUsecase usecase.AuthUsecase) *AuthHandler {
+	return &AuthHandler{
+		authUsecase: authUsecase,
+		validator:   validator.New(),
+	}
+}
+
+// RegisterRoutes registers the auth routes. Login, refresh and logout are
+// public, the refresh token authenticates refresh and logout; revoking access
+// tokens needs one.
+func (h *AuthHandler) RegisterRoutes(router *middleware.Router) {
+	router.Post("/auth/login", middleware.Public, h.Login)
+	router.Post("/auth/refresh", middleware.Public, h.Refresh)
+	router.Post("/auth/logout", middleware.Public, h.Logout)
+	router.Post("/auth/revoke", middleware.JWT, h.RevokeToken)
+	router.Post("/admin/users/:id/revoke-tokens", middleware.JWT, middleware.RequirePermission("tokens:revoke"), h.RevokeUserTokens)
+}
+
+// Login handles POST /auth/login
+// @Summary      Log in
+// @Description  Exchange email and password for a short-lived access token and a refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body      dto.LoginRequest        true  "Credentials"
+// @Success      200          {object}  dto.TokenResponse       "Tokens issued"
+// @Failure      400          {object}  map[string]interface{}  "Invalid request body or validation failed"
+// @Failure      401          {object}  map[string]interface{}  "Invalid email or password"
+// @Failure      403          {object}  map[string]interface{}  "Email not verified (AUTH_REQUIRE_VERIFIED_EMAIL)"
+// @Failure      429          {object}  map[string]interface{}  "Account locked after too many failed attempts, see Retry-After"
+// @Failure      500          {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/login [post]
+func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	var req dto.LoginRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	tokens, err := h.authUsecase.Login(&req)
+	if err != nil {
+		var locked *usecase.AccountLockedError
+		if errors.As(err, &locked) {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": usecase.ErrAccountLocked.Error(),
+			})
+		}
+		if errors.Is(err, usecase.ErrEmailNotVerified) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, usecase.ErrInvalidCredentials) {
+			helper.LogInfo("Login failed", map[string]interface{}{
+				"email": req.Email,
+			})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		helper.LogError("Failed to log in", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log in",
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
+// Refresh handles POST /auth/refresh
+// @Summary      Refresh tokens
+// @Description  Exchange a refresh token for new tokens. Refresh tokens are single-use; reusing one revokes the login.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body      dto.RefreshTokenRequest  true  "Refresh token"
+// @Success      200    {object}  dto.TokenResponse        "Tokens issued"
+// @Failure      400    {object}  map[string]interface{}   "Invalid request body or validation failed"
+// @Failure      401    {object}  map[string]interface{}   "Invalid, expired or reused refresh token"
+// @Failure      500    {object}  map[string]interface{}   "Internal server error"
+// @Router       /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req dto.RefreshTokenRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	tokens, err := h.authUsecase.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidRefreshToken) || errors.Is(err, usecase.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		helper.LogError("Failed to refresh tokens", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh tokens",
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
+// Logout handles POST /auth/logout
+// @Summary      Log out
+// @Description  Revoke the refresh token and every token rotated from the same login
+// @Tags         auth
+// @Accept       json
+// @Param        token  body  dto.RefreshTokenRequest  true  "Refresh token"
+// @Success      204    "Logged out"
+// @Failure      400    {object}  map[string]interface{}  "Invalid request body or validation failed"
+// @Failure      500    {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/logout [post]
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req dto.RefreshTokenRequest
+	if body := h.parse(c, &req); body != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+
+	if err := h.authUsecase.Logout(req.RefreshToken); err != nil {
+		helper.LogError("Failed to log out", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeToken handles POST /auth/revoke
+// @Summary      Revoke the access token
+// @Description  Revoke the access token of the request until it expires, e.g. with logout
+// @Tags         auth
+// @Success      204  "Access token revoked"
+// @Failure      400  {object}  map[string]interface{}  "Token without jti or exp"
+// @Failure      401  {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Failure      503  {object}  map[string]interface{}  "Token revocation not available"
+// @Security     BearerAuth
+// @Router       /auth/revoke [post]
+func (h *AuthHandler) RevokeToken(c *fiber.Ctx) error {
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Token cannot be revoked: it has no jti or exp",
+		})
+	}
+
+	if err := h.authUsecase.RevokeAccessToken(jti, exp.Time); err != nil {
+		return h.revocationError(c, "Failed to revoke token", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeUserTokens handles POST /admin/users/:id/revoke-tokens
+// @Summary      Revoke the tokens of a user
+// @Description  Revoke every access and refresh token issued to the user until now, e.g. when they leaked
+// @Tags         admin
+// @Param        id   path  int  true  "User ID"
+// @Success      204  "Tokens revoked"
+// @Failure      400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure      401  {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      403  {object}  map[string]interface{}  "Missing permission"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Failure      503  {object}  map[string]interface{}  "Token revocation not available"
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/revoke-tokens [post]
+func (h *AuthHandler) RevokeUserTokens(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.authUsecase.RevokeUserTokens(uint(id)); err != nil {
+		return h.revocationError(c, "Failed to revoke tokens", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// revocationError maps a revocation error to its response
+func (h *AuthHandler) revocationError(c *fiber.Ctx, message string, err error) error {
+	if errors.Is(err, usecase.ErrRevocationUnavailable) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	helper.LogError(message, err, c.Path(), nil)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// parse reads and validates the request body into req; it returns the 400
+// response body on failure
+func (h *AuthHandler) parse(c *fiber.Ctx, req interface{}) fiber.Map {
+	if err := c.BodyParser(req); err != nil {
+		helper.LogError("Failed to parse request body", err, c.Path(), nil)
+		return fiber.Map{"error": "Invalid request body"}
+	}
+	if err := h.validator.Struct(req); err != nil {
+		return fiber.Map{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		}
+	}
+	return nil
+}
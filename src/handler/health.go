@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"boilerblade/config/broker"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HealthHandler reports whether the service is able to do its work
+type HealthHandler struct {
+	consumers func() []broker.GuardStatus
+}
+
+// NewHealthHandler creates a health handler reporting the consumers returned by
+// consumers (broker.Guards in the app)
+func NewHealthHandler(consumers func() []broker.GuardStatus) *HealthHandler {
+	return &HealthHandler{consumers: consumers}
+}
+
+// RegisterRoutes registers the health route; it must stay outside authentication
+func (h *HealthHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/health", h.Health)
+}
+
+// Health handles GET /health: 200 while every consumer is consuming, 503 while
+// one is paused after repeated panics. It is served outside /api/v1, so it is
+// not part of the swagger document.
+func (h *HealthHandler) Health(c *fiber.Ctx) error {
+	consumers := h.consumers()
+	if consumers == nil {
+		consumers = []broker.GuardStatus{}
+	}
+
+	var paused []string
+	for _, consumer := range consumers {
+		if consumer.State == broker.GuardOpen {
+			paused = append(paused, consumer.Name)
+		}
+	}
+
+	if len(paused) > 0 {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":    "degraded",
+			"paused":    paused,
+			"consumers": consumers,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":    "ok",
+		"consumers": consumers,
+	})
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/usecase"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OIDCLoginCookie keeps the login state between the redirect to the identity
+// provider and its callback
+const OIDCLoginCookie = "oidc_login"
+
+// OIDCHandler handles HTTP requests for logging in with an identity provider
+type OIDCHandler struct {
+	oidcUsecase usecase.OIDCUsecase
+}
+
+// NewOIDCHandler creates a new OIDC handler instance
+func NewOIDCHandler(oidcUsecase usecase.OIDCUsecase) *OIDCHandler {
+	return &OIDCHandler{
+		oidcUsecase: oidcUsecase,
+	}
+}
+
+// RegisterRoutes registers the OIDC routes; both are public, the login state
+// cookie ties the callback to the browser that started the login
+func (h *OIDCHandler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/auth/oidc/login", middleware.Public, h.Login)
+	router.Get("/auth/oidc/callback", middleware.Public, h.Callback)
+}
+
+// Login handles GET /auth/oidc/login
+// @Summary      Log in with the identity provider
+// @Description  Redirect to the identity provider (authorization code flow with PKCE). The login state is kept in the oidc_login cookie until the callback.
+// @Tags         auth
+// @Success      302  "Redirect to the identity provider"
+// @Failure      502  {object}  map[string]interface{}  "Identity provider unavailable"
+// @Router       /auth/oidc/login [get]
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	authURL, loginState, err := h.oidcUsecase.Begin()
+	if err != nil {
+		helper.LogError("Failed to start OIDC login", err, c.Path(), nil)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Identity provider unavailable",
+		})
+	}
+
+	c.Cookie(h.cookie(c, loginState, time.Now().Add(usecase.OIDCLoginTTL)))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback handles GET /auth/oidc/callback
+// @Summary      Identity provider callback
+// @Description  Finish the login: exchange the code, validate the ID token, create or link the user on first login and issue our own tokens
+// @Tags         auth
+// @Produce      json
+// @Param        code   query     string                  false  "Authorization code"
+// @Param        state  query     string                  true   "State sent to the provider"
+// @Param        error  query     string                  false  "Error returned by the provider"
+// @Success      200    {object}  dto.TokenResponse       "Tokens issued"
+// @Failure      400    {object}  map[string]interface{}  "Invalid or expired login state"
+// @Failure      401    {object}  map[string]interface{}  "Login refused or failed at the identity provider"
+// @Failure      403    {object}  map[string]interface{}  "Email not verified by the identity provider"
+// @Failure      500    {object}  map[string]interface{}  "Internal server error"
+// @Router       /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	loginState := c.Cookies(OIDCLoginCookie)
+	// The login state is single-use
+	c.Cookie(h.cookie(c, "", time.Unix(0, 0)))
+
+	if providerError := c.Query("error"); providerError != "" {
+		helper.LogInfo("OIDC login refused by the identity provider", map[string]interface{}{
+			"error":       providerError,
+			"description": c.Query("error_description"),
+		})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Login refused by the identity provider",
+			"details": providerError,
+		})
+	}
+
+	tokens, err := h.oidcUsecase.Callback(loginState, c.Query("state"), c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrOIDCInvalidState):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, usecase.ErrOIDCLoginFailed), errors.Is(err, usecase.ErrOIDCUserNotFound):
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, usecase.ErrOIDCEmailNotVerified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		helper.LogError("Failed to finish OIDC login", err, c.Path(), nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log in",
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
+// cookie returns the login state cookie, scoped to the OIDC routes
+func (h *OIDCHandler) cookie(c *fiber.Ctx, value string, expires time.Time) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     OIDCLoginCookie,
+		Value:    value,
+		Path:     path.Dir(c.Path()),
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"boilerblade/helper"
+	"boilerblade/middleware"
 	"boilerblade/src/dto"
 	"boilerblade/src/usecase"
 	"strconv"
@@ -24,13 +25,14 @@ func NewProductHandler(productUsecase usecase.ProductUsecase) *ProductHandler {
 	}
 }
 
-// RegisterRoutes registers all product routes to the router group
-func (h *ProductHandler) RegisterRoutes(router fiber.Router) {
-	router.Get("/products", h.GetAllProducts)
-	router.Get("/products/:id", h.GetProduct)
-	router.Post("/products", h.CreateProduct)
-	router.Put("/products/:id", h.UpdateProduct)
-	router.Delete("/products/:id", h.DeleteProduct)
+// RegisterRoutes registers all product routes to the router group, each
+// behind JWT authentication and its products:<action> permission
+func (h *ProductHandler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/products", middleware.JWT, middleware.RequirePermission("products:read"), h.GetAllProducts)
+	router.Get("/products/:id", middleware.JWT, middleware.RequirePermission("products:read"), h.GetProduct)
+	router.Post("/products", middleware.JWT, middleware.RequirePermission("products:create"), h.CreateProduct)
+	router.Put("/products/:id", middleware.JWT, middleware.RequirePermission("products:update"), h.UpdateProduct)
+	router.Delete("/products/:id", middleware.JWT, middleware.RequirePermission("products:delete"), h.DeleteProduct)
 }
 
 // CreateProduct handles the creation of a new product
@@ -41,7 +43,7 @@ func (h *ProductHandler) CreateProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	productResponse, err := h.productUsecase.CreateProduct(&req)
+	productResponse, err := h.productUsecase.WithContext(middleware.AuditContext(c)).CreateProduct(&req)
 	if err != nil {
 		helper.LogError("Failed to create product", err, c.Path(), req)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -101,7 +103,7 @@ func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	productResponse, err := h.productUsecase.UpdateProduct(uint(id), &req)
+	productResponse, err := h.productUsecase.WithContext(middleware.AuditContext(c)).UpdateProduct(uint(id), &req)
 	if err != nil {
 		helper.LogError("Failed to update product", err, c.Path(), req)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -118,7 +120,7 @@ func (h *ProductHandler) DeleteProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
 	}
 
-	if err := h.productUsecase.DeleteProduct(uint(id)); err != nil {
+	if err := h.productUsecase.WithContext(middleware.AuditContext(c)).DeleteProduct(uint(id)); err != nil {
 		helper.LogError("Failed to delete product", err, c.Path(), nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"boilerblade/helper"
+	"boilerblade/middleware"
 	"boilerblade/src/dto"
 	"boilerblade/src/usecase"
+	"errors"
 	"strconv"
 
 	"github.com/go-playground/validator/v10"
@@ -24,13 +26,15 @@ func NewUserHandler(userUsecase usecase.UserUsecase) *UserHandler {
 	}
 }
 
-// RegisterRoutes registers all user routes to the router group
-func (h *UserHandler) RegisterRoutes(router fiber.Router) {
-	router.Get("/users", h.GetAllUsers)
-	router.Get("/users/:id", h.GetUser)
-	router.Post("/users", h.CreateUser)
-	router.Put("/users/:id", h.UpdateUser)
-	router.Delete("/users/:id", h.DeleteUser)
+// RegisterRoutes registers all user routes to the router group. Sign-up is
+// public; users read and update themselves, other users need the users:*
+// permissions. Services read users with an API key scoped users:read.
+func (h *UserHandler) RegisterRoutes(router *middleware.Router) {
+	router.Get("/users", middleware.JWTOrAPIKey, middleware.RequirePermission("users:read"), h.GetAllUsers)
+	router.Get("/users/:id", middleware.JWTOrAPIKey, middleware.RequireOwnerOrPermission("id", "users:read"), h.GetUser)
+	router.Post("/users", middleware.Public, h.CreateUser)
+	router.Put("/users/:id", middleware.JWT, middleware.RequireOwnerOrPermission("id", "users:update"), h.UpdateUser)
+	router.Delete("/users/:id", middleware.JWT, middleware.RequirePermission("users:delete"), h.DeleteUser)
 }
 
 // CreateUser handles POST /users
@@ -43,7 +47,6 @@ func (h *UserHandler) RegisterRoutes(router fiber.Router) {
 // @Success      201   {object}  map[string]interface{}  "User created successfully"
 // @Failure      400   {object}  map[string]interface{}  "Invalid request body or validation failed"
 // @Failure      500   {object}  map[string]interface{}  "Internal server error"
-// @Security     BearerAuth
 // @Router       /users [post]
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	var req dto.CreateUserRequest
@@ -58,7 +61,7 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 
 	// Validate request
 	if err := h.validator.Struct(&req); err != nil {
-		helper.LogError("Validation failed", err, c.Path(), req)
+		helper.LogError("Validation failed", err, c.Path(), map[string]interface{}{"fields": invalidFields(err)})
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Validation failed",
 			"details": err.Error(),
@@ -66,9 +69,9 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	}
 
 	// Call usecase
-	user, err := h.userUsecase.CreateUser(&req)
+	user, err := h.userUsecase.WithContext(middleware.AuditContext(c)).CreateUser(&req)
 	if err != nil {
-		helper.LogError("Failed to create user", err, c.Path(), req)
+		helper.LogError("Failed to create user", err, c.Path(), map[string]interface{}{"email": req.Email})
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -94,8 +97,11 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 // @Param        id   path      int  true  "User ID"
 // @Success      200  {object}  map[string]interface{}  "User data"
 // @Failure      400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure      401  {object}  map[string]interface{}  "Missing or invalid token or API key"
+// @Failure      403  {object}  map[string]interface{}  "Missing permission"
 // @Failure      404  {object}  map[string]interface{}  "User not found"
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users/{id} [get]
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 	// Get ID from params
@@ -129,8 +135,11 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 // @Param        limit   query     int  false  "Limit number of results (default: 10, max: 100)"
 // @Param        offset  query     int  false  "Offset for pagination (default: 0)"
 // @Success      200     {object}  map[string]interface{}  "List of users"
+// @Failure      401     {object}  map[string]interface{}  "Missing or invalid token or API key"
+// @Failure      403     {object}  map[string]interface{}  "Missing permission"
 // @Failure      500     {object}  map[string]interface{}  "Internal server error"
 // @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users [get]
 func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
 	// Get pagination parameters
@@ -161,6 +170,8 @@ func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
 // @Param        user  body      dto.UpdateUserRequest  true  "User data to update"
 // @Success      200   {object}  map[string]interface{}  "User updated successfully"
 // @Failure      400   {object}  map[string]interface{}  "Invalid request body or validation failed"
+// @Failure      401   {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      403   {object}  map[string]interface{}  "Missing permission"
 // @Failure      404   {object}  map[string]interface{}  "User not found"
 // @Failure      500   {object}  map[string]interface{}  "Internal server error"
 // @Security     BearerAuth
@@ -186,7 +197,7 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 
 	// Validate request
 	if err := h.validator.Struct(&req); err != nil {
-		helper.LogError("Validation failed", err, c.Path(), req)
+		helper.LogError("Validation failed", err, c.Path(), map[string]interface{}{"id": id, "fields": invalidFields(err)})
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Validation failed",
 			"details": err.Error(),
@@ -194,7 +205,7 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	}
 
 	// Call usecase
-	user, err := h.userUsecase.UpdateUser(uint(id), &req)
+	user, err := h.userUsecase.WithContext(middleware.AuditContext(c)).UpdateUser(uint(id), &req)
 	if err != nil {
 		helper.LogError("Failed to update user", err, c.Path(), map[string]interface{}{"id": id})
 		statusCode := fiber.StatusInternalServerError
@@ -225,6 +236,8 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 // @Param        id   path      int  true  "User ID"
 // @Success      200  {object}  map[string]interface{}  "User deleted successfully"
 // @Failure      400  {object}  map[string]interface{}  "Invalid user ID"
+// @Failure      401  {object}  map[string]interface{}  "Missing or invalid token"
+// @Failure      403  {object}  map[string]interface{}  "Missing permission"
 // @Failure      404  {object}  map[string]interface{}  "User not found"
 // @Failure      500  {object}  map[string]interface{}  "Internal server error"
 // @Security     BearerAuth
@@ -239,7 +252,7 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	}
 
 	// Call usecase
-	if err := h.userUsecase.DeleteUser(uint(id)); err != nil {
+	if err := h.userUsecase.WithContext(middleware.AuditContext(c)).DeleteUser(uint(id)); err != nil {
 		helper.LogError("Failed to delete user", err, c.Path(), map[string]interface{}{"id": id})
 		statusCode := fiber.StatusInternalServerError
 		if err.Error() == "user not found" {
@@ -258,3 +271,17 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 		"message": "User deleted successfully",
 	})
 }
+
+// invalidFields lists the fields a validation error is about. User requests
+// carry a plaintext password, so they are logged by field name, never whole.
+func invalidFields(err error) []string {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+	fields := make([]string, len(validationErrs))
+	for i, fieldErr := range validationErrs {
+		fields[i] = fieldErr.Field()
+	}
+	return fields
+}
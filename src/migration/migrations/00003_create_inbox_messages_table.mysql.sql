@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE inbox_messages (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    processed_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    UNIQUE KEY idx_inbox_messages_message_consumer (message_id, consumer),
+    KEY idx_inbox_messages_processed_at (processed_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +goose Down
+DROP TABLE IF EXISTS inbox_messages;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE inbox_messages (
+    id SERIAL PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_inbox_messages_message_consumer ON inbox_messages (message_id, consumer);
+CREATE INDEX idx_inbox_messages_processed_at ON inbox_messages (processed_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS inbox_messages;
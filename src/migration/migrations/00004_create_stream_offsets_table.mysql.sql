@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE stream_offsets (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    stream VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    next_offset BIGINT NOT NULL,
+    updated_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    UNIQUE KEY idx_stream_offsets_stream_consumer (stream, consumer)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +goose Down
+DROP TABLE IF EXISTS stream_offsets;
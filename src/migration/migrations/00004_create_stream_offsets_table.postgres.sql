@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE stream_offsets (
+    id SERIAL PRIMARY KEY,
+    stream VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    next_offset BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_stream_offsets_stream_consumer ON stream_offsets (stream, consumer);
+
+-- +goose Down
+DROP TABLE IF EXISTS stream_offsets;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE external_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    provider VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_external_identities_provider_subject ON external_identities (provider, subject);
+CREATE INDEX idx_external_identities_user_id ON external_identities (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS external_identities;
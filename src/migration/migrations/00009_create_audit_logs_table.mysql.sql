@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE audit_logs (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    actor_type VARCHAR(32) NOT NULL,
+    actor_id VARCHAR(255) NOT NULL DEFAULT '',
+    entity VARCHAR(64) NOT NULL,
+    entity_id INT UNSIGNED NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    changes TEXT,
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    source VARCHAR(32) NOT NULL,
+    created_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    KEY idx_audit_logs_entity (entity, entity_id),
+    KEY idx_audit_logs_actor (actor_type, actor_id),
+    KEY idx_audit_logs_request_id (request_id),
+    KEY idx_audit_logs_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_logs;
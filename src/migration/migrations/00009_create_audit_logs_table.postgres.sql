@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    actor_type VARCHAR(32) NOT NULL,
+    actor_id VARCHAR(255) NOT NULL DEFAULT '',
+    entity VARCHAR(64) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    changes TEXT,
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    source VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_logs_entity ON audit_logs (entity, entity_id);
+CREATE INDEX idx_audit_logs_actor ON audit_logs (actor_type, actor_id);
+CREATE INDEX idx_audit_logs_request_id ON audit_logs (request_id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_logs;
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// APIKey is a service API key; only the SHA-256 of the key is stored, next to
+// the prefix it is looked up by. A rotated key points to its replacement and
+// keeps working until ExpiresAt (the grace period).
+type APIKey struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"not null;index"` // service the key belongs to
+	Prefix       string     `json:"prefix" gorm:"not null;uniqueIndex"`
+	KeyHash      string     `json:"-" gorm:"not null"`
+	Scopes       string     `json:"scopes" gorm:"type:text;not null"` // permissions, separated by spaces
+	ExpiresAt    *time.Time `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
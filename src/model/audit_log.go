@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// AuditLog records a create, update or delete of an entity: who made it
+// (ActorType and ActorID), through which channel (Source and RequestID) and
+// the changed fields, as JSON-encoded event.FieldChange with secrets redacted.
+// Records are append-only.
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ActorType string    `json:"actor_type" gorm:"not null;index:idx_audit_logs_actor"`
+	ActorID   string    `json:"actor_id" gorm:"not null;index:idx_audit_logs_actor"`
+	Entity    string    `json:"entity" gorm:"not null;index:idx_audit_logs_entity"`
+	EntityID  uint      `json:"entity_id" gorm:"not null;index:idx_audit_logs_entity"`
+	Action    string    `json:"action" gorm:"not null"`
+	Changes   string    `json:"changes" gorm:"type:text"`
+	RequestID string    `json:"request_id" gorm:"not null;index"`
+	Source    string    `json:"source" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName specifies the table name for AuditLog model
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
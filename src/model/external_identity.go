@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ExternalIdentity links a user to its account at an OIDC identity provider:
+// Provider is the issuer and Subject the sub claim, which never changes (the
+// email may).
+type ExternalIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"not null;uniqueIndex:idx_external_identities_provider_subject"`
+	Subject     string     `json:"subject" gorm:"not null;uniqueIndex:idx_external_identities_provider_subject"`
+	Email       string     `json:"email" gorm:"not null"` // email of the last login
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for ExternalIdentity model
+func (ExternalIdentity) TableName() string {
+	return "external_identities"
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// InboxMessage records an AMQP message already processed by a consumer.
+// The (message_id, consumer) pair is unique so redeliveries can be detected.
+type InboxMessage struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MessageID   string    `json:"message_id" gorm:"not null;uniqueIndex:idx_inbox_messages_message_consumer"`
+	Consumer    string    `json:"consumer" gorm:"not null;uniqueIndex:idx_inbox_messages_message_consumer"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// TableName specifies the table name for InboxMessage model
+func (InboxMessage) TableName() string {
+	return "inbox_messages"
+}
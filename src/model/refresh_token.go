@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// RefreshToken is an issued refresh token; only the SHA-256 of the token is
+// stored. Tokens rotated from one login share a FamilyID, so presenting a
+// rotated token again revokes the whole family.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID  string     `json:"family_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`    // set when rotated
+	RevokedAt *time.Time `json:"revoked_at"` // set on logout or reuse
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
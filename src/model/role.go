@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// Role groups permissions ("users:delete", "users:*" or "*") granted to users
+type Role struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	Name        string           `json:"name" gorm:"not null;uniqueIndex"`
+	Description string           `json:"description"`
+	Permissions []RolePermission `json:"permissions,omitempty" gorm:"foreignKey:RoleID"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// TableName specifies the table name for Role model
+func (Role) TableName() string {
+	return "roles"
+}
+
+// RolePermission is a permission granted by a role
+type RolePermission struct {
+	RoleID     uint   `json:"role_id" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey"`
+}
+
+// TableName specifies the table name for RolePermission model
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// UserRole assigns a role to a user
+type UserRole struct {
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	RoleID    uint      `json:"role_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for UserRole model
+func (UserRole) TableName() string {
+	return "user_roles"
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// StreamOffset stores the next offset a named consumer reads from an AMQP stream.
+// The (stream, consumer) pair is unique.
+type StreamOffset struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Stream    string    `json:"stream" gorm:"not null;uniqueIndex:idx_stream_offsets_stream_consumer"`
+	Consumer  string    `json:"consumer" gorm:"not null;uniqueIndex:idx_stream_offsets_stream_consumer"`
+	Offset    int64     `json:"offset" gorm:"column:next_offset;not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for StreamOffset model
+func (StreamOffset) TableName() string {
+	return "stream_offsets"
+}
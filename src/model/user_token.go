@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// User token purposes
+const (
+	UserTokenEmailVerification = "email_verification"
+	UserTokenPasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use token mailed to a user to verify its email or
+// reset its password; only the SHA-256 of the token is stored
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_user_tokens_user_purpose"`
+	Purpose   string     `json:"purpose" gorm:"not null;index:idx_user_tokens_user_purpose"`
+	Email     string     `json:"email" gorm:"not null"` // the address the token was mailed to
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"` // set when used or superseded
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for UserToken model
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository defines the interface for API key data operations
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	GetByID(id uint) (*model.APIKey, error)
+	GetByPrefix(prefix string) (*model.APIKey, error)
+	// GetAll lists keys, newest first; revoked ones only with includeRevoked
+	GetAll(limit, offset int, includeRevoked bool) ([]model.APIKey, error)
+	Count(includeRevoked bool) (int64, error)
+	Update(key *model.APIKey) error
+	// TouchLastUsed records a use of the key
+	TouchLastUsed(id uint, at time.Time) error
+}
+
+// apiKeyRepository implements APIKeyRepository interface
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository instance
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+// Create stores a new API key
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// GetByID retrieves an API key by ID
+func (r *apiKeyRepository) GetByID(id uint) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.First(&key, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetByPrefix retrieves an API key by its lookup prefix
+func (r *apiKeyRepository) GetByPrefix(prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAll retrieves API keys with pagination
+func (r *apiKeyRepository) GetAll(limit, offset int, includeRevoked bool) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.scope(includeRevoked).Order("id DESC").Limit(limit).Offset(offset).Find(&keys).Error
+	return keys, err
+}
+
+// Count returns the number of API keys
+func (r *apiKeyRepository) Count(includeRevoked bool) (int64, error) {
+	var count int64
+	err := r.scope(includeRevoked).Count(&count).Error
+	return count, err
+}
+
+// Update saves an API key
+func (r *apiKeyRepository) Update(key *model.APIKey) error {
+	return r.db.Save(key).Error
+}
+
+// TouchLastUsed sets last_used_at without touching updated_at
+func (r *apiKeyRepository) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&model.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
+
+func (r *apiKeyRepository) scope(includeRevoked bool) *gorm.DB {
+	query := r.db.Model(&model.APIKey{})
+	if !includeRevoked {
+		query = query.Where("revoked_at IS NULL")
+	}
+	return query
+}
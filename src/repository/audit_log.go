@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLogFilter selects audit logs; zero fields match everything
+type AuditLogFilter struct {
+	Entity    string
+	EntityID  uint
+	ActorType string
+	ActorID   string
+	Action    string
+	Source    string
+	RequestID string
+	Since     time.Time // inclusive
+	Until     time.Time // exclusive
+}
+
+// AuditLogRepository defines the interface for audit log data operations
+type AuditLogRepository interface {
+	Create(log *model.AuditLog) error
+	// Find lists the logs matching filter, newest first
+	Find(filter AuditLogFilter, limit, offset int) ([]model.AuditLog, error)
+	Count(filter AuditLogFilter) (int64, error)
+}
+
+// auditLogRepository implements AuditLogRepository interface
+type auditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository creates a new audit log repository instance
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &auditLogRepository{
+		db: db,
+	}
+}
+
+// Create stores a new audit log
+func (r *auditLogRepository) Create(log *model.AuditLog) error {
+	return r.db.Create(log).Error
+}
+
+// Find retrieves audit logs with pagination
+func (r *auditLogRepository) Find(filter AuditLogFilter, limit, offset int) ([]model.AuditLog, error) {
+	var logs []model.AuditLog
+	err := r.scope(filter).Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, err
+}
+
+// Count returns the number of audit logs matching filter
+func (r *auditLogRepository) Count(filter AuditLogFilter) (int64, error) {
+	var count int64
+	err := r.scope(filter).Count(&count).Error
+	return count, err
+}
+
+func (r *auditLogRepository) scope(filter AuditLogFilter) *gorm.DB {
+	query := r.db.Model(&model.AuditLog{})
+	for column, value := range map[string]string{
+		"entity":     filter.Entity,
+		"actor_type": filter.ActorType,
+		"actor_id":   filter.ActorID,
+		"action":     filter.Action,
+		"source":     filter.Source,
+		"request_id": filter.RequestID,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	return query
+}
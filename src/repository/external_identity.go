@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+
+	"gorm.io/gorm"
+)
+
+// ExternalIdentityRepository defines the interface for external identity data operations
+type ExternalIdentityRepository interface {
+	Create(identity *model.ExternalIdentity) error
+	// GetByProviderSubject retrieves the identity of subject at provider
+	GetByProviderSubject(provider, subject string) (*model.ExternalIdentity, error)
+	Update(identity *model.ExternalIdentity) error
+}
+
+// externalIdentityRepository implements ExternalIdentityRepository interface
+type externalIdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewExternalIdentityRepository creates a new external identity repository instance
+func NewExternalIdentityRepository(db *gorm.DB) ExternalIdentityRepository {
+	return &externalIdentityRepository{
+		db: db,
+	}
+}
+
+// Create stores a new external identity
+func (r *externalIdentityRepository) Create(identity *model.ExternalIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// GetByProviderSubject retrieves an external identity by issuer and subject
+func (r *externalIdentityRepository) GetByProviderSubject(provider, subject string) (*model.ExternalIdentity, error) {
+	var identity model.ExternalIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// Update updates an existing external identity
+func (r *externalIdentityRepository) Update(identity *model.ExternalIdentity) error {
+	return r.db.Save(identity).Error
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InboxRepository defines the interface for the consumer inbox
+type InboxRepository interface {
+	// RunOnce records (messageID, consumer) and runs fn in the same transaction.
+	// If the pair was already recorded, fn is not called and processed is false.
+	// If fn returns an error, the transaction (including the inbox record) is rolled back.
+	// tx is bound to ctx, so the message deadline also applies to fn's queries.
+	RunOnce(ctx context.Context, messageID, consumer string, fn func(tx *gorm.DB) error) (processed bool, err error)
+}
+
+// inboxRepository implements InboxRepository interface
+type inboxRepository struct {
+	db *gorm.DB
+}
+
+// NewInboxRepository creates a new inbox repository instance
+func NewInboxRepository(db *gorm.DB) InboxRepository {
+	return &inboxRepository{
+		db: db,
+	}
+}
+
+// RunOnce records the message and runs fn atomically
+func (r *inboxRepository) RunOnce(ctx context.Context, messageID, consumer string, fn func(tx *gorm.DB) error) (bool, error) {
+	processed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.InboxMessage{
+			MessageID:   messageID,
+			Consumer:    consumer,
+			ProcessedAt: time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		// Nothing inserted: already processed by this consumer
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		processed = true
+		return fn(tx)
+	})
+	if err != nil {
+		return false, err
+	}
+	return processed, nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"boilerblade/src/model"
+	"context"
 
 	"gorm.io/gorm"
 )
@@ -9,6 +10,7 @@ import (
 // ProductRepository defines the interface for product data operations
 type ProductRepository interface {
 	Create(product *model.Product) error
+	CreateBatch(ctx context.Context, products []*model.Product, batchSize int) error
 	GetByID(id uint) (*model.Product, error)
 	GetAll(limit, offset int) ([]model.Product, error)
 	Update(product *model.Product) error
@@ -33,6 +35,12 @@ func (r *productRepository) Create(product *model.Product) error {
 	return r.db.Create(product).Error
 }
 
+// CreateBatch inserts products with one INSERT per batchSize rows, in a single
+// transaction rolled back when ctx is done
+func (r *productRepository) CreateBatch(ctx context.Context, products []*model.Product, batchSize int) error {
+	return r.db.WithContext(ctx).CreateInBatches(products, batchSize).Error
+}
+
 // GetByID retrieves a product by ID
 func (r *productRepository) GetByID(id uint) (*model.Product, error) {
 	var product model.Product
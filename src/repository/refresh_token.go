@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshTokenRepository defines the interface for refresh token data operations
+type RefreshTokenRepository interface {
+	Create(token *model.RefreshToken) error
+	GetByHash(tokenHash string) (*model.RefreshToken, error)
+	// MarkUsed marks an unused, unrevoked token as rotated; false means another
+	// request used or revoked it first
+	MarkUsed(id uint, at time.Time) (bool, error)
+	// RevokeFamily revokes every token of a login
+	RevokeFamily(familyID string, at time.Time) error
+}
+
+// refreshTokenRepository implements RefreshTokenRepository interface
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new refresh token repository instance
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{
+		db: db,
+	}
+}
+
+// Create stores a new refresh token
+func (r *refreshTokenRepository) Create(token *model.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByHash retrieves a refresh token by the hash of its value
+func (r *refreshTokenRepository) GetByHash(tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed sets used_at in a single conditional update, so two concurrent
+// refreshes with the same token cannot both succeed
+func (r *refreshTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeFamily sets revoked_at on the tokens of familyID not revoked yet
+func (r *refreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+	return r.db.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RoleRepository defines the interface for role data operations
+type RoleRepository interface {
+	GetByName(name string) (*model.Role, error)
+	// UserRoles returns the names of the roles assigned to a user
+	UserRoles(userID uint) ([]string, error)
+	// RolePermissions returns the permissions granted by the named roles
+	RolePermissions(roles []string) ([]string, error)
+	// AssignRole gives a role to a user; assigning it twice is not an error
+	AssignRole(userID, roleID uint) error
+	RevokeRole(userID, roleID uint) error
+}
+
+// roleRepository implements RoleRepository interface
+type roleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository creates a new role repository instance
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{
+		db: db,
+	}
+}
+
+// GetByName retrieves a role and its permissions by name
+func (r *roleRepository) GetByName(name string) (*model.Role, error) {
+	var role model.Role
+	err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UserRoles returns the names of the roles assigned to userID
+func (r *roleRepository) UserRoles(userID uint) ([]string, error) {
+	var names []string
+	err := r.db.Model(&model.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// RolePermissions returns the distinct permissions of the roles named roles
+func (r *roleRepository) RolePermissions(roles []string) ([]string, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	var permissions []string
+	err := r.db.Model(&model.RolePermission{}).
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name IN ?", roles).
+		Distinct().
+		Order("role_permissions.permission").
+		Pluck("role_permissions.permission", &permissions).Error
+	return permissions, err
+}
+
+// AssignRole inserts the user_roles row, ignoring an existing one
+func (r *roleRepository) AssignRole(userID, roleID uint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.UserRole{UserID: userID, RoleID: roleID}).Error
+}
+
+// RevokeRole deletes the user_roles row
+func (r *roleRepository) RevokeRole(userID, roleID uint) error {
+	return r.db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&model.UserRole{}).Error
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StreamOffsetRepository stores stream consumer offsets; it implements amqp.OffsetStore
+type StreamOffsetRepository interface {
+	// LoadOffset returns the next offset to read; ok is false when nothing was stored yet
+	LoadOffset(ctx context.Context, stream, consumer string) (offset int64, ok bool, err error)
+	// SaveOffset inserts or updates the next offset to read
+	SaveOffset(ctx context.Context, stream, consumer string, offset int64) error
+}
+
+// streamOffsetRepository implements StreamOffsetRepository interface
+type streamOffsetRepository struct {
+	db *gorm.DB
+}
+
+// NewStreamOffsetRepository creates a new stream offset repository instance
+func NewStreamOffsetRepository(db *gorm.DB) StreamOffsetRepository {
+	return &streamOffsetRepository{
+		db: db,
+	}
+}
+
+// LoadOffset retrieves the stored offset of consumer on stream
+func (r *streamOffsetRepository) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	var row model.StreamOffset
+	err := r.db.WithContext(ctx).Where("stream = ? AND consumer = ?", stream, consumer).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return row.Offset, true, nil
+}
+
+// SaveOffset upserts the offset of consumer on stream
+func (r *streamOffsetRepository) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stream"}, {Name: "consumer"}},
+		DoUpdates: clause.AssignmentColumns([]string{"next_offset", "updated_at"}),
+	}).Create(&model.StreamOffset{
+		Stream:    stream,
+		Consumer:  consumer,
+		Offset:    offset,
+		UpdatedAt: time.Now(),
+	}).Error
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"boilerblade/src/model"
+	"context"
 
 	"gorm.io/gorm"
 )
@@ -9,8 +10,10 @@ import (
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	Create(user *model.User) error
+	CreateBatch(ctx context.Context, users []*model.User, batchSize int) error
 	GetByID(id uint) (*model.User, error)
 	GetByEmail(email string) (*model.User, error)
+	GetByEmails(emails []string) ([]model.User, error)
 	GetAll(limit, offset int) ([]model.User, error)
 	Update(user *model.User) error
 	Delete(id uint) error
@@ -34,6 +37,12 @@ func (r *userRepository) Create(user *model.User) error {
 	return r.db.Create(user).Error
 }
 
+// CreateBatch inserts users with one INSERT per batchSize rows, in a single
+// transaction rolled back when ctx is done
+func (r *userRepository) CreateBatch(ctx context.Context, users []*model.User, batchSize int) error {
+	return r.db.WithContext(ctx).CreateInBatches(users, batchSize).Error
+}
+
 // GetByID retrieves a user by ID
 func (r *userRepository) GetByID(id uint) (*model.User, error) {
 	var user model.User
@@ -54,6 +63,13 @@ func (r *userRepository) GetByEmail(email string) (*model.User, error) {
 	return &user, nil
 }
 
+// GetByEmails retrieves the users with any of the given emails
+func (r *userRepository) GetByEmails(emails []string) ([]model.User, error) {
+	var users []model.User
+	err := r.db.Where("email IN ?", emails).Find(&users).Error
+	return users, err
+}
+
 // GetAll retrieves all users with pagination
 func (r *userRepository) GetAll(limit, offset int) ([]model.User, error) {
 	var users []model.User
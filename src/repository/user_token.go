@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"boilerblade/src/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserTokenRepository defines the interface for email verification and
+// password reset token data operations
+type UserTokenRepository interface {
+	Create(token *model.UserToken) error
+	// GetByHash retrieves the token of purpose with the hash of its value
+	GetByHash(purpose, tokenHash string) (*model.UserToken, error)
+	// MarkUsed marks an unused token as used; false means another request
+	// used it first
+	MarkUsed(id uint, at time.Time) (bool, error)
+	// InvalidateUser marks the unused tokens of purpose of a user as used
+	InvalidateUser(userID uint, purpose string, at time.Time) error
+}
+
+// userTokenRepository implements UserTokenRepository interface
+type userTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewUserTokenRepository creates a new user token repository instance
+func NewUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &userTokenRepository{
+		db: db,
+	}
+}
+
+// Create stores a new user token
+func (r *userTokenRepository) Create(token *model.UserToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetByHash retrieves a user token by purpose and the hash of its value
+func (r *userTokenRepository) GetByHash(purpose, tokenHash string) (*model.UserToken, error) {
+	var token model.UserToken
+	err := r.db.Where("purpose = ? AND token_hash = ?", purpose, tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed sets used_at in a single conditional update, so a token cannot be
+// used twice by concurrent requests
+func (r *userTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&model.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateUser sets used_at on the unused tokens of purpose of userID
+func (r *userTokenRepository) InvalidateUser(userID uint, purpose string, at time.Time) error {
+	return r.db.Model(&model.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", at).Error
+}
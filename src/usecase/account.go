@@ -0,0 +1,332 @@
+package usecase
+
+import (
+	"boilerblade/config/mail"
+	"boilerblade/helper"
+	"boilerblade/src/audit"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultVerificationTTL is the lifetime of an email verification token
+	DefaultVerificationTTL = 24 * time.Hour
+	// DefaultPasswordResetTTL is the lifetime of a password reset token
+	DefaultPasswordResetTTL = time.Hour
+)
+
+// ErrInvalidAccountToken is returned for an unknown, expired or already used
+// email verification or password reset token
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// AccountOptions configures AccountUsecase
+type AccountOptions struct {
+	VerificationTTL  time.Duration // default DefaultVerificationTTL
+	PasswordResetTTL time.Duration // default DefaultPasswordResetTTL
+	// VerificationURL and PasswordResetURL are the pages of the frontend the
+	// emails link to, with the token added as the token query parameter. Empty
+	// = the email carries the bare token.
+	VerificationURL  string
+	PasswordResetURL string
+	// Revoker revokes the tokens of a user whose password is reset; nil
+	// disables revocation
+	Revoker TokenRevoker
+	// Lockout is cleared by a password reset; nil disables it
+	Lockout LoginLockout
+}
+
+// AccountUsecase defines the interface for the email verification and
+// password reset flows
+type AccountUsecase interface {
+	// RequestEmailVerification mails a verification link to the user of email
+	RequestEmailVerification(email string) error
+	// VerifyEmail marks the email of the token's user verified
+	VerifyEmail(token string) error
+	// RequestPasswordReset mails a password reset link to the user of email
+	RequestPasswordReset(email string) error
+	// ResetPassword sets the password of the token's user
+	ResetPassword(token, password string) error
+	// WithContext returns the usecase with its mutations attributed to the
+	// audit metadata of ctx (see audit.WithMetadata)
+	WithContext(ctx context.Context) AccountUsecase
+}
+
+// accountUsecase implements AccountUsecase interface
+type accountUsecase struct {
+	userRepo  repository.UserRepository
+	tokenRepo repository.UserTokenRepository
+	mailer    mail.Mailer
+	publisher event.Publisher
+	auditor   Auditor
+	opts      AccountOptions
+	ctx       context.Context
+}
+
+// NewAccountUsecase creates a new account usecase instance. Emails are sent
+// through mailer, the queue mailer in production. Domain events are sent
+// through publisher and mutations recorded through auditor; nil disables them.
+func NewAccountUsecase(userRepo repository.UserRepository, tokenRepo repository.UserTokenRepository, mailer mail.Mailer, publisher event.Publisher, auditor Auditor, opts AccountOptions) AccountUsecase {
+	if publisher == nil {
+		publisher = event.NewNoopPublisher()
+	}
+	if opts.VerificationTTL <= 0 {
+		opts.VerificationTTL = DefaultVerificationTTL
+	}
+	if opts.PasswordResetTTL <= 0 {
+		opts.PasswordResetTTL = DefaultPasswordResetTTL
+	}
+	return &accountUsecase{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mailer:    mailer,
+		publisher: publisher,
+		auditor:   auditor,
+		opts:      opts,
+		ctx:       context.Background(),
+	}
+}
+
+// WithContext returns a copy of the usecase bound to ctx
+func (uc *accountUsecase) WithContext(ctx context.Context) AccountUsecase {
+	bound := *uc
+	bound.ctx = ctx
+	return &bound
+}
+
+// RequestEmailVerification mails a verification link, superseding the earlier
+// ones. Unknown and already verified emails are ignored without an error, so
+// the response does not tell which emails are registered.
+func (uc *accountUsecase) RequestEmailVerification(email string) error {
+	user, err := uc.findUser(email)
+	if err != nil || user == nil || user.EmailVerifiedAt != nil {
+		return err
+	}
+
+	token, err := uc.issue(user, model.UserTokenEmailVerification, uc.opts.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	return uc.mailer.Send(uc.ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm your email address with this link:\n\n%s\n\nIt expires in %s. If you did not sign up, ignore this email.\n",
+			user.Name, tokenLink(uc.opts.VerificationURL, token), formatTTL(uc.opts.VerificationTTL)),
+	})
+}
+
+// VerifyEmail verifies the email of the token's user
+func (uc *accountUsecase) VerifyEmail(token string) error {
+	user, err := uc.redeem(model.UserTokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := uc.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	changes := event.Diff(nil, "email_verified", false, true, false)
+	uc.publish(event.NewUserUpdated(user.ID, changes))
+	uc.audit(user.ID, changes)
+	helper.LogInfo("Email verified", map[string]interface{}{
+		"source":  "accountUsecase.VerifyEmail",
+		"user_id": user.ID,
+	})
+	return nil
+}
+
+// RequestPasswordReset mails a password reset link, superseding the earlier
+// ones. Unknown emails are ignored without an error, so the response does not
+// tell which emails are registered.
+func (uc *accountUsecase) RequestPasswordReset(email string) error {
+	user, err := uc.findUser(email)
+	if err != nil || user == nil {
+		return err
+	}
+
+	token, err := uc.issue(user, model.UserTokenPasswordReset, uc.opts.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return uc.mailer.Send(uc.ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nChoose a new password with this link:\n\n%s\n\nIt expires in %s. If you did not ask for it, ignore this email: your password stays the same.\n",
+			user.Name, tokenLink(uc.opts.PasswordResetURL, token), formatTTL(uc.opts.PasswordResetTTL)),
+	})
+}
+
+// ResetPassword sets the password of the token's user. Its tokens are revoked
+// first, as on any password change, and its other reset links invalidated.
+// The reset proves the user reads its email, so the email is verified too,
+// and the login lockout of the account is cleared.
+func (uc *accountUsecase) ResetPassword(token, password string) error {
+	user, err := uc.redeem(model.UserTokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := helper.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if uc.opts.Revoker != nil {
+		if err := revokeUserTokens(uc.opts.Revoker, user.ID); err != nil {
+			return err
+		}
+	}
+
+	before := *user
+	now := time.Now()
+	user.Password = passwordHash
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	if err := uc.userRepo.Update(user); err != nil {
+		return err
+	}
+	if err := uc.tokenRepo.InvalidateUser(user.ID, model.UserTokenPasswordReset, now); err != nil {
+		return err
+	}
+	resetLockout(uc.opts.Lockout, user.Email)
+
+	var changes []event.FieldChange
+	changes = event.Diff(changes, "password", before.Password, user.Password, true)
+	changes = event.Diff(changes, "email_verified", before.EmailVerifiedAt != nil, user.EmailVerifiedAt != nil, false)
+	uc.publish(event.NewUserUpdated(user.ID, changes))
+	uc.audit(user.ID, changes)
+	helper.LogInfo("Password reset", map[string]interface{}{
+		"source":  "accountUsecase.ResetPassword",
+		"user_id": user.ID,
+	})
+	return nil
+}
+
+// findUser returns the user of email, nil when there is none
+func (uc *accountUsecase) findUser(email string) (*model.User, error) {
+	user, err := uc.userRepo.GetByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// issue stores a new token of purpose for user, valid for ttl, and
+// invalidates the earlier ones so only the latest email works
+func (uc *accountUsecase) issue(user *model.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := uc.tokenRepo.InvalidateUser(user.ID, purpose, now); err != nil {
+		return "", err
+	}
+	if err := uc.tokenRepo.Create(&model.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeem uses the token of purpose and returns its user. The token is marked
+// used before anything else, so concurrent requests cannot both use it. A
+// token mailed to an address the user changed since is refused.
+func (uc *accountUsecase) redeem(purpose, token string) (*model.User, error) {
+	userToken, err := uc.tokenRepo.GetByHash(purpose, hashRefreshToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if userToken.UsedAt != nil || !now.Before(userToken.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+	used, err := uc.tokenRepo.MarkUsed(userToken.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidAccountToken
+	}
+
+	user, err := uc.userRepo.GetByID(userToken.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return nil, ErrInvalidAccountToken
+	}
+	return user, nil
+}
+
+// audit records an update of the user id in the audit log. The change is the
+// user's own, proven by its token: it is the actor, whatever the request was
+// authenticated with (nothing, usually).
+func (uc *accountUsecase) audit(id uint, changes []event.FieldChange) {
+	meta := audit.FromContext(uc.ctx)
+	meta.ActorType, meta.ActorID = audit.ActorUser, strconv.FormatUint(uint64(id), 10)
+	recordAudit(uc.auditor, audit.WithMetadata(uc.ctx, meta), "user", event.ActionUpdated, id, changes)
+}
+
+// publish emits a user domain event, see publishEvent
+func (uc *accountUsecase) publish(evt event.Event) {
+	publishEvent(uc.publisher, evt, "accountUsecase.publish")
+}
+
+// tokenLink returns base with token added as the token query parameter, or the
+// bare token when base is empty
+func tokenLink(base, token string) string {
+	if base == "" {
+		return token
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return token
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// formatTTL renders ttl for an email ("24 hours", "1 hour", "30 minutes")
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		return plural(int(ttl/time.Hour), "hour")
+	}
+	return plural(int((ttl+time.Minute-1)/time.Minute), "minute")
+}
+
+// plural renders n unit, pluralized
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
+}
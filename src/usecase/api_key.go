@@ -0,0 +1,314 @@
+package usecase
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/helper"
+	"boilerblade/src/dto"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyMarker starts every API key, so a leaked key is easy to recognize
+	APIKeyMarker = "bbk_"
+	// DefaultAPIKeyGracePeriod is how long a rotated key keeps working
+	DefaultAPIKeyGracePeriod = 24 * time.Hour
+	// apiKeyLastUsedInterval limits last_used_at writes to one per key and interval
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for an unknown API key ID
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAPIKeyInactive is returned when rotating a revoked or already rotated key
+	ErrAPIKeyInactive = errors.New("API key is revoked or already rotated")
+)
+
+// APIKeyUsecase defines the interface for service API key business logic
+type APIKeyUsecase interface {
+	// Create issues a key; the plaintext key is only in the response
+	Create(req *dto.CreateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error)
+	List(limit, offset int, includeRevoked bool) (*dto.APIKeyListResponse, error)
+	// Rotate issues a key with the same name and scopes; the old one expires
+	// after the grace period
+	Rotate(id uint, req *dto.RotateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error)
+	Revoke(id uint) error
+	// AuthenticateAPIKey returns the service of a valid key, or auth.ErrInvalidAPIKey
+	AuthenticateAPIKey(key string) (*auth.Service, error)
+}
+
+// apiKeyUsecase implements APIKeyUsecase interface
+type apiKeyUsecase struct {
+	apiKeyRepo repository.APIKeyRepository
+}
+
+// NewAPIKeyUsecase creates a new API key usecase instance
+func NewAPIKeyUsecase(apiKeyRepo repository.APIKeyRepository) APIKeyUsecase {
+	return &apiKeyUsecase{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// Create issues a new API key
+func (uc *apiKeyUsecase) Create(req *dto.CreateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		at := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &at
+	}
+	return uc.issue(req.Name, strings.Join(req.Scopes, " "), expiresAt)
+}
+
+// List retrieves API keys with pagination
+func (uc *apiKeyUsecase) List(limit, offset int, includeRevoked bool) (*dto.APIKeyListResponse, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	keys, err := uc.apiKeyRepo.GetAll(limit, offset, includeRevoked)
+	if err != nil {
+		return nil, err
+	}
+	total, err := uc.apiKeyRepo.Count(includeRevoked)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]dto.APIKeyResponse, len(keys))
+	for i := range keys {
+		responses[i] = *toAPIKeyResponse(&keys[i])
+	}
+	return &dto.APIKeyListResponse{
+		APIKeys: responses,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// Rotate replaces an active key. Without ExpiresInDays the new key gets the
+// lifetime of the old one.
+func (uc *apiKeyUsecase) Rotate(id uint, req *dto.RotateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	old, err := uc.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.RevokedAt != nil || old.ReplacedByID != nil {
+		return nil, ErrAPIKeyInactive
+	}
+
+	now := time.Now()
+	var expiresAt *time.Time
+	switch {
+	case req.ExpiresInDays > 0:
+		at := now.AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &at
+	case old.ExpiresAt != nil:
+		at := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		expiresAt = &at
+	}
+
+	created, err := uc.issue(old.Name, old.Scopes, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	grace := DefaultAPIKeyGracePeriod
+	if req.GracePeriod != nil {
+		grace = time.Duration(*req.GracePeriod) * time.Second
+	}
+	if end := now.Add(grace); old.ExpiresAt == nil || end.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &end
+	}
+	old.ReplacedByID = &created.APIKey.ID
+	if err := uc.apiKeyRepo.Update(old); err != nil {
+		return nil, err
+	}
+
+	helper.LogInfo("API key rotated", map[string]interface{}{
+		"api_key_id":     old.ID,
+		"replaced_by_id": created.APIKey.ID,
+		"name":           old.Name,
+		"old_expires_at": old.ExpiresAt,
+	})
+	return created, nil
+}
+
+// Revoke disables a key immediately; revoking a revoked key does nothing
+func (uc *apiKeyUsecase) Revoke(id uint) error {
+	key, err := uc.get(id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	if err := uc.apiKeyRepo.Update(key); err != nil {
+		return err
+	}
+
+	helper.LogInfo("API key revoked", map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+	})
+	return nil
+}
+
+// AuthenticateAPIKey looks the key up by its prefix and compares its hash
+func (uc *apiKeyUsecase) AuthenticateAPIKey(plaintext string) (*auth.Service, error) {
+	prefix, ok := apiKeyPrefix(plaintext)
+	if !ok {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	key, err := uc.apiKeyRepo.GetByPrefix(prefix)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(plaintext)), []byte(key.KeyHash)) != 1 {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		helper.LogInfo("Inactive API key used", map[string]interface{}{
+			"api_key_id": key.ID,
+			"name":       key.Name,
+			"revoked":    key.RevokedAt != nil,
+		})
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	// A failed write must not fail the request: last use is informational
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval {
+		if err := uc.apiKeyRepo.TouchLastUsed(key.ID, now); err != nil {
+			helper.LogError("Failed to record API key use", err, "", map[string]interface{}{
+				"source":     "apiKeyUsecase.AuthenticateAPIKey",
+				"api_key_id": key.ID,
+			})
+		}
+	}
+
+	return &auth.Service{
+		Name:   key.Name,
+		KeyID:  key.ID,
+		Scopes: strings.Fields(key.Scopes),
+	}, nil
+}
+
+// issue generates and stores a key
+func (uc *apiKeyUsecase) issue(name, scopes string, expiresAt *time.Time) (*dto.APIKeyCreatedResponse, error) {
+	prefix, plaintext, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key := &model.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashAPIKey(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := uc.apiKeyRepo.Create(key); err != nil {
+		return nil, err
+	}
+
+	helper.LogInfo("API key created", map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+	})
+	return &dto.APIKeyCreatedResponse{
+		Key:    plaintext,
+		APIKey: *toAPIKeyResponse(key),
+	}, nil
+}
+
+func (uc *apiKeyUsecase) get(id uint) (*model.APIKey, error) {
+	key, err := uc.apiKeyRepo.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// newAPIKey returns a random key "bbk_<prefix>_<secret>" and its prefix: 6
+// random bytes in hex to look it up, 32 more as the secret
+func newAPIKey() (string, string, error) {
+	b := make([]byte, 38)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix := hex.EncodeToString(b[:6])
+	return prefix, APIKeyMarker + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[6:]), nil
+}
+
+// apiKeyPrefix extracts the lookup prefix of a key
+func apiKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyMarker)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// hashAPIKey returns the hex SHA-256 of a key; keys are random, so a fast hash
+// is enough (unlike passwords)
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKeyResponse(key *model.APIKey) *dto.APIKeyResponse {
+	scopes := strings.Fields(key.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &dto.APIKeyResponse{
+		ID:           key.ID,
+		Name:         key.Name,
+		Prefix:       key.Prefix,
+		Scopes:       scopes,
+		ExpiresAt:    formatTime(key.ExpiresAt),
+		LastUsedAt:   formatTime(key.LastUsedAt),
+		RevokedAt:    formatTime(key.RevokedAt),
+		ReplacedByID: key.ReplacedByID,
+		CreatedAt:    key.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// formatTime formats an optional timestamp like the other responses
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format("2006-01-02 15:04:05")
+	return &s
+}
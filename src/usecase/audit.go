@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"boilerblade/helper"
+	"boilerblade/src/audit"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Auditor records the mutations of entities in the audit log
+type Auditor interface {
+	// Record records action on the entity id, made under ctx (see
+	// audit.WithMetadata); changes hold the changed fields, secrets redacted
+	Record(ctx context.Context, entity, action string, id uint, changes []event.FieldChange)
+}
+
+// auditor implements Auditor interface
+type auditor struct {
+	auditLogRepo repository.AuditLogRepository
+}
+
+// NewAuditor creates an auditor writing to auditLogRepo. A failed write is
+// logged, not returned, like a failed publish (see publishEvent).
+func NewAuditor(auditLogRepo repository.AuditLogRepository) Auditor {
+	return &auditor{
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+// Record stores an audit log
+func (a *auditor) Record(ctx context.Context, entity, action string, id uint, changes []event.FieldChange) {
+	meta := audit.FromContext(ctx)
+	log := &model.AuditLog{
+		ActorType: meta.ActorType,
+		ActorID:   meta.ActorID,
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+		RequestID: meta.RequestID,
+		Source:    meta.Source,
+	}
+	if len(changes) > 0 {
+		encoded, err := json.Marshal(changes)
+		if err != nil {
+			helper.LogError("Failed to encode audit log changes", err, "", map[string]interface{}{
+				"source": "auditor.Record",
+				"entity": entity,
+				"id":     id,
+			})
+		}
+		log.Changes = string(encoded)
+	}
+	if err := a.auditLogRepo.Create(log); err != nil {
+		helper.LogError("Failed to write audit log", err, "", map[string]interface{}{
+			"source":     "auditor.Record",
+			"entity":     entity,
+			"id":         id,
+			"action":     action,
+			"actor_type": meta.ActorType,
+			"actor_id":   meta.ActorID,
+		})
+	}
+}
+
+// recordAudit records through auditor; a nil auditor disables auditing
+func recordAudit(auditor Auditor, ctx context.Context, entity, action string, id uint, changes []event.FieldChange) {
+	if auditor != nil {
+		auditor.Record(ctx, entity, action, id, changes)
+	}
+}
+
+// AuditUsecase defines the interface for querying the audit log
+type AuditUsecase interface {
+	GetAuditLogs(query *dto.AuditLogQuery) (*dto.AuditLogListResponse, error)
+}
+
+// auditUsecase implements AuditUsecase interface
+type auditUsecase struct {
+	auditLogRepo repository.AuditLogRepository
+}
+
+// NewAuditUsecase creates a new audit usecase instance
+func NewAuditUsecase(auditLogRepo repository.AuditLogRepository) AuditUsecase {
+	return &auditUsecase{
+		auditLogRepo: auditLogRepo,
+	}
+}
+
+// GetAuditLogs retrieves the audit logs matching query, newest first. Since and
+// Until must be RFC 3339 (the handler validates them).
+func (uc *auditUsecase) GetAuditLogs(query *dto.AuditLogQuery) (*dto.AuditLogListResponse, error) {
+	limit, offset := query.Limit, query.Offset
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := repository.AuditLogFilter{
+		Entity:    query.Entity,
+		EntityID:  query.EntityID,
+		ActorType: query.ActorType,
+		ActorID:   query.ActorID,
+		Action:    query.Action,
+		Source:    query.Source,
+		RequestID: query.RequestID,
+	}
+	var err error
+	if query.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, query.Since); err != nil {
+			return nil, err
+		}
+	}
+	if query.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, query.Until); err != nil {
+			return nil, err
+		}
+	}
+
+	logs, err := uc.auditLogRepo.Find(filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	total, err := uc.auditLogRepo.Count(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]dto.AuditLogResponse, len(logs))
+	for i, log := range logs {
+		responses[i] = dto.AuditLogResponse{
+			ID:        log.ID,
+			ActorType: log.ActorType,
+			ActorID:   log.ActorID,
+			Entity:    log.Entity,
+			EntityID:  log.EntityID,
+			Action:    log.Action,
+			Changes:   []dto.AuditLogChange{},
+			RequestID: log.RequestID,
+			Source:    log.Source,
+			CreatedAt: log.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if log.Changes != "" {
+			if err := json.Unmarshal([]byte(log.Changes), &responses[i].Changes); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &dto.AuditLogListResponse{
+		AuditLogs: responses,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}, nil
+}
@@ -0,0 +1,415 @@
+package usecase
+
+import (
+	"boilerblade/helper"
+	"boilerblade/src/dto"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultAccessTokenTTL is the lifetime of an access token
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL is the lifetime of a refresh token
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidCredentials is returned by Login for an unknown email or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrInvalidRefreshToken is returned for an unknown, expired or revoked refresh token
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is presented
+	// again; every token of its login is revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused, please log in again")
+	// ErrRevocationUnavailable is returned when tokens cannot be revoked
+	// because no TokenRevoker is configured (Redis disabled)
+	ErrRevocationUnavailable = errors.New("token revocation is not available")
+	// ErrAccountLocked is matched by the *AccountLockedError Login returns
+	// after too many failed attempts
+	ErrAccountLocked = errors.New("too many failed login attempts")
+	// ErrEmailNotVerified is returned by Login when AuthOptions.RequireVerifiedEmail
+	// is set and the user has not verified its email
+	ErrEmailNotVerified = errors.New("email not verified")
+)
+
+// AccountLockedError is returned by Login while the account is locked
+type AccountLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrAccountLocked, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrAccountLocked) match
+func (e *AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// TokenRevoker revokes access tokens before they expire: one token by its jti,
+// or every token of a user issued before a watermark. *auth.Revocations
+// implements it.
+type TokenRevoker interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID string, before time.Time) error
+	UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error)
+}
+
+// LoginLockout locks an account, by email, after too many failed logins.
+// *auth.RedisLockout implements it.
+type LoginLockout interface {
+	// Locked returns how long the account stays locked, 0 when it is not
+	Locked(ctx context.Context, email string) (time.Duration, error)
+	// Fail records a failed login and returns the lock duration when it locked
+	// the account, 0 otherwise
+	Fail(ctx context.Context, email string) (time.Duration, error)
+	// Reset clears the failures and the lock of the account
+	Reset(ctx context.Context, email string) error
+}
+
+// AuthOptions configures AuthUsecase
+type AuthOptions struct {
+	// SigningKey signs access tokens with HS256 (APP_KEY or an AUTH_HMAC_KEYS key)
+	SigningKey []byte
+	// SigningKeyID is set as the kid header of access tokens (empty = no kid)
+	SigningKeyID string
+	// Issuer and Audience are set as the iss and aud claims (empty = left out)
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration // default DefaultAccessTokenTTL
+	RefreshTokenTTL time.Duration // default DefaultRefreshTokenTTL
+	// Revoker revokes access tokens; refresh tokens issued before the
+	// watermark of their user are refused too. nil disables revocation.
+	Revoker TokenRevoker
+	// Lockout locks accounts after too many failed logins; nil disables it
+	Lockout LoginLockout
+	// RequireVerifiedEmail refuses logins until the user verified its email
+	RequireVerifiedEmail bool
+}
+
+// AuthUsecase defines the interface for authentication business logic
+type AuthUsecase interface {
+	Login(req *dto.LoginRequest) (*dto.TokenResponse, error)
+	Refresh(refreshToken string) (*dto.TokenResponse, error)
+	Logout(refreshToken string) error
+	// RevokeAccessToken revokes the access token jti until it expires
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	// RevokeUserTokens revokes every access and refresh token userID holds
+	RevokeUserTokens(userID uint) error
+}
+
+// authUsecase implements AuthUsecase interface
+type authUsecase struct {
+	userRepo  repository.UserRepository
+	tokenRepo repository.RefreshTokenRepository
+	opts      AuthOptions
+}
+
+// NewAuthUsecase creates a new auth usecase instance
+func NewAuthUsecase(userRepo repository.UserRepository, tokenRepo repository.RefreshTokenRepository, opts AuthOptions) AuthUsecase {
+	return newAuthUsecase(userRepo, tokenRepo, opts)
+}
+
+// newAuthUsecase creates the auth usecase; the OIDC usecase issues its tokens with it
+func newAuthUsecase(userRepo repository.UserRepository, tokenRepo repository.RefreshTokenRepository, opts AuthOptions) *authUsecase {
+	if opts.AccessTokenTTL <= 0 {
+		opts.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if opts.RefreshTokenTTL <= 0 {
+		opts.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	return &authUsecase{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		opts:      opts,
+	}
+}
+
+var (
+	dummyPasswordOnce sync.Once
+	dummyPasswordHash string
+)
+
+// verifyDummyPassword spends the time of a password check when the email is
+// unknown, so the response time does not tell which emails are registered
+func verifyDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = helper.HashPassword("dummy password")
+	})
+	helper.VerifyPassword(dummyPasswordHash, password)
+}
+
+// Login checks the credentials and starts a new refresh token family. A
+// password hashed with outdated parameters (or stored in plaintext) is hashed
+// again with the current ones. A locked account is refused without checking
+// the password, so it cannot be guessed meanwhile.
+func (uc *authUsecase) Login(req *dto.LoginRequest) (*dto.TokenResponse, error) {
+	if retryAfter := uc.lockedFor(req.Email); retryAfter > 0 {
+		return nil, &AccountLockedError{RetryAfter: retryAfter}
+	}
+
+	user, err := uc.userRepo.GetByEmail(req.Email)
+	if err != nil || user == nil {
+		verifyDummyPassword(req.Password)
+		return nil, uc.loginFailed(req.Email)
+	}
+
+	ok, rehash := helper.VerifyPassword(user.Password, req.Password)
+	if !ok {
+		return nil, uc.loginFailed(req.Email)
+	}
+	resetLockout(uc.opts.Lockout, req.Email)
+	if uc.opts.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if rehash {
+		uc.rehashPassword(user, req.Password)
+	}
+
+	return uc.issue(user, uuid.NewString())
+}
+
+// lockedFor returns how long the account of email stays locked. The lockout
+// fails open: when Redis is unreachable logins go on, only unthrottled.
+func (uc *authUsecase) lockedFor(email string) time.Duration {
+	if uc.opts.Lockout == nil {
+		return 0
+	}
+	retryAfter, err := uc.opts.Lockout.Locked(context.Background(), email)
+	if err != nil {
+		logLockoutError("authUsecase.lockedFor", err)
+		return 0
+	}
+	return retryAfter
+}
+
+// loginFailed counts a failed login of email and returns the error to answer
+// it with: ErrInvalidCredentials, or an *AccountLockedError when it locked the
+// account
+func (uc *authUsecase) loginFailed(email string) error {
+	if uc.opts.Lockout == nil {
+		return ErrInvalidCredentials
+	}
+	retryAfter, err := uc.opts.Lockout.Fail(context.Background(), email)
+	if err != nil {
+		logLockoutError("authUsecase.loginFailed", err)
+		return ErrInvalidCredentials
+	}
+	if retryAfter > 0 {
+		helper.LogInfo("Account locked after failed logins", map[string]interface{}{
+			"source":      "authUsecase.loginFailed",
+			"email":       email,
+			"retry_after": retryAfter.String(),
+		})
+		return &AccountLockedError{RetryAfter: retryAfter}
+	}
+	return ErrInvalidCredentials
+}
+
+// resetLockout clears the failed logins and the lock of email; nil lockout is
+// a no-op
+func resetLockout(lockout LoginLockout, email string) {
+	if lockout == nil {
+		return
+	}
+	if err := lockout.Reset(context.Background(), email); err != nil {
+		logLockoutError("resetLockout", err)
+	}
+}
+
+// logLockoutError logs a lockout store failure
+func logLockoutError(source string, err error) {
+	helper.LogError("Login lockout unavailable", err, "", map[string]interface{}{
+		"source": source,
+	})
+}
+
+// rehashPassword stores password hashed with the current parameters; a failure
+// is logged, the login goes on and the next one tries again
+func (uc *authUsecase) rehashPassword(user *model.User, password string) {
+	passwordHash, err := helper.HashPassword(password)
+	if err == nil {
+		user.Password = passwordHash
+		err = uc.userRepo.Update(user)
+	}
+	if err != nil {
+		helper.LogError("Failed to rehash password", err, "", map[string]interface{}{
+			"source":  "authUsecase.rehashPassword",
+			"user_id": user.ID,
+		})
+		return
+	}
+	helper.LogInfo("Password rehashed with current parameters", map[string]interface{}{
+		"source":  "authUsecase.rehashPassword",
+		"user_id": user.ID,
+	})
+}
+
+// Refresh exchanges a refresh token for new tokens. Each refresh token is
+// single-use: presenting one that was already rotated means it leaked, so the
+// whole family is revoked and the user has to log in again.
+func (uc *authUsecase) Refresh(refreshToken string) (*dto.TokenResponse, error) {
+	token, err := uc.tokenRepo.GetByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	if token.RevokedAt != nil || !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if uc.opts.Revoker != nil {
+		before, err := uc.opts.Revoker.UserTokensRevokedBefore(context.Background(), strconv.FormatUint(uint64(token.UserID), 10))
+		if err != nil {
+			return nil, err
+		}
+		if token.CreatedAt.Before(before) {
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+
+	rotated := false
+	if token.UsedAt == nil {
+		if rotated, err = uc.tokenRepo.MarkUsed(token.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	if !rotated {
+		if err := uc.tokenRepo.RevokeFamily(token.FamilyID, now); err != nil {
+			return nil, err
+		}
+		helper.LogError("Refresh token reuse detected, login revoked", ErrRefreshTokenReused, "", map[string]interface{}{
+			"source":    "authUsecase.Refresh",
+			"user_id":   token.UserID,
+			"family_id": token.FamilyID,
+		})
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := uc.userRepo.GetByID(token.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	return uc.issue(user, token.FamilyID)
+}
+
+// Logout revokes the login the refresh token belongs to. Unknown tokens are
+// ignored, so logging out twice succeeds.
+func (uc *authUsecase) Logout(refreshToken string) error {
+	token, err := uc.tokenRepo.GetByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+	return uc.tokenRepo.RevokeFamily(token.FamilyID, time.Now())
+}
+
+// RevokeAccessToken revokes one access token, e.g. the caller's own
+func (uc *authUsecase) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if uc.opts.Revoker == nil {
+		return ErrRevocationUnavailable
+	}
+	return uc.opts.Revoker.RevokeToken(context.Background(), jti, expiresAt)
+}
+
+// RevokeUserTokens revokes the tokens of a user issued until now; its refresh
+// tokens are refused by Refresh, so the user has to log in again
+func (uc *authUsecase) RevokeUserTokens(userID uint) error {
+	if uc.opts.Revoker == nil {
+		return ErrRevocationUnavailable
+	}
+	if err := revokeUserTokens(uc.opts.Revoker, userID); err != nil {
+		return err
+	}
+	helper.LogInfo("User tokens revoked", map[string]interface{}{
+		"source":  "authUsecase.RevokeUserTokens",
+		"user_id": userID,
+	})
+	return nil
+}
+
+// revokeUserTokens sets the watermark of userID to now
+func revokeUserTokens(revoker TokenRevoker, userID uint) error {
+	return revoker.RevokeUserTokens(context.Background(), strconv.FormatUint(uint64(userID), 10), time.Now())
+}
+
+// issue signs an access token for user and stores a new refresh token in familyID
+func (uc *authUsecase) issue(user *model.User, familyID string) (*dto.TokenResponse, error) {
+	if len(uc.opts.SigningKey) == 0 {
+		return nil, errors.New("signing key not configured")
+	}
+
+	now := time.Now()
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+	claims := jwt.MapClaims{
+		"sub":     userID,
+		"user_id": userID,
+		"email":   user.Email,
+		"iat":     now.Unix(),
+		"exp":     now.Add(uc.opts.AccessTokenTTL).Unix(),
+		"jti":     uuid.NewString(),
+	}
+	if uc.opts.Issuer != "" {
+		claims["iss"] = uc.opts.Issuer
+	}
+	if uc.opts.Audience != "" {
+		claims["aud"] = uc.opts.Audience
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if uc.opts.SigningKeyID != "" {
+		token.Header["kid"] = uc.opts.SigningKeyID
+	}
+	accessToken, err := token.SignedString(uc.opts.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.tokenRepo.Create(&model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: now.Add(uc.opts.RefreshTokenTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(uc.opts.AccessTokenTTL / time.Second),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(uc.opts.RefreshTokenTTL / time.Second),
+	}, nil
+}
+
+// newRefreshToken returns 32 random bytes, base64url encoded
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the hex SHA-256 of token, as stored in refresh_tokens
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
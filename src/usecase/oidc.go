@@ -0,0 +1,283 @@
+package usecase
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/helper"
+	"boilerblade/src/audit"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OIDCLoginTTL is how long a user has to log in at the identity provider
+const OIDCLoginTTL = 10 * time.Minute
+
+var (
+	// ErrOIDCInvalidState is returned by Callback for a missing, tampered or
+	// expired login state, or a state parameter that does not match it
+	ErrOIDCInvalidState = errors.New("invalid or expired login state")
+	// ErrOIDCLoginFailed is returned when the identity provider refuses the code
+	// or its ID token is invalid
+	ErrOIDCLoginFailed = errors.New("login with the identity provider failed")
+	// ErrOIDCEmailNotVerified is returned when a new identity has no email
+	// verified by the provider, so it cannot be linked to a user
+	ErrOIDCEmailNotVerified = errors.New("the identity provider did not verify the email")
+	// ErrOIDCUserNotFound is returned when the user of a known identity was deleted
+	ErrOIDCUserNotFound = errors.New("user of the identity not found")
+)
+
+// OIDCProvider is the relying party of an identity provider; *auth.OIDCProvider
+// implements it
+type OIDCProvider interface {
+	Issuer() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*auth.OIDCIdentity, error)
+}
+
+// OIDCUsecase defines the interface for the OIDC login flow
+type OIDCUsecase interface {
+	// Begin starts a login: it returns the provider URL to redirect the user to
+	// and the sealed login state to keep (in a cookie) until Callback
+	Begin() (authURL string, loginState string, err error)
+	// Callback finishes the login with the state and code the provider
+	// redirected back with, provisioning the user on its first login, and
+	// issues our own tokens
+	Callback(loginState, state, code string) (*dto.TokenResponse, error)
+}
+
+// oidcUsecase implements OIDCUsecase interface
+type oidcUsecase struct {
+	provider     OIDCProvider
+	userRepo     repository.UserRepository
+	identityRepo repository.ExternalIdentityRepository
+	publisher    event.Publisher
+	auditor      Auditor
+	auth         *authUsecase
+	stateKey     []byte
+}
+
+// oidcLoginState is what the callback needs from Begin: the state and nonce
+// sent to the provider and the PKCE code verifier
+type oidcLoginState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// NewOIDCUsecase creates a new OIDC usecase instance. Tokens are issued as by
+// Login, with opts; the login state is sealed with a key derived from
+// opts.SigningKey. User creations are published through publisher and
+// recorded through auditor, as made by the system on behalf of the provider;
+// nil disables either.
+func NewOIDCUsecase(provider OIDCProvider, userRepo repository.UserRepository, identityRepo repository.ExternalIdentityRepository, tokenRepo repository.RefreshTokenRepository, publisher event.Publisher, auditor Auditor, opts AuthOptions) OIDCUsecase {
+	if publisher == nil {
+		publisher = event.NewNoopPublisher()
+	}
+	// A separate key, so a login state can never pass for an access token
+	mac := hmac.New(sha256.New, opts.SigningKey)
+	mac.Write([]byte("oidc-login-state"))
+	return &oidcUsecase{
+		provider:     provider,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		publisher:    publisher,
+		auditor:      auditor,
+		auth:         newAuthUsecase(userRepo, tokenRepo, opts),
+		stateKey:     mac.Sum(nil),
+	}
+}
+
+// Begin creates the state, nonce and PKCE verifier of a login
+func (uc *oidcUsecase) Begin() (string, string, error) {
+	login := oidcLoginState{ExpiresAt: time.Now().Add(OIDCLoginTTL).Unix()}
+	var err error
+	if login.State, err = auth.NewOIDCNonce(); err != nil {
+		return "", "", err
+	}
+	if login.Nonce, err = auth.NewOIDCNonce(); err != nil {
+		return "", "", err
+	}
+	if login.CodeVerifier, err = auth.NewPKCEVerifier(); err != nil {
+		return "", "", err
+	}
+
+	authURL, err := uc.provider.AuthCodeURL(context.Background(), login.State, login.Nonce, auth.PKCEChallenge(login.CodeVerifier))
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := uc.seal(login)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, sealed, nil
+}
+
+// Callback checks the state, exchanges the code and logs the user in
+func (uc *oidcUsecase) Callback(loginState, state, code string) (*dto.TokenResponse, error) {
+	login, ok := uc.open(loginState)
+	if !ok || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		return nil, ErrOIDCInvalidState
+	}
+
+	identity, err := uc.provider.Exchange(context.Background(), code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCExchange) || errors.Is(err, auth.ErrOIDCInvalidIDToken) {
+			helper.LogError("OIDC login failed", err, "", map[string]interface{}{
+				"source": "oidcUsecase.Callback",
+				"issuer": uc.provider.Issuer(),
+			})
+			return nil, ErrOIDCLoginFailed
+		}
+		return nil, err
+	}
+
+	user, err := uc.provision(identity)
+	if err != nil {
+		return nil, err
+	}
+	return uc.auth.issue(user, uuid.NewString())
+}
+
+// provision returns the user linked to identity. A new identity is linked to
+// the user with its email, created when there is none; the email must be
+// verified by the provider, or anyone could claim an account by its email.
+func (uc *oidcUsecase) provision(identity *auth.OIDCIdentity) (*model.User, error) {
+	now := time.Now()
+	linked, err := uc.identityRepo.GetByProviderSubject(identity.Issuer, identity.Subject)
+	if err == nil {
+		user, err := uc.userRepo.GetByID(linked.UserID)
+		if err != nil {
+			return nil, ErrOIDCUserNotFound
+		}
+		linked.LastLoginAt = &now
+		if identity.Email != "" {
+			linked.Email = identity.Email
+		}
+		if err := uc.identityRepo.Update(linked); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	user, err := uc.userRepo.GetByEmail(identity.Email)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if user, err = uc.createUser(identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := uc.identityRepo.Create(&model.ExternalIdentity{
+		UserID:      user.ID,
+		Provider:    identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+	helper.LogInfo("External identity linked", map[string]interface{}{
+		"source":  "oidcUsecase.provision",
+		"issuer":  identity.Issuer,
+		"user_id": user.ID,
+	})
+	return user, nil
+}
+
+// createUser creates the user of a new identity, with its email verified. Its
+// password is random: it logs in through the provider.
+func (uc *oidcUsecase) createUser(identity *auth.OIDCIdentity) (*model.User, error) {
+	password, err := auth.NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := helper.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	// The provider verified the email (see provision)
+	verifiedAt := time.Now()
+	user := &model.User{
+		Name:            name,
+		Email:           identity.Email,
+		Password:        passwordHash,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	if err := uc.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	if err := uc.publisher.Publish(event.NewUserCreated(user.ID, user.Name, user.Email)); err != nil {
+		helper.LogError("Failed to publish user event", err, "", map[string]interface{}{
+			"source":  "oidcUsecase.createUser",
+			"user_id": user.ID,
+		})
+	}
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{
+		ActorType: audit.ActorSystem,
+		ActorID:   identity.Issuer,
+		Source:    audit.SourceHTTP,
+	})
+	recordAudit(uc.auditor, ctx, "user", event.ActionCreated, user.ID, userSnapshot(user, false))
+	return user, nil
+}
+
+// seal encodes login as base64url(JSON) "." base64url(HMAC-SHA256)
+func (uc *oidcUsecase) seal(login oidcLoginState) (string, error) {
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(uc.sign(encoded)), nil
+}
+
+// open decodes a sealed login state; false when tampered or expired
+func (uc *oidcUsecase) open(sealed string) (oidcLoginState, bool) {
+	var login oidcLoginState
+	encoded, signature, ok := strings.Cut(sealed, ".")
+	if !ok {
+		return login, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, uc.sign(encoded)) {
+		return login, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &login) != nil {
+		return login, false
+	}
+	return login, time.Now().Unix() < login.ExpiresAt
+}
+
+func (uc *oidcUsecase) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, uc.stateKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
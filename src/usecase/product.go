@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"boilerblade/src/dto"
+	"boilerblade/src/event"
 	"boilerblade/src/model"
 	"boilerblade/src/repository"
+	"context"
 	"errors"
 	"math"
 )
@@ -15,20 +17,40 @@ type ProductUsecase interface {
 	GetAllProducts(limit, offset int) (*dto.ProductListResponse, error)
 	UpdateProduct(id uint, req *dto.UpdateProductRequest) (*dto.ProductResponse, error)
 	DeleteProduct(id uint) error
+	// WithContext returns the usecase with its mutations attributed to the
+	// audit metadata of ctx (see audit.WithMetadata)
+	WithContext(ctx context.Context) ProductUsecase
 }
 
 // productUsecase implements ProductUsecase interface
 type productUsecase struct {
 	productRepo repository.ProductRepository
+	auditor     Auditor
+	ctx         context.Context
 }
 
-// NewProductUsecase creates a new product usecase instance
-func NewProductUsecase(productRepo repository.ProductRepository) ProductUsecase {
+// NewProductUsecase creates a new product usecase instance.
+// Mutations are recorded through auditor; nil disables auditing.
+func NewProductUsecase(productRepo repository.ProductRepository, auditor Auditor) ProductUsecase {
 	return &productUsecase{
 		productRepo: productRepo,
+		auditor:     auditor,
+		ctx:         context.Background(),
 	}
 }
 
+// WithContext returns a copy of the usecase bound to ctx
+func (uc *productUsecase) WithContext(ctx context.Context) ProductUsecase {
+	bound := *uc
+	bound.ctx = ctx
+	return &bound
+}
+
+// audit records a mutation of the product id in the audit log
+func (uc *productUsecase) audit(action string, id uint, changes []event.FieldChange) {
+	recordAudit(uc.auditor, uc.ctx, "product", action, id, changes)
+}
+
 // CreateProduct creates a new product
 func (uc *productUsecase) CreateProduct(req *dto.CreateProductRequest) (*dto.ProductResponse, error) {
 	// Create product model
@@ -41,6 +63,8 @@ func (uc *productUsecase) CreateProduct(req *dto.CreateProductRequest) (*dto.Pro
 		return nil, err
 	}
 
+	uc.audit(event.ActionCreated, product.ID, nil)
+
 	// Return response DTO
 	return &dto.ProductResponse{
 		ID: product.ID,
@@ -120,13 +144,17 @@ func (uc *productUsecase) UpdateProduct(id uint, req *dto.UpdateProductRequest)
 		return nil, errors.New("product not found")
 	}
 
-	// TODO: Update fields if provided
+	// TODO: Update fields if provided and record them for the audit log, e.g.
+	// changes = event.Diff(changes, "name", product.Name, req.Name, false)
+	var changes []event.FieldChange
 
 	// Save updates
 	if err := uc.productRepo.Update(product); err != nil {
 		return nil, err
 	}
 
+	uc.audit(event.ActionUpdated, product.ID, changes)
+
 	// Return response DTO
 	return &dto.ProductResponse{
 		ID: product.ID,
@@ -145,5 +173,10 @@ func (uc *productUsecase) DeleteProduct(id uint) error {
 	}
 
 	// Delete product
-	return uc.productRepo.Delete(id)
+	if err := uc.productRepo.Delete(id); err != nil {
+		return err
+	}
+
+	uc.audit(event.ActionDeleted, id, nil)
+	return nil
 }
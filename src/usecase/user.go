@@ -1,31 +1,117 @@
 package usecase
 
 import (
+	"boilerblade/helper"
 	"boilerblade/src/dto"
+	"boilerblade/src/event"
 	"boilerblade/src/model"
 	"boilerblade/src/repository"
+	"context"
 	"errors"
 	"math"
 )
 
+// createBatchSize is the number of rows per INSERT in CreateUsers
+const createBatchSize = 100
+
 // UserUsecase defines the interface for user business logic
 type UserUsecase interface {
 	CreateUser(req *dto.CreateUserRequest) (*dto.UserResponse, error)
+	CreateUsers(reqs []*dto.CreateUserRequest) ([]*dto.UserResponse, []error)
 	GetUserByID(id uint) (*dto.UserResponse, error)
 	GetAllUsers(limit, offset int) (*dto.UserListResponse, error)
 	UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.UserResponse, error)
 	DeleteUser(id uint) error
+	// WithContext returns the usecase with its mutations attributed to the
+	// audit metadata of ctx (see audit.WithMetadata)
+	WithContext(ctx context.Context) UserUsecase
 }
 
 // userUsecase implements UserUsecase interface
 type userUsecase struct {
-	userRepo repository.UserRepository
+	userRepo  repository.UserRepository
+	publisher event.Publisher
+	revoker   TokenRevoker
+	auditor   Auditor
+	ctx       context.Context
 }
 
-// NewUserUsecase creates a new user usecase instance
-func NewUserUsecase(userRepo repository.UserRepository) UserUsecase {
+// NewUserUsecase creates a new user usecase instance.
+// Domain events are sent through publisher; nil disables publishing.
+// Deleting a user or changing its password revokes its tokens through
+// revoker; nil disables revocation. Mutations are recorded through auditor;
+// nil disables auditing.
+func NewUserUsecase(userRepo repository.UserRepository, publisher event.Publisher, revoker TokenRevoker, auditor Auditor) UserUsecase {
+	if publisher == nil {
+		publisher = event.NewNoopPublisher()
+	}
 	return &userUsecase{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		publisher: publisher,
+		revoker:   revoker,
+		auditor:   auditor,
+		ctx:       context.Background(),
+	}
+}
+
+// WithContext returns a copy of the usecase bound to ctx
+func (uc *userUsecase) WithContext(ctx context.Context) UserUsecase {
+	bound := *uc
+	bound.ctx = ctx
+	return &bound
+}
+
+// audit records a mutation of the user id in the audit log
+func (uc *userUsecase) audit(action string, id uint, changes []event.FieldChange) {
+	recordAudit(uc.auditor, uc.ctx, "user", action, id, changes)
+}
+
+// userSnapshot lists the fields of user as changes from before to after;
+// creations have a nil before and deletions a nil after
+func userSnapshot(user *model.User, deleted bool) []event.FieldChange {
+	var changes []event.FieldChange
+	for _, field := range []struct {
+		name   string
+		value  string
+		secret bool
+	}{
+		{"name", user.Name, false},
+		{"email", user.Email, false},
+		{"password", user.Password, true},
+	} {
+		if deleted {
+			changes = event.Diff(changes, field.name, field.value, nil, field.secret)
+		} else {
+			changes = event.Diff(changes, field.name, nil, field.value, field.secret)
+		}
+	}
+	return changes
+}
+
+// revokeTokens revokes the tokens of a user before its deletion or password
+// change is saved: a failure fails the request, so no token outlives it
+func (uc *userUsecase) revokeTokens(id uint) error {
+	if uc.revoker == nil {
+		return nil
+	}
+	return revokeUserTokens(uc.revoker, id)
+}
+
+// publish emits a user domain event, see publishEvent
+func (uc *userUsecase) publish(evt event.Event) {
+	publishEvent(uc.publisher, evt, "userUsecase.publish")
+}
+
+// publishEvent publishes evt for the usecase method source. Usecases publish
+// once the mutation is persisted, so a failure is logged instead of failing
+// the request; audit log writes (Auditor) are handled the same way.
+func publishEvent(publisher event.Publisher, evt event.Event, source string) {
+	if err := publisher.Publish(evt); err != nil {
+		helper.LogError("Failed to publish event", err, "", map[string]interface{}{
+			"source":      source,
+			"exchange":    evt.Exchange(),
+			"routing_key": evt.RoutingKey(),
+		})
 	}
 }
 
@@ -37,11 +123,16 @@ func (uc *userUsecase) CreateUser(req *dto.CreateUserRequest) (*dto.UserResponse
 		return nil, errors.New("email already exists")
 	}
 
+	passwordHash, err := helper.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create user model
 	user := &model.User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: req.Password, // In production, hash the password
+		Password: passwordHash,
 	}
 
 	// Save to database
@@ -49,6 +140,9 @@ func (uc *userUsecase) CreateUser(req *dto.CreateUserRequest) (*dto.UserResponse
 		return nil, err
 	}
 
+	uc.publish(event.NewUserCreated(user.ID, user.Name, user.Email))
+	uc.audit(event.ActionCreated, user.ID, userSnapshot(user, false))
+
 	// Return response DTO
 	return &dto.UserResponse{
 		ID:        user.ID,
@@ -59,6 +153,90 @@ func (uc *userUsecase) CreateUser(req *dto.CreateUserRequest) (*dto.UserResponse
 	}, nil
 }
 
+// CreateUsers creates many users with batched inserts. The results line up
+// with reqs: errs[i] is nil when reqs[i] was created, "email already exists"
+// when the email is taken (or repeated earlier in reqs), or the insert error.
+// Once the context of the usecase (WithContext) is done, the insert is rolled
+// back and the remaining users fail with its error.
+func (uc *userUsecase) CreateUsers(reqs []*dto.CreateUserRequest) ([]*dto.UserResponse, []error) {
+	responses := make([]*dto.UserResponse, len(reqs))
+	errs := make([]error, len(reqs))
+
+	emails := make([]string, len(reqs))
+	for i, req := range reqs {
+		emails[i] = req.Email
+	}
+	existing, err := uc.userRepo.GetByEmails(emails)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return responses, errs
+	}
+	taken := make(map[string]bool, len(existing)+len(reqs))
+	for _, user := range existing {
+		taken[user.Email] = true
+	}
+
+	users := make([]*model.User, 0, len(reqs))
+	index := make([]int, 0, len(reqs)) // position in reqs of users[i]
+	for i, req := range reqs {
+		if taken[req.Email] {
+			errs[i] = errors.New("email already exists")
+			continue
+		}
+		taken[req.Email] = true
+		if err := uc.ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		passwordHash, err := helper.HashPassword(req.Password)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		users = append(users, &model.User{
+			Name:     req.Name,
+			Email:    req.Email,
+			Password: passwordHash,
+		})
+		index = append(index, i)
+	}
+	if len(users) == 0 {
+		return responses, errs
+	}
+
+	if err := uc.userRepo.CreateBatch(uc.ctx, users, createBatchSize); err != nil {
+		// One bad row fails the whole batch: insert row by row to find it,
+		// unless the batch failed because its time is up
+		for k, user := range users {
+			if ctxErr := uc.ctx.Err(); ctxErr != nil {
+				errs[index[k]] = ctxErr
+				continue
+			}
+			user.ID = 0
+			errs[index[k]] = uc.userRepo.Create(user)
+		}
+	}
+
+	for k, user := range users {
+		i := index[k]
+		if errs[i] != nil {
+			continue
+		}
+		uc.publish(event.NewUserCreated(user.ID, user.Name, user.Email))
+		uc.audit(event.ActionCreated, user.ID, userSnapshot(user, false))
+		responses[i] = &dto.UserResponse{
+			ID:        user.ID,
+			Name:      user.Name,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
+			UpdatedAt: user.UpdatedAt.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return responses, errs
+}
+
 // GetUserByID retrieves a user by ID
 func (uc *userUsecase) GetUserByID(id uint) (*dto.UserResponse, error) {
 	user, err := uc.userRepo.GetByID(id)
@@ -131,6 +309,9 @@ func (uc *userUsecase) UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.Use
 		return nil, errors.New("user not found")
 	}
 
+	// Keep original values for the event diff
+	before := *user
+
 	// Update fields if provided
 	if req.Name != "" {
 		user.Name = req.Name
@@ -141,10 +322,21 @@ func (uc *userUsecase) UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.Use
 		if existingUser != nil && existingUser.ID != id {
 			return nil, errors.New("email already exists")
 		}
+		if req.Email != user.Email {
+			// The new address has to be verified again
+			user.EmailVerifiedAt = nil
+		}
 		user.Email = req.Email
 	}
 	if req.Password != "" {
-		user.Password = req.Password // In production, hash the password
+		passwordHash, err := helper.HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = passwordHash
+		if err := uc.revokeTokens(id); err != nil {
+			return nil, err
+		}
 	}
 
 	// Save updates
@@ -152,6 +344,13 @@ func (uc *userUsecase) UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.Use
 		return nil, err
 	}
 
+	var changes []event.FieldChange
+	changes = event.Diff(changes, "name", before.Name, user.Name, false)
+	changes = event.Diff(changes, "email", before.Email, user.Email, false)
+	changes = event.Diff(changes, "password", before.Password, user.Password, true)
+	uc.publish(event.NewUserUpdated(user.ID, changes))
+	uc.audit(event.ActionUpdated, user.ID, changes)
+
 	// Return response DTO
 	return &dto.UserResponse{
 		ID:        user.ID,
@@ -165,11 +364,21 @@ func (uc *userUsecase) UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.Use
 // DeleteUser deletes a user
 func (uc *userUsecase) DeleteUser(id uint) error {
 	// Check if user exists
-	_, err := uc.userRepo.GetByID(id)
+	user, err := uc.userRepo.GetByID(id)
 	if err != nil {
 		return errors.New("user not found")
 	}
 
+	if err := uc.revokeTokens(id); err != nil {
+		return err
+	}
+
 	// Delete user
-	return uc.userRepo.Delete(id)
+	if err := uc.userRepo.Delete(id); err != nil {
+		return err
+	}
+
+	uc.publish(event.NewUserDeleted(id))
+	uc.audit(event.ActionDeleted, id, userSnapshot(user, true))
+	return nil
 }
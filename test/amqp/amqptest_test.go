@@ -0,0 +1,236 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"boilerblade/src/event"
+	"context"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// newBrokerWithTopology returns a broker with the topology applied
+func newBrokerWithTopology(t *testing.T, yaml string) *amqptest.Broker {
+	topology, err := amqp.ParseTopology([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Failed to parse topology: %v", err)
+	}
+	broker := amqptest.NewBroker()
+	ch, err := broker.Channel()
+	if err != nil {
+		t.Fatalf("Failed to open channel: %v", err)
+	}
+	defer ch.Close()
+	if err := topology.Apply(ch); err != nil {
+		t.Fatalf("Failed to apply topology: %v", err)
+	}
+	return broker
+}
+
+func TestBroker_TopicRouting(t *testing.T) {
+	broker := newBrokerWithTopology(t, `
+exchanges:
+  - name: audit
+    type: topic
+queues:
+  - name: all_users
+    type: classic
+  - name: created_only
+    type: classic
+bindings:
+  - exchange: audit
+    queue: all_users
+    routing_key: user.#
+  - exchange: audit
+    queue: created_only
+    routing_key: "*.created"
+`)
+
+	for _, key := range []string{"user.created", "user.event.deleted", "order.created"} {
+		if err := broker.Deliver("audit", key, amqplib.Publishing{Body: []byte(key)}); err != nil {
+			t.Fatalf("Deliver %s failed: %v", key, err)
+		}
+	}
+
+	if got := broker.Stats("all_users").Ready; got != 2 {
+		t.Errorf("Expected 2 messages in all_users, got %d", got)
+	}
+	if got := broker.Stats("created_only").Ready; got != 2 {
+		t.Errorf("Expected 2 messages in created_only, got %d", got)
+	}
+}
+
+func TestBroker_RetryFlow(t *testing.T) {
+	broker := newBrokerWithTopology(t, orderTopology)
+	if err := broker.Deliver("order_events", "order.created", amqplib.Publishing{Body: []byte(`{}`)}); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	ch, _ := broker.Channel()
+	defer ch.Close()
+
+	d, ok, err := ch.GetChannel().Get("order_created_queue", false)
+	if err != nil || !ok {
+		t.Fatalf("Expected a message, got ok=%v err=%v", ok, err)
+	}
+	if err := d.Nack(false, false); err != nil {
+		t.Fatalf("Nack failed: %v", err)
+	}
+
+	if got := broker.Stats("order_created_queue.retry").Ready; got != 1 {
+		t.Fatalf("Expected rejected message in retry queue, got %d", got)
+	}
+
+	broker.Advance(2999 * time.Millisecond)
+	if got := broker.Stats("order_created_queue").Ready; got != 0 {
+		t.Fatalf("Message returned before the retry interval elapsed")
+	}
+
+	broker.Advance(time.Millisecond)
+	d, ok, _ = ch.GetChannel().Get("order_created_queue", false)
+	if !ok {
+		t.Fatal("Expected message back in the queue after the retry interval")
+	}
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) != 2 {
+		t.Fatalf("Expected x-death entries for rejection and expiry, got %v", d.Headers["x-death"])
+	}
+	if d.RoutingKey != "order.created" {
+		t.Errorf("Expected routing key order.created, got %s", d.RoutingKey)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+
+	stats := broker.Stats("order_created_queue")
+	if stats.Acked != 1 || stats.DeadLettered != 1 || stats.Ready != 0 || stats.Unacked != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestBroker_ConsumeRequeue(t *testing.T) {
+	broker := newBrokerWithTopology(t, orderTopology)
+	ch, _ := broker.Channel()
+
+	deliveries, err := ch.ReadMessage(context.Background(), amqplib.Queue{Name: "order_created_queue"})
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	broker.Deliver("order_events", "order.created", amqplib.Publishing{MessageId: "m-1"})
+
+	first := <-deliveries
+	if first.Redelivered {
+		t.Error("First delivery should not be redelivered")
+	}
+	first.Nack(false, true)
+
+	second := <-deliveries
+	if !second.Redelivered || second.MessageId != "m-1" {
+		t.Errorf("Expected redelivery of m-1, got %+v", second)
+	}
+	second.Ack(false)
+
+	stats := broker.WaitIdle(t, "order_created_queue")
+	if stats.Requeued != 1 || stats.Acked != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	ch.Close()
+	if _, ok := <-deliveries; ok {
+		t.Error("Deliveries should be closed with the channel")
+	}
+}
+
+func TestBroker_ConsumeCancel(t *testing.T) {
+	broker := newBrokerWithTopology(t, orderTopology)
+	ch, _ := broker.Channel()
+	defer ch.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries, err := ch.ReadMessage(ctx, amqplib.Queue{Name: "order_created_queue"})
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	broker.Deliver("order_events", "order.created", amqplib.Publishing{MessageId: "m-1"})
+	broker.Deliver("order_events", "order.created", amqplib.Publishing{MessageId: "m-2"})
+
+	first := <-deliveries
+	cancel()
+
+	// The channel is closed promptly; a delivery already in flight must still be settled
+	for d := range deliveries {
+		d.Nack(false, true)
+	}
+	first.Ack(false)
+
+	stats := broker.Stats("order_created_queue")
+	if stats.Consumers != 0 || stats.Ready != 1 || stats.Unacked != 0 || stats.Acked != 1 {
+		t.Errorf("Unexpected stats after cancellation: %+v", stats)
+	}
+}
+
+func TestMessageContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, cancelMsg := amqp.MessageContext(parent, time.Minute)
+	defer cancelMsg()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected a deadline within a minute, got %v (set: %v)", deadline, ok)
+	}
+
+	// The message being handled is not cut short by the consumer shutting down
+	cancel()
+	if ctx.Err() != nil {
+		t.Errorf("Expected the message context to outlive its parent, got %v", ctx.Err())
+	}
+}
+
+func TestBroker_DeclareConflictAndNotFound(t *testing.T) {
+	broker := newBrokerWithTopology(t, orderTopology)
+
+	ch, _ := broker.Channel()
+	if _, err := ch.QueueDeclare("order_created_queue", true, false, false, false, amqplib.Table{"x-queue-type": "classic"}); !isAMQPError(err, amqplib.PreconditionFailed) {
+		t.Errorf("Expected PRECONDITION_FAILED, got %v", err)
+	}
+	if !ch.IsClosed() {
+		t.Error("Channel should be closed after a channel exception")
+	}
+
+	ch, _ = broker.Channel()
+	if err := ch.PublishMessage(context.Background(), nil, "x", "application/json", "missing", nil); !isAMQPError(err, amqplib.NotFound) {
+		t.Errorf("Expected NOT_FOUND, got %v", err)
+	}
+}
+
+func TestBroker_ExpectPublished(t *testing.T) {
+	broker := newBrokerWithTopology(t, `
+exchanges:
+  - name: user_events
+    type: direct
+`)
+
+	publisher, err := event.NewAMQPPublisher(broker, "test", amqp.CloudEventModeStructured, nil)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	if err := publisher.Publish(event.NewUserDeleted(7)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	msg := broker.ExpectPublished(t, "user_events", "user.event.deleted")
+	evt, err := amqp.ParseCloudEvent(msg.Delivery())
+	if err != nil {
+		t.Fatalf("Published message is not a CloudEvent: %v", err)
+	}
+	if evt.Type != "boilerblade.user.event.deleted" || evt.Source != "test" {
+		t.Errorf("Unexpected event: %+v", evt)
+	}
+}
+
+func isAMQPError(err error, code int) bool {
+	amqpErr, ok := err.(*amqplib.Error)
+	return ok && amqpErr.Code == code
+}
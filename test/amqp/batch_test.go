@@ -0,0 +1,209 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"boilerblade/config/broker"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+const batchTopology = `
+exchanges:
+  - name: imports
+    type: direct
+queues:
+  - name: import_queue
+    type: quorum
+bindings:
+  - exchange: imports
+    queue: import_queue
+    routing_key: row
+`
+
+// startBatches consumes import_queue in batches of body strings until the test ends
+func startBatches(t *testing.T, opts broker.BatchOptions, handle broker.BatchHandler[string]) *amqptest.Broker {
+	fake := newBrokerWithTopology(t, batchTopology)
+	topology, _ := amqp.ParseTopology([]byte(batchTopology))
+	b := broker.NewAMQP(fake, topology)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sub, err := b.Consume(ctx, "import_queue", "test", broker.WithPrefetch(opts.Size))
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	opts.Queue, opts.Consumer = "import_queue", "test"
+
+	decode := func(d amqplib.Delivery) (string, error) {
+		if len(d.Body) == 0 {
+			return "", errors.New("empty row")
+		}
+		return string(d.Body), nil
+	}
+	go broker.ConsumeBatches(ctx, b, sub, opts, decode, handle)
+	return fake
+}
+
+func deliverRows(t *testing.T, fake *amqptest.Broker, rows ...string) {
+	for _, row := range rows {
+		if err := fake.Deliver("imports", "row", amqplib.Publishing{MessageId: row, Body: []byte(row)}); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+	}
+}
+
+func TestConsumeBatches_SizeAndWait(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	fake := newBrokerWithTopology(t, batchTopology)
+	deliverRows(t, fake, "1", "2", "3", "4", "5", "6", "7")
+
+	// Start on a broker that already holds the rows, so the first batches fill up
+	topology, _ := amqp.ParseTopology([]byte(batchTopology))
+	b := broker.NewAMQP(fake, topology)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := b.Consume(ctx, "import_queue", "test", broker.WithPrefetch(3))
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	go broker.ConsumeBatches(ctx, b, sub, broker.BatchOptions{Size: 3, Wait: 20 * time.Millisecond, Queue: "import_queue"},
+		func(d amqplib.Delivery) (string, error) { return string(d.Body), nil },
+		func(ctx context.Context, rows []string) []error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected the batch context to carry a deadline")
+			}
+			mu.Lock()
+			sizes = append(sizes, len(rows))
+			mu.Unlock()
+			return nil
+		})
+
+	stats := fake.WaitIdle(t, "import_queue")
+	if stats.Acked != 7 {
+		t.Errorf("Expected every row to be acked, got %+v", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("Expected batches of 3, 3 and 1 (flushed after the wait), got %v", sizes)
+	}
+}
+
+func TestConsumeBatches_SettlesEachDelivery(t *testing.T) {
+	var mu sync.Mutex
+	failed := false
+	fake := startBatches(t, broker.BatchOptions{Size: 10, Wait: 20 * time.Millisecond}, func(ctx context.Context, rows []string) []error {
+		mu.Lock()
+		defer mu.Unlock()
+		errs := make([]error, len(rows))
+		for i, row := range rows {
+			switch {
+			case row == "bad":
+				errs[i] = amqp.Permanent(errors.New("invalid row"))
+			case row == "flaky" && !failed:
+				failed = true
+				errs[i] = errors.New("deadlock")
+			}
+		}
+		return errs
+	})
+	deliverRows(t, fake, "1", "bad", "flaky", "", "2")
+
+	stats := fake.WaitIdle(t, "import_queue")
+	if stats.Acked != 5 || stats.Requeued != 1 {
+		t.Errorf("Expected 5 acks (2 of them parked) and one requeue, got %+v", stats)
+	}
+	if got := fake.Stats(amqp.ErrorQueueName("import_queue")).Ready; got != 2 {
+		t.Errorf("Expected the permanent failure and the undecodable row in the error queue, got %d", got)
+	}
+}
+
+func TestConsumeBatches_MismatchedResultsRequeue(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	fake := startBatches(t, broker.BatchOptions{Size: 2, Wait: 20 * time.Millisecond}, func(ctx context.Context, rows []string) []error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return []error{nil}
+		}
+		return nil
+	})
+	deliverRows(t, fake, "1", "2")
+
+	stats := fake.WaitIdle(t, "import_queue")
+	if stats.Requeued != 2 || stats.Acked != 2 {
+		t.Errorf("Expected a malformed result to requeue the batch, got %+v", stats)
+	}
+}
+
+func TestConsumeBatches_PanicRetriesBatch(t *testing.T) {
+	fake := newBrokerWithTopology(t, retryTopology)
+	topology, _ := amqp.ParseTopology([]byte(retryTopology))
+	b := broker.NewAMQP(fake, topology)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := b.Consume(ctx, "import_queue", "test", broker.WithPrefetch(10))
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	var mu sync.Mutex
+	calls := 0
+	go broker.ConsumeBatches(ctx, b, sub, broker.BatchOptions{Size: 10, Wait: 20 * time.Millisecond, Queue: "import_queue"},
+		func(d amqplib.Delivery) (string, error) { return string(d.Body), nil },
+		func(ctx context.Context, rows []string) []error {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				panic("index out of range")
+			}
+			return nil
+		})
+
+	deliverRows(t, fake, "1", "2")
+	fake.WaitIdle(t, "import_queue")
+	deliverRows(t, fake, "3")
+
+	stats := fake.WaitIdle(t, "import_queue")
+	if stats.DeadLettered != 2 || stats.Acked != 1 {
+		t.Errorf("Expected the panicking batch in the retry queue and the next batch acked, got %+v", stats)
+	}
+}
+
+func TestConsumeBatches_TimeoutRetriesBatch(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	abandoned := make(chan struct{})
+	fake := startBatches(t, broker.BatchOptions{Size: 2, Wait: 20 * time.Millisecond, MessageTimeout: 20 * time.Millisecond}, func(ctx context.Context, rows []string) []error {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if !first {
+			return nil
+		}
+		// Ignores ctx and reports success long after the timeout: its
+		// outcome must not settle the deliveries (run with -race)
+		defer close(abandoned)
+		time.Sleep(100 * time.Millisecond)
+		return make([]error, len(rows))
+	})
+	deliverRows(t, fake, "1", "2")
+
+	<-abandoned
+	stats := fake.WaitIdle(t, "import_queue")
+	if stats.Requeued != 2 || stats.Acked != 2 {
+		t.Errorf("Expected the timed-out batch to be requeued, then acked once redelivered, got %+v", stats)
+	}
+}
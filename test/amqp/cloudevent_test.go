@@ -0,0 +1,135 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"context"
+	"errors"
+	"testing"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+type userPayload struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// toDelivery turns a publishing into the delivery a consumer would receive
+func toDelivery(p amqplib.Publishing) amqplib.Delivery {
+	return amqplib.Delivery{
+		Headers:     p.Headers,
+		ContentType: p.ContentType,
+		MessageId:   p.MessageId,
+		Timestamp:   p.Timestamp,
+		Type:        p.Type,
+		Body:        p.Body,
+	}
+}
+
+func newTestEvent(t *testing.T) *amqp.CloudEvent {
+	evt, err := amqp.NewCloudEvent("evt-1", "test", "boilerblade.user.created", "urn:boilerblade:schema:user.created:v1", userPayload{
+		Name:  "Test User",
+		Email: "test@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CloudEvent: %v", err)
+	}
+	return evt
+}
+
+func TestCloudEvent_RoundTrip(t *testing.T) {
+	for _, mode := range []amqp.CloudEventMode{amqp.CloudEventModeBinary, amqp.CloudEventModeStructured} {
+		t.Run(string(mode), func(t *testing.T) {
+			publishing, err := newTestEvent(t).ToPublishing(mode)
+			if err != nil {
+				t.Fatalf("Failed to build publishing: %v", err)
+			}
+
+			parsed, err := amqp.ParseCloudEvent(toDelivery(publishing))
+			if err != nil {
+				t.Fatalf("Failed to parse CloudEvent: %v", err)
+			}
+
+			if parsed.Legacy {
+				t.Error("Event should not be legacy")
+			}
+			if parsed.ID != "evt-1" || parsed.Type != "boilerblade.user.created" || parsed.Source != "test" {
+				t.Errorf("Unexpected attributes: %+v", parsed)
+			}
+			if parsed.SchemaVersion() != "v1" {
+				t.Errorf("Expected schema version 'v1', got '%s'", parsed.SchemaVersion())
+			}
+
+			var payload userPayload
+			if err := parsed.Decode(&payload); err != nil {
+				t.Fatalf("Failed to decode data: %v", err)
+			}
+			if payload.Email != "test@example.com" {
+				t.Errorf("Expected email 'test@example.com', got '%s'", payload.Email)
+			}
+		})
+	}
+}
+
+func TestParseCloudEvent_Legacy(t *testing.T) {
+	parsed, err := amqp.ParseCloudEvent(amqplib.Delivery{
+		MessageId:   "legacy-1",
+		ContentType: "application/json",
+		Body:        []byte(`{"name":"Test User","email":"test@example.com"}`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse legacy payload: %v", err)
+	}
+
+	if !parsed.Legacy {
+		t.Error("Bare payload should be legacy")
+	}
+	if parsed.ID != "legacy-1" {
+		t.Errorf("Expected ID from MessageId, got '%s'", parsed.ID)
+	}
+}
+
+func TestParseCloudEvent_InvalidStructured(t *testing.T) {
+	_, err := amqp.ParseCloudEvent(amqplib.Delivery{
+		ContentType: amqp.CloudEventsContentType,
+		Body:        []byte(`not json`),
+	})
+	if !errors.Is(err, amqp.ErrInvalidCloudEvent) {
+		t.Errorf("Expected ErrInvalidCloudEvent, got %v", err)
+	}
+}
+
+func TestEventRouter_Dispatch(t *testing.T) {
+	var handled []string
+	router := amqp.NewEventRouter("boilerblade.user.created", "v1").
+		Handle("boilerblade.user.created", "v1", func(ctx context.Context, evt *amqp.CloudEvent) error {
+			handled = append(handled, "v1")
+			return nil
+		}).
+		Handle("boilerblade.user.created", "v2", func(ctx context.Context, evt *amqp.CloudEvent) error {
+			handled = append(handled, "v2")
+			return nil
+		})
+
+	v2 := newTestEvent(t)
+	v2.DataSchema = "urn:boilerblade:schema:user.created:v2"
+	publishing, _ := v2.ToPublishing(amqp.CloudEventModeBinary)
+	if err := router.Dispatch(context.Background(), toDelivery(publishing)); err != nil {
+		t.Fatalf("Dispatch v2 failed: %v", err)
+	}
+
+	if err := router.Dispatch(context.Background(), amqplib.Delivery{Body: []byte(`{}`)}); err != nil {
+		t.Fatalf("Dispatch legacy failed: %v", err)
+	}
+
+	if len(handled) != 2 || handled[0] != "v2" || handled[1] != "v1" {
+		t.Errorf("Expected [v2 v1], got %v", handled)
+	}
+
+	unknown := newTestEvent(t)
+	unknown.Type = "boilerblade.user.unknown"
+	publishing, _ = unknown.ToPublishing(amqp.CloudEventModeStructured)
+	if err := router.Dispatch(context.Background(), toDelivery(publishing)); !errors.Is(err, amqp.ErrUnhandledEvent) {
+		t.Errorf("Expected ErrUnhandledEvent, got %v", err)
+	}
+}
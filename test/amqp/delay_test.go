@@ -0,0 +1,118 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newReminderBroker declares the reminders exchange with reminder_queue bound to reminder.send
+func newReminderBroker(t *testing.T, plugin bool) *amqptest.Broker {
+	fake := amqptest.NewBroker()
+	fake.DelayedMessagePlugin = plugin
+
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	if err := ch.ExchangeDeclare("reminders", "direct", true, false, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare exchange: %v", err)
+	}
+	if _, err := ch.QueueDeclare("reminder_queue", true, false, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare queue: %v", err)
+	}
+	if err := ch.QueueBind("reminder_queue", "reminder.send", "reminders", false, nil); err != nil {
+		t.Fatalf("Failed to bind queue: %v", err)
+	}
+	return fake
+}
+
+func TestDelayedPublisher_Buckets(t *testing.T) {
+	fake := newReminderBroker(t, false)
+	publisher := amqp.NewDelayedPublisher(fake, false)
+	defer publisher.Close()
+
+	if err := publisher.PublishDelayed(context.Background(), "reminders", "reminder.send", []byte(`{"user_id":1}`), 90*time.Second); err != nil {
+		t.Fatalf("PublishDelayed failed: %v", err)
+	}
+
+	published := fake.ExpectPublished(t, "reminders.delay.5m", "reminder.send")
+	if published.Expiration != "90000" {
+		t.Errorf("Expected expiration 90000, got %q", published.Expiration)
+	}
+
+	fake.Advance(89 * time.Second)
+	if stats := fake.Stats("reminder_queue"); stats.Ready != 0 {
+		t.Fatalf("Expected no message before the delay, got %+v", stats)
+	}
+	fake.Advance(time.Second)
+	if stats := fake.Stats("reminder_queue"); stats.Ready != 1 {
+		t.Errorf("Expected the message after the delay, got %+v", stats)
+	}
+}
+
+func TestDelayedPublisher_Plugin(t *testing.T) {
+	fake := newReminderBroker(t, true)
+	publisher := amqp.NewDelayedPublisher(fake, true)
+	defer publisher.Close()
+
+	if err := publisher.PublishDelayed(context.Background(), "reminders", "reminder.send", []byte(`{"user_id":1}`), 24*time.Hour); err != nil {
+		t.Fatalf("PublishDelayed failed: %v", err)
+	}
+
+	published := fake.ExpectPublished(t, "reminders.delayed", "reminder.send")
+	if published.Headers[amqp.DelayHeader] != (24 * time.Hour).Milliseconds() {
+		t.Errorf("Expected x-delay of 24h, got %v", published.Headers[amqp.DelayHeader])
+	}
+
+	fake.Advance(23 * time.Hour)
+	if stats := fake.Stats("reminder_queue"); stats.Ready != 0 {
+		t.Fatalf("Expected no message before the delay, got %+v", stats)
+	}
+	fake.Advance(time.Hour)
+	if stats := fake.Stats("reminder_queue"); stats.Ready != 1 {
+		t.Errorf("Expected the message after the delay, got %+v", stats)
+	}
+}
+
+func TestDelayedPublisher_PluginMissing(t *testing.T) {
+	fake := newReminderBroker(t, false)
+	publisher := amqp.NewDelayedPublisher(fake, true)
+	defer publisher.Close()
+
+	if err := publisher.PublishDelayed(context.Background(), "reminders", "reminder.send", nil, time.Minute); err == nil {
+		t.Error("Expected an error when the delayed-message plugin is not enabled")
+	}
+}
+
+func TestDelayedPublisher_ImmediateAndTooLong(t *testing.T) {
+	fake := newReminderBroker(t, false)
+	publisher := amqp.NewDelayedPublisher(fake, false)
+	defer publisher.Close()
+
+	if err := publisher.PublishDelayed(context.Background(), "reminders", "reminder.send", nil, 0); err != nil {
+		t.Fatalf("PublishDelayed failed: %v", err)
+	}
+	if stats := fake.Stats("reminder_queue"); stats.Ready != 1 {
+		t.Errorf("Expected a zero delay to publish immediately, got %+v", stats)
+	}
+
+	err := publisher.PublishDelayed(context.Background(), "reminders", "reminder.send", nil, 30*24*time.Hour)
+	if !errors.Is(err, amqp.ErrDelayTooLong) {
+		t.Errorf("Expected ErrDelayTooLong, got %v", err)
+	}
+}
+
+func TestDelayBucketName(t *testing.T) {
+	cases := map[time.Duration]string{
+		15 * time.Second: "user_events.delay.15s",
+		5 * time.Minute:  "user_events.delay.5m",
+		24 * time.Hour:   "user_events.delay.24h",
+	}
+	for bucket, want := range cases {
+		if got := amqp.DelayBucketName("user_events", bucket); got != want {
+			t.Errorf("DelayBucketName(%s) = %s, want %s", bucket, got, want)
+		}
+	}
+}
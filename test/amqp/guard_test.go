@@ -0,0 +1,178 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+func panicking(ctx context.Context) error {
+	panic("nil map")
+}
+
+func TestGuard_RecoversPanic(t *testing.T) {
+	guard := broker.NewGuard("test/recover", broker.GuardOptions{})
+	defer guard.Close()
+
+	err := guard.Run(context.Background(), amqplib.Delivery{MessageId: "1"}, panicking)
+	var panicErr *amqp.PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Expected a PanicError, got %v", err)
+	}
+	if panicErr.Value != "nil map" || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected the panic value and its stack, got %+v", panicErr)
+	}
+	if amqp.IsPermanent(err) {
+		t.Errorf("Expected a panic to be retried, not parked")
+	}
+
+	if err := guard.Run(context.Background(), amqplib.Delivery{MessageId: "2"}, func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Expected the next message to be handled, got %v", err)
+	}
+}
+
+func TestGuard_Timeout(t *testing.T) {
+	guard := broker.NewGuard("test/timeout", broker.GuardOptions{Timeout: 20 * time.Millisecond})
+	defer guard.Close()
+
+	// A handler ignoring its deadline is left behind
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	err := guard.Run(context.Background(), amqplib.Delivery{}, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, broker.ErrMessageTimeout) {
+		t.Fatalf("Expected ErrMessageTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Run to return at the deadline, took %s", elapsed)
+	}
+
+	// A handler giving up at its deadline is reported the same way
+	err = guard.Run(context.Background(), amqplib.Delivery{}, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, broker.ErrMessageTimeout) {
+		t.Errorf("Expected ErrMessageTimeout, got %v", err)
+	}
+}
+
+func TestGuard_CircuitPausesAndResumes(t *testing.T) {
+	guard := broker.NewGuard("test/circuit", broker.GuardOptions{PanicThreshold: 2, Pause: 50 * time.Millisecond})
+	defer guard.Close()
+	ctx := context.Background()
+
+	guard.Run(ctx, amqplib.Delivery{}, panicking)
+	if state := guard.Status().State; state != broker.GuardClosed {
+		t.Fatalf("Expected one panic to keep consuming, got %s", state)
+	}
+	guard.Run(ctx, amqplib.Delivery{}, panicking)
+
+	status := guard.Status()
+	if status.State != broker.GuardOpen || status.Trips != 1 || status.PausedUntil == nil || status.LastPanic != "panic: nil map" {
+		t.Fatalf("Expected the circuit to open, got %+v", status)
+	}
+	found := false
+	for _, s := range broker.Guards() {
+		found = found || (s.Name == "test/circuit" && s.State == broker.GuardOpen)
+	}
+	if !found {
+		t.Errorf("Expected the open circuit to be reported by Guards, got %+v", broker.Guards())
+	}
+
+	start := time.Now()
+	if err := guard.Run(ctx, amqplib.Delivery{}, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected Run to wait for the pause, took %s", elapsed)
+	}
+	if state := guard.Status().State; state != broker.GuardClosed {
+		t.Errorf("Expected a successful message to close the circuit, got %s", state)
+	}
+}
+
+func TestGuard_HalfOpenPanicReopens(t *testing.T) {
+	guard := broker.NewGuard("test/half-open", broker.GuardOptions{PanicThreshold: 1, Pause: 20 * time.Millisecond})
+	defer guard.Close()
+
+	guard.Run(context.Background(), amqplib.Delivery{}, panicking)
+	guard.Run(context.Background(), amqplib.Delivery{}, panicking)
+	if status := guard.Status(); status.State != broker.GuardOpen || status.Trips != 2 {
+		t.Fatalf("Expected a panic after the pause to reopen the circuit, got %+v", status)
+	}
+
+	// Waiting for the pause stops with ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := guard.Run(ctx, amqplib.Delivery{}, func(ctx context.Context) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with ctx, got %v", err)
+	}
+}
+
+func TestGuard_CloseUnregisters(t *testing.T) {
+	guard := broker.NewGuard("test/close", broker.GuardOptions{})
+	guard.Close()
+	for _, s := range broker.Guards() {
+		if s.Name == "test/close" {
+			t.Errorf("Expected a closed guard not to be reported")
+		}
+	}
+}
+
+const retryTopology = `
+exchanges:
+  - name: imports
+    type: direct
+queues:
+  - name: import_queue
+    type: quorum
+    retry:
+      interval: 60000
+  - name: audit_queue
+    type: quorum
+bindings:
+  - exchange: imports
+    queue: import_queue
+    routing_key: row
+  - exchange: imports
+    queue: audit_queue
+    routing_key: audit
+`
+
+func TestRetry_UsesRetryQueue(t *testing.T) {
+	fake := newBrokerWithTopology(t, retryTopology)
+	topology, _ := amqp.ParseTopology([]byte(retryTopology))
+	b := broker.NewAMQP(fake, topology)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, route := range []struct{ queue, key string }{{"import_queue", "row"}, {"audit_queue", "audit"}} {
+		sub, err := b.Consume(ctx, route.queue, "test")
+		if err != nil {
+			t.Fatalf("Consume failed: %v", err)
+		}
+		if err := fake.Deliver("imports", route.key, amqplib.Publishing{Body: []byte("x")}); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+		broker.Retry(b, <-sub.Deliveries(), route.queue)
+	}
+
+	if stats := fake.Stats("import_queue"); stats.DeadLettered != 1 {
+		t.Errorf("Expected the message to go to the retry queue, got %+v", stats)
+	}
+	if got := fake.Stats("import_queue" + amqp.QueueRetrySuffix).Ready; got != 1 {
+		t.Errorf("Expected the message to wait in the retry queue, got %d", got)
+	}
+	if stats := fake.Stats("audit_queue"); stats.Requeued != 1 || stats.DeadLettered != 0 {
+		t.Errorf("Expected a queue without retry to requeue, got %+v", stats)
+	}
+}
@@ -0,0 +1,36 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsPermanent(t *testing.T) {
+	var decoded map[string]interface{}
+	jsonErr := json.Unmarshal([]byte(`{"name":`), &decoded)
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"marked", amqp.Permanent(errors.New("email is required")), true},
+		{"wrapped mark", fmt.Errorf("handler: %w", amqp.Permanent(errors.New("bad"))), true},
+		{"json", jsonErr, true},
+		{"invalid cloudevent", fmt.Errorf("%w: missing type header", amqp.ErrInvalidCloudEvent), true},
+		{"unhandled event", amqp.ErrUnhandledEvent, true},
+		{"transient", errors.New("connection refused"), false},
+	}
+	for _, tc := range cases {
+		if got := amqp.IsPermanent(tc.err); got != tc.want {
+			t.Errorf("%s: IsPermanent = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if amqp.Permanent(nil) != nil {
+		t.Error("Expected Permanent(nil) to be nil")
+	}
+}
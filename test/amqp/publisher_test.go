@@ -0,0 +1,174 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// newOrdersBroker declares the orders exchange with orders_queue bound to order.created
+func newOrdersBroker(t *testing.T, queueArgs amqplib.Table) *amqptest.Broker {
+	fake := amqptest.NewBroker()
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	if err := ch.ExchangeDeclare("orders", "direct", true, false, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare exchange: %v", err)
+	}
+	if _, err := ch.QueueDeclare("orders_queue", true, false, false, false, queueArgs); err != nil {
+		t.Fatalf("Failed to declare queue: %v", err)
+	}
+	if err := ch.QueueBind("orders_queue", "order.created", "orders", false, nil); err != nil {
+		t.Fatalf("Failed to bind queue: %v", err)
+	}
+	return fake
+}
+
+func TestPublisher_Confirmed(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	publisher := amqp.NewPublisher(fake, amqp.DefaultPublisherOptions())
+	defer publisher.Close()
+
+	err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{
+		Headers:    amqplib.Table{"tenant": "acme"},
+		Priority:   5,
+		Expiration: "60000",
+		Body:       []byte(`{"id":1}`),
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	msg := fake.ExpectPublished(t, "orders", "order.created")
+	if msg.MessageId == "" {
+		t.Error("Expected a generated MessageId")
+	}
+	if msg.DeliveryMode != amqplib.Persistent {
+		t.Errorf("Expected persistent delivery mode, got %d", msg.DeliveryMode)
+	}
+	if msg.Headers["tenant"] != "acme" || msg.Priority != 5 || msg.Expiration != "60000" {
+		t.Errorf("Expected headers, priority and expiration to be kept, got %+v", msg.Publishing)
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != 1 {
+		t.Errorf("Expected 1 ready message, got %+v", stats)
+	}
+}
+
+func TestPublisher_Returned(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	publisher := amqp.NewPublisher(fake, amqp.DefaultPublisherOptions())
+	defer publisher.Close()
+
+	err := publisher.Publish(context.Background(), "orders", "order.unknown", amqplib.Publishing{Body: []byte("{}")})
+
+	var returned *amqp.ReturnedError
+	if !errors.As(err, &returned) || returned.ReplyCode != amqplib.NoRoute || returned.RoutingKey != "order.unknown" {
+		t.Fatalf("Expected NO_ROUTE ReturnedError, got %v", err)
+	}
+
+	// The channel stays usable after a return
+	if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); err != nil {
+		t.Errorf("Publish after return failed: %v", err)
+	}
+}
+
+func TestPublisher_NotMandatory(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	opts := amqp.DefaultPublisherOptions()
+	opts.Mandatory = false
+	publisher := amqp.NewPublisher(fake, opts)
+	defer publisher.Close()
+
+	if err := publisher.Publish(context.Background(), "orders", "order.unknown", amqplib.Publishing{}); err != nil {
+		t.Errorf("Expected unroutable message to be accepted without mandatory, got %v", err)
+	}
+}
+
+func TestPublisher_Nacked(t *testing.T) {
+	fake := newOrdersBroker(t, amqplib.Table{"x-max-length": 1, "x-overflow": "reject-publish"})
+	publisher := amqp.NewPublisher(fake, amqp.DefaultPublisherOptions())
+	defer publisher.Close()
+
+	if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); err != nil {
+		t.Fatalf("First publish failed: %v", err)
+	}
+	if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); !errors.Is(err, amqp.ErrPublishNacked) {
+		t.Errorf("Expected ErrPublishNacked for a full queue, got %v", err)
+	}
+}
+
+func TestPublisher_Concurrent(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	publisher := amqp.NewPublisher(fake, amqp.PublisherOptions{PoolSize: 4, Mandatory: true})
+	defer publisher.Close()
+
+	const publishes = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, publishes)
+	for i := 0; i < publishes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{
+				Body: []byte(fmt.Sprintf(`{"id":%d}`, i)),
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Publish failed: %v", err)
+		}
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != publishes {
+		t.Errorf("Expected %d ready messages, got %+v", publishes, stats)
+	}
+}
+
+func TestPublisher_Closed(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	publisher := amqp.NewPublisher(fake, amqp.DefaultPublisherOptions())
+	publisher.Close()
+
+	if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); !errors.Is(err, amqp.ErrPublisherClosed) {
+		t.Errorf("Expected ErrPublisherClosed, got %v", err)
+	}
+}
+
+func TestPublisher_Reconnect(t *testing.T) {
+	fake := newOrdersBroker(t, nil)
+	publisher := amqp.NewPublisher(fake, amqp.PublisherOptions{PoolSize: 2, ConfirmTimeout: time.Second, Mandatory: true})
+	defer publisher.Close()
+
+	// Two pooled channels, both idle when the connection is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); err != nil {
+				t.Errorf("Publish failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	fake.Reconnect()
+
+	// Their raw channels were replaced, without confirm mode: neither is reused
+	for i := 0; i < 2; i++ {
+		if err := publisher.Publish(context.Background(), "orders", "order.created", amqplib.Publishing{}); err != nil {
+			t.Fatalf("Publish %d after the reconnect failed: %v", i+1, err)
+		}
+	}
+	if stats := fake.Stats("orders_queue"); stats.Ready != 4 {
+		t.Errorf("Expected 4 ready messages, got %+v", stats)
+	}
+}
@@ -0,0 +1,147 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// startEchoServer declares rpc_queue and serves it with a handler that upper-cases the body
+func startEchoServer(t *testing.T, fake *amqptest.Broker) {
+	ch, _ := fake.Channel()
+	if _, err := ch.QueueDeclare("rpc_queue", false, false, false, false, nil); err != nil {
+		t.Fatalf("Failed to declare rpc_queue: %v", err)
+	}
+	ch.Close()
+
+	server, err := amqp.NewRPCServer(fake, "rpc_queue", func(ctx context.Context, req amqplib.Delivery) (amqplib.Publishing, error) {
+		if string(req.Body) == "fail" {
+			return amqplib.Publishing{}, errors.New("handler failed")
+		}
+		return amqplib.Publishing{Body: []byte(strings.ToUpper(string(req.Body)))}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create RPC server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve(context.Background())
+}
+
+func newRPCClient(t *testing.T, fake *amqptest.Broker, mode amqp.RPCReplyMode) *amqp.RPCClient {
+	client, err := amqp.NewRPCClient(fake, mode)
+	if err != nil {
+		t.Fatalf("Failed to create RPC client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRPC_Call(t *testing.T) {
+	for _, mode := range []amqp.RPCReplyMode{amqp.RPCReplyDirect, amqp.RPCReplyExclusive} {
+		t.Run(string(mode), func(t *testing.T) {
+			fake := amqptest.NewBroker()
+			startEchoServer(t, fake)
+			client := newRPCClient(t, fake, mode)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			reply, err := client.Call(ctx, "", "rpc_queue", amqplib.Publishing{Body: []byte("ping")})
+			if err != nil {
+				t.Fatalf("Call failed: %v", err)
+			}
+			if string(reply.Body) != "PING" {
+				t.Errorf("Expected PING, got %q", reply.Body)
+			}
+
+			if stats := fake.WaitIdle(t, "rpc_queue"); stats.Acked != 1 {
+				t.Errorf("Expected request to be acked, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestRPC_HandlerError(t *testing.T) {
+	fake := amqptest.NewBroker()
+	startEchoServer(t, fake)
+	client := newRPCClient(t, fake, amqp.RPCReplyDirect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := client.Call(ctx, "", "rpc_queue", amqplib.Publishing{Body: []byte("fail")})
+
+	var rpcErr *amqp.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "handler failed" {
+		t.Fatalf("Expected RPCError \"handler failed\", got %v", err)
+	}
+	if stats := fake.WaitIdle(t, "rpc_queue"); stats.Acked != 1 || stats.Requeued != 0 {
+		t.Errorf("Expected failed request to be acked, not requeued, got %+v", stats)
+	}
+}
+
+func TestRPC_DeadlineWithoutServer(t *testing.T) {
+	fake := amqptest.NewBroker()
+	ch, _ := fake.Channel()
+	ch.QueueDeclare("rpc_queue", false, false, false, false, nil)
+	ch.Close()
+	client := newRPCClient(t, fake, amqp.RPCReplyDirect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Call(ctx, "", "rpc_queue", amqplib.Publishing{Body: []byte("ping")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	published := fake.ExpectPublished(t, "", "rpc_queue")
+	if published.Expiration == "" {
+		t.Error("Expected request expiration to follow the ctx deadline")
+	}
+}
+
+func TestRPCServer_ServeStopsOnCancel(t *testing.T) {
+	fake := amqptest.NewBroker()
+	ch, _ := fake.Channel()
+	ch.QueueDeclare("rpc_queue", false, false, false, false, nil)
+	ch.Close()
+
+	server, err := amqp.NewRPCServer(fake, "rpc_queue", func(ctx context.Context, req amqplib.Delivery) (amqplib.Publishing, error) {
+		return amqplib.Publishing{}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create RPC server: %v", err)
+	}
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after cancellation")
+	}
+}
+
+func TestRPC_CallAfterClose(t *testing.T) {
+	fake := amqptest.NewBroker()
+	client, err := amqp.NewRPCClient(fake, amqp.RPCReplyDirect)
+	if err != nil {
+		t.Fatalf("Failed to create RPC client: %v", err)
+	}
+	client.Close()
+
+	if _, err := client.Call(context.Background(), "", "rpc_queue", amqplib.Publishing{}); !errors.Is(err, amqp.ErrRPCClosed) {
+		t.Errorf("Expected ErrRPCClosed, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+)
+
+// memOffsetStore is an in-memory amqp.OffsetStore
+type memOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[string]int64
+	saves   int
+}
+
+func newMemOffsetStore() *memOffsetStore {
+	return &memOffsetStore{offsets: make(map[string]int64)}
+}
+
+func (s *memOffsetStore) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset, ok := s.offsets[stream+"/"+consumer]
+	return offset, ok, nil
+}
+
+func (s *memOffsetStore) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets[stream+"/"+consumer] = offset
+	s.saves++
+	return nil
+}
+
+func (s *memOffsetStore) offset(stream, consumer string) (int64, bool) {
+	offset, ok, _ := s.LoadOffset(context.Background(), stream, consumer)
+	return offset, ok
+}
+
+const streamTopology = `
+exchanges:
+  - name: user_events
+    type: direct
+queues:
+  - name: user_events_stream
+    type: stream
+bindings:
+  - exchange: user_events
+    queue: user_events_stream
+    routing_key: user.created
+`
+
+// publishUsers appends one user.created event per id to the stream
+func publishUsers(t *testing.T, broker *amqptest.Broker, ids ...int) {
+	for _, id := range ids {
+		body := fmt.Sprintf(`{"id":%d}`, id)
+		if err := broker.Deliver("user_events", "user.created", amqplib.Publishing{MessageId: body, Body: []byte(body)}); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+	}
+}
+
+// runStream runs the consumer until handler has seen want messages, and returns
+// the bodies seen and the error of Run
+func runStream(t *testing.T, consumer *amqp.StreamConsumer, want int, handler func(body string) error) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var seen []string
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.Run(ctx, func(ctx context.Context, d amqplib.Delivery) error {
+			seen = append(seen, string(d.Body))
+			if len(seen) >= want {
+				defer cancel()
+			}
+			if handler != nil {
+				return handler(string(d.Body))
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		return seen, err
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run did not return; seen %v", seen)
+		return nil, nil
+	}
+}
+
+func TestStreamConsumer_StartsAtFirstAndCommits(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2, 3)
+
+	store := newMemOffsetStore()
+	consumer := amqp.NewStreamConsumer(broker, "user_events_stream", "user-directory", store, amqp.StreamConsumerOptions{Start: amqp.OffsetFirst})
+	seen, err := runStream(t, consumer, 3, nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(seen) != 3 || seen[0] != `{"id":1}` {
+		t.Errorf("Expected the whole history, got %v", seen)
+	}
+	if offset, _ := store.offset("user_events_stream", "user-directory"); offset != 3 {
+		t.Errorf("Expected next offset 3 to be committed, got %d", offset)
+	}
+	if stats := broker.Stats("user_events_stream"); stats.Stored != 3 {
+		t.Errorf("Expected the stream to keep its messages, got %+v", stats)
+	}
+}
+
+func TestStreamConsumer_ResumesFromStoredOffset(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2, 3)
+
+	store := newMemOffsetStore()
+	store.SaveOffset(context.Background(), "user_events_stream", "user-directory", 2)
+	consumer := amqp.NewStreamConsumer(broker, "user_events_stream", "user-directory", store, amqp.StreamConsumerOptions{Start: amqp.OffsetFirst})
+	seen, err := runStream(t, consumer, 1, nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != `{"id":3}` {
+		t.Errorf("Expected to resume at offset 2, got %v", seen)
+	}
+}
+
+func TestStreamConsumer_CommitEvery(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2, 3, 4, 5)
+
+	store := newMemOffsetStore()
+	consumer := amqp.NewStreamConsumer(broker, "user_events_stream", "rebuild", store, amqp.StreamConsumerOptions{Start: amqp.OffsetFirst, CommitEvery: 2})
+	if _, err := runStream(t, consumer, 5, nil); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if offset, _ := store.offset("user_events_stream", "rebuild"); offset != 5 {
+		t.Errorf("Expected pending progress to be committed on return, got %d", offset)
+	}
+	if store.saves != 3 {
+		t.Errorf("Expected 3 commits (after 2, 4 and on return), got %d", store.saves)
+	}
+}
+
+func TestStreamConsumer_TransientErrorStopsWithoutCommit(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2, 3)
+
+	store := newMemOffsetStore()
+	consumer := amqp.NewStreamConsumer(broker, "user_events_stream", "user-directory", store, amqp.StreamConsumerOptions{Start: amqp.OffsetFirst})
+	failure := errors.New("database unavailable")
+	_, err := runStream(t, consumer, 3, func(body string) error {
+		if body == `{"id":2}` {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected Run to stop with the handler error, got %v", err)
+	}
+	if offset, _ := store.offset("user_events_stream", "user-directory"); offset != 1 {
+		t.Errorf("Expected offset 1 (the failed message is read again), got %d", offset)
+	}
+}
+
+func TestStreamConsumer_PermanentErrorSkipsMessage(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2, 3)
+
+	store := newMemOffsetStore()
+	consumer := amqp.NewStreamConsumer(broker, "user_events_stream", "user-directory", store, amqp.StreamConsumerOptions{Start: amqp.OffsetFirst})
+	seen, err := runStream(t, consumer, 3, func(body string) error {
+		if body == `{"id":2}` {
+			return amqp.Permanent(errors.New("invalid payload"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected every message to be handled, got %v", seen)
+	}
+	if offset, _ := store.offset("user_events_stream", "user-directory"); offset != 3 {
+		t.Errorf("Expected offset 3, got %d", offset)
+	}
+}
+
+func TestResolveStreamOffset_Timestamp(t *testing.T) {
+	broker := newBrokerWithTopology(t, streamTopology)
+	publishUsers(t, broker, 1, 2)
+	broker.Advance(time.Hour)
+	since := broker.Now()
+	publishUsers(t, broker, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	offset, found, err := amqp.ResolveStreamOffset(ctx, broker, "user_events_stream", amqp.OffsetTimestamp(since))
+	if err != nil || !found {
+		t.Fatalf("ResolveStreamOffset failed: found=%v err=%v", found, err)
+	}
+	if offset != 2 {
+		t.Errorf("Expected offset 2, got %d", offset)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, found, _ := amqp.ResolveStreamOffset(ctx, broker, "user_events_stream", amqp.OffsetTimestamp(since.Add(time.Hour))); found {
+		t.Errorf("Expected no message after the last one")
+	}
+}
+
+func TestParseStreamOffset(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := map[string]amqp.StreamOffset{
+		"first":                amqp.OffsetFirst,
+		"last":                 amqp.OffsetLast,
+		"":                     amqp.OffsetNext,
+		"42":                   amqp.OffsetAt(42),
+		"2025-01-02T03:04:05Z": amqp.OffsetTimestamp(at),
+	}
+	for input, want := range cases {
+		got, err := amqp.ParseStreamOffset(input)
+		if err != nil {
+			t.Errorf("ParseStreamOffset(%q) failed: %v", input, err)
+			continue
+		}
+		if got.String() != want.String() {
+			t.Errorf("ParseStreamOffset(%q) = %s, want %s", input, got, want)
+		}
+	}
+	for _, input := range []string{"-1", "yesterday"} {
+		if _, err := amqp.ParseStreamOffset(input); err == nil {
+			t.Errorf("Expected ParseStreamOffset(%q) to fail", input)
+		}
+	}
+}
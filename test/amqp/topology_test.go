@@ -0,0 +1,193 @@
+package amqp_test
+
+import (
+	"boilerblade/config/amqp"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const orderTopology = `
+exchanges:
+  - name: order_events
+    type: direct
+queues:
+  - name: order_created_queue
+    type: quorum
+    retry:
+      interval: 3000
+bindings:
+  - exchange: order_events
+    queue: order_created_queue
+    routing_key: order.created
+`
+
+const orderProductionTopology = `
+queues:
+  - name: order_created_queue
+    type: quorum
+    retry:
+      interval: 10000
+`
+
+func writeTopologyFile(t *testing.T, dir, name, content string) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write topology file: %v", err)
+	}
+}
+
+func TestLoadTopology_Embedded(t *testing.T) {
+	topology, err := amqp.LoadTopology("", "")
+	if err != nil {
+		t.Fatalf("Failed to load embedded topology: %v", err)
+	}
+
+	if _, ok := topology.Exchange("user_events"); !ok {
+		t.Error("Expected embedded topology to declare user_events")
+	}
+	if _, ok := topology.Queue("user_created_queue"); !ok {
+		t.Error("Expected embedded topology to declare user_created_queue")
+	}
+}
+
+func TestLoadTopology_EnvOverrideAndExpand(t *testing.T) {
+	dir := t.TempDir()
+	writeTopologyFile(t, dir, "order.yaml", orderTopology)
+	writeTopologyFile(t, filepath.Join(dir, "production"), "order.yaml", orderProductionTopology)
+
+	topology, err := amqp.LoadTopology(dir, "production")
+	if err != nil {
+		t.Fatalf("Failed to load topology: %v", err)
+	}
+
+	queue, _ := topology.Queue("order_created_queue")
+	if queue.Retry == nil || queue.Retry.Interval != 10000 {
+		t.Fatalf("Expected production retry interval 10000, got %+v", queue.Retry)
+	}
+
+	expanded := topology.Expand()
+	if _, ok := expanded.Exchange("order_events.retry"); !ok {
+		t.Error("Expected retry exchange order_events.retry")
+	}
+	retryQueue, ok := expanded.Queue("order_created_queue.retry")
+	if !ok {
+		t.Fatal("Expected retry queue order_created_queue.retry")
+	}
+	if retryQueue.MessageTTL != 10000 || retryQueue.DeadLetterExchange != "order_events" || retryQueue.DeadLetterRoutingKey != "order.created" {
+		t.Errorf("Unexpected retry queue: %+v", retryQueue)
+	}
+	primary, _ := expanded.Queue("order_created_queue")
+	if primary.DeadLetterExchange != "order_events.retry" || primary.DeadLetterRoutingKey != "order.created.retry" {
+		t.Errorf("Unexpected primary queue dead-lettering: %+v", primary)
+	}
+}
+
+func TestTopology_Validate(t *testing.T) {
+	topology, err := amqp.ParseTopology([]byte(`
+queues:
+  - name: orphan
+    type: quorum
+bindings:
+  - exchange: missing
+    queue: orphan
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse topology: %v", err)
+	}
+	if err := topology.Validate(); err == nil {
+		t.Error("Expected error for binding to unknown exchange")
+	}
+
+	topology, _ = amqp.ParseTopology([]byte(`
+exchanges:
+  - name: bad
+    type: fanciful
+`))
+	if err := topology.Validate(); err == nil {
+		t.Error("Expected error for invalid exchange type")
+	}
+}
+
+func TestTopology_Route(t *testing.T) {
+	topology, err := amqp.ParseTopology([]byte(`
+exchanges:
+  - name: orders
+    type: topic
+queues:
+  - name: all_orders
+    type: classic
+  - name: paid_orders
+    type: classic
+bindings:
+  - exchange: orders
+    queue: all_orders
+    routing_key: order.#
+  - exchange: orders
+    queue: paid_orders
+    routing_key: order.*.paid
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse topology: %v", err)
+	}
+
+	if got := topology.Route("orders", "order.42.paid"); len(got) != 2 {
+		t.Errorf("Expected both queues, got %v", got)
+	}
+	if got := topology.Route("orders", "order.created"); len(got) != 1 || got[0] != "all_orders" {
+		t.Errorf("Expected [all_orders], got %v", got)
+	}
+	if got := topology.Route("", "paid_orders"); len(got) != 1 || got[0] != "paid_orders" {
+		t.Errorf("Expected default exchange to route by queue name, got %v", got)
+	}
+	if got := topology.Route("orders", "invoice.created"); len(got) != 0 {
+		t.Errorf("Expected no queues, got %v", got)
+	}
+}
+
+func TestTopology_ErrorQueues(t *testing.T) {
+	topology, err := amqp.ParseTopology([]byte(`
+exchanges:
+  - name: orders
+    type: direct
+queues:
+  - name: order_queue
+    type: quorum
+  - name: order_rpc_queue
+    type: classic
+    error_queue: false
+bindings:
+  - exchange: orders
+    queue: order_queue
+    routing_key: order.created
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse topology: %v", err)
+	}
+
+	expanded := topology.Expand()
+	if _, ok := expanded.Queue("order_queue.error"); !ok {
+		t.Error("Expected error queue order_queue.error")
+	}
+	if _, ok := expanded.Queue("order_rpc_queue.error"); ok {
+		t.Error("Expected no error queue when error_queue is false")
+	}
+	if got := topology.Route("", "order_queue.error"); len(got) != 1 {
+		t.Errorf("Expected default exchange to route to the error queue, got %v", got)
+	}
+	if got := topology.Route("", "order_rpc_queue.error"); len(got) != 0 {
+		t.Errorf("Expected no route to a disabled error queue, got %v", got)
+	}
+
+	stream, _ := amqp.ParseTopology([]byte(`
+queues:
+  - name: audit
+    type: stream
+    error_queue: true
+`))
+	if err := stream.Validate(); err == nil {
+		t.Error("Expected error for a stream queue with an error queue")
+	}
+}
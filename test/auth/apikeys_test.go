@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"errors"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := auth.ParseAPIKeys("billing:billing-secret, reporting:report:secret")
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+
+	if service, err := keys.AuthenticateAPIKey("billing-secret"); err != nil || service.Name != "billing" {
+		t.Errorf("AuthenticateAPIKey = %+v, %v, want billing", service, err)
+	}
+	if service, err := keys.AuthenticateAPIKey("report:secret"); err != nil || service.Name != "reporting" {
+		t.Errorf("AuthenticateAPIKey = %+v, %v, want reporting", service, err)
+	}
+	if _, err := keys.AuthenticateAPIKey("billing"); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey, got %v", err)
+	}
+
+	for _, invalid := range []string{"no-key", ":key", "billing:", "billing:a,billing:b"} {
+		if _, err := auth.ParseAPIKeys(invalid); err == nil {
+			t.Errorf("ParseAPIKeys(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestParseAPIKeys_Empty(t *testing.T) {
+	keys, err := auth.ParseAPIKeys("")
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+	if _, err := keys.AuthenticateAPIKey(""); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("Expected no key to be accepted, got %v", err)
+	}
+}
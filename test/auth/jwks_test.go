@@ -0,0 +1,294 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a private key of the identity provider with its kid and alg
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) signingKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return signingKey{kid: kid, method: jwt.SigningMethodRS256, key: key}
+}
+
+func newECKey(t *testing.T, kid string) signingKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	return signingKey{kid: kid, method: jwt.SigningMethodES256, key: key}
+}
+
+func newEd25519Key(t *testing.T, kid string) signingKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	return signingKey{kid: kid, method: jwt.SigningMethodEdDSA, key: key}
+}
+
+// jwk returns the public JWK of k
+func (k signingKey) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig", "alg": "RS256",
+			"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		point, _ := pub.Bytes()
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256",
+			"x": b64(point[1:33]), "y": b64(point[33:])}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": b64(pub)}
+	}
+	return nil
+}
+
+// sign returns a token for user signed with k; an empty kid leaves the header out
+func (k signingKey) sign(t *testing.T, user string) string {
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"sub":     user,
+		"user_id": user,
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func jwksDocument(keys ...signingKey) []byte {
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		doc.Keys = append(doc.Keys, k.jwk())
+	}
+	data, _ := json.Marshal(doc)
+	return data
+}
+
+// provider serves a JWKS whose keys can be rotated, and counts the fetches
+type provider struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []signingKey
+	fail    bool
+	fetches atomic.Int32
+}
+
+func newProvider(t *testing.T, keys ...signingKey) *provider {
+	p := &provider{keys: keys}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwksDocument(p.keys...))
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) rotate(fail bool, keys ...signingKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fail = fail
+	if keys != nil {
+		p.keys = keys
+	}
+}
+
+// startJWKS starts a JWKS on opts until the test ends
+func startJWKS(t *testing.T, opts auth.JWKSOptions) *auth.JWKS {
+	jwks, err := auth.NewJWKS(opts)
+	if err != nil {
+		t.Fatalf("NewJWKS failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := jwks.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	return jwks
+}
+
+// verify parses token with keyring as AuthValidator does
+func verify(keyring *auth.Keyring, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keyring.Keyfunc, jwt.WithValidMethods(keyring.Methods()))
+	return claims, err
+}
+
+func TestJWKS_VerifiesAsymmetricAlgorithms(t *testing.T) {
+	keys := []signingKey{newRSAKey(t, "rsa-1"), newECKey(t, "ec-1"), newEd25519Key(t, "ed-1")}
+	p := newProvider(t, keys...)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL}))
+
+	for _, k := range keys {
+		claims, err := verify(keyring, k.sign(t, "42"))
+		if err != nil {
+			t.Errorf("%s token rejected: %v", k.method.Alg(), err)
+			continue
+		}
+		if claims["sub"] != "42" {
+			t.Errorf("%s token: unexpected claims %v", k.method.Alg(), claims)
+		}
+	}
+}
+
+func TestJWKS_RejectsWrongKey(t *testing.T) {
+	trusted := newRSAKey(t, "rsa-1")
+	p := newProvider(t, trusted)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL}))
+
+	forged := newRSAKey(t, "rsa-1")
+	if _, err := verify(keyring, forged.sign(t, "42")); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+
+	// kid names an RSA key, but the token claims ES256
+	ec := newECKey(t, "rsa-1")
+	if _, err := verify(keyring, ec.sign(t, "42")); !errors.Is(err, auth.ErrUnsupportedAlgorithm) {
+		t.Errorf("Expected ErrUnsupportedAlgorithm for an alg the key cannot verify, got %v", err)
+	}
+}
+
+func TestJWKS_TokenWithoutKid(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	p := newProvider(t, rsaKey)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL}))
+
+	rsaKey.kid = ""
+	if _, err := verify(keyring, rsaKey.sign(t, "42")); err != nil {
+		t.Errorf("Expected a token without kid to use the only RS256 key, got %v", err)
+	}
+
+	p.rotate(false, newRSAKey(t, "rsa-1"), newRSAKey(t, "rsa-2"))
+	keyring.JWKS().Refresh(context.Background())
+	if _, err := verify(keyring, rsaKey.sign(t, "42")); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey with several candidate keys, got %v", err)
+	}
+}
+
+func TestJWKS_UnknownKidRefreshesOnce(t *testing.T) {
+	oldKey, newKey := newRSAKey(t, "2024"), newRSAKey(t, "2025")
+	p := newProvider(t, oldKey)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL, MinRefresh: time.Nanosecond}))
+
+	// The provider rotates its keys and signs with the new one
+	p.rotate(false, oldKey, newKey)
+	if _, err := verify(keyring, newKey.sign(t, "42")); err != nil {
+		t.Fatalf("Expected the new kid to be fetched, got %v", err)
+	}
+	if got := p.fetches.Load(); got != 2 {
+		t.Errorf("Expected 2 fetches, got %d", got)
+	}
+}
+
+func TestJWKS_UnknownKidRefreshIsRateLimited(t *testing.T) {
+	p := newProvider(t, newRSAKey(t, "rsa-1"))
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL, MinRefresh: time.Hour}))
+
+	random := newRSAKey(t, "random")
+	for i := 0; i < 5; i++ {
+		if _, err := verify(keyring, random.sign(t, "42")); !errors.Is(err, auth.ErrUnknownKey) {
+			t.Fatalf("Expected ErrUnknownKey, got %v", err)
+		}
+	}
+	if got := p.fetches.Load(); got != 1 {
+		t.Errorf("Expected unknown kids not to refetch within MinRefresh, got %d fetches", got)
+	}
+}
+
+func TestJWKS_BackgroundRefresh(t *testing.T) {
+	oldKey, newKey := newECKey(t, "old"), newECKey(t, "new")
+	p := newProvider(t, oldKey)
+	jwks := startJWKS(t, auth.JWKSOptions{URL: p.URL, Refresh: 10 * time.Millisecond, MinRefresh: time.Hour})
+
+	p.rotate(false, newKey)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		kids := jwks.Kids()
+		if len(kids) == 1 && kids[0] == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the background refresh to pick up the new key, got %v", kids)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJWKS_KeepsKeysWhenRefreshFails(t *testing.T) {
+	k := newEd25519Key(t, "ed-1")
+	p := newProvider(t, k)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL}))
+
+	p.rotate(true)
+	if err := keyring.JWKS().Refresh(context.Background()); err == nil {
+		t.Fatal("Expected the refresh to fail")
+	}
+	if _, err := verify(keyring, k.sign(t, "42")); err != nil {
+		t.Errorf("Expected the cached key to keep verifying, got %v", err)
+	}
+}
+
+func TestJWKS_File(t *testing.T) {
+	k := newRSAKey(t, "file-1")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwksDocument(k), 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{File: file}))
+
+	if _, err := verify(keyring, k.sign(t, "42")); err != nil {
+		t.Errorf("Expected a token verified with the JWKS file, got %v", err)
+	}
+}
+
+func TestNewJWKS_RequiresOneSource(t *testing.T) {
+	if _, err := auth.NewJWKS(auth.JWKSOptions{}); err == nil {
+		t.Error("Expected an error without URL and File")
+	}
+	if _, err := auth.NewJWKS(auth.JWKSOptions{URL: "http://idp", File: "jwks.json"}); err == nil {
+		t.Error("Expected an error with both URL and File")
+	}
+}
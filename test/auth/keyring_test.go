@@ -0,0 +1,92 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacToken returns an HS256 token signed with secret, with kid unless empty
+func hmacToken(t *testing.T, kid, secret string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "42",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestParseHMACKeys(t *testing.T) {
+	keys, err := auth.ParseHMACKeys("v1:first-secret, v2:second:secret")
+	if err != nil {
+		t.Fatalf("ParseHMACKeys failed: %v", err)
+	}
+	if string(keys["v1"]) != "first-secret" || string(keys["v2"]) != "second:secret" {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	for _, invalid := range []string{"no-secret", ":secret", "v1:", "v1:a,v1:b"} {
+		if _, err := auth.ParseHMACKeys(invalid); err == nil {
+			t.Errorf("ParseHMACKeys(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestKeyring_HMACRotation(t *testing.T) {
+	keyring := auth.NewKeyring(map[string][]byte{
+		"":   []byte("app-key"),
+		"v2": []byte("rotated-key"),
+	}, nil)
+
+	// Sessions issued before the rotation (no kid, APP_KEY) keep working
+	if _, err := verify(keyring, hmacToken(t, "", "app-key")); err != nil {
+		t.Errorf("Token without kid rejected: %v", err)
+	}
+	if _, err := verify(keyring, hmacToken(t, "v2", "rotated-key")); err != nil {
+		t.Errorf("Token with kid v2 rejected: %v", err)
+	}
+
+	if _, err := verify(keyring, hmacToken(t, "v2", "app-key")); err == nil {
+		t.Error("Expected a token signed with another key than its kid to be rejected")
+	}
+	if _, err := verify(keyring, hmacToken(t, "v3", "rotated-key")); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for an unknown kid, got %v", err)
+	}
+}
+
+func TestKeyring_RejectsAsymmetricWithoutJWKS(t *testing.T) {
+	keyring := auth.NewKeyring(map[string][]byte{"": []byte("app-key")}, nil)
+
+	if _, err := verify(keyring, newRSAKey(t, "rsa-1").sign(t, "42")); err == nil {
+		t.Error("Expected an RS256 token to be rejected without JWKS")
+	}
+}
+
+func TestKeyring_RejectsPublicKeyAsHMACSecret(t *testing.T) {
+	k := newEd25519Key(t, "ed-1")
+	p := newProvider(t, k)
+	keyring := auth.NewKeyring(nil, startJWKS(t, auth.JWKSOptions{URL: p.URL}))
+
+	// An attacker signs HS256 with the published public key under its kid
+	if _, err := verify(keyring, hmacToken(t, "ed-1", k.jwk()["x"])); err == nil {
+		t.Error("Expected an HS256 token to be rejected when only the JWKS is configured")
+	}
+}
+
+func TestKeyring_Methods(t *testing.T) {
+	if methods := auth.NewKeyring(map[string][]byte{"": []byte("app-key")}, nil).Methods(); len(methods) != 3 {
+		t.Errorf("Expected the HMAC algorithms only, got %v", methods)
+	}
+	if methods := auth.NewKeyring(nil, nil).Methods(); len(methods) != 0 {
+		t.Errorf("Expected no algorithm for an empty keyring, got %v", methods)
+	}
+}
@@ -0,0 +1,115 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newLockout returns a lockout of 3 failures within a minute locking for 15
+// minutes, on an in-process Redis whose clock the test moves with FastForward
+func newLockout(t *testing.T) (*auth.RedisLockout, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return auth.NewRedisLockout(client, auth.LockoutOptions{
+		MaxAttempts: 3,
+		Window:      time.Minute,
+		Duration:    15 * time.Minute,
+	}), server
+}
+
+// fail records n failed logins of email and returns the lock of the last one
+func fail(t *testing.T, lockout *auth.RedisLockout, email string, n int) time.Duration {
+	t.Helper()
+	var locked time.Duration
+	for i := 0; i < n; i++ {
+		var err error
+		if locked, err = lockout.Fail(context.Background(), email); err != nil {
+			t.Fatalf("Fail failed: %v", err)
+		}
+	}
+	return locked
+}
+
+func lockedFor(t *testing.T, lockout *auth.RedisLockout, email string) time.Duration {
+	t.Helper()
+	locked, err := lockout.Locked(context.Background(), email)
+	if err != nil {
+		t.Fatalf("Locked failed: %v", err)
+	}
+	return locked
+}
+
+func TestRedisLockout_LocksAfterMaxAttempts(t *testing.T) {
+	lockout, server := newLockout(t)
+
+	if locked := fail(t, lockout, "john@example.com", 2); locked != 0 || lockedFor(t, lockout, "john@example.com") != 0 {
+		t.Fatalf("Expected no lock below the limit, got %s", locked)
+	}
+	// Emails are matched like logins: case and spaces do not split the count
+	if locked := fail(t, lockout, " John@Example.com", 1); locked != 15*time.Minute {
+		t.Fatalf("Expected the third failure to lock for 15m, got %s", locked)
+	}
+	if locked := lockedFor(t, lockout, "JOHN@example.com"); locked != 15*time.Minute {
+		t.Errorf("Expected the account to be locked for 15m, got %s", locked)
+	}
+	if server.Exists(auth.LoginFailuresKeyPrefix + "john@example.com") {
+		t.Error("Expected the lock to clear the failure counter")
+	}
+	if lockedFor(t, lockout, "jane@example.com") != 0 {
+		t.Error("Expected other accounts to stay unlocked")
+	}
+
+	server.FastForward(10 * time.Minute)
+	if locked := lockedFor(t, lockout, "john@example.com"); locked != 5*time.Minute {
+		t.Errorf("Expected 5m left, got %s", locked)
+	}
+	server.FastForward(5 * time.Minute)
+	if locked := lockedFor(t, lockout, "john@example.com"); locked != 0 {
+		t.Errorf("Expected the lock to expire, got %s", locked)
+	}
+}
+
+func TestRedisLockout_WindowExpires(t *testing.T) {
+	lockout, server := newLockout(t)
+
+	fail(t, lockout, "john@example.com", 2)
+	if ttl := server.TTL(auth.LoginFailuresKeyPrefix + "john@example.com"); ttl != time.Minute {
+		t.Errorf("Expected the window to start at the first failure, got a TTL of %s", ttl)
+	}
+	server.FastForward(time.Minute)
+
+	// The window started by the first failure is over: counting starts again
+	if locked := fail(t, lockout, "john@example.com", 2); locked != 0 {
+		t.Errorf("Expected failures of an expired window not to count, got a lock of %s", locked)
+	}
+	if locked := fail(t, lockout, "john@example.com", 1); locked != 15*time.Minute {
+		t.Errorf("Expected 3 failures within the new window to lock, got %s", locked)
+	}
+}
+
+func TestRedisLockout_Reset(t *testing.T) {
+	lockout, _ := newLockout(t)
+	ctx := context.Background()
+
+	fail(t, lockout, "john@example.com", 2)
+	if err := lockout.Reset(ctx, "John@example.com"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if locked := fail(t, lockout, "john@example.com", 2); locked != 0 {
+		t.Errorf("Expected the reset to clear the failures, got a lock of %s", locked)
+	}
+
+	fail(t, lockout, "john@example.com", 1)
+	if err := lockout.Reset(ctx, "john@example.com"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if locked := lockedFor(t, lockout, "john@example.com"); locked != 0 {
+		t.Errorf("Expected the reset to unlock the account, got %s", locked)
+	}
+}
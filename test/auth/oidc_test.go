@@ -0,0 +1,320 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcClientID     = "boilerblade"
+	oidcClientSecret = "client-secret"
+	oidcRedirectURL  = "http://app.test/api/v1/auth/oidc/callback"
+)
+
+// oidcAuthorization is a code issued by the mock provider
+type oidcAuthorization struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+// mockOIDCProvider is a minimal OpenID Connect provider: discovery, an
+// authorization endpoint that logs the user in at once, a token endpoint
+// checking PKCE and the client secret, and its JWKS
+type mockOIDCProvider struct {
+	*httptest.Server
+	key signingKey
+
+	mu       sync.Mutex
+	codes    map[string]oidcAuthorization
+	issuer   string                 // issuer of the discovery document, default the server URL
+	claims   map[string]interface{} // set on (or, when nil, removed from) the next ID tokens
+	lastForm url.Values
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	p := &mockOIDCProvider{key: newRSAKey(t, "oidc-1"), codes: map[string]oidcAuthorization{}, claims: map[string]interface{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwksDocument(p.key))
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	issuer := p.issuer
+	p.mu.Unlock()
+	if issuer == "" {
+		issuer = p.URL
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                           issuer,
+		"authorization_endpoint":           p.URL + "/authorize",
+		"token_endpoint":                   p.URL + "/token",
+		"jwks_uri":                         p.URL + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+func (p *mockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != oidcClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code, _ := auth.NewOIDCNonce()
+	p.mu.Lock()
+	p.codes[code] = oidcAuthorization{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+	http.Redirect(w, r, query.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastForm = r.PostForm
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != oidcClientID || secret != oidcClientSecret {
+		fail("invalid_client")
+		return
+	}
+	authz, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code")) // codes are single-use
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != authz.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != authz.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.URL,
+		"sub":            "user-1",
+		"aud":            oidcClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          authz.nonce,
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+	for name, value := range p.claims {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	token := jwt.NewWithClaims(p.key.method, claims)
+	token.Header["kid"] = p.key.kid
+	idToken, _ := token.SignedString(p.key.key)
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "provider-token", "token_type": "Bearer", "id_token": idToken})
+}
+
+// setClaims sets claims on the next ID tokens
+func (p *mockOIDCProvider) setClaims(claims map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+func newOIDCProvider(t *testing.T, issuer string) *auth.OIDCProvider {
+	provider, err := auth.NewOIDCProvider(auth.OIDCOptions{
+		Issuer:       issuer,
+		ClientID:     oidcClientID,
+		ClientSecret: oidcClientSecret,
+		RedirectURL:  oidcRedirectURL,
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider failed: %v", err)
+	}
+	return provider
+}
+
+// oidcLogin runs the browser part of a login: it follows the authorization URL
+// and returns the code and state of the redirect to the callback, and the
+// code verifier and nonce of the login
+func oidcLogin(t *testing.T, provider *auth.OIDCProvider) (code, state, codeVerifier, nonce string) {
+	codeVerifier, _ = auth.NewPKCEVerifier()
+	nonce, _ = auth.NewOIDCNonce()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", nonce, auth.PKCEChallenge(codeVerifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), oidcRedirectURL) {
+		t.Fatalf("Expected a redirect to the callback, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query().Get("code"), location.Query().Get("state"), codeVerifier, nonce
+}
+
+func TestOIDCProvider_LoginFlow(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider := newOIDCProvider(t, p.URL+"/")
+
+	code, state, codeVerifier, nonce := oidcLogin(t, provider)
+	if state != "state-1" || code == "" {
+		t.Fatalf("Expected a code and the state back, got code %q state %q", code, state)
+	}
+
+	identity, err := provider.Exchange(context.Background(), code, codeVerifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	want := auth.OIDCIdentity{Issuer: p.URL, Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+	if *identity != want {
+		t.Errorf("Expected %+v, got %+v", want, *identity)
+	}
+	if p.lastForm.Get("client_id") != "" {
+		t.Error("Expected a confidential client to authenticate with basic auth only")
+	}
+
+	if _, err := provider.Exchange(context.Background(), code, codeVerifier, nonce); !errors.Is(err, auth.ErrOIDCExchange) {
+		t.Errorf("Expected a used code to be refused, got %v", err)
+	}
+}
+
+func TestOIDCProvider_AuthCodeURL(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider := newOIDCProvider(t, p.URL)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", auth.PKCEChallenge("verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             oidcClientID,
+		"redirect_uri":          oidcRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        auth.PKCEChallenge("verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestOIDCProvider_ExchangeRequiresCodeVerifier(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider := newOIDCProvider(t, p.URL)
+
+	code, _, _, nonce := oidcLogin(t, provider)
+	other, _ := auth.NewPKCEVerifier()
+	if _, err := provider.Exchange(context.Background(), code, other, nonce); !errors.Is(err, auth.ErrOIDCExchange) {
+		t.Errorf("Expected another code verifier to be refused, got %v", err)
+	}
+}
+
+func TestOIDCProvider_ValidatesIDToken(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider := newOIDCProvider(t, p.URL)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{"another nonce", map[string]interface{}{"nonce": "replayed"}},
+		{"no nonce", map[string]interface{}{"nonce": nil}},
+		{"another audience", map[string]interface{}{"aud": "other-client"}},
+		{"another issuer", map[string]interface{}{"iss": "https://evil.example.com"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"no subject", map[string]interface{}{"sub": nil}},
+		{"another authorized party", map[string]interface{}{"aud": []string{oidcClientID, "other-client"}, "azp": "other-client"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.setClaims(tt.claims)
+			code, _, codeVerifier, nonce := oidcLogin(t, provider)
+			if _, err := provider.Exchange(context.Background(), code, codeVerifier, nonce); !errors.Is(err, auth.ErrOIDCInvalidIDToken) {
+				t.Errorf("Expected ErrOIDCInvalidIDToken, got %v", err)
+			}
+		})
+	}
+
+	p.setClaims(map[string]interface{}{"aud": []string{oidcClientID, "other-client"}, "azp": oidcClientID, "email_verified": "true"})
+	code, _, codeVerifier, nonce := oidcLogin(t, provider)
+	identity, err := provider.Exchange(context.Background(), code, codeVerifier, nonce)
+	if err != nil || !identity.EmailVerified {
+		t.Errorf("Expected a token for several audiences with azp to pass, got %+v %v", identity, err)
+	}
+}
+
+func TestOIDCProvider_Discovery(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider := newOIDCProvider(t, p.URL)
+
+	p.mu.Lock()
+	p.issuer = "https://evil.example.com"
+	p.mu.Unlock()
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); !errors.Is(err, auth.ErrOIDCDiscovery) {
+		t.Fatalf("Expected an issuer mismatch to fail discovery, got %v", err)
+	}
+
+	// A failed discovery is retried on the next use
+	p.mu.Lock()
+	p.issuer = ""
+	p.mu.Unlock()
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err != nil {
+		t.Errorf("Expected discovery to succeed once fixed, got %v", err)
+	}
+}
+
+func TestNewOIDCProvider_RequiresClient(t *testing.T) {
+	if _, err := auth.NewOIDCProvider(auth.OIDCOptions{Issuer: "https://idp.example.com"}); err == nil {
+		t.Error("Expected an error without client ID and redirect URL")
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil || len(verifier) != 43 {
+		t.Fatalf("Expected a 43 character verifier, got %q %v", verifier, err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if got := auth.PKCEChallenge(verifier); got != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected challenge %q", got)
+	}
+}
@@ -0,0 +1,241 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memoryRevocationStore is an in-memory RevocationStore shared by "instances",
+// counting lookups and notifying listeners like the Redis store
+type memoryRevocationStore struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	users     map[string]time.Time
+	lookups   int
+	err       error
+	listeners []func(key string)
+}
+
+func newMemoryRevocationStore() *memoryRevocationStore {
+	return &memoryRevocationStore{tokens: map[string]time.Time{}, users: map[string]time.Time{}}
+}
+
+func (s *memoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	s.tokens[jti] = expiresAt
+	s.mu.Unlock()
+	s.notify("jti:" + jti)
+	return nil
+}
+
+func (s *memoryRevocationStore) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	s.mu.Lock()
+	s.users[userID] = before
+	s.mu.Unlock()
+	s.notify("user:" + userID)
+	return nil
+}
+
+func (s *memoryRevocationStore) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	_, ok := s.tokens[jti]
+	return ok, s.err
+}
+
+func (s *memoryRevocationStore) UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	return s.users[userID], s.err
+}
+
+func (s *memoryRevocationStore) Listen(ctx context.Context, invalidate func(key string)) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, invalidate)
+	s.mu.Unlock()
+}
+
+func (s *memoryRevocationStore) notify(key string) {
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+	for _, invalidate := range listeners {
+		invalidate(key)
+	}
+}
+
+// startRevocations starts an instance on store and waits for it to listen
+func startRevocations(t *testing.T, store *memoryRevocationStore, opts auth.RevocationOptions) *auth.Revocations {
+	revocations := auth.NewRevocations(store, opts)
+	store.mu.Lock()
+	listening := len(store.listeners)
+	store.mu.Unlock()
+	revocations.Start(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		n := len(store.listeners)
+		store.mu.Unlock()
+		if n > listening {
+			return revocations
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Revocations did not start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// localToken returns a token of this app, its claims as decoded from a token
+// (numbers as float64)
+func localToken(userID, jti string, issuedAt time.Time) *auth.Token {
+	return &auth.Token{Claims: jwt.MapClaims{
+		"user_id": userID,
+		"jti":     jti,
+		"iat":     float64(issuedAt.Unix()),
+		"exp":     float64(issuedAt.Add(15 * time.Minute).Unix()),
+	}, Local: true}
+}
+
+func isRevoked(err error) bool {
+	var verr *auth.ValidationError
+	return errors.As(err, &verr) && verr.Reason == auth.ReasonRevoked
+}
+
+func TestRevocations_RevokeToken(t *testing.T) {
+	store := newMemoryRevocationStore()
+	revocations := auth.NewRevocations(store, auth.RevocationOptions{})
+	ctx := context.Background()
+	token := localToken("1", "token-1", time.Now())
+
+	if err := revocations.Check(ctx, token); err != nil {
+		t.Fatalf("Expected a fresh token to pass, got %v", err)
+	}
+	if err := revocations.RevokeToken(ctx, "token-1", time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	err := revocations.Check(ctx, token)
+	if !isRevoked(err) || err.Error() != "token revoked" {
+		t.Errorf("Expected the revoked token to be rejected, got %v", err)
+	}
+	if err := revocations.Check(ctx, localToken("1", "token-2", time.Now())); err != nil {
+		t.Errorf("Expected another token to pass, got %v", err)
+	}
+}
+
+func TestRevocations_RevokeUserTokens(t *testing.T) {
+	store := newMemoryRevocationStore()
+	revocations := auth.NewRevocations(store, auth.RevocationOptions{})
+	ctx := context.Background()
+	old := localToken("1", "old", time.Now().Add(-time.Minute))
+	revokedAt := time.Now()
+	sameSecond := localToken("1", "same-second", revokedAt)
+
+	if err := revocations.RevokeUserTokens(ctx, "1", revokedAt); err != nil {
+		t.Fatalf("RevokeUserTokens failed: %v", err)
+	}
+	if err := revocations.Check(ctx, old); !isRevoked(err) {
+		t.Errorf("Expected a token issued before the watermark to be rejected, got %v", err)
+	}
+	// iat has second precision: the watermark is rounded up, so a token issued
+	// earlier in the same second is rejected
+	if err := revocations.Check(ctx, sameSecond); !isRevoked(err) {
+		t.Errorf("Expected a token issued in the second of the revocation to be rejected, got %v", err)
+	}
+	// RevokeUserTokens returned after the watermark: a login right after it passes
+	if err := revocations.Check(ctx, localToken("1", "new", time.Now())); err != nil {
+		t.Errorf("Expected a token issued after the watermark to pass, got %v", err)
+	}
+	if err := revocations.Check(ctx, &auth.Token{Claims: jwt.MapClaims{"sub": "1", "exp": float64(time.Now().Add(time.Minute).Unix())}, Local: true}); !isRevoked(err) {
+		t.Errorf("Expected a token without iat to be rejected, got %v", err)
+	}
+	if err := revocations.Check(ctx, localToken("2", "other", time.Now().Add(-time.Minute))); err != nil {
+		t.Errorf("Expected a token of another user to pass, got %v", err)
+	}
+
+	// The sub of an identity provider is not a local user ID
+	external := &auth.Token{Claims: jwt.MapClaims{
+		"iss": "https://idp.example.com",
+		"sub": "1",
+		"iat": float64(time.Now().Add(-time.Minute).Unix()),
+	}}
+	if err := revocations.Check(ctx, external); err != nil {
+		t.Errorf("Expected the watermark of user 1 to leave the identity provider's user 1 alone, got %v", err)
+	}
+	if err := revocations.RevokeUserTokens(ctx, "https://idp.example.com#1", time.Now()); err != nil {
+		t.Fatalf("RevokeUserTokens failed: %v", err)
+	}
+	if err := revocations.Check(ctx, external); !isRevoked(err) {
+		t.Errorf("Expected the watermark of the external subject to apply, got %v", err)
+	}
+}
+
+func TestRevocations_CachesLookups(t *testing.T) {
+	store := newMemoryRevocationStore()
+	revocations := auth.NewRevocations(store, auth.RevocationOptions{CacheTTL: time.Minute})
+	ctx := context.Background()
+	token := localToken("1", "token-1", time.Now())
+
+	for i := 0; i < 3; i++ {
+		if err := revocations.Check(ctx, token); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+	if store.lookups != 2 {
+		t.Errorf("Expected one jti and one user lookup, got %d", store.lookups)
+	}
+}
+
+func TestRevocations_InvalidatedByOtherInstances(t *testing.T) {
+	store := newMemoryRevocationStore()
+	first := startRevocations(t, store, auth.RevocationOptions{CacheTTL: time.Hour})
+	second := startRevocations(t, store, auth.RevocationOptions{CacheTTL: time.Hour})
+	ctx := context.Background()
+	token := localToken("1", "token-1", time.Now().Add(-time.Minute))
+
+	// Both instances cache the token as valid
+	for _, revocations := range []*auth.Revocations{first, second} {
+		if err := revocations.Check(ctx, token); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+
+	if err := first.RevokeToken(ctx, "token-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if err := second.Check(ctx, token); !isRevoked(err) {
+		t.Errorf("Expected the other instance to see the revoked jti, got %v", err)
+	}
+
+	other := localToken("2", "token-2", time.Now().Add(-time.Minute))
+	second.Check(ctx, other)
+	if err := first.RevokeUserTokens(ctx, "2", time.Now()); err != nil {
+		t.Fatalf("RevokeUserTokens failed: %v", err)
+	}
+	if err := second.Check(ctx, other); !isRevoked(err) {
+		t.Errorf("Expected the other instance to see the watermark, got %v", err)
+	}
+}
+
+func TestRevocations_StoreError(t *testing.T) {
+	store := newMemoryRevocationStore()
+	store.err = errors.New("redis down")
+	ctx := context.Background()
+	token := localToken("1", "token-1", time.Now())
+
+	err := auth.NewRevocations(store, auth.RevocationOptions{}).Check(ctx, token)
+	if err == nil || isRevoked(err) {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+	if err := auth.NewRevocations(store, auth.RevocationOptions{FailOpen: true}).Check(ctx, token); err != nil {
+		t.Errorf("Expected the token to pass when failing open, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package auth_test
+
+import (
+	"boilerblade/config/auth"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const verifierKey = "verifier-key"
+
+// claimsToken returns an HS256 token with claims, signed with verifierKey
+func claimsToken(t *testing.T, claims jwt.MapClaims) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(verifierKey))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// validClaims returns claims every check below accepts
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub": "42",
+		"iss": "https://idp.example.com",
+		"aud": []string{"boilerblade", "other-api"},
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+}
+
+func newVerifier(opts auth.ClaimsOptions) *auth.Verifier {
+	return auth.NewVerifier(auth.NewKeyring(map[string][]byte{"": []byte(verifierKey)}, nil), opts)
+}
+
+func strictOptions() auth.ClaimsOptions {
+	return auth.ClaimsOptions{
+		Issuers:   []string{"https://idp.example.com"},
+		Audiences: []string{"boilerblade"},
+		Leeway:    5 * time.Second,
+		MaxAge:    time.Hour,
+		Required:  []string{"exp", "sub"},
+	}
+}
+
+func TestVerifier_AcceptsValidToken(t *testing.T) {
+	claims, err := newVerifier(strictOptions()).Verify(claimsToken(t, validClaims()))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims["sub"] != "42" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+}
+
+func TestVerifier_RejectionReasons(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		edit   func(jwt.MapClaims)
+		token  string
+		reason string
+		detail string
+	}{
+		{name: "other issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, reason: auth.ReasonInvalidIssuer},
+		{name: "no issuer", edit: func(c jwt.MapClaims) { delete(c, "iss") }, reason: auth.ReasonInvalidIssuer},
+		{name: "other audience", edit: func(c jwt.MapClaims) { c["aud"] = "billing-api" }, reason: auth.ReasonInvalidAudience},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }, reason: auth.ReasonExpired},
+		{name: "not yet valid", edit: func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() }, reason: auth.ReasonNotYetValid},
+		{name: "issued in the future", edit: func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() }, reason: auth.ReasonIssuedInFuture},
+		{name: "too old", edit: func(c jwt.MapClaims) { c["iat"] = now.Add(-2 * time.Hour).Unix() }, reason: auth.ReasonTooOld},
+		{name: "no exp", edit: func(c jwt.MapClaims) { delete(c, "exp") }, reason: auth.ReasonMissingClaim, detail: "exp"},
+		{name: "no subject", edit: func(c jwt.MapClaims) { delete(c, "sub") }, reason: auth.ReasonMissingClaim, detail: "sub or user_id"},
+		{name: "no iat with max age", edit: func(c jwt.MapClaims) { delete(c, "iat") }, reason: auth.ReasonMissingClaim, detail: "iat"},
+		{name: "malformed", token: "not-a-jwt", reason: auth.ReasonMalformed},
+	}
+
+	verifier := newVerifier(strictOptions())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				claims := validClaims()
+				tt.edit(claims)
+				token = claimsToken(t, claims)
+			}
+
+			_, err := verifier.Verify(token)
+			var verr *auth.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if verr.Reason != tt.reason || verr.Detail != tt.detail {
+				t.Errorf("Got reason %q (%q), want %q (%q)", verr.Reason, verr.Detail, tt.reason, tt.detail)
+			}
+			if strings.Contains(verr.Error(), token) {
+				t.Errorf("Error message contains the token: %q", verr.Error())
+			}
+		})
+	}
+}
+
+func TestVerifier_SignatureReasons(t *testing.T) {
+	verifier := newVerifier(auth.DefaultClaimsOptions())
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("other-key"))
+	if _, err := verifier.Verify(forged); !hasReason(err, auth.ReasonInvalidSignature) {
+		t.Errorf("Expected invalid_signature, got %v", err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	unknown.Header["kid"] = "v9"
+	signed, _ := unknown.SignedString([]byte(verifierKey))
+	if _, err := verifier.Verify(signed); !hasReason(err, auth.ReasonUnknownKey) {
+		t.Errorf("Expected unknown_key, got %v", err)
+	}
+
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := verifier.Verify(none); !hasReason(err, auth.ReasonUnsupportedAlgorithm) {
+		t.Errorf("Expected unsupported_algorithm for alg none, got %v", err)
+	}
+
+	rsaToken := newRSAKey(t, "rsa-1").sign(t, "42")
+	var verr *auth.ValidationError
+	if _, err := verifier.Verify(rsaToken); !errors.As(err, &verr) || verr.Reason != auth.ReasonUnsupportedAlgorithm || verr.Alg != "RS256" || verr.Kid != "rsa-1" {
+		t.Errorf("Expected unsupported_algorithm with alg and kid, got %+v", verr)
+	}
+}
+
+func TestVerifier_Leeway(t *testing.T) {
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-2 * time.Second).Unix()
+	token := claimsToken(t, claims)
+
+	if _, err := newVerifier(strictOptions()).Verify(token); err != nil {
+		t.Errorf("Expected a token expired within the leeway to be accepted, got %v", err)
+	}
+	if _, err := newVerifier(auth.ClaimsOptions{}).Verify(token); !hasReason(err, auth.ReasonExpired) {
+		t.Errorf("Expected expired without leeway, got %v", err)
+	}
+}
+
+func TestVerifier_UserIDSatisfiesSubject(t *testing.T) {
+	claims := validClaims()
+	delete(claims, "sub")
+	claims["user_id"] = "42"
+
+	if _, err := newVerifier(auth.DefaultClaimsOptions()).Verify(claimsToken(t, claims)); err != nil {
+		t.Errorf("Expected user_id to satisfy the subject requirement, got %v", err)
+	}
+}
+
+func TestVerifier_TokenOrigin(t *testing.T) {
+	k := newEd25519Key(t, "idp-1")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwksDocument(k), 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	keyring := auth.NewKeyring(map[string][]byte{"": []byte(verifierKey)}, startJWKS(t, auth.JWKSOptions{File: file}))
+	external := jwt.NewWithClaims(k.method, validClaims())
+	external.Header["kid"] = k.kid
+	externalToken, _ := external.SignedString(k.key)
+
+	local, err := auth.NewVerifier(keyring, auth.DefaultClaimsOptions()).VerifyToken(claimsToken(t, validClaims()))
+	if err != nil || !local.Local || !local.Trusted || local.UserID() != "42" || local.Subject() != "42" {
+		t.Errorf("Expected a trusted local token of user 42, got %+v, %v", local, err)
+	}
+
+	provider, err := auth.NewVerifier(keyring, auth.DefaultClaimsOptions()).VerifyToken(externalToken)
+	if err != nil || provider.Local || provider.Trusted || provider.UserID() != "" || provider.Subject() != "https://idp.example.com#42" {
+		t.Errorf("Expected an untrusted identity provider token of https://idp.example.com#42, got %+v, %v", provider, err)
+	}
+
+	opts := auth.DefaultClaimsOptions()
+	opts.TrustedIssuers = []string{"https://idp.example.com"}
+	trusted, err := auth.NewVerifier(keyring, opts).VerifyToken(externalToken)
+	if err != nil || trusted.Local || !trusted.Trusted || trusted.UserID() != "" {
+		t.Errorf("Expected a trusted identity provider token without local user, got %+v, %v", trusted, err)
+	}
+}
+
+func TestParseRequiredClaims(t *testing.T) {
+	claims, err := auth.ParseRequiredClaims("exp, sub,jti")
+	if err != nil || strings.Join(claims, ",") != "exp,sub,jti" {
+		t.Errorf("ParseRequiredClaims = %v, %v", claims, err)
+	}
+	if _, err := auth.ParseRequiredClaims("exp,role"); err == nil {
+		t.Error("Expected an error for an unsupported claim")
+	}
+}
+
+func hasReason(err error, reason string) bool {
+	var verr *auth.ValidationError
+	return errors.As(err, &verr) && verr.Reason == reason
+}
@@ -0,0 +1,356 @@
+package broker_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/broker"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	amqplib "github.com/streadway/amqp"
+)
+
+// ordersTopology fans orders out to order_queue, retried after 300 ms, and
+// audit_queue, without retry
+const ordersTopology = `
+exchanges:
+  - name: orders
+    type: direct
+queues:
+  - name: order_queue
+    type: quorum
+    retry:
+      interval: 300
+  - name: audit_queue
+    type: quorum
+bindings:
+  - exchange: orders
+    queue: order_queue
+    routing_key: created
+  - exchange: orders
+    queue: audit_queue
+    routing_key: created
+`
+
+// newRedisBroker returns a Redis Streams broker on an in-process Redis, and a
+// client to inspect the streams with
+func newRedisBroker(t *testing.T, options broker.RedisOptions) (broker.Broker, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	topology, err := amqp.ParseTopology([]byte(ordersTopology))
+	if err != nil {
+		t.Fatalf("ParseTopology failed: %v", err)
+	}
+	if options.Group == "" {
+		options.Group = "test"
+	}
+	return broker.NewRedis(client, topology, options), client
+}
+
+// consume subscribes to queue until the test ends
+func consume(t *testing.T, b broker.Broker, queue, consumer string) broker.Subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sub, err := b.Consume(ctx, queue, consumer)
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	return sub
+}
+
+func publishOrder(t *testing.T, b broker.Broker, id string) {
+	err := b.Publish(context.Background(), "orders", "created", amqplib.Publishing{
+		MessageId:   id,
+		ContentType: "application/json",
+		Headers:     amqplib.Table{"tenant": "acme"},
+		Body:        []byte(`{"id":"` + id + `"}`),
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+}
+
+// next returns the next delivery of sub, failing the test after wait
+func next(t *testing.T, sub broker.Subscription, wait time.Duration) amqplib.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-sub.Deliveries():
+		if !ok {
+			t.Fatal("Deliveries closed")
+		}
+		return d
+	case <-time.After(wait):
+		t.Fatalf("No delivery within %s", wait)
+	}
+	return amqplib.Delivery{}
+}
+
+// expectNone fails the test when sub delivers within wait
+func expectNone(t *testing.T, sub broker.Subscription, wait time.Duration) {
+	t.Helper()
+	select {
+	case d := <-sub.Deliveries():
+		t.Fatalf("Unexpected delivery %s", d.MessageId)
+	case <-time.After(wait):
+	}
+}
+
+func pendingCount(t *testing.T, client *redis.Client, queue string) int64 {
+	pending, err := client.XPending(context.Background(), broker.StreamPrefix+queue, "test").Result()
+	if err != nil {
+		t.Fatalf("XPending failed: %v", err)
+	}
+	return pending.Count
+}
+
+// deadLetters returns the entries of the dead-letter stream of queue
+func deadLetters(t *testing.T, client *redis.Client, queue string) []redis.XMessage {
+	messages, err := client.XRange(context.Background(), broker.StreamPrefix+queue+broker.DeadLetterSuffix, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange failed: %v", err)
+	}
+	return messages
+}
+
+func TestRedisBroker_PublishConsumeAck(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{})
+	orders := consume(t, b, "order_queue", "orders")
+	publishOrder(t, b, "order-1")
+
+	d := next(t, orders, time.Second)
+	if d.MessageId != "order-1" || string(d.Body) != `{"id":"order-1"}` || d.Headers["tenant"] != "acme" || d.RoutingKey != "created" || d.Redelivered {
+		t.Errorf("Unexpected delivery: %+v", d)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	if count := pendingCount(t, client, "order_queue"); count != 0 {
+		t.Errorf("Expected no pending entry after the ack, got %d", count)
+	}
+
+	// Every bound queue gets its copy, kept until consumed
+	audit := consume(t, b, "audit_queue", "audit")
+	if d := next(t, audit, time.Second); d.MessageId != "order-1" {
+		t.Errorf("Expected order-1 on audit_queue, got %s", d.MessageId)
+	}
+	if err := d.Ack(false); err == nil {
+		t.Error("Expected a second ack of the same delivery to fail")
+	}
+}
+
+func TestRedisBroker_PublishKeepsEveryField(t *testing.T) {
+	b, _ := newRedisBroker(t, broker.RedisOptions{})
+	orders := consume(t, b, "order_queue", "orders")
+
+	headers := amqplib.Table{
+		"tenant":  "acme",
+		"attempt": int32(3),
+		"size":    int64(1) << 60,
+		"ratio":   1.5,
+		"flag":    true,
+		"none":    nil,
+		"raw":     []byte{0, 1, 2},
+		"price":   amqplib.Decimal{Scale: 2, Value: 1999},
+		"sent":    time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		"tags":    []interface{}{"a", int16(7)},
+		"nested":  amqplib.Table{"level": byte(2)},
+	}
+	msg := amqplib.Publishing{
+		Headers:         headers,
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		DeliveryMode:    amqplib.Persistent,
+		CorrelationId:   "corr-1",
+		ReplyTo:         "replies",
+		MessageId:       "order-1",
+		Timestamp:       time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Type:            "order.created",
+		UserId:          "guest",
+		AppId:           "shop",
+		Body:            []byte(`{"id":"order-1"}`),
+	}
+	if err := b.Publish(context.Background(), "orders", "created", msg); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	d := next(t, orders, time.Second)
+	got := amqplib.Publishing{
+		Headers:         d.Headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("Expected the publishing back unchanged\ngot  %#v\nwant %#v", got, msg)
+	}
+
+	// A requeued message keeps its header types
+	d.Nack(false, true)
+	d = next(t, orders, time.Second)
+	if d.Headers["attempt"] != int32(3) || d.Headers["size"] != int64(1)<<60 || d.Headers[broker.RetryCountHeader] != int64(1) {
+		t.Errorf("Unexpected headers after the requeue: %#v", d.Headers)
+	}
+}
+
+func TestRedisBroker_PublishRejectsUnsupportedFields(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{})
+
+	for name, msg := range map[string]amqplib.Publishing{
+		"priority":   {MessageId: "order-1", Priority: 5},
+		"expiration": {MessageId: "order-1", Expiration: "60000"},
+		"header":     {MessageId: "order-1", Headers: amqplib.Table{"id": uint64(1)}},
+	} {
+		if err := b.Publish(context.Background(), "orders", "created", msg); err == nil {
+			t.Errorf("Expected the %s to be rejected", name)
+		} else if name != "header" && !errors.Is(err, broker.ErrUnsupportedField) {
+			t.Errorf("Expected ErrUnsupportedField for the %s, got %v", name, err)
+		}
+	}
+	if length, _ := client.XLen(context.Background(), broker.StreamPrefix+"order_queue").Result(); length != 0 {
+		t.Errorf("Expected nothing published, got %d entries", length)
+	}
+}
+
+func TestRedisBroker_NackRequeueRedelivers(t *testing.T) {
+	b, _ := newRedisBroker(t, broker.RedisOptions{})
+	audit := consume(t, b, "audit_queue", "audit")
+	publishOrder(t, b, "order-1")
+
+	if err := next(t, audit, time.Second).Nack(false, true); err != nil {
+		t.Fatalf("Nack failed: %v", err)
+	}
+	d := next(t, audit, time.Second)
+	if d.MessageId != "order-1" || !d.Redelivered || d.Headers[broker.RetryCountHeader] != int64(1) {
+		t.Errorf("Expected order-1 redelivered with retry count 1, got %+v", d)
+	}
+}
+
+func TestRedisBroker_RetryWaitsForInterval(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{})
+	if !b.Retries("order_queue") || b.Retries("audit_queue") {
+		t.Fatal("Expected order_queue only to be retried")
+	}
+	orders := consume(t, b, "order_queue", "orders")
+	publishOrder(t, b, "order-1")
+
+	rejected := time.Now()
+	if err := broker.Retry(b, next(t, orders, time.Second), "order_queue"); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	retryStream := broker.StreamPrefix + "order_queue" + broker.RetrySuffix
+	if waiting, _ := client.XLen(context.Background(), retryStream).Result(); waiting != 1 {
+		t.Errorf("Expected the message to wait in %s, got %d entries", retryStream, waiting)
+	}
+	if count := pendingCount(t, client, "order_queue"); count != 0 {
+		t.Errorf("Expected the rejected entry to be acked, got %d pending", count)
+	}
+
+	// Released between reads, so up to the read block after the interval
+	d := next(t, orders, 5*time.Second)
+	if elapsed := time.Since(rejected); elapsed < 300*time.Millisecond {
+		t.Errorf("Expected the retry after the 300ms interval, got it after %s", elapsed)
+	}
+	if d.MessageId != "order-1" || string(d.Body) != `{"id":"order-1"}` || d.Headers[broker.RetryCountHeader] != int64(1) {
+		t.Errorf("Expected order-1 with retry count 1, got %+v", d)
+	}
+	if waiting, _ := client.XLen(context.Background(), retryStream).Result(); waiting != 0 {
+		t.Errorf("Expected the retry stream to be empty, got %d entries", waiting)
+	}
+}
+
+func TestRedisBroker_MaxRetriesDeadLetters(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{MaxRetries: 2})
+	audit := consume(t, b, "audit_queue", "audit")
+	publishOrder(t, b, "order-1")
+
+	for i := 0; i < 3; i++ {
+		if err := next(t, audit, time.Second).Nack(false, true); err != nil {
+			t.Fatalf("Nack failed: %v", err)
+		}
+	}
+	expectNone(t, audit, 100*time.Millisecond)
+
+	dead := deadLetters(t, client, "audit_queue")
+	if len(dead) != 1 || dead[0].Values["dead_reason"] != "max-retries" || dead[0].Values["message_id"] != "order-1" || dead[0].Values["original_queue"] != "audit_queue" {
+		t.Fatalf("Expected order-1 dead-lettered after 2 retries, got %v", dead)
+	}
+
+	// Rejected without requeue on a queue without retry: dead-lettered at once
+	publishOrder(t, b, "order-2")
+	if err := next(t, audit, time.Second).Reject(false); err != nil {
+		t.Fatalf("Reject failed: %v", err)
+	}
+	if dead := deadLetters(t, client, "audit_queue"); len(dead) != 2 || dead[1].Values["dead_reason"] != "rejected" {
+		t.Errorf("Expected order-2 dead-lettered as rejected, got %v", dead)
+	}
+	if count := pendingCount(t, client, "audit_queue"); count != 0 {
+		t.Errorf("Expected no pending entry, got %d", count)
+	}
+}
+
+func TestRedisBroker_ReclaimsIdlePending(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{Consumer: "crashed", ClaimIdle: 100 * time.Millisecond})
+	crashed := consume(t, b, "audit_queue", "audit")
+	publishOrder(t, b, "order-1")
+	next(t, crashed, time.Second) // never settled
+	crashed.Close()
+
+	// Another instance in the group takes it over once idle for ClaimIdle
+	other := broker.NewRedis(client, mustTopology(t), broker.RedisOptions{Group: "test", Consumer: "survivor", ClaimIdle: 100 * time.Millisecond})
+	time.Sleep(150 * time.Millisecond)
+	survivor := consume(t, other, "audit_queue", "audit")
+	d := next(t, survivor, 5*time.Second)
+	if d.MessageId != "order-1" || !d.Redelivered || d.ConsumerTag != "survivor-audit" {
+		t.Errorf("Expected order-1 reclaimed by survivor-audit, got %+v", d)
+	}
+	if err := d.Ack(false); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	if count := pendingCount(t, client, "audit_queue"); count != 0 {
+		t.Errorf("Expected no pending entry after the ack, got %d", count)
+	}
+}
+
+func TestRedisBroker_ReclaimDeadLettersAfterMaxRetries(t *testing.T) {
+	b, client := newRedisBroker(t, broker.RedisOptions{MaxRetries: 1, ClaimIdle: 50 * time.Millisecond})
+	sub := consume(t, b, "audit_queue", "audit")
+	publishOrder(t, b, "order-1")
+
+	// Delivered, then reclaimed once, each time left unsettled (a handler
+	// crashing the worker): the next reclaim dead-letters it
+	next(t, sub, time.Second)
+	next(t, sub, 5*time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(deadLetters(t, client, "audit_queue")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the entry to be dead-lettered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if dead := deadLetters(t, client, "audit_queue"); dead[0].Values["dead_reason"] != "max-retries" {
+		t.Errorf("Expected max-retries, got %v", dead[0].Values)
+	}
+}
+
+func mustTopology(t *testing.T) *amqp.Topology {
+	topology, err := amqp.ParseTopology([]byte(ordersTopology))
+	if err != nil {
+		t.Fatalf("ParseTopology failed: %v", err)
+	}
+	return topology
+}
@@ -0,0 +1,113 @@
+package consumer_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"boilerblade/config/broker"
+	"boilerblade/config/mail"
+	"boilerblade/constants"
+	"boilerblade/src/consumer"
+	"boilerblade/src/event"
+	"context"
+	"errors"
+	"net/textproto"
+	"sync"
+	"testing"
+)
+
+// flakyMailer fails with errs in order, then sends to a MemoryMailer
+type flakyMailer struct {
+	*mail.MemoryMailer
+	mu   sync.Mutex
+	errs []error
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		m.mu.Unlock()
+		return err
+	}
+	m.mu.Unlock()
+	return m.MemoryMailer.Send(ctx, msg)
+}
+
+// startMailConsumer applies the embedded topology to a fresh broker, starts a
+// mail consumer sending through mailer and returns the queue mailer of the broker
+func startMailConsumer(t *testing.T, mailer mail.Mailer) (*amqptest.Broker, mail.Mailer) {
+	fake := amqptest.NewBroker()
+	topology, err := amqp.LoadTopology("", "")
+	if err != nil {
+		t.Fatalf("Failed to load topology: %v", err)
+	}
+	ch, _ := fake.Channel()
+	if err := topology.Apply(ch); err != nil {
+		t.Fatalf("Failed to apply topology: %v", err)
+	}
+	ch.Close()
+
+	b := broker.NewAMQP(fake, topology)
+	c := consumer.NewMailConsumer(b, mailer, broker.GuardOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		c.Close()
+	})
+	go c.ProcessMail(ctx)
+
+	return fake, event.NewQueueMailer(event.NewBrokerPublisher(b, "test", amqp.CloudEventModeBinary))
+}
+
+func TestMailConsumer_SendsQueuedEmails(t *testing.T) {
+	mailer := &flakyMailer{MemoryMailer: mail.NewMemoryMailer()}
+	fake, queue := startMailConsumer(t, mailer)
+
+	msg := mail.Message{To: "john@example.com", Subject: "Reset your password", Text: "token=abc"}
+	if err := queue.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if stats := fake.WaitIdle(t, constants.MailQueueName); stats.Acked != 1 {
+		t.Errorf("Expected 1 acked message, got %+v", stats)
+	}
+	if sent := mailer.Messages(); len(sent) != 1 || sent[0] != msg {
+		t.Errorf("Expected %+v to be sent, got %+v", msg, sent)
+	}
+}
+
+func TestMailConsumer_FailedSendIsRetriedLater(t *testing.T) {
+	mailer := &flakyMailer{MemoryMailer: mail.NewMemoryMailer(), errs: []error{errors.New("connection refused")}}
+	fake, queue := startMailConsumer(t, mailer)
+
+	queue.Send(context.Background(), mail.Message{To: "john@example.com", Subject: "Verify your email address"})
+
+	if stats := fake.WaitIdle(t, constants.MailQueueName); stats.DeadLettered != 1 {
+		t.Errorf("Expected the message in the retry path, got %+v", stats)
+	}
+	if got := fake.Stats(constants.MailQueueName + amqp.QueueRetrySuffix).Ready; got != 1 {
+		t.Errorf("Expected the message to wait in the retry queue, got %d", got)
+	}
+	if len(mailer.Messages()) != 0 {
+		t.Errorf("Expected nothing sent yet, got %+v", mailer.Messages())
+	}
+}
+
+func TestMailConsumer_RejectedEmailGoesToErrorQueue(t *testing.T) {
+	mailer := &flakyMailer{
+		MemoryMailer: mail.NewMemoryMailer(),
+		errs:         []error{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}},
+	}
+	fake, queue := startMailConsumer(t, mailer)
+
+	queue.Send(context.Background(), mail.Message{To: "nobody@example.com", Subject: "Verify your email address"})
+	queue.Send(context.Background(), mail.Message{Subject: "No recipient"})
+
+	if stats := fake.WaitIdle(t, constants.MailQueueName); stats.Acked != 2 || stats.Requeued != 0 {
+		t.Errorf("Expected both messages to be acked without requeue, got %+v", stats)
+	}
+	if got := fake.Stats(amqp.ErrorQueueName(constants.MailQueueName)).Ready; got != 2 {
+		t.Errorf("Expected 2 messages in the error queue, got %d", got)
+	}
+}
@@ -0,0 +1,489 @@
+package consumer_test
+
+import (
+	"boilerblade/config/amqp"
+	"boilerblade/config/amqp/amqptest"
+	"boilerblade/config/broker"
+	"boilerblade/constants"
+	"boilerblade/src/audit"
+	"boilerblade/src/consumer"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/usecase"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqplib "github.com/streadway/amqp"
+	"gorm.io/gorm"
+)
+
+// mockUserUsecase records the calls made by the consumer
+type mockUserUsecase struct {
+	mu         sync.Mutex
+	created    []dto.CreateUserRequest
+	updated    map[uint]dto.UpdateUserRequest
+	failTimes  int // CreateUser fails this many times before succeeding
+	panicTimes int // CreateUser panics this many times before succeeding
+
+	batches    []int          // sizes of the CreateUsers calls
+	failEmails map[string]int // CreateUsers fails an email this many times
+
+	audits []audit.Metadata // metadata of the WithContext calls
+
+	events    *event.RecordingPublisher // when set, CreateUser publishes UserCreated
+	publisher event.Publisher           // publisher handed over by the last factory call
+}
+
+func newMockUserUsecase() *mockUserUsecase {
+	return &mockUserUsecase{updated: make(map[uint]dto.UpdateUserRequest)}
+}
+
+func (m *mockUserUsecase) CreateUser(req *dto.CreateUserRequest) (*dto.UserResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failTimes > 0 {
+		m.failTimes--
+		return nil, errors.New("database unavailable")
+	}
+	if m.panicTimes > 0 {
+		m.panicTimes--
+		panic("assignment to entry in nil map")
+	}
+	m.created = append(m.created, *req)
+	if m.publisher != nil {
+		m.publisher.Publish(event.NewUserCreated(uint(len(m.created)), req.Name, req.Email))
+	}
+	return &dto.UserResponse{ID: uint(len(m.created)), Name: req.Name, Email: req.Email}, nil
+}
+
+func (m *mockUserUsecase) CreateUsers(reqs []*dto.CreateUserRequest) ([]*dto.UserResponse, []error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, len(reqs))
+	responses := make([]*dto.UserResponse, len(reqs))
+	errs := make([]error, len(reqs))
+	for i, req := range reqs {
+		switch {
+		case req.Email == "taken@example.com":
+			errs[i] = errors.New("email already exists")
+		case m.failEmails[req.Email] > 0:
+			m.failEmails[req.Email]--
+			errs[i] = errors.New("database unavailable")
+		default:
+			m.created = append(m.created, *req)
+			responses[i] = &dto.UserResponse{ID: uint(len(m.created)), Name: req.Name, Email: req.Email}
+		}
+	}
+	return responses, errs
+}
+
+func (m *mockUserUsecase) GetUserByID(id uint) (*dto.UserResponse, error) {
+	return nil, errors.New("user not found")
+}
+
+func (m *mockUserUsecase) GetAllUsers(limit, offset int) (*dto.UserListResponse, error) {
+	return &dto.UserListResponse{}, nil
+}
+
+func (m *mockUserUsecase) UpdateUser(id uint, req *dto.UpdateUserRequest) (*dto.UserResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updated[id] = *req
+	return &dto.UserResponse{ID: id, Name: req.Name, Email: req.Email}, nil
+}
+
+func (m *mockUserUsecase) DeleteUser(id uint) error {
+	return nil
+}
+
+func (m *mockUserUsecase) WithContext(ctx context.Context) usecase.UserUsecase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audits = append(m.audits, audit.FromContext(ctx))
+	return m
+}
+
+func (m *mockUserUsecase) createdCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.created)
+}
+
+// mockInboxRepository is an in-memory InboxRepository
+type mockInboxRepository struct {
+	mu          sync.Mutex
+	seen        map[string]bool
+	noDeadlines int // calls whose ctx had no deadline
+	failCommits int // this many commits fail after fn succeeded
+}
+
+func newMockInboxRepository() *mockInboxRepository {
+	return &mockInboxRepository{seen: make(map[string]bool)}
+}
+
+func (m *mockInboxRepository) RunOnce(ctx context.Context, messageID, consumerName string, fn func(tx *gorm.DB) error) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := ctx.Deadline(); !ok {
+		m.noDeadlines++
+	}
+	key := consumerName + "|" + messageID
+	if m.seen[key] {
+		return false, nil
+	}
+	if err := fn(nil); err != nil {
+		return false, err
+	}
+	if m.failCommits > 0 {
+		m.failCommits--
+		return false, errors.New("commit failed")
+	}
+	m.seen[key] = true
+	return true, nil
+}
+
+// startUserConsumer applies the embedded topology to a fresh broker and starts both
+// user consumers; they are stopped when the test ends
+func startUserConsumer(t *testing.T, uc *mockUserUsecase) *amqptest.Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	fake, c := newUserConsumer(t, uc, newMockInboxRepository())
+
+	go c.ProcessUserCreated(ctx)
+	go c.ProcessUserUpdated(ctx)
+	return fake
+}
+
+// newUserConsumer applies the embedded topology to a fresh broker and creates a user consumer on it
+func newUserConsumer(t *testing.T, uc *mockUserUsecase, inbox *mockInboxRepository) (*amqptest.Broker, *consumer.UserConsumer) {
+	fake := amqptest.NewBroker()
+
+	topology, err := amqp.LoadTopology("", "")
+	if err != nil {
+		t.Fatalf("Failed to load topology: %v", err)
+	}
+	ch, _ := fake.Channel()
+	if err := topology.Apply(ch); err != nil {
+		t.Fatalf("Failed to apply topology: %v", err)
+	}
+	ch.Close()
+
+	c, err := consumer.NewUserConsumer(broker.NewAMQP(fake, topology), inbox, func(tx *gorm.DB, deferred *event.Deferred) usecase.UserUsecase {
+		uc.mu.Lock()
+		defer uc.mu.Unlock()
+		uc.publisher = nil
+		if uc.events != nil {
+			uc.publisher = uc.events
+			if deferred != nil {
+				uc.publisher = deferred.Publisher(uc.events)
+			}
+		}
+		return uc
+	})
+	if err != nil {
+		t.Fatalf("Failed to create consumer: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return fake, c
+}
+
+func userCreatedEvent(t *testing.T, id string) amqplib.Publishing {
+	evt, err := amqp.NewCloudEvent(id, "test", constants.UserCreatedEventType, constants.EventSchemaPrefix+constants.UserCreatedRouteKey+":v1", consumer.UserCreateMessage{
+		Name:  "Test User",
+		Email: "test@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	publishing, err := evt.ToPublishing(amqp.CloudEventModeBinary)
+	if err != nil {
+		t.Fatalf("Failed to build publishing: %v", err)
+	}
+	return publishing
+}
+
+func TestUserConsumer_ProcessUserCreated(t *testing.T) {
+	uc := newMockUserUsecase()
+	fake := startUserConsumer(t, uc)
+
+	if err := fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1")); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	stats := fake.WaitIdle(t, constants.UserCreatedQueueName)
+	if stats.Acked != 1 {
+		t.Errorf("Expected 1 acked message, got %+v", stats)
+	}
+	if uc.createdCount() != 1 || uc.created[0].Email != "test@example.com" {
+		t.Errorf("Expected user to be created, got %+v", uc.created)
+	}
+	want := audit.Metadata{ActorType: audit.ActorConsumer, ActorID: constants.UserCreatedQueueName, RequestID: "evt-1", Source: audit.SourceAMQP}
+	if len(uc.audits) != 1 || uc.audits[0] != want {
+		t.Errorf("Expected the creation attributed to the consumer, got %+v", uc.audits)
+	}
+}
+
+func TestUserConsumer_StopsOnCancel(t *testing.T) {
+	uc := newMockUserUsecase()
+	inbox := newMockInboxRepository()
+	fake, c := newUserConsumer(t, uc, inbox)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.ProcessUserCreated(ctx)
+	}()
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+	if stats := fake.WaitIdle(t, constants.UserCreatedQueueName); stats.Acked != 1 {
+		t.Fatalf("Expected 1 acked message, got %+v", stats)
+	}
+	inbox.mu.Lock()
+	noDeadlines := inbox.noDeadlines
+	inbox.mu.Unlock()
+	if noDeadlines != 0 {
+		t.Errorf("Expected the handler context to carry a deadline")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ProcessUserCreated did not return after cancellation")
+	}
+
+	// Nothing consumes the queue anymore
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-2"))
+	if stats := fake.Stats(constants.UserCreatedQueueName); stats.Consumers != 0 || stats.Ready != 1 {
+		t.Errorf("Expected the message to wait in the queue, got %+v", stats)
+	}
+}
+
+func TestUserConsumer_EventsPublishedAfterCommit(t *testing.T) {
+	uc := newMockUserUsecase()
+	uc.events = event.NewRecordingPublisher()
+	inbox := newMockInboxRepository()
+	inbox.failCommits = 1
+	fake, c := newUserConsumer(t, uc, inbox)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go c.ProcessUserCreated(ctx)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+	if stats := fake.WaitIdle(t, constants.UserCreatedQueueName); stats.Acked != 1 {
+		t.Fatalf("Expected the redelivery to be acked, got %+v", stats)
+	}
+	if uc.createdCount() != 2 {
+		t.Fatalf("Expected CreateUser to run for both attempts, got %d", uc.createdCount())
+	}
+	// The first attempt was rolled back: only the committed one is announced
+	events := uc.events.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 published event, got %d", len(events))
+	}
+	if created, ok := events[0].(*event.UserCreated); !ok || created.Email != "test@example.com" {
+		t.Errorf("Expected a UserCreated event, got %+v", events[0])
+	}
+}
+
+func TestUserConsumer_DuplicateDeliveryIsSkipped(t *testing.T) {
+	uc := newMockUserUsecase()
+	fake := startUserConsumer(t, uc)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+
+	stats := fake.WaitIdle(t, constants.UserCreatedQueueName)
+	if stats.Acked != 2 {
+		t.Errorf("Expected both deliveries to be acked, got %+v", stats)
+	}
+	if uc.createdCount() != 1 {
+		t.Errorf("Expected 1 user to be created, got %d", uc.createdCount())
+	}
+}
+
+func TestUserConsumer_FailureIsRequeued(t *testing.T) {
+	uc := newMockUserUsecase()
+	uc.failTimes = 1
+	fake := startUserConsumer(t, uc)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+
+	stats := fake.WaitIdle(t, constants.UserCreatedQueueName)
+	if stats.Requeued != 1 || stats.Acked != 1 {
+		t.Errorf("Expected one requeue then an ack, got %+v", stats)
+	}
+	if uc.createdCount() != 1 {
+		t.Errorf("Expected user to be created on redelivery, got %d", uc.createdCount())
+	}
+}
+
+func TestUserConsumer_PanicGoesToRetryQueue(t *testing.T) {
+	uc := newMockUserUsecase()
+	uc.panicTimes = 1
+	fake := startUserConsumer(t, uc)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-2"))
+
+	stats := fake.WaitIdle(t, constants.UserCreatedQueueName)
+	if stats.DeadLettered != 1 || stats.Acked != 1 {
+		t.Errorf("Expected the panicking message in the retry path and the next one acked, got %+v", stats)
+	}
+	if got := fake.Stats(constants.UserCreatedQueueName + amqp.QueueRetrySuffix).Ready; got != 1 {
+		t.Errorf("Expected the message to wait in the retry queue, got %d", got)
+	}
+	if uc.createdCount() != 1 {
+		t.Errorf("Expected the consumer to keep consuming after the panic, got %d users", uc.createdCount())
+	}
+}
+
+func TestUserConsumer_RepeatedPanicsPauseConsumer(t *testing.T) {
+	uc := newMockUserUsecase()
+	uc.panicTimes = 1
+	fake, c := newUserConsumer(t, uc, newMockInboxRepository())
+	c.SetGuardOptions(broker.GuardOptions{PanicThreshold: 1, Pause: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.ProcessUserCreated(ctx)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-1"))
+	fake.WaitIdle(t, constants.UserCreatedQueueName)
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, userCreatedEvent(t, "evt-2"))
+	time.Sleep(50 * time.Millisecond)
+
+	if uc.createdCount() != 0 {
+		t.Errorf("Expected the paused consumer to hold the next message, got %d users", uc.createdCount())
+	}
+	paused := false
+	for _, status := range broker.Guards() {
+		paused = paused || (status.Name == "UserConsumer/"+constants.UserCreatedQueueName && status.State == broker.GuardOpen)
+	}
+	if !paused {
+		t.Errorf("Expected the paused consumer to be reported, got %+v", broker.Guards())
+	}
+}
+
+func TestUserConsumer_LegacyUpdatePayload(t *testing.T) {
+	uc := newMockUserUsecase()
+	fake := startUserConsumer(t, uc)
+
+	fake.Deliver(constants.UserExchangeName, constants.UserUpdatedRouteKey, amqplib.Publishing{
+		MessageId:   "legacy-1",
+		ContentType: "application/json",
+		Body:        []byte(`{"id":5,"name":"Updated"}`),
+	})
+
+	stats := fake.WaitIdle(t, constants.UserUpdatedQueueName)
+	if stats.Acked != 1 {
+		t.Errorf("Expected 1 acked message, got %+v", stats)
+	}
+	if uc.updated[5].Name != "Updated" {
+		t.Errorf("Expected user 5 to be updated, got %+v", uc.updated)
+	}
+}
+
+func TestUserRPCHandler_NotFound(t *testing.T) {
+	handler := consumer.NewUserRPCHandler(newMockUserUsecase())
+
+	_, err := handler(context.Background(), amqplib.Delivery{Body: []byte(`{"id":7}`)})
+	if err == nil || err.Error() != "user not found" {
+		t.Errorf("Expected \"user not found\", got %v", err)
+	}
+}
+
+func TestUserConsumer_PoisonMessagesGoToErrorQueue(t *testing.T) {
+	uc := newMockUserUsecase()
+	fake := startUserConsumer(t, uc)
+
+	invalid, err := amqp.NewCloudEvent("evt-bad", "test", constants.UserCreatedEventType, constants.EventSchemaPrefix+constants.UserCreatedRouteKey+":v1", consumer.UserCreateMessage{Name: "No Email"})
+	if err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	publishing, _ := invalid.ToPublishing(amqp.CloudEventModeBinary)
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, publishing)
+	fake.Deliver(constants.UserExchangeName, constants.UserCreatedRouteKey, amqplib.Publishing{
+		MessageId:   "legacy-bad",
+		ContentType: "application/json",
+		Body:        []byte(`{"name":`),
+	})
+
+	stats := fake.WaitIdle(t, constants.UserCreatedQueueName)
+	if stats.Acked != 2 || stats.Requeued != 0 {
+		t.Errorf("Expected both messages to be acked without requeue, got %+v", stats)
+	}
+	if uc.createdCount() != 0 {
+		t.Errorf("Expected no user to be created, got %d", uc.createdCount())
+	}
+
+	errorQueue := amqp.ErrorQueueName(constants.UserCreatedQueueName)
+	if got := fake.Stats(errorQueue).Ready; got != 2 {
+		t.Fatalf("Expected 2 messages in %s, got %d", errorQueue, got)
+	}
+
+	ch, _ := fake.Channel()
+	defer ch.Close()
+	parked, ok, err := ch.GetChannel().Get(errorQueue, true)
+	if err != nil || !ok {
+		t.Fatalf("Failed to get message from error queue: %v", err)
+	}
+	if parked.Headers[amqp.OriginalRoutingKeyHeader] != constants.UserCreatedRouteKey ||
+		parked.Headers[amqp.ErrorConsumerHeader] != "UserConsumer" ||
+		parked.Headers[amqp.OriginalQueueHeader] != constants.UserCreatedQueueName {
+		t.Errorf("Unexpected error queue headers: %+v", parked.Headers)
+	}
+	if reason, _ := parked.Headers[amqp.ErrorHeader].(string); reason == "" {
+		t.Error("Expected the error in the x-error header")
+	}
+	if parked.MessageId != "evt-bad" {
+		t.Errorf("Expected original message to be kept, got message ID %q", parked.MessageId)
+	}
+}
+
+func userImport(email string) amqplib.Publishing {
+	return amqplib.Publishing{
+		MessageId:   "import-" + email,
+		ContentType: "application/json",
+		Body:        []byte(`{"name":"Imported","email":"` + email + `"}`),
+	}
+}
+
+func TestUserConsumer_ImportBatch(t *testing.T) {
+	uc := newMockUserUsecase()
+	uc.failEmails = map[string]int{"c@example.com": 1}
+	fake, c := newUserConsumer(t, uc, newMockInboxRepository())
+
+	for _, email := range []string{"a@example.com", "b@example.com", "taken@example.com", "c@example.com", ""} {
+		if err := fake.Deliver(constants.UserExchangeName, constants.UserImportRouteKey, userImport(email)); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go c.ProcessUserImports(ctx, broker.BatchOptions{Size: 10, Wait: 20 * time.Millisecond})
+
+	stats := fake.WaitIdle(t, constants.UserImportQueueName)
+	if stats.Acked != 5 || stats.Requeued != 1 {
+		t.Errorf("Expected 5 acks and the transient failure requeued once, got %+v", stats)
+	}
+
+	uc.mu.Lock()
+	batches, created := uc.batches, len(uc.created)
+	uc.mu.Unlock()
+	if len(batches) != 2 || batches[0] != 4 || batches[1] != 1 {
+		t.Errorf("Expected a batch of the 4 valid messages then the retried one, got %v", batches)
+	}
+	if created != 3 {
+		t.Errorf("Expected 3 users to be created, got %d", created)
+	}
+	if got := fake.Stats(amqp.ErrorQueueName(constants.UserImportQueueName)).Ready; got != 1 {
+		t.Errorf("Expected the invalid message in the error queue, got %d", got)
+	}
+}
@@ -0,0 +1,145 @@
+package handler_test
+
+import (
+	"boilerblade/middleware"
+	"boilerblade/src/audit"
+	"boilerblade/src/dto"
+	"boilerblade/src/handler"
+	"boilerblade/src/usecase"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mockAccountUsecase is a mock implementation of AccountUsecase for testing
+type mockAccountUsecase struct {
+	verificationRequests []string
+	resetRequests        []string
+	resets               map[string]string // token -> password
+	audits               []audit.Metadata
+	err                  error
+}
+
+func (m *mockAccountUsecase) RequestEmailVerification(email string) error {
+	m.verificationRequests = append(m.verificationRequests, email)
+	return m.err
+}
+
+func (m *mockAccountUsecase) VerifyEmail(token string) error {
+	if token != "valid" {
+		return usecase.ErrInvalidAccountToken
+	}
+	return m.err
+}
+
+func (m *mockAccountUsecase) RequestPasswordReset(email string) error {
+	m.resetRequests = append(m.resetRequests, email)
+	return m.err
+}
+
+func (m *mockAccountUsecase) ResetPassword(token, password string) error {
+	if token != "valid" {
+		return usecase.ErrInvalidAccountToken
+	}
+	if m.resets == nil {
+		m.resets = map[string]string{}
+	}
+	m.resets[token] = password
+	return m.err
+}
+
+func (m *mockAccountUsecase) WithContext(ctx context.Context) usecase.AccountUsecase {
+	m.audits = append(m.audits, audit.FromContext(ctx))
+	return m
+}
+
+func postAccount(t *testing.T, uc usecase.AccountUsecase, path string, body interface{}) (*http.Response, map[string]interface{}) {
+	app := setupTestApp()
+	handler.NewAccountHandler(uc).RegisterRoutes(middleware.NewRouter(app))
+
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var response map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp, response
+}
+
+func TestAccountHandler_RequestEmails(t *testing.T) {
+	uc := &mockAccountUsecase{}
+
+	resp, _ := postAccount(t, uc, "/auth/email/verification", dto.AccountEmailRequest{Email: "john@example.com"})
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", resp.StatusCode)
+	}
+	resp, _ = postAccount(t, uc, "/auth/password/forgot", dto.AccountEmailRequest{Email: "john@example.com"})
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", resp.StatusCode)
+	}
+	if len(uc.verificationRequests) != 1 || len(uc.resetRequests) != 1 {
+		t.Errorf("Expected one request of each, got %v and %v", uc.verificationRequests, uc.resetRequests)
+	}
+	if len(uc.audits) != 2 || uc.audits[0].ActorType != audit.ActorAnonymous || uc.audits[0].Source != audit.SourceHTTP {
+		t.Errorf("Expected anonymous HTTP audit metadata, got %+v", uc.audits)
+	}
+}
+
+func TestAccountHandler_RequestEmails_ValidationError(t *testing.T) {
+	uc := &mockAccountUsecase{}
+
+	resp, body := postAccount(t, uc, "/auth/password/forgot", dto.AccountEmailRequest{Email: "not-an-email"})
+	if resp.StatusCode != fiber.StatusBadRequest || body["error"] != "Validation failed" {
+		t.Errorf("Expected 400 validation failure, got %d %v", resp.StatusCode, body)
+	}
+	if len(uc.resetRequests) != 0 {
+		t.Errorf("Expected no request, got %v", uc.resetRequests)
+	}
+}
+
+func TestAccountHandler_VerifyEmail(t *testing.T) {
+	resp, _ := postAccount(t, &mockAccountUsecase{}, "/auth/email/verify", dto.VerifyEmailRequest{Token: "valid"})
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, body := postAccount(t, &mockAccountUsecase{}, "/auth/email/verify", dto.VerifyEmailRequest{Token: "expired"})
+	if resp.StatusCode != fiber.StatusBadRequest || body["error"] != usecase.ErrInvalidAccountToken.Error() {
+		t.Errorf("Expected 400 invalid token, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountHandler_ResetPassword(t *testing.T) {
+	uc := &mockAccountUsecase{}
+
+	resp, _ := postAccount(t, uc, "/auth/password/reset", dto.ResetPasswordRequest{Token: "valid", Password: "new-password123"})
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if uc.resets["valid"] != "new-password123" {
+		t.Errorf("Expected the password to be reset, got %v", uc.resets)
+	}
+
+	resp, body := postAccount(t, uc, "/auth/password/reset", dto.ResetPasswordRequest{Token: "valid", Password: "short"})
+	if resp.StatusCode != fiber.StatusBadRequest || body["error"] != "Validation failed" {
+		t.Errorf("Expected 400 validation failure, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAccountHandler_InternalError(t *testing.T) {
+	uc := &mockAccountUsecase{err: errors.New("database down")}
+
+	resp, body := postAccount(t, uc, "/auth/password/reset", dto.ResetPasswordRequest{Token: "valid", Password: "new-password123"})
+	if resp.StatusCode != fiber.StatusInternalServerError || body["error"] != "Failed to reset password" {
+		t.Errorf("Expected 500, got %d %v", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,178 @@
+package handler_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/auth"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/handler"
+	"boilerblade/src/usecase"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockAPIKeyUsecase is a mock implementation of APIKeyUsecase for testing
+type mockAPIKeyUsecase struct {
+	keys    map[uint]*dto.APIKeyResponse
+	revoked []uint
+}
+
+func newMockAPIKeyUsecase() *mockAPIKeyUsecase {
+	return &mockAPIKeyUsecase{keys: map[uint]*dto.APIKeyResponse{
+		1: {ID: 1, Name: "billing-job", Prefix: "3f9a1c2b7d4e", Scopes: []string{"users:read"}},
+		2: {ID: 2, Name: "old-job", Prefix: "0a1b2c3d4e5f", Scopes: []string{}, ReplacedByID: new(uint)},
+	}}
+}
+
+func (m *mockAPIKeyUsecase) Create(req *dto.CreateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	key := dto.APIKeyResponse{ID: uint(len(m.keys) + 1), Name: req.Name, Prefix: "9e8d7c6b5a4f", Scopes: req.Scopes}
+	m.keys[key.ID] = &key
+	return &dto.APIKeyCreatedResponse{Key: "bbk_9e8d7c6b5a4f_secret", APIKey: key}, nil
+}
+
+func (m *mockAPIKeyUsecase) List(limit, offset int, includeRevoked bool) (*dto.APIKeyListResponse, error) {
+	keys := []dto.APIKeyResponse{}
+	for _, key := range m.keys {
+		keys = append(keys, *key)
+	}
+	return &dto.APIKeyListResponse{APIKeys: keys, Total: int64(len(keys)), Limit: limit, Offset: offset}, nil
+}
+
+func (m *mockAPIKeyUsecase) Rotate(id uint, req *dto.RotateAPIKeyRequest) (*dto.APIKeyCreatedResponse, error) {
+	old, ok := m.keys[id]
+	if !ok {
+		return nil, usecase.ErrAPIKeyNotFound
+	}
+	if old.ReplacedByID != nil {
+		return nil, usecase.ErrAPIKeyInactive
+	}
+	return m.Create(&dto.CreateAPIKeyRequest{Name: old.Name, Scopes: old.Scopes})
+}
+
+func (m *mockAPIKeyUsecase) Revoke(id uint) error {
+	if _, ok := m.keys[id]; !ok {
+		return usecase.ErrAPIKeyNotFound
+	}
+	m.revoked = append(m.revoked, id)
+	return nil
+}
+
+func (m *mockAPIKeyUsecase) AuthenticateAPIKey(key string) (*auth.Service, error) {
+	return nil, auth.ErrInvalidAPIKey
+}
+
+// requestAPIKeys calls an admin API key route with a token holding permissions
+func requestAPIKeys(t *testing.T, uc usecase.APIKeyUsecase, method, path, body string, permissions ...string) (*http.Response, map[string]interface{}) {
+	app := setupTestApp()
+	apiGroup := app.Group("/api/v1", func(c *fiber.Ctx) error {
+		c.Locals("env", &config.Env{APP_KEY: "test-app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"})
+		return c.Next()
+	})
+	handler.NewAPIKeyHandler(uc).RegisterRoutes(middleware.NewRouter(apiGroup))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     "1",
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"permissions": permissions,
+	}).SignedString([]byte("test-app-key"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	req := httptest.NewRequest(method, "/api/v1"+path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var response map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp, response
+}
+
+func TestAPIKeyHandler_CreateAPIKey(t *testing.T) {
+	resp, body := requestAPIKeys(t, newMockAPIKeyUsecase(), http.MethodPost, "/admin/api-keys",
+		`{"name":"report-job","scopes":["users:read"]}`, "api_keys:create")
+
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	key, _ := body["api_key"].(map[string]interface{})
+	if body["key"] != "bbk_9e8d7c6b5a4f_secret" || key["name"] != "report-job" {
+		t.Errorf("Unexpected response: %v", body)
+	}
+}
+
+func TestAPIKeyHandler_CreateAPIKey_ValidationError(t *testing.T) {
+	resp, body := requestAPIKeys(t, newMockAPIKeyUsecase(), http.MethodPost, "/admin/api-keys", `{"scopes":["users:read"]}`, "api_keys:create")
+
+	if resp.StatusCode != fiber.StatusBadRequest || body["error"] != "Validation failed" {
+		t.Errorf("Expected 400 validation failure, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAPIKeyHandler_ListAPIKeys(t *testing.T) {
+	resp, body := requestAPIKeys(t, newMockAPIKeyUsecase(), http.MethodGet, "/admin/api-keys?limit=5", "", "api_keys:read")
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if body["total"] != float64(2) || body["limit"] != float64(5) {
+		t.Errorf("Unexpected response: %v", body)
+	}
+}
+
+func TestAPIKeyHandler_RotateAPIKey(t *testing.T) {
+	testCases := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/admin/api-keys/1/rotate", "", fiber.StatusCreated},
+		{"/admin/api-keys/1/rotate", `{"grace_period":60}`, fiber.StatusCreated},
+		{"/admin/api-keys/1/rotate", `{"grace_period":-1}`, fiber.StatusBadRequest},
+		{"/admin/api-keys/2/rotate", "", fiber.StatusConflict},
+		{"/admin/api-keys/99/rotate", "", fiber.StatusNotFound},
+		{"/admin/api-keys/abc/rotate", "", fiber.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		resp, _ := requestAPIKeys(t, newMockAPIKeyUsecase(), http.MethodPost, tc.path, tc.body, "api_keys:update")
+		if resp.StatusCode != tc.status {
+			t.Errorf("POST %s %s: expected status %d, got %d", tc.path, tc.body, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIKeyHandler_RevokeAPIKey(t *testing.T) {
+	uc := newMockAPIKeyUsecase()
+	resp, _ := requestAPIKeys(t, uc, http.MethodDelete, "/admin/api-keys/1", "", "api_keys:delete")
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if len(uc.revoked) != 1 || uc.revoked[0] != 1 {
+		t.Errorf("Expected key 1 to be revoked, got %v", uc.revoked)
+	}
+
+	resp, _ = requestAPIKeys(t, uc, http.MethodDelete, "/admin/api-keys/99", "", "api_keys:delete")
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIKeyHandler_RequiresPermission(t *testing.T) {
+	resp, _ := requestAPIKeys(t, newMockAPIKeyUsecase(), http.MethodPost, "/admin/api-keys",
+		`{"name":"report-job"}`, "api_keys:read")
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockAuditUsecase is a mock implementation of AuditUsecase for testing
+type mockAuditUsecase struct {
+	query *dto.AuditLogQuery // query received by GetAuditLogs
+}
+
+func (m *mockAuditUsecase) GetAuditLogs(query *dto.AuditLogQuery) (*dto.AuditLogListResponse, error) {
+	m.query = query
+	return &dto.AuditLogListResponse{
+		AuditLogs: []dto.AuditLogResponse{{
+			ID: 1, ActorType: "user", ActorID: "1", Entity: "user", EntityID: 7, Action: "updated",
+			Changes: []dto.AuditLogChange{{Field: "password", Before: "***", After: "***"}},
+		}},
+		Total: 1,
+		Limit: 10,
+	}, nil
+}
+
+// requestAuditLogs calls GET /admin/audit-logs with a token holding permissions
+func requestAuditLogs(t *testing.T, uc *mockAuditUsecase, query string, permissions ...string) (*http.Response, map[string]interface{}) {
+	app := setupTestApp()
+	apiGroup := app.Group("/api/v1", func(c *fiber.Ctx) error {
+		c.Locals("env", &config.Env{APP_KEY: "test-app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"})
+		return c.Next()
+	})
+	handler.NewAuditHandler(uc).RegisterRoutes(middleware.NewRouter(apiGroup))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     "1",
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"permissions": permissions,
+	}).SignedString([]byte("test-app-key"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit-logs"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var response map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp, response
+}
+
+func TestAuditHandler_ListAuditLogs(t *testing.T) {
+	uc := &mockAuditUsecase{}
+	resp, body := requestAuditLogs(t, uc, "?entity=user&entity_id=7&actor_type=user&action=updated&since=2024-01-01T00:00:00Z&limit=5", "audit_logs:read")
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d %v", resp.StatusCode, body)
+	}
+	logs, _ := body["audit_logs"].([]interface{})
+	if len(logs) != 1 {
+		t.Fatalf("Expected one audit log, got %v", body)
+	}
+	want := dto.AuditLogQuery{Entity: "user", EntityID: 7, ActorType: "user", Action: "updated", Since: "2024-01-01T00:00:00Z", Limit: 5}
+	if uc.query == nil || *uc.query != want {
+		t.Errorf("Expected the filters passed on, got %+v", uc.query)
+	}
+}
+
+func TestAuditHandler_ListAuditLogs_InvalidFilter(t *testing.T) {
+	for _, query := range []string{"?action=viewed", "?since=yesterday", "?entity_id=abc"} {
+		resp, _ := requestAuditLogs(t, &mockAuditUsecase{}, query, "audit_logs:read")
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAuditHandler_ListAuditLogs_RequiresPermission(t *testing.T) {
+	uc := &mockAuditUsecase{}
+	resp, _ := requestAuditLogs(t, uc, "", "users:read")
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 without audit_logs:read, got %d", resp.StatusCode)
+	}
+	if uc.query != nil {
+		t.Error("Expected the usecase not to be called")
+	}
+}
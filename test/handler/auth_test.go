@@ -0,0 +1,223 @@
+package handler_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/handler"
+	"boilerblade/src/usecase"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockAuthUsecase is a mock implementation of AuthUsecase for testing
+type mockAuthUsecase struct {
+	loggedOut    []string
+	revokedJTIs  []string
+	revokedUsers []uint
+	unavailable  bool
+}
+
+func (m *mockAuthUsecase) Login(req *dto.LoginRequest) (*dto.TokenResponse, error) {
+	switch req.Email {
+	case "locked@example.com":
+		return nil, &usecase.AccountLockedError{RetryAfter: 90*time.Second + 200*time.Millisecond}
+	case "unverified@example.com":
+		return nil, usecase.ErrEmailNotVerified
+	}
+	if req.Email != "john@example.com" || req.Password != "password123" {
+		return nil, usecase.ErrInvalidCredentials
+	}
+	return &dto.TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh-1"}, nil
+}
+
+func (m *mockAuthUsecase) Refresh(refreshToken string) (*dto.TokenResponse, error) {
+	switch refreshToken {
+	case "refresh-1":
+		return &dto.TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "refresh-2"}, nil
+	case "used":
+		return nil, usecase.ErrRefreshTokenReused
+	default:
+		return nil, usecase.ErrInvalidRefreshToken
+	}
+}
+
+func (m *mockAuthUsecase) Logout(refreshToken string) error {
+	m.loggedOut = append(m.loggedOut, refreshToken)
+	return nil
+}
+
+func (m *mockAuthUsecase) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if m.unavailable {
+		return usecase.ErrRevocationUnavailable
+	}
+	m.revokedJTIs = append(m.revokedJTIs, jti)
+	return nil
+}
+
+func (m *mockAuthUsecase) RevokeUserTokens(userID uint) error {
+	if m.unavailable {
+		return usecase.ErrRevocationUnavailable
+	}
+	m.revokedUsers = append(m.revokedUsers, userID)
+	return nil
+}
+
+func postAuth(t *testing.T, uc usecase.AuthUsecase, path string, body interface{}) (*http.Response, map[string]interface{}) {
+	app := setupTestApp()
+	handler.NewAuthHandler(uc).RegisterRoutes(middleware.NewRouter(app))
+
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var response map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp, response
+}
+
+func TestAuthHandler_Login(t *testing.T) {
+	resp, body := postAuth(t, &mockAuthUsecase{}, "/auth/login", dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if body["access_token"] != "access" || body["refresh_token"] != "refresh-1" || body["token_type"] != "Bearer" {
+		t.Errorf("Unexpected response: %v", body)
+	}
+}
+
+func TestAuthHandler_Login_InvalidCredentials(t *testing.T) {
+	resp, _ := postAuth(t, &mockAuthUsecase{}, "/auth/login", dto.LoginRequest{Email: "john@example.com", Password: "wrong"})
+
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuthHandler_Login_Locked(t *testing.T) {
+	resp, body := postAuth(t, &mockAuthUsecase{}, "/auth/login", dto.LoginRequest{Email: "locked@example.com", Password: "password123"})
+
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "91" {
+		t.Errorf("Expected Retry-After 91, got %q", got)
+	}
+	if body["error"] != usecase.ErrAccountLocked.Error() {
+		t.Errorf("Unexpected response: %v", body)
+	}
+}
+
+func TestAuthHandler_Login_EmailNotVerified(t *testing.T) {
+	resp, _ := postAuth(t, &mockAuthUsecase{}, "/auth/login", dto.LoginRequest{Email: "unverified@example.com", Password: "password123"})
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuthHandler_Login_ValidationError(t *testing.T) {
+	resp, body := postAuth(t, &mockAuthUsecase{}, "/auth/login", map[string]string{"email": "not-an-email"})
+
+	if resp.StatusCode != fiber.StatusBadRequest || body["error"] != "Validation failed" {
+		t.Errorf("Expected 400 validation failure, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	resp, body := postAuth(t, &mockAuthUsecase{}, "/auth/refresh", dto.RefreshTokenRequest{RefreshToken: "refresh-1"})
+	if resp.StatusCode != fiber.StatusOK || body["refresh_token"] != "refresh-2" {
+		t.Errorf("Expected rotated tokens, got %d %v", resp.StatusCode, body)
+	}
+
+	for _, token := range []string{"used", "unknown"} {
+		resp, _ := postAuth(t, &mockAuthUsecase{}, "/auth/refresh", dto.RefreshTokenRequest{RefreshToken: token})
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("Refresh(%s): expected status 401, got %d", token, resp.StatusCode)
+		}
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	uc := &mockAuthUsecase{}
+	resp, _ := postAuth(t, uc, "/auth/logout", dto.RefreshTokenRequest{RefreshToken: "refresh-1"})
+
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if len(uc.loggedOut) != 1 || uc.loggedOut[0] != "refresh-1" {
+		t.Errorf("Expected the refresh token to be revoked, got %v", uc.loggedOut)
+	}
+}
+
+// postRevoke calls a revocation route with a token holding claims
+func postRevoke(t *testing.T, uc usecase.AuthUsecase, path string, claims jwt.MapClaims) int {
+	app := setupTestApp()
+	apiGroup := app.Group("/api/v1", func(c *fiber.Ctx) error {
+		c.Locals("env", &config.Env{APP_KEY: "test-app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"})
+		return c.Next()
+	})
+	handler.NewAuthHandler(uc).RegisterRoutes(middleware.NewRouter(apiGroup))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-app-key"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1"+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestAuthHandler_RevokeToken(t *testing.T) {
+	uc := &mockAuthUsecase{}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	if status := postRevoke(t, uc, "/auth/revoke", jwt.MapClaims{"user_id": "1", "exp": exp, "jti": "token-1"}); status != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", status)
+	}
+	if len(uc.revokedJTIs) != 1 || uc.revokedJTIs[0] != "token-1" {
+		t.Errorf("Expected token-1 to be revoked, got %v", uc.revokedJTIs)
+	}
+	if status := postRevoke(t, uc, "/auth/revoke", jwt.MapClaims{"user_id": "1", "exp": exp}); status != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 without jti, got %d", status)
+	}
+
+	unavailable := &mockAuthUsecase{unavailable: true}
+	if status := postRevoke(t, unavailable, "/auth/revoke", jwt.MapClaims{"user_id": "1", "exp": exp, "jti": "token-1"}); status != fiber.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without revocation, got %d", status)
+	}
+}
+
+func TestAuthHandler_RevokeUserTokens(t *testing.T) {
+	uc := &mockAuthUsecase{}
+	exp := time.Now().Add(time.Minute).Unix()
+	admin := jwt.MapClaims{"user_id": "1", "exp": exp, "permissions": []string{"tokens:revoke"}}
+
+	if status := postRevoke(t, uc, "/admin/users/7/revoke-tokens", admin); status != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", status)
+	}
+	if len(uc.revokedUsers) != 1 || uc.revokedUsers[0] != 7 {
+		t.Errorf("Expected the tokens of user 7 to be revoked, got %v", uc.revokedUsers)
+	}
+	if status := postRevoke(t, uc, "/admin/users/abc/revoke-tokens", admin); status != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid ID, got %d", status)
+	}
+	if status := postRevoke(t, uc, "/admin/users/7/revoke-tokens", jwt.MapClaims{"user_id": "1", "exp": exp}); status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 without permission, got %d", status)
+	}
+}
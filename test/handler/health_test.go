@@ -0,0 +1,52 @@
+package handler_test
+
+import (
+	"boilerblade/config/broker"
+	"boilerblade/src/handler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func getHealth(t *testing.T, consumers ...broker.GuardStatus) (int, map[string]interface{}) {
+	app := setupTestApp()
+	handler.NewHealthHandler(func() []broker.GuardStatus { return consumers }).RegisterRoutes(app)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health", nil))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestHealthHandler_Healthy(t *testing.T) {
+	status, body := getHealth(t, broker.GuardStatus{Name: "UserConsumer/user_created_queue", State: broker.GuardClosed})
+
+	if status != fiber.StatusOK || body["status"] != "ok" {
+		t.Errorf("Expected 200 ok, got %d %v", status, body)
+	}
+	if consumers, _ := body["consumers"].([]interface{}); len(consumers) != 1 {
+		t.Errorf("Expected the consumer to be listed, got %v", body["consumers"])
+	}
+}
+
+func TestHealthHandler_PausedConsumer(t *testing.T) {
+	status, body := getHealth(t,
+		broker.GuardStatus{Name: "UserConsumer/user_created_queue", State: broker.GuardOpen, Trips: 1},
+		broker.GuardStatus{Name: "UserConsumer/user_updated_queue", State: broker.GuardClosed},
+	)
+
+	if status != fiber.StatusServiceUnavailable || body["status"] != "degraded" {
+		t.Errorf("Expected 503 degraded, got %d %v", status, body)
+	}
+	if paused, _ := body["paused"].([]interface{}); len(paused) != 1 || paused[0] != "UserConsumer/user_created_queue" {
+		t.Errorf("Expected the paused consumer to be named, got %v", body["paused"])
+	}
+}
@@ -0,0 +1,121 @@
+package handler_test
+
+import (
+	"boilerblade/middleware"
+	"boilerblade/src/dto"
+	"boilerblade/src/handler"
+	"boilerblade/src/usecase"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mockOIDCUsecase is a mock implementation of OIDCUsecase for testing
+type mockOIDCUsecase struct {
+	beginErr    error
+	callbackErr error
+	loginState  string // login state received by Callback
+	state       string
+}
+
+func (m *mockOIDCUsecase) Begin() (string, string, error) {
+	if m.beginErr != nil {
+		return "", "", m.beginErr
+	}
+	return "https://idp.example.com/authorize?state=state-1", "sealed-login", nil
+}
+
+func (m *mockOIDCUsecase) Callback(loginState, state, code string) (*dto.TokenResponse, error) {
+	m.loginState, m.state = loginState, state
+	if m.callbackErr != nil {
+		return nil, m.callbackErr
+	}
+	return &dto.TokenResponse{AccessToken: "access", TokenType: "Bearer", RefreshToken: "refresh"}, nil
+}
+
+func oidcRequest(t *testing.T, uc usecase.OIDCUsecase, path, cookie string) *http.Response {
+	app := setupTestApp()
+	handler.NewOIDCHandler(uc).RegisterRoutes(middleware.NewRouter(app.Group("/api/v1")))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1"+path, nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: handler.OIDCLoginCookie, Value: cookie})
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	return resp
+}
+
+// loginCookie returns the login state cookie set by resp
+func loginCookie(resp *http.Response) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == handler.OIDCLoginCookie {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCHandler_Login(t *testing.T) {
+	resp := oidcRequest(t, &mockOIDCUsecase{}, "/auth/oidc/login", "")
+
+	if resp.StatusCode != fiber.StatusFound || resp.Header.Get("Location") != "https://idp.example.com/authorize?state=state-1" {
+		t.Fatalf("Expected a redirect to the provider, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	cookie := loginCookie(resp)
+	if cookie == nil || cookie.Value != "sealed-login" || !cookie.HttpOnly || cookie.Path != "/api/v1/auth/oidc" {
+		t.Errorf("Expected an HttpOnly login state cookie on the OIDC routes, got %+v", cookie)
+	}
+
+	resp = oidcRequest(t, &mockOIDCUsecase{beginErr: errors.New("discovery failed")}, "/auth/oidc/login", "")
+	if resp.StatusCode != fiber.StatusBadGateway {
+		t.Errorf("Expected status 502 when the provider is unavailable, got %d", resp.StatusCode)
+	}
+}
+
+func TestOIDCHandler_Callback(t *testing.T) {
+	uc := &mockOIDCUsecase{}
+	resp := oidcRequest(t, uc, "/auth/oidc/callback?code=code-1&state=state-1", "sealed-login")
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var tokens dto.TokenResponse
+	json.NewDecoder(resp.Body).Decode(&tokens)
+	if tokens.AccessToken != "access" || tokens.RefreshToken != "refresh" {
+		t.Errorf("Expected our tokens, got %+v", tokens)
+	}
+	if uc.loginState != "sealed-login" || uc.state != "state-1" {
+		t.Errorf("Expected the cookie and state passed on, got %q %q", uc.loginState, uc.state)
+	}
+	if cookie := loginCookie(resp); cookie == nil || cookie.Value != "" {
+		t.Errorf("Expected the login state cookie cleared, got %+v", cookie)
+	}
+}
+
+func TestOIDCHandler_CallbackErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		query  string
+		status int
+	}{
+		{"invalid state", usecase.ErrOIDCInvalidState, "code=code-1&state=state-1", fiber.StatusBadRequest},
+		{"login failed", usecase.ErrOIDCLoginFailed, "code=code-1&state=state-1", fiber.StatusUnauthorized},
+		{"email not verified", usecase.ErrOIDCEmailNotVerified, "code=code-1&state=state-1", fiber.StatusForbidden},
+		{"internal error", errors.New("database down"), "code=code-1&state=state-1", fiber.StatusInternalServerError},
+		{"refused by the provider", nil, "error=access_denied&state=state-1", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp := oidcRequest(t, &mockOIDCUsecase{callbackErr: tt.err}, "/auth/oidc/callback?"+tt.query, "sealed-login")
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package handler_test
+
+import (
+	"boilerblade/middleware"
+	"boilerblade/src/handler"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// swaggerRoute is the documentation of a handler method
+type swaggerRoute struct {
+	function string
+	security []string
+}
+
+// parseSwaggerRoutes reads the @Router and @Security annotations of the
+// handlers, by "METHOD /path"
+func parseSwaggerRoutes(t *testing.T) map[string]swaggerRoute {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), "../../src/handler", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse handlers: %v", err)
+	}
+
+	routes := map[string]swaggerRoute{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Doc == nil {
+					continue
+				}
+				var key string
+				route := swaggerRoute{function: fn.Name.Name}
+				for _, comment := range fn.Doc.List {
+					fields := strings.Fields(strings.TrimPrefix(comment.Text, "//"))
+					if len(fields) < 2 {
+						continue
+					}
+					switch fields[0] {
+					case "@Router":
+						key = strings.ToUpper(strings.Trim(fields[len(fields)-1], "[]")) + " " + fields[1]
+					case "@Security":
+						route.security = append(route.security, fields[1])
+					}
+				}
+				if key != "" {
+					routes[key] = route
+				}
+			}
+		}
+	}
+	return routes
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// TestSwagger_SecurityMatchesRoutes checks that every documented route is
+// registered and that its @Security annotation matches the auth it declares
+func TestSwagger_SecurityMatchesRoutes(t *testing.T) {
+	router := middleware.NewRouter(setupTestApp())
+	handler.NewAuthHandler(nil).RegisterRoutes(router)
+	handler.NewUserHandler(nil).RegisterRoutes(router)
+	handler.NewProductHandler(nil).RegisterRoutes(router)
+	handler.NewAPIKeyHandler(nil).RegisterRoutes(router)
+	handler.NewOIDCHandler(nil).RegisterRoutes(router)
+	handler.NewAuditHandler(nil).RegisterRoutes(router)
+	handler.NewAccountHandler(nil).RegisterRoutes(router)
+
+	documented := parseSwaggerRoutes(t)
+	if len(documented) == 0 {
+		t.Fatal("No @Router annotation found")
+	}
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		key := route.Method + " " + pathParam.ReplaceAllString(route.Path, "{$1}")
+		registered[key] = true
+
+		doc, ok := documented[key]
+		if !ok {
+			continue // undocumented routes, e.g. generated handlers
+		}
+		want := strings.Join(route.Auth.SecuritySchemes(), ",")
+		got := strings.Join(doc.security, ",")
+		if got != want {
+			t.Errorf("%s (%s) is registered as %s but documented with @Security %q, want %q", key, doc.function, route.Auth, got, want)
+		}
+	}
+
+	for key, doc := range documented {
+		if !registered[key] {
+			t.Errorf("%s (%s) is documented but not registered", key, doc.function)
+		}
+	}
+}
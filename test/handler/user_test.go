@@ -1,22 +1,33 @@
 package handler_test
 
 import (
+	"boilerblade/config"
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"boilerblade/src/audit"
 	"boilerblade/src/dto"
 	"boilerblade/src/handler"
+	"boilerblade/src/usecase"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // mockUserUsecase is a mock implementation of UserUsecase for testing
 type mockUserUsecase struct {
 	users  map[uint]*dto.UserResponse
 	nextID uint
+	audits []audit.Metadata // metadata of the WithContext calls
 }
 
 func newMockUserUsecase() *mockUserUsecase {
@@ -46,6 +57,15 @@ func (m *mockUserUsecase) CreateUser(req *dto.CreateUserRequest) (*dto.UserRespo
 	return user, nil
 }
 
+func (m *mockUserUsecase) CreateUsers(reqs []*dto.CreateUserRequest) ([]*dto.UserResponse, []error) {
+	responses := make([]*dto.UserResponse, len(reqs))
+	errs := make([]error, len(reqs))
+	for i, req := range reqs {
+		responses[i], errs[i] = m.CreateUser(req)
+	}
+	return responses, errs
+}
+
 func (m *mockUserUsecase) GetUserByID(id uint) (*dto.UserResponse, error) {
 	user, ok := m.users[id]
 	if !ok {
@@ -116,6 +136,11 @@ func (m *mockUserUsecase) DeleteUser(id uint) error {
 	return nil
 }
 
+func (m *mockUserUsecase) WithContext(ctx context.Context) usecase.UserUsecase {
+	m.audits = append(m.audits, audit.FromContext(ctx))
+	return m
+}
+
 func setupTestApp() *fiber.App {
 	app := fiber.New()
 	return app
@@ -201,6 +226,45 @@ func TestUserHandler_CreateUser_ValidationError(t *testing.T) {
 	}
 }
 
+func TestUserHandler_CreateUser_DoesNotLogPassword(t *testing.T) {
+	var logs bytes.Buffer
+	logger := helper.GetLogger()
+	logger.SetOutput(&logs)
+	defer logger.SetOutput(os.Stderr)
+
+	mockUsecase := newMockUserUsecase()
+	userHandler := handler.NewUserHandler(mockUsecase)
+	app := setupTestApp()
+	app.Post("/users", userHandler.CreateUser)
+	signUp := func(req dto.CreateUserRequest) int {
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(httpReq)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	// Fails validation on the email, with a valid password
+	if status := signUp(dto.CreateUserRequest{Name: "Test User", Email: "invalid-email", Password: "first-secret"}); status != fiber.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", fiber.StatusBadRequest, status)
+	}
+	// Fails in the usecase: the email is taken
+	signUp(dto.CreateUserRequest{Name: "Test User", Email: "test@example.com", Password: "password123"})
+	if status := signUp(dto.CreateUserRequest{Name: "Other", Email: "test@example.com", Password: "second-secret"}); status != fiber.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", fiber.StatusInternalServerError, status)
+	}
+
+	if strings.Contains(logs.String(), "first-secret") || strings.Contains(logs.String(), "second-secret") {
+		t.Errorf("Expected no password in the logs, got %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `"fields":["Email"]`) {
+		t.Errorf("Expected the invalid field names to be logged, got %s", logs.String())
+	}
+}
+
 func TestUserHandler_GetUser(t *testing.T) {
 	mockUsecase := newMockUserUsecase()
 	userHandler := handler.NewUserHandler(mockUsecase)
@@ -405,6 +469,28 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 	}
 }
 
+func TestUserHandler_MutationsAreAttributed(t *testing.T) {
+	mockUsecase := newMockUserUsecase()
+	userHandler := handler.NewUserHandler(mockUsecase)
+	app := setupTestApp()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", "7")
+		return c.Next()
+	})
+	app.Delete("/users/:id", userHandler.DeleteUser)
+	mockUsecase.CreateUser(&dto.CreateUserRequest{Name: "Test User", Email: "test@example.com", Password: "password123"})
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+
+	want := audit.Metadata{ActorType: audit.ActorUser, ActorID: "7", Source: audit.SourceHTTP}
+	if len(mockUsecase.audits) != 1 || mockUsecase.audits[0] != want {
+		t.Errorf("Expected the deletion attributed to user 7, got %+v", mockUsecase.audits)
+	}
+}
+
 func TestUserHandler_DeleteUser_NotFound(t *testing.T) {
 	mockUsecase := newMockUserUsecase()
 	userHandler := handler.NewUserHandler(mockUsecase)
@@ -428,7 +514,7 @@ func TestUserHandler_RegisterRoutes(t *testing.T) {
 	app := setupTestApp()
 	apiGroup := app.Group("/api/v1")
 
-	userHandler.RegisterRoutes(apiGroup)
+	userHandler.RegisterRoutes(middleware.NewRouter(apiGroup))
 
 	// Test that routes are registered by making requests
 	testCases := []struct {
@@ -459,3 +545,59 @@ func TestUserHandler_RegisterRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestUserHandler_RegisterRoutes_PermissionGuards(t *testing.T) {
+	mockUsecase := newMockUserUsecase()
+	mockUsecase.users[1] = &dto.UserResponse{ID: 1, Name: "Owner", Email: "owner@example.com"}
+	mockUsecase.users[2] = &dto.UserResponse{ID: 2, Name: "Other", Email: "other@example.com"}
+
+	app := setupTestApp()
+	apiGroup := app.Group("/api/v1", func(c *fiber.Ctx) error {
+		c.Locals("env", &config.Env{APP_KEY: "test-app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"})
+		return c.Next()
+	})
+	handler.NewUserHandler(mockUsecase).RegisterRoutes(middleware.NewRouter(apiGroup))
+
+	// A plain user: reads users and updates itself only
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     "1",
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"roles":       []string{"user"},
+		"permissions": []string{"users:read"},
+	}).SignedString([]byte("test-app-key"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	testCases := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/users", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/v1/users", token, "", http.StatusOK},
+		{http.MethodGet, "/api/v1/users/2", token, "", http.StatusOK},
+		{http.MethodPut, "/api/v1/users/1", token, `{"name":"Renamed"}`, http.StatusOK},
+		{http.MethodPut, "/api/v1/users/2", token, `{"name":"Renamed"}`, http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/users/2", token, "", http.StatusForbidden},
+		// Sign-up is public
+		{http.MethodPost, "/api/v1/users", "", `{"name":"New User","email":"new@example.com","password":"password123"}`, http.StatusCreated},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to make request to %s %s: %v", tc.method, tc.path, err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.status, resp.StatusCode)
+		}
+	}
+}
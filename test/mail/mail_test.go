@@ -0,0 +1,249 @@
+package mail_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/mail"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpServer is a minimal SMTP server without STARTTLS that records what it
+// receives; recipients in reject are refused with 550
+type smtpServer struct {
+	listener net.Listener
+	reject   map[string]bool
+
+	mu    sync.Mutex
+	auth  string   // decoded AUTH PLAIN credentials
+	from  string   // MAIL FROM address
+	rcpts []string // RCPT TO addresses
+	data  string   // message of the last DATA
+}
+
+func startSMTPServer(t *testing.T, reject ...string) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &smtpServer{listener: listener, reject: map[string]bool{}}
+	for _, rcpt := range reject {
+		s.reject[rcpt] = true
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP test")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = address(arg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			rcpt := address(arg)
+			if s.reject[rcpt] {
+				tp.PrintfLine("550 5.1.1 mailbox unavailable")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, rcpt)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// address returns the address of a "FROM:<a>" or "TO:<a>" argument
+func address(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := startSMTPServer(t)
+	mailer, err := mail.NewSMTPMailer(mail.SMTPOptions{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "mailer",
+		Password: "secret",
+		From:     "noreply@example.com",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer failed: %v", err)
+	}
+
+	err = mailer.Send(context.Background(), mail.Message{
+		To:      "john@example.com",
+		Subject: "Réinitialiser\r\nBcc: evil@example.com",
+		Text:    "Hi John,\n\n.Reset link: https://app.example.com/reset?token=abc\n",
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.auth != "\x00mailer\x00secret" {
+		t.Errorf("Unexpected AUTH PLAIN credentials %q", server.auth)
+	}
+	if server.from != "noreply@example.com" || len(server.rcpts) != 1 || server.rcpts[0] != "john@example.com" {
+		t.Errorf("Unexpected envelope from %q to %v", server.from, server.rcpts)
+	}
+	headers, body, _ := strings.Cut(server.data, "\n\n")
+	if !strings.Contains(headers, "From: noreply@example.com") || !strings.Contains(headers, "To: john@example.com") {
+		t.Errorf("Missing headers in %q", headers)
+	}
+	if strings.Contains(headers, "\nBcc:") || !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("Expected a single encoded subject line, got %q", headers)
+	}
+	if body != "Hi John,\n\n.Reset link: https://app.example.com/reset?token=abc\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestSMTPMailer_RejectedRecipientIsPermanent(t *testing.T) {
+	server := startSMTPServer(t, "nobody@example.com")
+	mailer, _ := mail.NewSMTPMailer(mail.SMTPOptions{Host: "127.0.0.1", Port: server.port(), From: "noreply@example.com"})
+
+	err := mailer.Send(context.Background(), mail.Message{To: "nobody@example.com", Subject: "Hi"})
+	if err == nil {
+		t.Fatal("Expected the send to fail")
+	}
+	if !mail.IsPermanent(err) {
+		t.Errorf("Expected a permanent error, got %v", err)
+	}
+}
+
+func TestSMTPMailer_UnreachableServerIsTransient(t *testing.T) {
+	server := startSMTPServer(t)
+	port := server.port()
+	server.listener.Close()
+	mailer, _ := mail.NewSMTPMailer(mail.SMTPOptions{Host: "127.0.0.1", Port: port, From: "noreply@example.com"})
+
+	err := mailer.Send(context.Background(), mail.Message{To: "john@example.com", Subject: "Hi"})
+	if err == nil {
+		t.Fatal("Expected the send to fail")
+	}
+	if mail.IsPermanent(err) {
+		t.Errorf("Expected a transient error, got %v", err)
+	}
+}
+
+func TestNewSMTPMailer_RequiresHostAndFrom(t *testing.T) {
+	if _, err := mail.NewSMTPMailer(mail.SMTPOptions{From: "noreply@example.com"}); err == nil {
+		t.Error("Expected an error without host")
+	}
+	if _, err := mail.NewSMTPMailer(mail.SMTPOptions{Host: "smtp.example.com"}); err == nil {
+		t.Error("Expected an error without from")
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "mailbox unavailable"}, true},
+		{fmt.Errorf("send: %w", &textproto.Error{Code: 554, Msg: "rejected"}), true},
+		{&textproto.Error{Code: 421, Msg: "try again later"}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	} {
+		if got := mail.IsPermanent(tc.err); got != tc.want {
+			t.Errorf("IsPermanent(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := mail.NewMemoryMailer()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mailer.Send(context.Background(), mail.Message{To: strconv.Itoa(i) + "@example.com"})
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(mailer.Messages()); got != 10 {
+		t.Errorf("Expected 10 messages, got %d", got)
+	}
+	mailer.Reset()
+	if got := len(mailer.Messages()); got != 0 {
+		t.Errorf("Expected no messages after Reset, got %d", got)
+	}
+}
+
+func TestEnvMailer_DriverRequiredOutsideDevelopment(t *testing.T) {
+	if _, err := (&config.Env{MODE: "development"}).Mailer(); err != nil {
+		t.Errorf("Expected the log mailer by default in development, got %v", err)
+	}
+	if _, err := (&config.Env{MODE: "production"}).Mailer(); err == nil || !strings.Contains(err.Error(), "MAIL_DRIVER is required") {
+		t.Errorf("Expected production to require MAIL_DRIVER, got %v", err)
+	}
+	mailer, err := (&config.Env{MODE: "production", MAIL_DRIVER: "log"}).Mailer()
+	if _, ok := mailer.(*mail.LogMailer); err != nil || !ok {
+		t.Errorf("Expected an explicit MAIL_DRIVER=log to be honoured, got %T, %v", mailer, err)
+	}
+}
@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"boilerblade/middleware"
+	"boilerblade/src/audit"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+// auditMetadata returns the audit metadata of a request with locals and an
+// X-Request-ID header
+func auditMetadata(t *testing.T, locals fiber.Map, requestID string) audit.Metadata {
+	var meta audit.Metadata
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(requestid.New())
+	app.Get("/", func(c *fiber.Ctx) error {
+		for key, value := range locals {
+			c.Locals(key, value)
+		}
+		meta = audit.FromContext(middleware.AuditContext(c))
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if requestID != "" {
+		req.Header.Set(fiber.HeaderXRequestID, requestID)
+	}
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	return meta
+}
+
+func TestAuditContext_Actor(t *testing.T) {
+	tests := []struct {
+		name      string
+		locals    fiber.Map
+		actorType string
+		actorID   string
+	}{
+		{"user", fiber.Map{"user_id": "42"}, audit.ActorUser, "42"},
+		{"identity provider user", fiber.Map{"external_subject": "https://idp.example.com#1"}, audit.ActorExternal, "https://idp.example.com#1"},
+		{"API key", fiber.Map{"service": "billing-job"}, audit.ActorAPIKey, "billing-job"},
+		{"mTLS client", fiber.Map{"client_subject": "CN=reporting"}, audit.ActorClient, "CN=reporting"},
+		{"anonymous", fiber.Map{}, audit.ActorAnonymous, ""},
+	}
+	for _, tt := range tests {
+		meta := auditMetadata(t, tt.locals, "req-1")
+		if meta.ActorType != tt.actorType || meta.ActorID != tt.actorID {
+			t.Errorf("%s: expected actor %s/%s, got %s/%s", tt.name, tt.actorType, tt.actorID, meta.ActorType, meta.ActorID)
+		}
+		if meta.Source != audit.SourceHTTP || meta.RequestID != "req-1" {
+			t.Errorf("%s: expected the HTTP source and request ID, got %+v", tt.name, meta)
+		}
+	}
+}
+
+func TestAuditContext_RequestID(t *testing.T) {
+	if meta := auditMetadata(t, nil, ""); meta.RequestID == "" {
+		t.Error("Expected a generated request ID")
+	}
+	if meta := auditMetadata(t, nil, strings.Repeat("x", 300)); len(meta.RequestID) != 255 {
+		t.Errorf("Expected a long request ID to be capped at 255 bytes, got %d", len(meta.RequestID))
+	}
+}
+
+func TestAuditFromContext_DefaultsToSystem(t *testing.T) {
+	meta := audit.FromContext(context.Background())
+	if meta.ActorType != audit.ActorSystem || meta.Source != audit.SourceSystem {
+		t.Errorf("Expected the system actor without metadata, got %+v", meta)
+	}
+}
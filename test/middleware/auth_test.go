@@ -0,0 +1,254 @@
+package middleware_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/auth"
+	"boilerblade/helper"
+	"boilerblade/middleware"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/keyauth/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// setupProtectedApp serves GET /me behind AuthValidator, with locals set like server.Routes
+func setupProtectedApp(locals fiber.Map) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		for key, value := range locals {
+			c.Locals(key, value)
+		}
+		return c.Next()
+	})
+	app.Use(keyauth.New(keyauth.Config{
+		KeyLookup: "header:Authorization",
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			return middleware.AuthValidator(key, c)
+		},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		},
+	}))
+	app.Get("/me", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"user_id": c.Locals("user_id"), "external_subject": c.Locals("external_subject")})
+	})
+	return app
+}
+
+func getMe(t *testing.T, app *fiber.App, token string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"user_id": "42",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthValidator_AppKeyWithoutKeyring(t *testing.T) {
+	app := setupProtectedApp(fiber.Map{"env": &config.Env{APP_KEY: "app-key"}})
+
+	status, body := getMe(t, app, signToken(t, jwt.SigningMethodHS256, "", []byte("app-key")))
+	if status != fiber.StatusOK || body["user_id"] != "42" {
+		t.Errorf("Expected 200 for user 42, got %d %v", status, body)
+	}
+	if status, _ := getMe(t, app, signToken(t, jwt.SigningMethodHS256, "", []byte("other-key"))); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 for a token signed with another key, got %d", status)
+	}
+}
+
+func TestAuthValidator_KeyringWithJWKS(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(fiber.Map{"keys": []fiber.Map{{
+			"kty": "OKP", "crv": "Ed25519", "kid": "idp-1",
+			"x": base64.RawURLEncoding.EncodeToString(public),
+		}}})
+	}))
+	defer jwksServer.Close()
+
+	jwks, _ := auth.NewJWKS(auth.JWKSOptions{URL: jwksServer.URL})
+	if err := jwks.Refresh(t.Context()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	keyring := auth.NewKeyring(map[string][]byte{"": []byte("app-key"), "v2": []byte("rotated-key")}, jwks)
+	app := setupProtectedApp(fiber.Map{"keyring": keyring})
+
+	for name, token := range map[string]string{
+		"HS256 with APP_KEY": signToken(t, jwt.SigningMethodHS256, "", []byte("app-key")),
+		"HS256 with kid v2":  signToken(t, jwt.SigningMethodHS256, "v2", []byte("rotated-key")),
+	} {
+		if status, body := getMe(t, app, token); status != fiber.StatusOK || body["user_id"] != "42" {
+			t.Errorf("%s: expected 200 for user 42, got %d %v", name, status, body)
+		}
+	}
+	if status, _ := getMe(t, app, signToken(t, jwt.SigningMethodEdDSA, "idp-1", private)); status != fiber.StatusOK {
+		t.Errorf("EdDSA from the JWKS: expected 200, got %d", status)
+	}
+
+	if status, _ := getMe(t, app, signToken(t, jwt.SigningMethodHS256, "v1", []byte("retired-key"))); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 for a retired kid, got %d", status)
+	}
+}
+
+func TestAuthValidator_RejectsWithReasonWithoutLoggingToken(t *testing.T) {
+	var logs bytes.Buffer
+	logger := helper.GetLogger()
+	logger.SetOutput(&logs)
+	defer logger.SetOutput(os.Stderr)
+
+	verifier := auth.NewVerifier(auth.NewKeyring(map[string][]byte{"": []byte("app-key")}, nil), auth.ClaimsOptions{
+		Audiences: []string{"boilerblade"},
+		Required:  []string{"exp", "sub"},
+	})
+	app := setupProtectedApp(fiber.Map{"verifier": verifier})
+
+	// Minted for another service with the same key
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "42",
+		"aud": "billing-api",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("app-key"))
+
+	status, body := getMe(t, app, token)
+	if status != fiber.StatusUnauthorized || body["error"] != "token invalid audience" {
+		t.Errorf("Expected 401 token invalid audience, got %d %v", status, body)
+	}
+	if strings.Contains(logs.String(), token[:20]) {
+		t.Errorf("Token logged: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `"reason":"invalid_audience"`) || !strings.Contains(logs.String(), auth.Fingerprint(token)) {
+		t.Errorf("Expected the reason and fingerprint to be logged, got %s", logs.String())
+	}
+}
+
+func TestAuthValidator_SubjectAsUserID(t *testing.T) {
+	verifier := auth.NewVerifier(auth.NewKeyring(map[string][]byte{"": []byte("app-key")}, nil), auth.DefaultClaimsOptions())
+	app := setupProtectedApp(fiber.Map{"verifier": verifier})
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "idp|42",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("app-key"))
+
+	if status, body := getMe(t, app, token); status != fiber.StatusOK || body["user_id"] != "idp|42" {
+		t.Errorf("Expected sub as user_id, got %d %v", status, body)
+	}
+}
+
+func TestAuthValidator_ExternalSubjectIsNotAUserID(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	jwks, _ := auth.NewJWKS(auth.JWKSOptions{File: writeJWKS(t, public)})
+	if err := jwks.Refresh(t.Context()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	verifier := auth.NewVerifier(auth.NewKeyring(map[string][]byte{"": []byte("app-key")}, jwks), auth.DefaultClaimsOptions())
+	app := setupProtectedApp(fiber.Map{"verifier": verifier})
+
+	// The identity provider numbers its users too: its user 1 is not ours
+	for _, claims := range []jwt.MapClaims{
+		{"iss": "https://idp.example.com", "sub": "1"},
+		{"iss": "https://idp.example.com", "sub": "1", "user_id": "1"},
+	} {
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "idp-1"
+		signed, _ := token.SignedString(private)
+
+		status, body := getMe(t, app, signed)
+		if status != fiber.StatusOK || body["user_id"] != nil || body["external_subject"] != "https://idp.example.com#1" {
+			t.Errorf("Expected the external subject and no user_id for %v, got %d %v", claims, status, body)
+		}
+	}
+}
+
+// writeJWKS writes a JWKS holding the Ed25519 key public as idp-1
+func writeJWKS(t *testing.T, public ed25519.PublicKey) string {
+	path := t.TempDir() + "/jwks.json"
+	data, _ := json.Marshal(fiber.Map{"keys": []fiber.Map{{
+		"kty": "OKP", "crv": "Ed25519", "kid": "idp-1",
+		"x": base64.RawURLEncoding.EncodeToString(public),
+	}}})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	return path
+}
+
+// revocationStore is a RevocationStore revoking the jti "revoked", or failing
+type revocationStore struct {
+	err error
+}
+
+func (s revocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s revocationStore) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	return nil
+}
+
+func (s revocationStore) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return jti == "revoked", s.err
+}
+
+func (s revocationStore) UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	return time.Time{}, s.err
+}
+
+func TestAuthValidator_Revocations(t *testing.T) {
+	env := &config.Env{APP_KEY: "app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"}
+	sign := func(jti string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": "42",
+			"jti":     jti,
+			"iat":     time.Now().Unix(),
+			"exp":     time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte("app-key"))
+		return "Bearer " + token
+	}
+
+	app := setupRoutedApp(fiber.Map{"env": env, "revocations": auth.NewRevocations(revocationStore{}, auth.RevocationOptions{})})
+	if status, _ := get(t, app, "/jwt", map[string]string{"Authorization": sign("valid")}); status != fiber.StatusOK {
+		t.Errorf("Expected 200 for a valid token, got %d", status)
+	}
+	status, body := get(t, app, "/jwt", map[string]string{"Authorization": sign("revoked")})
+	if status != fiber.StatusUnauthorized || body["message"] != "token revoked" {
+		t.Errorf("Expected 401 token revoked, got %d %v", status, body)
+	}
+
+	failing := setupRoutedApp(fiber.Map{"env": env, "revocations": auth.NewRevocations(revocationStore{err: errors.New("redis down")}, auth.RevocationOptions{})})
+	if status, _ := get(t, failing, "/jwt", map[string]string{"Authorization": sign("valid")}); status != fiber.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when revocations cannot be checked, got %d", status)
+	}
+}
@@ -0,0 +1,218 @@
+package middleware_test
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/middleware"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockRoleStore is a mock implementation of middleware.RoleStore
+type mockRoleStore struct {
+	userRoles       map[uint][]string
+	rolePermissions map[string][]string
+	err             error
+}
+
+func (m *mockRoleStore) UserRoles(userID uint) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.userRoles[userID], nil
+}
+
+func (m *mockRoleStore) RolePermissions(roles []string) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var permissions []string
+	for _, role := range roles {
+		permissions = append(permissions, m.rolePermissions[role]...)
+	}
+	return permissions, nil
+}
+
+// setupGuardedApp serves guarded user routes, with the locals AuthValidator
+// would store for a token of this app with claims (none when claims is nil)
+// and store as role_store
+func setupGuardedApp(claims jwt.MapClaims, store middleware.RoleStore) *fiber.App {
+	if claims == nil {
+		return setupGuardedTokenApp(nil, store)
+	}
+	return setupGuardedTokenApp(&auth.Token{Claims: claims, Local: true, Trusted: true}, store)
+}
+
+// setupGuardedTokenApp is setupGuardedApp for any verified token
+func setupGuardedTokenApp(token *auth.Token, store middleware.RoleStore) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if token != nil {
+			c.Locals("claims", token.Claims)
+			c.Locals("access_token", token)
+			if userID := token.UserID(); userID != "" {
+				c.Locals("user_id", userID)
+			}
+		}
+		if store != nil {
+			c.Locals("role_store", store)
+		}
+		return c.Next()
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/users", middleware.RequirePermission("users:read"), ok)
+	app.Put("/users/:id", middleware.RequireOwnerOrPermission("id", "users:update"), ok)
+	app.Delete("/users/:id", middleware.RequirePermission("users:delete"), ok)
+	return app
+}
+
+func request(t *testing.T, app *fiber.App, method, path string) (int, map[string]interface{}) {
+	resp, err := app.Test(httptest.NewRequest(method, path, nil))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestPrincipal_Can(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  middleware.Principal
+		permission string
+		want       bool
+	}{
+		{name: "exact", principal: middleware.Principal{Permissions: []string{"users:read"}}, permission: "users:read", want: true},
+		{name: "other", principal: middleware.Principal{Permissions: []string{"users:read"}}, permission: "users:delete", want: false},
+		{name: "resource wildcard", principal: middleware.Principal{Permissions: []string{"users:*"}}, permission: "users:delete", want: true},
+		{name: "resource wildcard other resource", principal: middleware.Principal{Permissions: []string{"users:*"}}, permission: "products:read", want: false},
+		{name: "global wildcard", principal: middleware.Principal{Permissions: []string{"*"}}, permission: "products:delete", want: true},
+		{name: "admin role", principal: middleware.Principal{Roles: []string{middleware.AdminRole}}, permission: "users:delete", want: true},
+		{name: "nothing", principal: middleware.Principal{}, permission: "users:read", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Can(tt.permission); got != tt.want {
+				t.Errorf("Can(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission_Unauthenticated(t *testing.T) {
+	status, _ := request(t, setupGuardedApp(nil, nil), http.MethodGet, "/users")
+	if status != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", status)
+	}
+}
+
+func TestRequirePermission_FromClaims(t *testing.T) {
+	app := setupGuardedApp(jwt.MapClaims{
+		"user_id":     "7",
+		"permissions": []interface{}{"users:read"},
+	}, nil)
+
+	if status, _ := request(t, app, http.MethodGet, "/users"); status != fiber.StatusNoContent {
+		t.Errorf("Expected status 204 for users:read, got %d", status)
+	}
+
+	status, body := request(t, app, http.MethodDelete, "/users/8")
+	if status != fiber.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", status)
+	}
+	if body["message"] != "missing permission users:delete" {
+		t.Errorf("Expected the missing permission in the message, got %v", body["message"])
+	}
+}
+
+func TestRequirePermission_FromScope(t *testing.T) {
+	app := setupGuardedApp(jwt.MapClaims{"user_id": "7", "scope": "profile users:delete"}, nil)
+
+	if status, _ := request(t, app, http.MethodDelete, "/users/8"); status != fiber.StatusNoContent {
+		t.Errorf("Expected the scope claim to grant users:delete, got %d", status)
+	}
+}
+
+func TestRequirePermission_AdminRoleClaim(t *testing.T) {
+	app := setupGuardedApp(jwt.MapClaims{"user_id": "7", "roles": []interface{}{"admin"}}, nil)
+
+	if status, _ := request(t, app, http.MethodDelete, "/users/8"); status != fiber.StatusNoContent {
+		t.Errorf("Expected admin to delete users, got %d", status)
+	}
+}
+
+func TestRequirePermission_ExternalTokenClaims(t *testing.T) {
+	claims := jwt.MapClaims{
+		"iss":         "https://idp.example.com",
+		"sub":         "1",
+		"user_id":     "1",
+		"roles":       []interface{}{"admin"},
+		"permissions": []interface{}{"users:delete"},
+		"scope":       "users:read",
+	}
+	store := &mockRoleStore{
+		userRoles:       map[uint][]string{1: {"admin"}},
+		rolePermissions: map[string][]string{},
+	}
+
+	// Anyone can get a token from some identity provider: its claims grant
+	// nothing, and its sub is not local user 1
+	untrusted := setupGuardedTokenApp(&auth.Token{Claims: claims}, store)
+	for _, route := range [][2]string{{http.MethodGet, "/users"}, {http.MethodDelete, "/users/8"}, {http.MethodPut, "/users/1"}} {
+		if status, _ := request(t, untrusted, route[0], route[1]); status != fiber.StatusForbidden {
+			t.Errorf("Expected status 403 for %s %s with an untrusted token, got %d", route[0], route[1], status)
+		}
+	}
+
+	trusted := setupGuardedTokenApp(&auth.Token{Claims: claims, Trusted: true}, nil)
+	if status, _ := request(t, trusted, http.MethodDelete, "/users/8"); status != fiber.StatusNoContent {
+		t.Errorf("Expected the claims of a trusted issuer to grant users:delete, got %d", status)
+	}
+}
+
+func TestRequirePermission_FromRoleStore(t *testing.T) {
+	store := &mockRoleStore{
+		userRoles:       map[uint][]string{7: {"support"}},
+		rolePermissions: map[string][]string{"support": {"users:*"}},
+	}
+	app := setupGuardedApp(jwt.MapClaims{"user_id": "7"}, store)
+
+	if status, _ := request(t, app, http.MethodDelete, "/users/8"); status != fiber.StatusNoContent {
+		t.Errorf("Expected the stored role to grant users:delete, got %d", status)
+	}
+
+	other := setupGuardedApp(jwt.MapClaims{"user_id": "9"}, store)
+	if status, _ := request(t, other, http.MethodDelete, "/users/8"); status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 for a user without roles, got %d", status)
+	}
+}
+
+func TestRequirePermission_RoleStoreError(t *testing.T) {
+	app := setupGuardedApp(jwt.MapClaims{"user_id": "7"}, &mockRoleStore{err: errors.New("database down")})
+
+	if status, _ := request(t, app, http.MethodGet, "/users"); status != fiber.StatusInternalServerError {
+		t.Errorf("Expected status 500 when roles cannot be loaded, got %d", status)
+	}
+}
+
+func TestRequireOwnerOrPermission(t *testing.T) {
+	user := setupGuardedApp(jwt.MapClaims{"user_id": "7"}, nil)
+	if status, _ := request(t, user, http.MethodPut, "/users/7"); status != fiber.StatusNoContent {
+		t.Errorf("Expected a user to update themselves, got %d", status)
+	}
+	if status, _ := request(t, user, http.MethodPut, "/users/8"); status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 when updating another user, got %d", status)
+	}
+
+	admin := setupGuardedApp(jwt.MapClaims{"user_id": "1", "roles": "admin"}, nil)
+	if status, _ := request(t, admin, http.MethodPut, "/users/8"); status != fiber.StatusNoContent {
+		t.Errorf("Expected admin to update another user, got %d", status)
+	}
+}
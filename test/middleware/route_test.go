@@ -0,0 +1,317 @@
+package middleware_test
+
+import (
+	"boilerblade/config"
+	"boilerblade/config/auth"
+	"boilerblade/middleware"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// setupRoutedApp serves GET /<auth> for each auth, with locals set like server.Routes
+func setupRoutedApp(locals fiber.Map) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		for key, value := range locals {
+			c.Locals(key, value)
+		}
+		return c.Next()
+	})
+	router := middleware.NewRouter(app)
+	for _, auth := range []middleware.Auth{middleware.Public, middleware.JWT, middleware.APIKey, middleware.MTLS, middleware.JWTOrAPIKey} {
+		router.Get("/"+string(auth), auth, func(c *fiber.Ctx) error {
+			return c.JSON(fiber.Map{
+				"user_id":        c.Locals("user_id"),
+				"service":        c.Locals("service"),
+				"client_subject": c.Locals("client_subject"),
+			})
+		})
+	}
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, path string, headers map[string]string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestRouter_PublicAndJWT(t *testing.T) {
+	app := setupRoutedApp(fiber.Map{"env": &config.Env{APP_KEY: "app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"}})
+
+	if status, _ := get(t, app, "/public", nil); status != fiber.StatusOK {
+		t.Errorf("Expected a public route without credentials to answer 200, got %d", status)
+	}
+	if status, _ := get(t, app, "/jwt", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected a JWT route without token to answer 401, got %d", status)
+	}
+
+	token := signToken(t, jwt.SigningMethodHS256, "", []byte("app-key"))
+	status, body := get(t, app, "/jwt", map[string]string{"Authorization": "Bearer " + token})
+	if status != fiber.StatusOK || body["user_id"] != "42" {
+		t.Errorf("Expected 200 for user 42, got %d %v", status, body)
+	}
+}
+
+type failingAPIKeys struct{}
+
+func (failingAPIKeys) AuthenticateAPIKey(key string) (*auth.Service, error) {
+	return nil, errors.New("database down")
+}
+
+func TestRouter_APIKey(t *testing.T) {
+	keys, err := auth.ParseAPIKeys("billing:billing-secret")
+	if err != nil {
+		t.Fatalf("ParseAPIKeys failed: %v", err)
+	}
+	app := setupRoutedApp(fiber.Map{"api_keys": keys})
+
+	status, body := get(t, app, "/api_key", map[string]string{middleware.APIKeyHeader: "billing-secret"})
+	if status != fiber.StatusOK || body["service"] != "billing" {
+		t.Errorf("Expected 200 for the billing service, got %d %v", status, body)
+	}
+	if status, _ := get(t, app, "/api_key", map[string]string{middleware.APIKeyHeader: "guess"}); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown key, got %d", status)
+	}
+	if status, _ := get(t, app, "/api_key", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 without key, got %d", status)
+	}
+
+	// A bearer token does not open an API key route
+	token := signToken(t, jwt.SigningMethodHS256, "", []byte("app-key"))
+	if status, _ := get(t, app, "/api_key", map[string]string{"Authorization": "Bearer " + token}); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bearer token, got %d", status)
+	}
+
+	failing := setupRoutedApp(fiber.Map{"api_keys": failingAPIKeys{}})
+	if status, _ := get(t, failing, "/api_key", map[string]string{middleware.APIKeyHeader: "billing-secret"}); status != fiber.StatusInternalServerError {
+		t.Errorf("Expected 500 when keys cannot be checked, got %d", status)
+	}
+}
+
+// serviceKeys stands in for the database keys of one service with scopes
+type serviceKeys struct{}
+
+func (serviceKeys) AuthenticateAPIKey(key string) (*auth.Service, error) {
+	if key != "bbk_3f9a1c2b7d4e_secret" {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	return &auth.Service{Name: "report-job", KeyID: 7, Scopes: []string{"users:read"}}, nil
+}
+
+func TestRouter_APIKeyAuthenticatorsFallThrough(t *testing.T) {
+	static, _ := auth.ParseAPIKeys("billing:billing-secret")
+	app := setupRoutedApp(fiber.Map{"api_keys": middleware.APIKeyAuthenticators{static, serviceKeys{}}})
+
+	for key, service := range map[string]string{"billing-secret": "billing", "bbk_3f9a1c2b7d4e_secret": "report-job"} {
+		status, body := get(t, app, "/api_key", map[string]string{middleware.APIKeyHeader: key})
+		if status != fiber.StatusOK || body["service"] != service {
+			t.Errorf("Expected 200 for %s, got %d %v", service, status, body)
+		}
+	}
+	if status, _ := get(t, app, "/api_key", map[string]string{middleware.APIKeyHeader: "guess"}); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 when no authenticator knows the key, got %d", status)
+	}
+}
+
+func TestRouter_JWTOrAPIKey(t *testing.T) {
+	app := setupRoutedApp(fiber.Map{
+		"env":      &config.Env{APP_KEY: "app-key", AUTH_REQUIRED_CLAIMS: "exp,sub"},
+		"api_keys": serviceKeys{},
+	})
+	token := signToken(t, jwt.SigningMethodHS256, "", []byte("app-key"))
+
+	status, body := get(t, app, "/jwt_or_api_key", map[string]string{"Authorization": "Bearer " + token})
+	if status != fiber.StatusOK || body["user_id"] != "42" {
+		t.Errorf("Expected 200 for user 42, got %d %v", status, body)
+	}
+	status, body = get(t, app, "/jwt_or_api_key", map[string]string{middleware.APIKeyHeader: "bbk_3f9a1c2b7d4e_secret"})
+	if status != fiber.StatusOK || body["service"] != "report-job" || body["user_id"] != nil {
+		t.Errorf("Expected 200 for the report-job service, got %d %v", status, body)
+	}
+	// A wrong key is not rescued by a valid token
+	headers := map[string]string{"Authorization": "Bearer " + token, middleware.APIKeyHeader: "guess"}
+	if status, _ := get(t, app, "/jwt_or_api_key", headers); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong key, got %d", status)
+	}
+	if status, _ := get(t, app, "/jwt_or_api_key", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", status)
+	}
+}
+
+func TestRouter_APIKeyScopesArePermissions(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("api_keys", serviceKeys{})
+		return c.Next()
+	})
+	router := middleware.NewRouter(app)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	router.Get("/users", middleware.APIKey, middleware.RequirePermission("users:read"), ok)
+	router.Delete("/users", middleware.APIKey, middleware.RequirePermission("users:delete"), ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(middleware.APIKeyHeader, "bbk_3f9a1c2b7d4e_secret")
+	if resp, _ := app.Test(req); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected a granted scope to answer 200, got %d", resp.StatusCode)
+	}
+	req = httptest.NewRequest(http.MethodDelete, "/users", nil)
+	req.Header.Set(middleware.APIKeyHeader, "bbk_3f9a1c2b7d4e_secret")
+	if resp, _ := app.Test(req); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("Expected a missing scope to answer 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestRouter_MTLSWithoutTLS(t *testing.T) {
+	app := setupRoutedApp(nil)
+
+	if status, _ := get(t, app, "/mtls", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 without a client certificate, got %d", status)
+	}
+}
+
+func TestRouter_Routes(t *testing.T) {
+	app := fiber.New()
+	router := middleware.NewRouter(app)
+	router.Post("/auth/login", middleware.Public, func(c *fiber.Ctx) error { return nil })
+	router.Group("/admin").Delete("/keys/:id", middleware.JWT, func(c *fiber.Ctx) error { return nil })
+
+	routes := router.Routes()
+	want := []middleware.Route{
+		{Method: fiber.MethodPost, Path: "/auth/login", Auth: middleware.Public},
+		{Method: fiber.MethodDelete, Path: "/admin/keys/:id", Auth: middleware.JWT},
+	}
+	if len(routes) != len(want) || routes[0] != want[0] || routes[1] != want[1] {
+		t.Errorf("Routes() = %v, want %v", routes, want)
+	}
+}
+
+func TestRouter_UnknownAuthPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a route with an unknown auth to panic")
+		}
+	}()
+	middleware.NewRouter(fiber.New()).Get("/typo", middleware.Auth("jtw"), func(c *fiber.Ctx) error { return nil })
+}
+
+// testCA issues certificates for the mTLS test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestRouter_MTLS(t *testing.T) {
+	ca := newTestCA(t)
+	app := setupRoutedApp(fiber.Map{"env": &config.Env{AUTH_MTLS_SUBJECTS: "billing"}})
+
+	// Client certificates are verified when given, like config.Env.TLSConfig
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	fetch := func(cert *tls.Certificate, path string) (int, map[string]interface{}) {
+		clientConfig := &tls.Config{RootCAs: ca.pool}
+		if cert != nil {
+			clientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 5 * time.Second}
+		resp, err := client.Get("https://" + ln.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	billing := ca.issue(t, "billing", x509.ExtKeyUsageClientAuth)
+	status, body := fetch(&billing, "/mtls")
+	if status != fiber.StatusOK || body["client_subject"] != "billing" {
+		t.Errorf("Expected 200 for the billing certificate, got %d %v", status, body)
+	}
+
+	other := ca.issue(t, "reporting", x509.ExtKeyUsageClientAuth)
+	if status, _ := fetch(&other, "/mtls"); status != fiber.StatusForbidden {
+		t.Errorf("Expected 403 for a certificate outside AUTH_MTLS_SUBJECTS, got %d", status)
+	}
+
+	if status, _ := fetch(nil, "/mtls"); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected 401 without a client certificate, got %d", status)
+	}
+	if status, _ := fetch(nil, "/public"); status != fiber.StatusOK {
+		t.Errorf("Expected public routes to work without a client certificate, got %d", status)
+	}
+}
@@ -0,0 +1,136 @@
+package repository_test
+
+import (
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// note is a row fn writes, to check it commits or rolls back with the inbox
+type note struct {
+	ID   uint `gorm:"primaryKey"`
+	Text string
+}
+
+// newInboxDB opens an in-memory SQLite database (pure Go, no CGO) with the
+// inbox table, private to the test
+func newInboxDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open SQLite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	// One connection: the in-memory database lives as long as it does
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&model.InboxMessage{}, &note{}); err != nil {
+		t.Fatalf("AutoMigrate failed: %v", err)
+	}
+	return db
+}
+
+func countRows(t *testing.T, db *gorm.DB, value interface{}) int64 {
+	var count int64
+	if err := db.Model(value).Count(&count).Error; err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	return count
+}
+
+func writeNote(text string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Create(&note{Text: text}).Error
+	}
+}
+
+func TestInboxRepository_RunOnce_FirstDeliveryRuns(t *testing.T) {
+	db := newInboxDB(t)
+	repo := repository.NewInboxRepository(db)
+
+	processed, err := repo.RunOnce(context.Background(), "msg-1", "user_consumer", writeNote("first"))
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if !processed {
+		t.Error("Expected the first delivery to be processed")
+	}
+	if count := countRows(t, db, &note{}); count != 1 {
+		t.Errorf("Expected fn's write to be committed, got %d rows", count)
+	}
+
+	var inbox model.InboxMessage
+	if err := db.First(&inbox).Error; err != nil {
+		t.Fatalf("Expected an inbox row: %v", err)
+	}
+	if inbox.MessageID != "msg-1" || inbox.Consumer != "user_consumer" || inbox.ProcessedAt.IsZero() {
+		t.Errorf("Unexpected inbox row: %+v", inbox)
+	}
+}
+
+func TestInboxRepository_RunOnce_DuplicateSkipped(t *testing.T) {
+	db := newInboxDB(t)
+	repo := repository.NewInboxRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.RunOnce(ctx, "msg-1", "user_consumer", writeNote("first")); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	processed, err := repo.RunOnce(ctx, "msg-1", "user_consumer", func(tx *gorm.DB) error {
+		t.Error("Expected fn not to run for a duplicate")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunOnce of the duplicate failed: %v", err)
+	}
+	if processed {
+		t.Error("Expected the duplicate not to be processed")
+	}
+
+	// The same message is still new to another consumer
+	if processed, err := repo.RunOnce(ctx, "msg-1", "audit_consumer", writeNote("other")); err != nil || !processed {
+		t.Errorf("Expected another consumer to process msg-1, got %v, %v", processed, err)
+	}
+	if count := countRows(t, db, &model.InboxMessage{}); count != 2 {
+		t.Errorf("Expected 2 inbox rows, got %d", count)
+	}
+}
+
+func TestInboxRepository_RunOnce_ErrorRollsBack(t *testing.T) {
+	db := newInboxDB(t)
+	repo := repository.NewInboxRepository(db)
+	ctx := context.Background()
+	errHandler := errors.New("handler failed")
+
+	processed, err := repo.RunOnce(ctx, "msg-1", "user_consumer", func(tx *gorm.DB) error {
+		if err := writeNote("partial")(tx); err != nil {
+			return err
+		}
+		return errHandler
+	})
+	if !errors.Is(err, errHandler) || processed {
+		t.Fatalf("Expected fn's error and not processed, got %v, %v", processed, err)
+	}
+	if count := countRows(t, db, &model.InboxMessage{}); count != 0 {
+		t.Errorf("Expected no inbox row after the error, got %d", count)
+	}
+	if count := countRows(t, db, &note{}); count != 0 {
+		t.Errorf("Expected fn's write to be rolled back, got %d rows", count)
+	}
+
+	// The redelivery is not taken for a duplicate
+	processed, err = repo.RunOnce(ctx, "msg-1", "user_consumer", writeNote("retry"))
+	if err != nil || !processed {
+		t.Fatalf("Expected the redelivery to be processed, got %v, %v", processed, err)
+	}
+	if count := countRows(t, db, &note{}); count != 1 {
+		t.Errorf("Expected the redelivery's write to be committed, got %d rows", count)
+	}
+}
@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"boilerblade/src/model"
+	"context"
 	"testing"
 
 	"gorm.io/gorm"
@@ -27,6 +28,15 @@ func (m *mockUserRepository) Create(user *model.User) error {
 	return nil
 }
 
+func (m *mockUserRepository) CreateBatch(ctx context.Context, users []*model.User, batchSize int) error {
+	for _, user := range users {
+		if err := m.Create(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockUserRepository) GetByID(id uint) (*model.User, error) {
 	for _, user := range m.users {
 		if user.ID == id && !user.DeletedAt.Valid {
@@ -121,6 +131,28 @@ func TestMockUserRepository_Create(t *testing.T) {
 	}
 }
 
+func TestMockUserRepository_CreateBatch(t *testing.T) {
+	repo := newMockUserRepository()
+
+	users := []*model.User{
+		{Name: "User 1", Email: "user1@example.com"},
+		{Name: "User 2", Email: "user2@example.com"},
+		{Name: "User 3", Email: "user3@example.com"},
+	}
+	if err := repo.CreateBatch(context.Background(), users, 2); err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+
+	for _, user := range users {
+		if user.ID == 0 {
+			t.Errorf("User ID should be set after creation for %s", user.Email)
+		}
+	}
+	if count, _ := repo.Count(); count != 3 {
+		t.Errorf("Expected 3 users, got %d", count)
+	}
+}
+
 func TestMockUserRepository_GetByID(t *testing.T) {
 	repo := newMockUserRepository()
 
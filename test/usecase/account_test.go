@@ -0,0 +1,413 @@
+package usecase_test
+
+import (
+	"boilerblade/config/mail"
+	"boilerblade/helper"
+	"boilerblade/src/audit"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/usecase"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mockUserTokenRepository is a mock implementation of UserTokenRepository for testing
+type mockUserTokenRepository struct {
+	tokens []*model.UserToken
+}
+
+func (m *mockUserTokenRepository) Create(token *model.UserToken) error {
+	token.ID = uint(len(m.tokens) + 1)
+	token.CreatedAt = time.Now()
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockUserTokenRepository) GetByHash(purpose, tokenHash string) (*model.UserToken, error) {
+	for _, token := range m.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockUserTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	for _, token := range m.tokens {
+		if token.ID == id && token.UsedAt == nil {
+			token.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUserTokenRepository) InvalidateUser(userID uint, purpose string, at time.Time) error {
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &at
+		}
+	}
+	return nil
+}
+
+// mockLoginLockout is a mock implementation of LoginLockout for testing
+type mockLoginLockout struct {
+	maxAttempts int
+	failures    map[string]int
+	locked      map[string]bool
+	resets      int
+	err         error
+}
+
+func newMockLoginLockout(maxAttempts int) *mockLoginLockout {
+	return &mockLoginLockout{maxAttempts: maxAttempts, failures: map[string]int{}, locked: map[string]bool{}}
+}
+
+func (m *mockLoginLockout) Locked(ctx context.Context, email string) (time.Duration, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	if m.locked[email] {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (m *mockLoginLockout) Fail(ctx context.Context, email string) (time.Duration, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.failures[email]++
+	if m.failures[email] >= m.maxAttempts {
+		m.locked[email] = true
+		delete(m.failures, email)
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (m *mockLoginLockout) Reset(ctx context.Context, email string) error {
+	m.resets++
+	delete(m.failures, email)
+	delete(m.locked, email)
+	return m.err
+}
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// mailedToken returns the token of the last email sent by mailer
+func mailedToken(t *testing.T, mailer *mail.MemoryMailer) string {
+	messages := mailer.Messages()
+	if len(messages) == 0 {
+		t.Fatal("Expected an email")
+	}
+	match := tokenPattern.FindStringSubmatch(messages[len(messages)-1].Text)
+	if match == nil {
+		t.Fatalf("No token link in %q", messages[len(messages)-1].Text)
+	}
+	return match[1]
+}
+
+// newAccountUsecase returns an account usecase with one unverified user
+func newAccountUsecase(t *testing.T, opts usecase.AccountOptions) (usecase.AccountUsecase, *mockUserRepository, *mockUserTokenRepository, *mail.MemoryMailer) {
+	userRepo := newMockUserRepository()
+	if err := userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	tokenRepo := &mockUserTokenRepository{}
+	mailer := mail.NewMemoryMailer()
+	opts.VerificationURL = "https://app.example.com/verify-email"
+	opts.PasswordResetURL = "https://app.example.com/reset-password"
+	return usecase.NewAccountUsecase(userRepo, tokenRepo, mailer, event.NewNoopPublisher(), nil, opts), userRepo, tokenRepo, mailer
+}
+
+func TestAccountUsecase_VerifyEmail(t *testing.T) {
+	uc, userRepo, tokenRepo, mailer := newAccountUsecase(t, usecase.AccountOptions{})
+
+	if err := uc.RequestEmailVerification("john@example.com"); err != nil {
+		t.Fatalf("RequestEmailVerification failed: %v", err)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "john@example.com" {
+		t.Fatalf("Expected one email to john@example.com, got %+v", messages)
+	}
+	if !strings.Contains(messages[0].Text, "https://app.example.com/verify-email?token=") || !strings.Contains(messages[0].Text, "24 hours") {
+		t.Errorf("Unexpected email text %q", messages[0].Text)
+	}
+	token := mailedToken(t, mailer)
+	if tokenRepo.tokens[0].TokenHash == token || tokenRepo.tokens[0].Email != "john@example.com" {
+		t.Errorf("Expected the hash of the token and its address to be stored, got %+v", tokenRepo.tokens[0])
+	}
+
+	if err := uc.VerifyEmail(token); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if userRepo.users[0].EmailVerifiedAt == nil {
+		t.Fatal("Expected the email to be verified")
+	}
+	if err := uc.VerifyEmail(token); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("Second VerifyEmail = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// A verified email gets no more verification emails
+	if err := uc.RequestEmailVerification("john@example.com"); err != nil {
+		t.Fatalf("RequestEmailVerification failed: %v", err)
+	}
+	if len(mailer.Messages()) != 1 {
+		t.Errorf("Expected no email for a verified address, got %d", len(mailer.Messages()))
+	}
+}
+
+func TestAccountUsecase_UnknownEmailIsIgnored(t *testing.T) {
+	uc, _, tokenRepo, mailer := newAccountUsecase(t, usecase.AccountOptions{})
+
+	if err := uc.RequestEmailVerification("nobody@example.com"); err != nil {
+		t.Errorf("RequestEmailVerification = %v, want nil", err)
+	}
+	if err := uc.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Errorf("RequestPasswordReset = %v, want nil", err)
+	}
+	if len(mailer.Messages()) != 0 || len(tokenRepo.tokens) != 0 {
+		t.Errorf("Expected no email and no token, got %d and %d", len(mailer.Messages()), len(tokenRepo.tokens))
+	}
+}
+
+func TestAccountUsecase_RefusesInvalidTokens(t *testing.T) {
+	uc, userRepo, tokenRepo, mailer := newAccountUsecase(t, usecase.AccountOptions{})
+
+	if err := uc.VerifyEmail("unknown"); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail(unknown) = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// Only the latest email works
+	uc.RequestEmailVerification("john@example.com")
+	first := mailedToken(t, mailer)
+	uc.RequestEmailVerification("john@example.com")
+	if err := uc.VerifyEmail(first); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail(superseded) = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// Expired
+	uc.RequestEmailVerification("john@example.com")
+	expired := mailedToken(t, mailer)
+	tokenRepo.tokens[len(tokenRepo.tokens)-1].ExpiresAt = time.Now().Add(-time.Second)
+	if err := uc.VerifyEmail(expired); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail(expired) = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// Mailed to an address the user changed since
+	uc.RequestEmailVerification("john@example.com")
+	stale := mailedToken(t, mailer)
+	userRepo.users[0].Email = "john.doe@example.com"
+	if err := uc.VerifyEmail(stale); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("VerifyEmail(old address) = %v, want ErrInvalidAccountToken", err)
+	}
+
+	// A verification token cannot reset the password
+	userRepo.users[0].Email = "john@example.com"
+	uc.RequestEmailVerification("john@example.com")
+	if err := uc.ResetPassword(mailedToken(t, mailer), "new-password123"); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("ResetPassword(verification token) = %v, want ErrInvalidAccountToken", err)
+	}
+	if userRepo.users[0].EmailVerifiedAt != nil {
+		t.Error("Expected the email to stay unverified")
+	}
+}
+
+func TestAccountUsecase_ResetPassword(t *testing.T) {
+	revoker := newMockTokenRevoker()
+	lockout := newMockLoginLockout(3)
+	lockout.locked["john@example.com"] = true
+	uc, userRepo, _, mailer := newAccountUsecase(t, usecase.AccountOptions{
+		PasswordResetTTL: 30 * time.Minute,
+		Revoker:          revoker,
+		Lockout:          lockout,
+	})
+
+	if err := uc.RequestPasswordReset("john@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0].Text, "https://app.example.com/reset-password?token=") || !strings.Contains(messages[0].Text, "30 minutes") {
+		t.Fatalf("Unexpected emails %+v", messages)
+	}
+	token := mailedToken(t, mailer)
+
+	if err := uc.ResetPassword(token, "new-password123"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	user := userRepo.users[0]
+	if ok, _ := helper.VerifyPassword(user.Password, "new-password123"); !ok {
+		t.Error("Expected the new password to be stored")
+	}
+	if _, ok := revoker.users["1"]; !ok {
+		t.Error("Expected the tokens of the user to be revoked")
+	}
+	if lockout.locked["john@example.com"] {
+		t.Error("Expected the lockout to be cleared")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("Expected the reset to verify the email")
+	}
+	if err := uc.ResetPassword(token, "other-password123"); !errors.Is(err, usecase.ErrInvalidAccountToken) {
+		t.Errorf("Second ResetPassword = %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestAccountUsecase_ResetPassword_RevocationFailureKeepsPassword(t *testing.T) {
+	revoker := newMockTokenRevoker()
+	revoker.err = errors.New("redis down")
+	uc, userRepo, _, mailer := newAccountUsecase(t, usecase.AccountOptions{Revoker: revoker})
+	stored := userRepo.users[0].Password
+
+	uc.RequestPasswordReset("john@example.com")
+	if err := uc.ResetPassword(mailedToken(t, mailer), "new-password123"); err == nil {
+		t.Fatal("Expected ResetPassword to fail")
+	}
+	if userRepo.users[0].Password != stored {
+		t.Error("Expected the password to be unchanged")
+	}
+}
+
+func TestAccountUsecase_AuditsAsTheUser(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: "x"})
+	auditRepo := &mockAuditLogRepository{}
+	mailer := mail.NewMemoryMailer()
+	uc := usecase.NewAccountUsecase(userRepo, &mockUserTokenRepository{}, mailer, nil, usecase.NewAuditor(auditRepo), usecase.AccountOptions{
+		PasswordResetURL: "https://app.example.com/reset-password",
+	})
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{
+		ActorType: audit.ActorAnonymous, RequestID: "req-1", Source: audit.SourceHTTP,
+	})
+
+	uc.RequestPasswordReset("john@example.com")
+	if err := uc.WithContext(ctx).ResetPassword(mailedToken(t, mailer), "new-password123"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if len(auditRepo.logs) != 1 {
+		t.Fatalf("Expected one audit log, got %d", len(auditRepo.logs))
+	}
+	log := auditRepo.logs[0]
+	if log.ActorType != audit.ActorUser || log.ActorID != "1" || log.RequestID != "req-1" || log.Action != event.ActionUpdated {
+		t.Errorf("Unexpected audit log %+v", log)
+	}
+	if change := changes(t, log)["password"]; change.Before != "***" || change.After != "***" {
+		t.Errorf("Expected a redacted password change, got %+v", change)
+	}
+}
+
+func TestUserUsecase_EmailChangeUnverifies(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	verifiedAt := time.Now()
+	mockRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: "x", EmailVerifiedAt: &verifiedAt})
+	uc := usecase.NewUserUsecase(mockRepo, nil, nil, nil)
+
+	if _, err := uc.UpdateUser(1, &dto.UpdateUserRequest{Name: "John", Email: "john@example.com"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if mockRepo.users[0].EmailVerifiedAt == nil {
+		t.Error("Expected the email to stay verified when unchanged")
+	}
+	if _, err := uc.UpdateUser(1, &dto.UpdateUserRequest{Email: "john.doe@example.com"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if mockRepo.users[0].EmailVerifiedAt != nil {
+		t.Error("Expected a new email to be unverified")
+	}
+}
+
+func TestAuthUsecase_Login_Lockout(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	lockout := newMockLoginLockout(3)
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey: []byte(testSigningKey),
+		Lockout:    lockout,
+	})
+	wrong := &dto.LoginRequest{Email: "john@example.com", Password: "wrong"}
+	right := &dto.LoginRequest{Email: "john@example.com", Password: "password123"}
+
+	// A success clears the failures
+	uc.Login(wrong)
+	if _, err := uc.Login(right); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if lockout.failures["john@example.com"] != 0 {
+		t.Errorf("Expected the failures to be cleared, got %d", lockout.failures["john@example.com"])
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := uc.Login(wrong); !errors.Is(err, usecase.ErrInvalidCredentials) {
+			t.Fatalf("Login %d = %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	_, err := uc.Login(wrong)
+	var locked *usecase.AccountLockedError
+	if !errors.As(err, &locked) || !errors.Is(err, usecase.ErrAccountLocked) || locked.RetryAfter != time.Minute {
+		t.Fatalf("Third failure = %v, want an AccountLockedError", err)
+	}
+
+	// Locked: the right password is not even checked
+	if _, err := uc.Login(right); !errors.Is(err, usecase.ErrAccountLocked) {
+		t.Errorf("Login while locked = %v, want ErrAccountLocked", err)
+	}
+
+	// Unknown emails are counted too
+	unknown := &dto.LoginRequest{Email: "nobody@example.com", Password: "wrong"}
+	uc.Login(unknown)
+	if lockout.failures["nobody@example.com"] != 1 {
+		t.Errorf("Expected the unknown email to be counted, got %v", lockout.failures)
+	}
+}
+
+func TestAuthUsecase_Login_LockoutFailsOpen(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	lockout := newMockLoginLockout(1)
+	lockout.err = errors.New("redis down")
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey: []byte(testSigningKey),
+		Lockout:    lockout,
+	})
+
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "wrong"}); !errors.Is(err, usecase.ErrInvalidCredentials) {
+		t.Errorf("Login = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"}); err != nil {
+		t.Errorf("Login failed: %v", err)
+	}
+}
+
+func TestAuthUsecase_Login_RequireVerifiedEmail(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey:           []byte(testSigningKey),
+		RequireVerifiedEmail: true,
+	})
+	req := &dto.LoginRequest{Email: "john@example.com", Password: "password123"}
+
+	if _, err := uc.Login(req); !errors.Is(err, usecase.ErrEmailNotVerified) {
+		t.Fatalf("Login = %v, want ErrEmailNotVerified", err)
+	}
+	// A wrong password does not tell whether the email is verified
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "wrong"}); !errors.Is(err, usecase.ErrInvalidCredentials) {
+		t.Errorf("Login = %v, want ErrInvalidCredentials", err)
+	}
+
+	verifiedAt := time.Now()
+	userRepo.users[0].EmailVerifiedAt = &verifiedAt
+	if _, err := uc.Login(req); err != nil {
+		t.Errorf("Login failed: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package usecase_test
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/src/dto"
+	"boilerblade/src/model"
+	"boilerblade/src/usecase"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// mockAPIKeyRepository is a mock implementation of APIKeyRepository for testing
+type mockAPIKeyRepository struct {
+	keys    []*model.APIKey
+	nextID  uint
+	touches int
+}
+
+func newMockAPIKeyRepository() *mockAPIKeyRepository {
+	return &mockAPIKeyRepository{nextID: 1}
+}
+
+func (m *mockAPIKeyRepository) Create(key *model.APIKey) error {
+	key.ID = m.nextID
+	key.CreatedAt = time.Now()
+	m.nextID++
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *mockAPIKeyRepository) find(match func(*model.APIKey) bool) (*model.APIKey, error) {
+	for _, key := range m.keys {
+		if match(key) {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockAPIKeyRepository) GetByID(id uint) (*model.APIKey, error) {
+	return m.find(func(key *model.APIKey) bool { return key.ID == id })
+}
+
+func (m *mockAPIKeyRepository) GetByPrefix(prefix string) (*model.APIKey, error) {
+	return m.find(func(key *model.APIKey) bool { return key.Prefix == prefix })
+}
+
+func (m *mockAPIKeyRepository) GetAll(limit, offset int, includeRevoked bool) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	for _, key := range m.keys {
+		if includeRevoked || key.RevokedAt == nil {
+			keys = append(keys, *key)
+		}
+	}
+	if offset >= len(keys) {
+		return nil, nil
+	}
+	return keys[offset:min(offset+limit, len(keys))], nil
+}
+
+func (m *mockAPIKeyRepository) Count(includeRevoked bool) (int64, error) {
+	keys, _ := m.GetAll(len(m.keys), 0, includeRevoked)
+	return int64(len(keys)), nil
+}
+
+func (m *mockAPIKeyRepository) Update(key *model.APIKey) error {
+	for i, stored := range m.keys {
+		if stored.ID == key.ID {
+			copied := *key
+			m.keys[i] = &copied
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *mockAPIKeyRepository) TouchLastUsed(id uint, at time.Time) error {
+	m.touches++
+	for _, key := range m.keys {
+		if key.ID == id {
+			key.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func createAPIKey(t *testing.T, uc usecase.APIKeyUsecase, req *dto.CreateAPIKeyRequest) *dto.APIKeyCreatedResponse {
+	created, err := uc.Create(req)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return created
+}
+
+func TestAPIKeyUsecase_CreateStoresHashOnly(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+
+	created := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "billing-job", Scopes: []string{"users:read"}, ExpiresInDays: 30})
+
+	if !strings.HasPrefix(created.Key, usecase.APIKeyMarker+created.APIKey.Prefix+"_") {
+		t.Errorf("Expected the key to start with the marker and prefix, got %q", created.Key)
+	}
+	stored := repo.keys[0]
+	if stored.KeyHash == "" || strings.Contains(stored.KeyHash, created.Key) || stored.Scopes != "users:read" {
+		t.Errorf("Unexpected stored key: %+v", stored)
+	}
+	if created.APIKey.ExpiresAt == nil {
+		t.Error("Expected an expiry")
+	}
+}
+
+func TestAPIKeyUsecase_Authenticate(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+	created := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "billing-job", Scopes: []string{"users:read", "orders:*"}})
+
+	service, err := uc.AuthenticateAPIKey(created.Key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if service.Name != "billing-job" || service.KeyID != created.APIKey.ID || strings.Join(service.Scopes, " ") != "users:read orders:*" {
+		t.Errorf("Unexpected service: %+v", service)
+	}
+	if repo.keys[0].LastUsedAt == nil {
+		t.Error("Expected last_used_at to be recorded")
+	}
+
+	// Uses within a minute are not written again
+	uc.AuthenticateAPIKey(created.Key)
+	if repo.touches != 1 {
+		t.Errorf("Expected one last_used_at write, got %d", repo.touches)
+	}
+
+	tampered := created.Key[:len(created.Key)-1] + "x"
+	if created.Key[len(created.Key)-1] == 'x' {
+		tampered = created.Key[:len(created.Key)-1] + "y"
+	}
+	for _, key := range []string{tampered, "bbk_000000000000_secret", "not-a-key", ""} {
+		if _, err := uc.AuthenticateAPIKey(key); !errors.Is(err, auth.ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey(%q): expected ErrInvalidAPIKey, got %v", key, err)
+		}
+	}
+}
+
+func TestAPIKeyUsecase_AuthenticateRejectsExpiredAndRevoked(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+
+	expired := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "expired-job"})
+	past := time.Now().Add(-time.Minute)
+	repo.keys[0].ExpiresAt = &past
+	if _, err := uc.AuthenticateAPIKey(expired.Key); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("Expected an expired key to be rejected, got %v", err)
+	}
+
+	revoked := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "revoked-job"})
+	if err := uc.Revoke(revoked.APIKey.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := uc.AuthenticateAPIKey(revoked.Key); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("Expected a revoked key to be rejected, got %v", err)
+	}
+	if err := uc.Revoke(revoked.APIKey.ID); err != nil {
+		t.Errorf("Expected revoking twice to succeed, got %v", err)
+	}
+	if err := uc.Revoke(99); !errors.Is(err, usecase.ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestAPIKeyUsecase_Rotate(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+	old := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "billing-job", Scopes: []string{"users:read"}, ExpiresInDays: 90})
+
+	grace := 3600
+	rotated, err := uc.Rotate(old.APIKey.ID, &dto.RotateAPIKeyRequest{GracePeriod: &grace})
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated.Key == old.Key || rotated.APIKey.Name != "billing-job" || strings.Join(rotated.APIKey.Scopes, " ") != "users:read" {
+		t.Errorf("Unexpected rotated key: %+v", rotated.APIKey)
+	}
+	if rotated.APIKey.ExpiresAt == nil {
+		t.Error("Expected the rotated key to keep the 90 day lifetime")
+	}
+
+	stored := repo.keys[0]
+	if stored.ReplacedByID == nil || *stored.ReplacedByID != rotated.APIKey.ID {
+		t.Errorf("Expected the old key to point to its replacement, got %v", stored.ReplacedByID)
+	}
+	if stored.ExpiresAt == nil || time.Until(*stored.ExpiresAt) > time.Hour || time.Until(*stored.ExpiresAt) < 59*time.Minute {
+		t.Errorf("Expected the old key to expire after the grace period, got %v", stored.ExpiresAt)
+	}
+
+	// Both keys work during the grace period
+	if _, err := uc.AuthenticateAPIKey(old.Key); err != nil {
+		t.Errorf("Expected the old key to work during the grace period, got %v", err)
+	}
+	if _, err := uc.AuthenticateAPIKey(rotated.Key); err != nil {
+		t.Errorf("Expected the new key to work, got %v", err)
+	}
+
+	if _, err := uc.Rotate(old.APIKey.ID, &dto.RotateAPIKeyRequest{}); !errors.Is(err, usecase.ErrAPIKeyInactive) {
+		t.Errorf("Expected ErrAPIKeyInactive when rotating twice, got %v", err)
+	}
+	if _, err := uc.Rotate(99, &dto.RotateAPIKeyRequest{}); !errors.Is(err, usecase.ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestAPIKeyUsecase_RotateWithoutGrace(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+	old := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "billing-job"})
+
+	none := 0
+	if _, err := uc.Rotate(old.APIKey.ID, &dto.RotateAPIKeyRequest{GracePeriod: &none}); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err := uc.AuthenticateAPIKey(old.Key); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Errorf("Expected the old key to stop working at once, got %v", err)
+	}
+}
+
+func TestAPIKeyUsecase_List(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	uc := usecase.NewAPIKeyUsecase(repo)
+	createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "first"})
+	second := createAPIKey(t, uc, &dto.CreateAPIKeyRequest{Name: "second"})
+	uc.Revoke(second.APIKey.ID)
+
+	active, err := uc.List(10, 0, false)
+	if err != nil || active.Total != 1 || len(active.APIKeys) != 1 || active.APIKeys[0].Name != "first" {
+		t.Errorf("Unexpected active keys: %+v, %v", active, err)
+	}
+	all, _ := uc.List(10, 0, true)
+	if all.Total != 2 {
+		t.Errorf("Expected 2 keys with revoked ones, got %d", all.Total)
+	}
+}
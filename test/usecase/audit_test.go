@@ -0,0 +1,192 @@
+package usecase_test
+
+import (
+	"boilerblade/src/audit"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/repository"
+	"boilerblade/src/usecase"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockAuditLogRepository is a mock implementation of AuditLogRepository for testing
+type mockAuditLogRepository struct {
+	logs      []*model.AuditLog
+	createErr error
+	filter    repository.AuditLogFilter // filter of the last Find
+	limit     int
+}
+
+func (m *mockAuditLogRepository) Create(log *model.AuditLog) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	log.ID = uint(len(m.logs) + 1)
+	log.CreatedAt = time.Now()
+	m.logs = append(m.logs, log)
+	return nil
+}
+
+func (m *mockAuditLogRepository) Find(filter repository.AuditLogFilter, limit, offset int) ([]model.AuditLog, error) {
+	m.filter, m.limit = filter, limit
+	logs := make([]model.AuditLog, 0, len(m.logs))
+	for i := len(m.logs) - 1; i >= 0; i-- {
+		logs = append(logs, *m.logs[i])
+	}
+	return logs, nil
+}
+
+func (m *mockAuditLogRepository) Count(filter repository.AuditLogFilter) (int64, error) {
+	return int64(len(m.logs)), nil
+}
+
+// changes decodes the changes of an audit log
+func changes(t *testing.T, log *model.AuditLog) map[string]event.FieldChange {
+	var list []event.FieldChange
+	if err := json.Unmarshal([]byte(log.Changes), &list); err != nil {
+		t.Fatalf("Invalid changes %q: %v", log.Changes, err)
+	}
+	byField := make(map[string]event.FieldChange, len(list))
+	for _, change := range list {
+		byField[change.Field] = change
+	}
+	return byField
+}
+
+func TestUserUsecase_AuditsMutations(t *testing.T) {
+	auditRepo := &mockAuditLogRepository{}
+	uc := usecase.NewUserUsecase(newMockUserRepository(), nil, nil, usecase.NewAuditor(auditRepo))
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{
+		ActorType: audit.ActorUser, ActorID: "42", RequestID: "req-1", Source: audit.SourceHTTP,
+	})
+	bound := uc.WithContext(ctx)
+
+	created, err := bound.CreateUser(&dto.CreateUserRequest{Name: "Jane", Email: "jane@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if _, err := bound.UpdateUser(created.ID, &dto.UpdateUserRequest{Email: "jane.doe@example.com", Password: "password456"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if err := bound.DeleteUser(created.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	if len(auditRepo.logs) != 3 {
+		t.Fatalf("Expected 3 audit logs, got %d", len(auditRepo.logs))
+	}
+	for i, action := range []string{event.ActionCreated, event.ActionUpdated, event.ActionDeleted} {
+		log := auditRepo.logs[i]
+		if log.Action != action || log.Entity != "user" || log.EntityID != created.ID {
+			t.Errorf("Log %d: expected %s of user %d, got %+v", i, action, created.ID, log)
+		}
+		if log.ActorType != audit.ActorUser || log.ActorID != "42" || log.RequestID != "req-1" || log.Source != audit.SourceHTTP {
+			t.Errorf("Log %d: expected the metadata of ctx, got %+v", i, log)
+		}
+		if strings.Contains(log.Changes, "$2") || strings.Contains(log.Changes, "password123") {
+			t.Errorf("Log %d: expected the password redacted, got %s", i, log.Changes)
+		}
+	}
+
+	if email := changes(t, auditRepo.logs[0])["email"]; email.Before != nil || email.After != "jane@example.com" {
+		t.Errorf("Expected the created email, got %+v", email)
+	}
+	updated := changes(t, auditRepo.logs[1])
+	if updated["email"].Before != "jane@example.com" || updated["email"].After != "jane.doe@example.com" {
+		t.Errorf("Expected the email change, got %+v", updated["email"])
+	}
+	if updated["password"].Before != "***" || updated["password"].After != "***" {
+		t.Errorf("Expected a redacted password change, got %+v", updated["password"])
+	}
+	if _, ok := updated["name"]; ok {
+		t.Error("Expected no change of the unchanged name")
+	}
+	if email := changes(t, auditRepo.logs[2])["email"]; email.Before != "jane.doe@example.com" || email.After != nil {
+		t.Errorf("Expected the deleted email, got %+v", email)
+	}
+
+	// The usecase itself is not bound to ctx
+	if _, err := uc.CreateUser(&dto.CreateUserRequest{Name: "John", Email: "john@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if log := auditRepo.logs[3]; log.ActorType != audit.ActorSystem || log.Source != audit.SourceSystem {
+		t.Errorf("Expected a system actor without metadata, got %+v", log)
+	}
+}
+
+func TestUserUsecase_AuditsBatchCreation(t *testing.T) {
+	auditRepo := &mockAuditLogRepository{}
+	uc := usecase.NewUserUsecase(newMockUserRepository(), nil, nil, usecase.NewAuditor(auditRepo))
+
+	_, errs := uc.CreateUsers([]*dto.CreateUserRequest{
+		{Name: "Jane", Email: "jane@example.com", Password: "password123"},
+		{Name: "Jane again", Email: "jane@example.com", Password: "password123"},
+	})
+	if errs[0] != nil || errs[1] == nil {
+		t.Fatalf("Expected the duplicate to fail, got %v", errs)
+	}
+	if len(auditRepo.logs) != 1 || auditRepo.logs[0].Action != event.ActionCreated {
+		t.Errorf("Expected only the created user audited, got %+v", auditRepo.logs)
+	}
+}
+
+func TestUserUsecase_AuditFailureDoesNotFailMutation(t *testing.T) {
+	auditRepo := &mockAuditLogRepository{createErr: errors.New("database down")}
+	uc := usecase.NewUserUsecase(newMockUserRepository(), nil, nil, usecase.NewAuditor(auditRepo))
+
+	if _, err := uc.CreateUser(&dto.CreateUserRequest{Name: "Jane", Email: "jane@example.com", Password: "password123"}); err != nil {
+		t.Errorf("Expected the creation to succeed, got %v", err)
+	}
+}
+
+func TestOIDCUsecase_AuditsProvisioning(t *testing.T) {
+	auditRepo := &mockAuditLogRepository{}
+	uc := usecase.NewOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()}, newMockUserRepository(), newMockExternalIdentityRepository(),
+		newMockRefreshTokenRepository(), nil, usecase.NewAuditor(auditRepo), usecase.AuthOptions{SigningKey: []byte(testSigningKey)})
+
+	if _, err := oidcCallback(t, uc); err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if len(auditRepo.logs) != 1 {
+		t.Fatalf("Expected the created user audited, got %d logs", len(auditRepo.logs))
+	}
+	log := auditRepo.logs[0]
+	if log.Action != event.ActionCreated || log.ActorType != audit.ActorSystem || log.ActorID != "https://idp.example.com" {
+		t.Errorf("Expected a creation by the provider, got %+v", log)
+	}
+}
+
+func TestAuditUsecase_GetAuditLogs(t *testing.T) {
+	auditRepo := &mockAuditLogRepository{}
+	auditRepo.Create(&model.AuditLog{ActorType: audit.ActorUser, ActorID: "42", Entity: "user", EntityID: 7, Action: event.ActionDeleted})
+	auditRepo.Create(&model.AuditLog{ActorType: audit.ActorUser, ActorID: "42", Entity: "user", EntityID: 7, Action: event.ActionUpdated,
+		Changes: `[{"field":"email","before":"a@example.com","after":"b@example.com"}]`})
+	uc := usecase.NewAuditUsecase(auditRepo)
+
+	resp, err := uc.GetAuditLogs(&dto.AuditLogQuery{Entity: "user", EntityID: 7, Since: "2024-01-01T00:00:00Z", Limit: 500})
+	if err != nil {
+		t.Fatalf("GetAuditLogs failed: %v", err)
+	}
+	if resp.Total != 2 || len(resp.AuditLogs) != 2 || resp.Limit != 100 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	if changes := resp.AuditLogs[0].Changes; len(changes) != 1 || changes[0].Field != "email" || changes[0].After != "b@example.com" {
+		t.Errorf("Expected the decoded changes, got %+v", changes)
+	}
+	if changes := resp.AuditLogs[1].Changes; changes == nil || len(changes) != 0 {
+		t.Errorf("Expected empty changes, got %+v", changes)
+	}
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if auditRepo.filter.Entity != "user" || auditRepo.filter.EntityID != 7 || !auditRepo.filter.Since.Equal(want) || !auditRepo.filter.Until.IsZero() {
+		t.Errorf("Unexpected filter: %+v", auditRepo.filter)
+	}
+	if auditRepo.limit != 100 {
+		t.Errorf("Expected the limit capped at 100, got %d", auditRepo.limit)
+	}
+}
@@ -0,0 +1,447 @@
+package usecase_test
+
+import (
+	"boilerblade/helper"
+	"boilerblade/src/dto"
+	"boilerblade/src/event"
+	"boilerblade/src/model"
+	"boilerblade/src/usecase"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const testSigningKey = "test-signing-key-at-least-32-chars"
+
+// mockRefreshTokenRepository is a mock implementation of RefreshTokenRepository for testing
+type mockRefreshTokenRepository struct {
+	tokens []*model.RefreshToken
+	nextID uint
+}
+
+func newMockRefreshTokenRepository() *mockRefreshTokenRepository {
+	return &mockRefreshTokenRepository{nextID: 1}
+}
+
+func (m *mockRefreshTokenRepository) Create(token *model.RefreshToken) error {
+	token.ID = m.nextID
+	token.CreatedAt = time.Now()
+	m.nextID++
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockRefreshTokenRepository) GetByHash(tokenHash string) (*model.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockRefreshTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+	for _, token := range m.tokens {
+		if token.ID == id && token.UsedAt == nil && token.RevokedAt == nil {
+			token.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRefreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshTokenRepository) revoked() int {
+	count := 0
+	for _, token := range m.tokens {
+		if token.RevokedAt != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// newAuthUsecase returns an auth usecase with one user, whose password is stored as storedPassword
+func newAuthUsecase(t *testing.T, storedPassword string) (usecase.AuthUsecase, *mockUserRepository, *mockRefreshTokenRepository) {
+	userRepo := newMockUserRepository()
+	tokenRepo := newMockRefreshTokenRepository()
+	if err := userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: storedPassword}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	uc := usecase.NewAuthUsecase(userRepo, tokenRepo, usecase.AuthOptions{
+		SigningKey:     []byte(testSigningKey),
+		AccessTokenTTL: time.Minute,
+	})
+	return uc, userRepo, tokenRepo
+}
+
+func hashTestPassword(t *testing.T, password string) string {
+	hash, err := helper.HashPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	return hash
+}
+
+func TestAuthUsecase_Login(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+
+	tokens, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if tokens.TokenType != "Bearer" || tokens.ExpiresIn != 60 || tokens.RefreshToken == "" {
+		t.Errorf("Unexpected token response: %+v", tokens)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSigningKey), nil
+	}); err != nil {
+		t.Fatalf("Access token does not verify: %v", err)
+	}
+	if claims["user_id"] != "1" || claims["sub"] != "1" || claims["email"] != "john@example.com" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+
+	if len(tokenRepo.tokens) != 1 || tokenRepo.tokens[0].TokenHash == tokens.RefreshToken {
+		t.Errorf("Expected one refresh token stored as a hash, got %+v", tokenRepo.tokens)
+	}
+}
+
+func TestAuthUsecase_Login_SetsKeyID(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey:   []byte("rotated-key"),
+		SigningKeyID: "v2",
+	})
+
+	tokens, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	token, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
+		return []byte("rotated-key"), nil
+	})
+	if err != nil {
+		t.Fatalf("Access token does not verify: %v", err)
+	}
+	if token.Header["kid"] != "v2" {
+		t.Errorf("Expected kid v2, got %v", token.Header["kid"])
+	}
+}
+
+func TestAuthUsecase_Login_SetsIssuerAndAudience(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey: []byte(testSigningKey),
+		Issuer:     "https://api.example.com",
+		Audience:   "boilerblade",
+	})
+
+	tokens, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokens.AccessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSigningKey), nil
+	}, jwt.WithIssuer("https://api.example.com"), jwt.WithAudience("boilerblade")); err != nil {
+		t.Errorf("Expected iss and aud claims, got %v (%v)", err, claims)
+	}
+}
+
+func TestAuthUsecase_Login_InvalidCredentials(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+
+	for _, req := range []dto.LoginRequest{
+		{Email: "john@example.com", Password: "wrong"},
+		{Email: "nobody@example.com", Password: "password123"},
+	} {
+		if _, err := uc.Login(&req); !errors.Is(err, usecase.ErrInvalidCredentials) {
+			t.Errorf("Login(%s) = %v, want ErrInvalidCredentials", req.Email, err)
+		}
+	}
+	if len(tokenRepo.tokens) != 0 {
+		t.Errorf("Expected no refresh token, got %d", len(tokenRepo.tokens))
+	}
+}
+
+func TestAuthUsecase_Login_RefusesPlaintextPassword(t *testing.T) {
+	uc, userRepo, _ := newAuthUsecase(t, "password123")
+
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"}); err == nil {
+		t.Fatal("Expected a plaintext row to be refused without AUTH_ALLOW_PLAINTEXT_PASSWORDS")
+	}
+	if stored := userRepo.users[0].Password; stored != "password123" {
+		t.Errorf("Expected the plaintext row to be left alone, got %q", stored)
+	}
+}
+
+func TestAuthUsecase_Login_HashesPlaintextPassword(t *testing.T) {
+	allowPlaintext := helper.DefaultPasswordHasher()
+	allowPlaintext.AllowPlaintext = true
+	helper.SetPasswordHasher(allowPlaintext)
+	t.Cleanup(func() { helper.SetPasswordHasher(helper.DefaultPasswordHasher()) })
+	uc, userRepo, _ := newAuthUsecase(t, "password123")
+
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Login with a plaintext row failed: %v", err)
+	}
+
+	stored := userRepo.users[0].Password
+	if !strings.HasPrefix(stored, "$argon2id$") {
+		t.Fatalf("Expected the password to be hashed on login, got %q", stored)
+	}
+	if ok, rehash := helper.VerifyPassword(stored, "password123"); !ok || rehash {
+		t.Errorf("VerifyPassword(rehashed) = %v, %v, want true, false", ok, rehash)
+	}
+}
+
+func TestAuthUsecase_Login_RehashesOutdatedParameters(t *testing.T) {
+	old := helper.DefaultPasswordHasher()
+	old.Algorithm = helper.PasswordBcrypt
+	old.BcryptCost = 4
+	stored, err := old.Hash("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	uc, userRepo, _ := newAuthUsecase(t, stored)
+
+	if _, err := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if !strings.HasPrefix(userRepo.users[0].Password, "$argon2id$") {
+		t.Errorf("Expected the bcrypt hash to be replaced by argon2id, got %q", userRepo.users[0].Password)
+	}
+}
+
+func TestAuthUsecase_Refresh_RotatesToken(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+	login, _ := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+
+	refreshed, err := uc.Refresh(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if refreshed.RefreshToken == login.RefreshToken || refreshed.AccessToken == "" {
+		t.Errorf("Expected a new token pair, got %+v", refreshed)
+	}
+	if len(tokenRepo.tokens) != 2 || tokenRepo.tokens[0].UsedAt == nil || tokenRepo.tokens[1].FamilyID != tokenRepo.tokens[0].FamilyID {
+		t.Errorf("Expected the old token used and the new one in the same family, got %+v", tokenRepo.tokens)
+	}
+
+	if _, err := uc.Refresh(refreshed.RefreshToken); err != nil {
+		t.Errorf("Refreshing the rotated token failed: %v", err)
+	}
+}
+
+func TestAuthUsecase_Refresh_ReuseRevokesFamily(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+	login, _ := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	refreshed, _ := uc.Refresh(login.RefreshToken)
+
+	if _, err := uc.Refresh(login.RefreshToken); !errors.Is(err, usecase.ErrRefreshTokenReused) {
+		t.Fatalf("Reusing a rotated token = %v, want ErrRefreshTokenReused", err)
+	}
+	if tokenRepo.revoked() != 2 {
+		t.Errorf("Expected the whole family revoked, got %d of %d", tokenRepo.revoked(), len(tokenRepo.tokens))
+	}
+	if _, err := uc.Refresh(refreshed.RefreshToken); !errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		t.Errorf("Refreshing after reuse = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestAuthUsecase_Refresh_InvalidToken(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+
+	if _, err := uc.Refresh("unknown"); !errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh(unknown) = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	login, _ := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	tokenRepo.tokens[0].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := uc.Refresh(login.RefreshToken); !errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh(expired) = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestAuthUsecase_Logout(t *testing.T) {
+	uc, _, tokenRepo := newAuthUsecase(t, hashTestPassword(t, "password123"))
+	login, _ := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+
+	if err := uc.Logout(login.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if tokenRepo.revoked() != 1 {
+		t.Errorf("Expected the refresh token revoked")
+	}
+	if _, err := uc.Refresh(login.RefreshToken); !errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after logout = %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := uc.Logout("unknown"); err != nil {
+		t.Errorf("Logout(unknown) = %v, want nil", err)
+	}
+}
+
+func TestUserUsecase_CreateUser_HashesPassword(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
+
+	if _, err := uc.CreateUser(&dto.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	stored := mockRepo.users[0].Password
+	if !helper.IsPasswordHash(stored) {
+		t.Fatalf("Expected a hashed password, got %q", stored)
+	}
+	if ok, _ := helper.VerifyPassword(stored, "password123"); !ok {
+		t.Errorf("Stored hash does not verify")
+	}
+}
+
+// mockTokenRevoker is a mock implementation of TokenRevoker for testing
+type mockTokenRevoker struct {
+	tokens map[string]time.Time
+	users  map[string]time.Time
+	err    error
+}
+
+func newMockTokenRevoker() *mockTokenRevoker {
+	return &mockTokenRevoker{tokens: map[string]time.Time{}, users: map[string]time.Time{}}
+}
+
+func (m *mockTokenRevoker) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.tokens[jti] = expiresAt
+	return nil
+}
+
+func (m *mockTokenRevoker) RevokeUserTokens(ctx context.Context, userID string, before time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.users[userID] = before
+	return nil
+}
+
+func (m *mockTokenRevoker) UserTokensRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	return m.users[userID], m.err
+}
+
+func TestAuthUsecase_RevokeUserTokens_RefusesRefresh(t *testing.T) {
+	userRepo := newMockUserRepository()
+	userRepo.Create(&model.User{Name: "John Doe", Email: "john@example.com", Password: hashTestPassword(t, "password123")})
+	revoker := newMockTokenRevoker()
+	uc := usecase.NewAuthUsecase(userRepo, newMockRefreshTokenRepository(), usecase.AuthOptions{
+		SigningKey: []byte(testSigningKey),
+		Revoker:    revoker,
+	})
+	login, _ := uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+
+	if err := uc.RevokeUserTokens(1); err != nil {
+		t.Fatalf("RevokeUserTokens failed: %v", err)
+	}
+	if _, ok := revoker.users["1"]; !ok {
+		t.Errorf("Expected a watermark for user 1, got %v", revoker.users)
+	}
+	if _, err := uc.Refresh(login.RefreshToken); !errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after revocation = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	login, _ = uc.Login(&dto.LoginRequest{Email: "john@example.com", Password: "password123"})
+	if _, err := uc.Refresh(login.RefreshToken); err != nil {
+		t.Errorf("Refresh of a new login failed: %v", err)
+	}
+}
+
+func TestAuthUsecase_RevokeAccessToken(t *testing.T) {
+	revoker := newMockTokenRevoker()
+	uc := usecase.NewAuthUsecase(newMockUserRepository(), newMockRefreshTokenRepository(), usecase.AuthOptions{Revoker: revoker})
+	expiresAt := time.Now().Add(time.Minute)
+
+	if err := uc.RevokeAccessToken("token-1", expiresAt); err != nil {
+		t.Fatalf("RevokeAccessToken failed: %v", err)
+	}
+	if !revoker.tokens["token-1"].Equal(expiresAt) {
+		t.Errorf("Expected token-1 revoked until %v, got %v", expiresAt, revoker.tokens)
+	}
+}
+
+func TestAuthUsecase_Revoke_Unavailable(t *testing.T) {
+	uc, _, _ := newAuthUsecase(t, hashTestPassword(t, "password123"))
+
+	if err := uc.RevokeAccessToken("token-1", time.Now().Add(time.Minute)); !errors.Is(err, usecase.ErrRevocationUnavailable) {
+		t.Errorf("RevokeAccessToken = %v, want ErrRevocationUnavailable", err)
+	}
+	if err := uc.RevokeUserTokens(1); !errors.Is(err, usecase.ErrRevocationUnavailable) {
+		t.Errorf("RevokeUserTokens = %v, want ErrRevocationUnavailable", err)
+	}
+}
+
+func TestUserUsecase_RevokesTokens(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	revoker := newMockTokenRevoker()
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), revoker, nil)
+	uc.CreateUser(&dto.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Password: "password123"})
+	uc.CreateUser(&dto.CreateUserRequest{Name: "Jane Doe", Email: "jane@example.com", Password: "password123"})
+
+	if _, err := uc.UpdateUser(1, &dto.UpdateUserRequest{Name: "John"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if len(revoker.users) != 0 {
+		t.Errorf("Expected no revocation without a password change, got %v", revoker.users)
+	}
+	if _, err := uc.UpdateUser(1, &dto.UpdateUserRequest{Password: "new-password123"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if err := uc.DeleteUser(2); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, ok := revoker.users["1"]; !ok {
+		t.Errorf("Expected the password change to revoke the tokens of user 1")
+	}
+	if _, ok := revoker.users["2"]; !ok {
+		t.Errorf("Expected the deletion to revoke the tokens of user 2")
+	}
+}
+
+func TestUserUsecase_RevocationFailureFailsMutation(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	revoker := newMockTokenRevoker()
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), revoker, nil)
+	uc.CreateUser(&dto.CreateUserRequest{Name: "John Doe", Email: "john@example.com", Password: "password123"})
+	updatedAt := mockRepo.users[0].UpdatedAt
+	revoker.err = errors.New("redis down")
+
+	if _, err := uc.UpdateUser(1, &dto.UpdateUserRequest{Password: "new-password123"}); err == nil {
+		t.Error("Expected UpdateUser to fail when tokens cannot be revoked")
+	}
+	if !mockRepo.users[0].UpdatedAt.Equal(updatedAt) {
+		t.Error("Expected the user not saved")
+	}
+	if err := uc.DeleteUser(1); err == nil {
+		t.Error("Expected DeleteUser to fail when tokens cannot be revoked")
+	}
+	if !mockRepo.users[0].DeletedAt.Time.IsZero() {
+		t.Error("Expected the user kept")
+	}
+}
@@ -0,0 +1,208 @@
+package usecase_test
+
+import (
+	"boilerblade/config/auth"
+	"boilerblade/src/dto"
+	"boilerblade/src/model"
+	"boilerblade/src/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// mockExternalIdentityRepository is a mock implementation of ExternalIdentityRepository for testing
+type mockExternalIdentityRepository struct {
+	identities []*model.ExternalIdentity
+	nextID     uint
+}
+
+func newMockExternalIdentityRepository() *mockExternalIdentityRepository {
+	return &mockExternalIdentityRepository{nextID: 1}
+}
+
+func (m *mockExternalIdentityRepository) Create(identity *model.ExternalIdentity) error {
+	identity.ID = m.nextID
+	m.nextID++
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+func (m *mockExternalIdentityRepository) GetByProviderSubject(provider, subject string) (*model.ExternalIdentity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *mockExternalIdentityRepository) Update(identity *model.ExternalIdentity) error {
+	return nil
+}
+
+// stubOIDCProvider issues codes for identity; Exchange checks the code
+// verifier against the challenge of AuthCodeURL, like a provider does
+type stubOIDCProvider struct {
+	identity  auth.OIDCIdentity
+	challenge string
+	nonce     string
+	err       error
+}
+
+func (p *stubOIDCProvider) Issuer() string {
+	return "https://idp.example.com"
+}
+
+func (p *stubOIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.challenge, p.nonce = codeChallenge, nonce
+	return "https://idp.example.com/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (p *stubOIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*auth.OIDCIdentity, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if code != "code-1" || auth.PKCEChallenge(codeVerifier) != p.challenge || nonce != p.nonce {
+		return nil, fmt.Errorf("%w: invalid_grant", auth.ErrOIDCExchange)
+	}
+	identity := p.identity
+	return &identity, nil
+}
+
+func newOIDCUsecase(provider *stubOIDCProvider) (usecase.OIDCUsecase, *mockUserRepository, *mockExternalIdentityRepository) {
+	userRepo := newMockUserRepository()
+	identityRepo := newMockExternalIdentityRepository()
+	uc := usecase.NewOIDCUsecase(provider, userRepo, identityRepo, newMockRefreshTokenRepository(), nil, nil, usecase.AuthOptions{
+		SigningKey: []byte(testSigningKey),
+	})
+	return uc, userRepo, identityRepo
+}
+
+func janeIdentity() auth.OIDCIdentity {
+	return auth.OIDCIdentity{Issuer: "https://idp.example.com", Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+}
+
+// oidcCallback begins a login and calls back with its state and code-1
+func oidcCallback(t *testing.T, uc usecase.OIDCUsecase) (*dto.TokenResponse, error) {
+	authURL, loginState, err := uc.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	return uc.Callback(loginState, parsed.Query().Get("state"), "code-1")
+}
+
+func TestOIDCUsecase_CreatesUserOnFirstLogin(t *testing.T) {
+	uc, userRepo, identityRepo := newOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()})
+
+	tokens, err := oidcCallback(t, uc)
+	if err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("Expected our own tokens, got %+v", tokens)
+	}
+	if len(userRepo.users) != 1 || userRepo.users[0].Email != "jane@example.com" || userRepo.users[0].Name != "Jane Doe" {
+		t.Fatalf("Expected Jane to be created, got %+v", userRepo.users)
+	}
+	if len(identityRepo.identities) != 1 || identityRepo.identities[0].UserID != userRepo.users[0].ID || identityRepo.identities[0].Subject != "user-1" {
+		t.Errorf("Expected the identity linked to Jane, got %+v", identityRepo.identities)
+	}
+
+	// The next login finds the user by its identity
+	if _, err := oidcCallback(t, uc); err != nil {
+		t.Fatalf("Second login failed: %v", err)
+	}
+	if len(userRepo.users) != 1 || len(identityRepo.identities) != 1 {
+		t.Errorf("Expected no new user or identity, got %d users and %d identities", len(userRepo.users), len(identityRepo.identities))
+	}
+}
+
+func TestOIDCUsecase_LinksExistingUserByEmail(t *testing.T) {
+	uc, userRepo, identityRepo := newOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()})
+	userRepo.Create(&model.User{Name: "Jane", Email: "jane@example.com", Password: "hash"})
+
+	if _, err := oidcCallback(t, uc); err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	if len(userRepo.users) != 1 || len(identityRepo.identities) != 1 || identityRepo.identities[0].UserID != userRepo.users[0].ID {
+		t.Errorf("Expected the identity linked to the existing user, got %+v", identityRepo.identities)
+	}
+}
+
+func TestOIDCUsecase_RequiresVerifiedEmail(t *testing.T) {
+	identity := janeIdentity()
+	identity.EmailVerified = false
+	uc, userRepo, identityRepo := newOIDCUsecase(&stubOIDCProvider{identity: identity})
+	userRepo.Create(&model.User{Name: "Jane", Email: "jane@example.com", Password: "hash"})
+
+	if _, err := oidcCallback(t, uc); !errors.Is(err, usecase.ErrOIDCEmailNotVerified) {
+		t.Errorf("Callback = %v, want ErrOIDCEmailNotVerified", err)
+	}
+	if len(identityRepo.identities) != 0 {
+		t.Error("Expected no identity linked")
+	}
+}
+
+func TestOIDCUsecase_DeletedUser(t *testing.T) {
+	uc, userRepo, _ := newOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()})
+	if _, err := oidcCallback(t, uc); err != nil {
+		t.Fatalf("Callback failed: %v", err)
+	}
+	userRepo.Delete(userRepo.users[0].ID)
+
+	if _, err := oidcCallback(t, uc); !errors.Is(err, usecase.ErrOIDCUserNotFound) {
+		t.Errorf("Callback = %v, want ErrOIDCUserNotFound", err)
+	}
+}
+
+func TestOIDCUsecase_InvalidState(t *testing.T) {
+	uc, _, _ := newOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()})
+	authURL, loginState, err := uc.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	state := parsed.Query().Get("state")
+
+	encoded, signature, _ := strings.Cut(loginState, ".")
+	tests := []struct {
+		name       string
+		loginState string
+		state      string
+	}{
+		{"no login state", "", state},
+		{"another state", loginState, "forged"},
+		{"no state", loginState, ""},
+		{"tampered login state", encoded + "x." + signature, state},
+	}
+	for _, tt := range tests {
+		if _, err := uc.Callback(tt.loginState, tt.state, "code-1"); !errors.Is(err, usecase.ErrOIDCInvalidState) {
+			t.Errorf("%s: Callback = %v, want ErrOIDCInvalidState", tt.name, err)
+		}
+	}
+
+	// A login state is bound to the signing key
+	other := usecase.NewOIDCUsecase(&stubOIDCProvider{identity: janeIdentity()}, newMockUserRepository(), newMockExternalIdentityRepository(),
+		newMockRefreshTokenRepository(), nil, nil, usecase.AuthOptions{SigningKey: []byte("another-signing-key")})
+	if _, err := other.Callback(loginState, state, "code-1"); !errors.Is(err, usecase.ErrOIDCInvalidState) {
+		t.Errorf("Callback with another key = %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCUsecase_LoginFailed(t *testing.T) {
+	provider := &stubOIDCProvider{err: fmt.Errorf("%w: nonce mismatch", auth.ErrOIDCInvalidIDToken)}
+	uc, userRepo, _ := newOIDCUsecase(provider)
+
+	if _, err := oidcCallback(t, uc); !errors.Is(err, usecase.ErrOIDCLoginFailed) {
+		t.Errorf("Callback = %v, want ErrOIDCLoginFailed", err)
+	}
+	if len(userRepo.users) != 0 {
+		t.Error("Expected no user created")
+	}
+}
@@ -2,8 +2,11 @@ package usecase_test
 
 import (
 	"boilerblade/src/dto"
+	"boilerblade/src/event"
 	"boilerblade/src/model"
 	"boilerblade/src/usecase"
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -14,6 +17,11 @@ import (
 type mockUserRepository struct {
 	users  []*model.User
 	nextID uint
+
+	batchErr   error  // CreateBatch fails with batchErr when set
+	failEmail  string // Create fails for this email
+	batchCalls int
+	onBatch    func() // called by CreateBatch before it inserts
 }
 
 func newMockUserRepository() *mockUserRepository {
@@ -24,6 +32,9 @@ func newMockUserRepository() *mockUserRepository {
 }
 
 func (m *mockUserRepository) Create(user *model.User) error {
+	if m.failEmail != "" && user.Email == m.failEmail {
+		return errors.New("value too long for column email")
+	}
 	user.ID = m.nextID
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
@@ -32,6 +43,23 @@ func (m *mockUserRepository) Create(user *model.User) error {
 	return nil
 }
 
+func (m *mockUserRepository) CreateBatch(ctx context.Context, users []*model.User, batchSize int) error {
+	m.batchCalls++
+	if m.onBatch != nil {
+		m.onBatch()
+	}
+	if m.batchErr != nil {
+		return m.batchErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, user := range users {
+		m.Create(user)
+	}
+	return nil
+}
+
 func (m *mockUserRepository) GetByID(id uint) (*model.User, error) {
 	for _, user := range m.users {
 		if user.ID == id && user.DeletedAt.Time.IsZero() {
@@ -50,6 +78,16 @@ func (m *mockUserRepository) GetByEmail(email string) (*model.User, error) {
 	return nil, gorm.ErrRecordNotFound
 }
 
+func (m *mockUserRepository) GetByEmails(emails []string) ([]model.User, error) {
+	users := make([]model.User, 0)
+	for _, email := range emails {
+		if user, err := m.GetByEmail(email); err == nil {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
 func (m *mockUserRepository) GetAll(limit, offset int) ([]model.User, error) {
 	activeUsers := make([]model.User, 0)
 	for _, user := range m.users {
@@ -107,7 +145,7 @@ func (m *mockUserRepository) Count() (int64, error) {
 
 func TestNewUserUsecase(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	if uc == nil {
 		t.Error("NewUserUsecase returned nil")
@@ -116,7 +154,7 @@ func TestNewUserUsecase(t *testing.T) {
 
 func TestUserUsecase_CreateUser(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	req := &dto.CreateUserRequest{
 		Name:     "Test User",
@@ -148,7 +186,7 @@ func TestUserUsecase_CreateUser(t *testing.T) {
 
 func TestUserUsecase_CreateUser_DuplicateEmail(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create first user
 	req1 := &dto.CreateUserRequest{
@@ -175,9 +213,91 @@ func TestUserUsecase_CreateUser_DuplicateEmail(t *testing.T) {
 	}
 }
 
+func TestUserUsecase_CreateUsers(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
+	uc.CreateUser(&dto.CreateUserRequest{Name: "Existing", Email: "existing@example.com"})
+
+	reqs := []*dto.CreateUserRequest{
+		{Name: "A", Email: "a@example.com"},
+		{Name: "Existing", Email: "existing@example.com"},
+		{Name: "B", Email: "b@example.com"},
+		{Name: "A again", Email: "a@example.com"},
+	}
+	responses, errs := uc.CreateUsers(reqs)
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("Expected new users to be created, got %v", errs)
+	}
+	if errs[1] == nil || errs[1].Error() != "email already exists" {
+		t.Errorf("Expected 'email already exists' for a stored email, got %v", errs[1])
+	}
+	if errs[3] == nil || errs[3].Error() != "email already exists" {
+		t.Errorf("Expected 'email already exists' for an email repeated in the batch, got %v", errs[3])
+	}
+	if responses[0] == nil || responses[0].ID == 0 || responses[2].Email != "b@example.com" {
+		t.Errorf("Expected responses for the created users, got %+v", responses)
+	}
+	if mockRepo.batchCalls != 1 {
+		t.Errorf("Expected one batch insert, got %d", mockRepo.batchCalls)
+	}
+}
+
+func TestUserUsecase_CreateUsers_BatchFailureFallsBackToRows(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	mockRepo.batchErr = errors.New("value too long for column email")
+	mockRepo.failEmail = "bad@example.com"
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
+
+	_, errs := uc.CreateUsers([]*dto.CreateUserRequest{
+		{Name: "A", Email: "a@example.com"},
+		{Name: "Bad", Email: "bad@example.com"},
+		{Name: "B", Email: "b@example.com"},
+	})
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("Expected the valid rows to be inserted one by one, got %v", errs)
+	}
+	if errs[1] == nil {
+		t.Error("Expected the failing row to report its error")
+	}
+	if count, _ := mockRepo.Count(); count != 2 {
+		t.Errorf("Expected 2 users, got %d", count)
+	}
+}
+
+func TestUserUsecase_CreateUsers_StopsWhenContextDone(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The message timeout expires during the insert
+	mockRepo.onBatch = cancel
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil).WithContext(ctx)
+
+	reqs := []*dto.CreateUserRequest{
+		{Name: "A", Email: "a@example.com"},
+		{Name: "B", Email: "b@example.com"},
+	}
+	_, errs := uc.CreateUsers(reqs)
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected user %d to fail with the context error, got %v", i, err)
+		}
+	}
+	if count, _ := mockRepo.Count(); count != 0 {
+		t.Errorf("Expected no row inserted one by one after the context is done, got %d", count)
+	}
+
+	// Already done: nothing is hashed or inserted
+	_, errs = uc.CreateUsers(reqs)
+	if !errors.Is(errs[0], context.Canceled) || mockRepo.batchCalls != 1 {
+		t.Errorf("Expected no insert once the context is done, got %v after %d batches", errs, mockRepo.batchCalls)
+	}
+}
+
 func TestUserUsecase_GetUserByID(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create a user first
 	req := &dto.CreateUserRequest{
@@ -204,7 +324,7 @@ func TestUserUsecase_GetUserByID(t *testing.T) {
 
 func TestUserUsecase_GetUserByID_NotFound(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	_, err := uc.GetUserByID(999)
 	if err == nil {
@@ -218,7 +338,7 @@ func TestUserUsecase_GetUserByID_NotFound(t *testing.T) {
 
 func TestUserUsecase_GetAllUsers(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create multiple users with unique emails
 	for i := 0; i < 5; i++ {
@@ -256,7 +376,7 @@ func TestUserUsecase_GetAllUsers(t *testing.T) {
 
 func TestUserUsecase_GetAllUsers_WithPagination(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create 10 users with unique emails by modifying email
 	for i := 0; i < 10; i++ {
@@ -291,7 +411,7 @@ func TestUserUsecase_GetAllUsers_WithPagination(t *testing.T) {
 
 func TestUserUsecase_GetAllUsers_InvalidLimit(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Test with invalid limit (should default to 10)
 	resp, err := uc.GetAllUsers(-1, 0)
@@ -316,7 +436,7 @@ func TestUserUsecase_GetAllUsers_InvalidLimit(t *testing.T) {
 
 func TestUserUsecase_UpdateUser(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create a user first
 	req := &dto.CreateUserRequest{
@@ -348,7 +468,7 @@ func TestUserUsecase_UpdateUser(t *testing.T) {
 
 func TestUserUsecase_UpdateUser_NotFound(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	updateReq := &dto.UpdateUserRequest{
 		Name: "Updated User",
@@ -366,7 +486,7 @@ func TestUserUsecase_UpdateUser_NotFound(t *testing.T) {
 
 func TestUserUsecase_UpdateUser_DuplicateEmail(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create two users
 	req1 := &dto.CreateUserRequest{
@@ -399,7 +519,7 @@ func TestUserUsecase_UpdateUser_DuplicateEmail(t *testing.T) {
 
 func TestUserUsecase_DeleteUser(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	// Create a user
 	req := &dto.CreateUserRequest{
@@ -424,7 +544,7 @@ func TestUserUsecase_DeleteUser(t *testing.T) {
 
 func TestUserUsecase_DeleteUser_NotFound(t *testing.T) {
 	mockRepo := newMockUserRepository()
-	uc := usecase.NewUserUsecase(mockRepo)
+	uc := usecase.NewUserUsecase(mockRepo, event.NewNoopPublisher(), nil, nil)
 
 	err := uc.DeleteUser(999)
 	if err == nil {
@@ -435,3 +555,77 @@ func TestUserUsecase_DeleteUser_NotFound(t *testing.T) {
 		t.Errorf("Expected 'user not found' error, got '%s'", err.Error())
 	}
 }
+
+func TestUserUsecase_EmitsDomainEvents(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	publisher := event.NewRecordingPublisher()
+	uc := usecase.NewUserUsecase(mockRepo, publisher, nil, nil)
+
+	created, err := uc.CreateUser(&dto.CreateUserRequest{
+		Name:     "Test User",
+		Email:    "test@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	_, err = uc.UpdateUser(created.ID, &dto.UpdateUserRequest{
+		Name:     "Updated User",
+		Password: "newpassword123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+
+	if err := uc.DeleteUser(created.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	events := publisher.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+
+	createdEvt, ok := events[0].(*event.UserCreated)
+	if !ok {
+		t.Fatalf("Expected UserCreated, got %T", events[0])
+	}
+	if createdEvt.UserID != created.ID || createdEvt.Email != "test@example.com" {
+		t.Errorf("Unexpected UserCreated payload: %+v", createdEvt)
+	}
+
+	updatedEvt, ok := events[1].(*event.UserUpdated)
+	if !ok {
+		t.Fatalf("Expected UserUpdated, got %T", events[1])
+	}
+	if len(updatedEvt.Changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d: %+v", len(updatedEvt.Changes), updatedEvt.Changes)
+	}
+	if updatedEvt.Changes[0].Field != "name" || updatedEvt.Changes[0].Before != "Test User" || updatedEvt.Changes[0].After != "Updated User" {
+		t.Errorf("Unexpected name change: %+v", updatedEvt.Changes[0])
+	}
+	if updatedEvt.Changes[1].Field != "password" || updatedEvt.Changes[1].After == "newpassword123" {
+		t.Errorf("Password change should be redacted: %+v", updatedEvt.Changes[1])
+	}
+
+	if _, ok := events[2].(*event.UserDeleted); !ok {
+		t.Fatalf("Expected UserDeleted, got %T", events[2])
+	}
+}
+
+func TestUserUsecase_PublishFailureDoesNotFailMutation(t *testing.T) {
+	mockRepo := newMockUserRepository()
+	publisher := event.NewRecordingPublisher()
+	publisher.Err = errors.New("broker down")
+	uc := usecase.NewUserUsecase(mockRepo, publisher, nil, nil)
+
+	_, err := uc.CreateUser(&dto.CreateUserRequest{
+		Name:     "Test User",
+		Email:    "test@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser should succeed when publishing fails: %v", err)
+	}
+}